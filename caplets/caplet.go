@@ -3,7 +3,6 @@ package caplets
 import (
 	"fmt"
 	"path/filepath"
-	"strings"
 
 	"github.com/evilsocket/islazy/fs"
 )
@@ -36,28 +35,35 @@ func NewCaplet(name string, path string, size int64) Caplet {
 	}
 }
 
-func (cap *Caplet) Eval(argv []string, lineCb func(line string) error) error {
+// Eval parses and runs the caplet, lineCb is called for every command
+// while errCb, if not nil, receives the errors that have been ignored
+// because of an 'on error continue' statement.
+func (cap *Caplet) Eval(argv []string, env Env, lineCb func(line string) error, errCb func(line string, err error)) error {
 	if argv == nil {
 		argv = []string{}
 	}
+
+	prog, err := Parse(cap.Path, cap.Code)
+	if err != nil {
+		return err
+	}
+
+	vars := make(map[string]string)
+	for i, arg := range argv {
+		vars[fmt.Sprintf("%d", i)] = arg
+	}
+
+	it := &interpreter{
+		prog:  prog,
+		env:   env,
+		exec:  lineCb,
+		onErr: errCb,
+		mode:  ErrorAbort,
+	}
+
 	// the caplet might include other files (include directive, proxy modules, etc),
 	// temporarily change the working directory
 	return fs.Chdir(filepath.Dir(cap.Path), func() error {
-		for _, line := range cap.Code {
-			// skip empty lines and comments
-			if line == "" || line[0] == '#' {
-				continue
-			}
-			// replace $0 with argv[0], $1 with argv[1] and so on
-			for i, arg := range argv {
-				what := fmt.Sprintf("$%d", i)
-				line = strings.Replace(line, what, arg, -1)
-			}
-
-			if err := lineCb(line); err != nil {
-				return err
-			}
-		}
-		return nil
+		return it.run(prog.Body, vars)
 	})
 }
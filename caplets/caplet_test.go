@@ -0,0 +1,173 @@
+package caplets
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type mapEnv map[string]string
+
+func (e mapEnv) Get(name string) (bool, string) {
+	v, found := e[name]
+	return found, v
+}
+
+func evalCode(code string, argv []string, env Env, fail map[string]bool) (executed []string, ignored []string, err error) {
+	cap := NewCaplet("test", "test.cap", 0)
+	cap.Code = strings.Split(code, "\n")
+
+	executed = make([]string, 0)
+	ignored = make([]string, 0)
+	err = cap.Eval(argv, env, func(line string) error {
+		executed = append(executed, line)
+		if fail[line] {
+			return fmt.Errorf("%s failed", line)
+		}
+		return nil
+	}, func(line string, err error) {
+		ignored = append(ignored, err.Error())
+	})
+	return
+}
+
+func TestCapletEvalArguments(t *testing.T) {
+	executed, _, err := evalCode("set a $0\nset b $1\nset c $2", []string{"foo", "bar"}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"set a foo", "set b bar", "set c $2"}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("expected %v, got %v", expected, executed)
+	}
+}
+
+func TestCapletEvalIf(t *testing.T) {
+	code := `
+if {env.wifi.handshakes} > 0
+  yes
+else if {env.wifi.aps} > 0
+  maybe
+else
+  no
+end`
+
+	var units = []struct {
+		env      mapEnv
+		expected []string
+	}{
+		{mapEnv{"wifi.handshakes": "2"}, []string{"yes"}},
+		{mapEnv{"wifi.handshakes": "0", "wifi.aps": "3"}, []string{"maybe"}},
+		{mapEnv{}, []string{"no"}},
+	}
+
+	for _, u := range units {
+		executed, _, err := evalCode(code, nil, u.env, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !reflect.DeepEqual(executed, u.expected) {
+			t.Fatalf("expected %v, got %v", u.expected, executed)
+		}
+	}
+}
+
+func TestCapletEvalFor(t *testing.T) {
+	code := `
+for target in {env.targets}
+  for port in $0
+    syn.scan $target $port
+  end
+end`
+
+	executed, _, err := evalCode(code, []string{"22,80"}, mapEnv{"targets": "10.0.0.1, 10.0.0.2"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"syn.scan 10.0.0.1 22",
+		"syn.scan 10.0.0.1 80",
+		"syn.scan 10.0.0.2 22",
+		"syn.scan 10.0.0.2 80",
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("expected %v, got %v", expected, executed)
+	}
+}
+
+func TestCapletEvalDefCall(t *testing.T) {
+	code := `
+def spoof
+  set arp.spoof.targets $0
+  arp.spoof on
+end
+
+for t in a b
+  call spoof $t
+end`
+
+	executed, _, err := evalCode(code, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"set arp.spoof.targets a",
+		"arp.spoof on",
+		"set arp.spoof.targets b",
+		"arp.spoof on",
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("expected %v, got %v", expected, executed)
+	}
+}
+
+func TestCapletEvalRecursionLimit(t *testing.T) {
+	_, _, err := evalCode("def f\ncall f\nend\ncall f", nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "maximum call depth") {
+		t.Fatalf("expected call depth error, got %v", err)
+	}
+}
+
+func TestCapletEvalErrorAbort(t *testing.T) {
+	executed, _, err := evalCode("a\nb\nc", nil, nil, map[string]bool{"b": true})
+	if err == nil {
+		t.Fatal("expected error")
+	} else if err.Error() != "test.cap:2: b failed" {
+		t.Fatalf("unexpected error '%s'", err)
+	} else if !reflect.DeepEqual(executed, []string{"a", "b"}) {
+		t.Fatalf("unexpected executed lines %v", executed)
+	}
+}
+
+func TestCapletEvalErrorContinue(t *testing.T) {
+	code := `
+on error continue
+a
+b
+def f
+  on error abort
+end
+call f
+c
+on error abort
+b
+d`
+
+	executed, ignored, err := evalCode(code, nil, nil, map[string]bool{"a": true, "b": true})
+	if err == nil || err.Error() != "test.cap:11: b failed" {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	expected := []string{"a", "b", "c", "b"}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("expected %v, got %v", expected, executed)
+	}
+
+	expectedIgnored := []string{"test.cap:3: a failed", "test.cap:4: b failed"}
+	if !reflect.DeepEqual(ignored, expectedIgnored) {
+		t.Fatalf("expected %v, got %v", expectedIgnored, ignored)
+	}
+}
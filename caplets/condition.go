@@ -0,0 +1,308 @@
+package caplets
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Env is the subset of the session environment needed to evaluate
+// conditions and loop lists.
+type Env interface {
+	Get(name string) (bool, string)
+}
+
+var (
+	reEnvToken  = regexp.MustCompile(`{env\.([^}]+)}`)
+	reVarToken  = regexp.MustCompile(`\$([0-9]+|[A-Za-z_][A-Za-z0-9_]*)`)
+	operators   = []string{"&&", "||", "==", "!=", ">=", "<=", "=~", ">", "<", "!", "(", ")"}
+	comparisons = map[string]bool{"==": true, "!=": true, ">=": true, "<=": true, "=~": true, ">": true, "<": true}
+)
+
+// Condition is the compiled expression of an if statement.
+//
+//	COND  := AND ( '||' AND )*
+//	AND   := UNARY ( '&&' UNARY )*
+//	UNARY := '!' UNARY | '(' COND ')' | VALUE [ OP VALUE ]
+//	OP    := '==' | '!=' | '>' | '<' | '>=' | '<=' | '=~'
+//
+// A VALUE can be a literal, a quoted string, a $variable or an {env.NAME}
+// token. A VALUE alone is true if not empty, "false" or "0".
+type Condition struct {
+	Op    string
+	Value string
+	Left  *Condition
+	Right *Condition
+}
+
+type condToken struct {
+	op    bool
+	value string
+}
+
+func tokenizeCondition(expr string) ([]condToken, error) {
+	tokens := make([]condToken, 0)
+	buf := ""
+	flush := func() {
+		if buf != "" {
+			tokens = append(tokens, condToken{value: buf})
+			buf = ""
+		}
+	}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		if c == ' ' || c == '\t' {
+			flush()
+			i++
+			continue
+		} else if c == '"' || c == '\'' {
+			end := strings.IndexByte(expr[i+1:], c)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated quoted string in '%s'", expr)
+			}
+			flush()
+			// quoted strings are always values, even if empty
+			tokens = append(tokens, condToken{value: expr[i+1 : i+1+end]})
+			i += end + 2
+			continue
+		}
+
+		matched := false
+		for _, op := range operators {
+			if strings.HasPrefix(expr[i:], op) {
+				flush()
+				tokens = append(tokens, condToken{op: true, value: op})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			buf += string(c)
+			i++
+		}
+	}
+	flush()
+
+	return tokens, nil
+}
+
+type condParser struct {
+	tokens []condToken
+	pos    int
+}
+
+func (p *condParser) peek() (condToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return condToken{}, false
+}
+
+func (p *condParser) isOp(op string) bool {
+	t, ok := p.peek()
+	return ok && t.op && t.value == op
+}
+
+func (p *condParser) or() (*Condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Condition{Op: "||", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) and() (*Condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Condition{Op: "&&", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) unary() (*Condition, error) {
+	if p.isOp("!") {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Condition{Op: "!", Left: operand}, nil
+	} else if p.isOp("(") {
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		} else if !p.isOp(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	left, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := p.peek(); ok && t.op && comparisons[t.value] {
+		p.pos++
+		right, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if t.value == "=~" && !reVarToken.MatchString(right.Value) && !reEnvToken.MatchString(right.Value) {
+			if _, err := regexp.Compile(right.Value); err != nil {
+				return nil, fmt.Errorf("invalid regular expression '%s': %v", right.Value, err)
+			}
+		}
+		return &Condition{Op: t.value, Left: left, Right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *condParser) value() (*Condition, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of condition")
+	} else if t.op {
+		return nil, fmt.Errorf("unexpected '%s' in condition", t.value)
+	}
+	p.pos++
+	return &Condition{Value: t.value}, nil
+}
+
+// ParseCondition compiles the expression of an if statement.
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	} else if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	p := &condParser{tokens: tokens}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	} else if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in condition", p.tokens[p.pos].value)
+	}
+	return cond, nil
+}
+
+// expandVars replaces $N and $name tokens with their values, leaving
+// unknown ones untouched.
+func expandVars(s string, vars map[string]string) string {
+	return reVarToken.ReplaceAllStringFunc(s, func(m string) string {
+		if v, found := vars[m[1:]]; found {
+			return v
+		}
+		return m
+	})
+}
+
+// expandEnv replaces {env.NAME} tokens with their values, undefined
+// variables are replaced with an empty string.
+func expandEnv(s string, env Env) string {
+	return reEnvToken.ReplaceAllStringFunc(s, func(m string) string {
+		if env != nil {
+			if found, v := env.Get(m[5 : len(m)-1]); found {
+				return v
+			}
+		}
+		return ""
+	})
+}
+
+func isTrue(v string) bool {
+	v = strings.ToLower(strings.TrimSpace(v))
+	return v != "" && v != "false" && v != "0"
+}
+
+func compare(op, left, right string) (bool, error) {
+	if op == "=~" {
+		re, err := regexp.Compile(right)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression '%s': %v", right, err)
+		}
+		return re.MatchString(left), nil
+	}
+
+	cmp := 0
+	l, errL := strconv.ParseFloat(left, 64)
+	r, errR := strconv.ParseFloat(right, 64)
+	if errL == nil && errR == nil {
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(left, right)
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<":
+		return cmp < 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+
+	return false, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// Eval evaluates the condition resolving variables and environment tokens.
+func (c *Condition) Eval(env Env, vars map[string]string) (bool, error) {
+	switch c.Op {
+	case "":
+		return isTrue(c.resolve(env, vars)), nil
+	case "!":
+		v, err := c.Left.Eval(env, vars)
+		return !v, err
+	case "&&", "||":
+		left, err := c.Left.Eval(env, vars)
+		if err != nil {
+			return false, err
+		} else if c.Op == "&&" && !left {
+			return false, nil
+		} else if c.Op == "||" && left {
+			return true, nil
+		}
+		return c.Right.Eval(env, vars)
+	}
+
+	return compare(c.Op, c.Left.resolve(env, vars), c.Right.resolve(env, vars))
+}
+
+func (c *Condition) resolve(env Env, vars map[string]string) string {
+	return expandEnv(expandVars(c.Value, vars), env)
+}
@@ -17,6 +17,7 @@ const (
 var (
 	InstallPathArchive = filepath.Join(InstallBase, "caplets-master")
 	InstallPath        = filepath.Join(InstallBase, "caplets")
+	PackagesPath       = filepath.Join(InstallBase, "packages")
 
 	LoadPaths = []string{
 		"./",
@@ -0,0 +1,124 @@
+package caplets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/evilsocket/islazy/str"
+)
+
+// MaxCallDepth limits recursive function calls.
+const MaxCallDepth = 64
+
+type interpreter struct {
+	prog  *Program
+	env   Env
+	exec  func(line string) error
+	onErr func(line string, err error)
+	mode  ErrorMode
+	depth int
+}
+
+func (it *interpreter) errorf(n *Node, err error) error {
+	return fmt.Errorf("%s:%d: %v", it.prog.File, n.Line, err)
+}
+
+// handle applies the current error mode to the error of a statement, a
+// cancelled context always aborts.
+func (it *interpreter) handle(n *Node, err error) error {
+	if err == nil {
+		return nil
+	} else if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	} else if it.mode == ErrorContinue {
+		if it.onErr != nil {
+			it.onErr(n.Text, it.errorf(n, err))
+		}
+		return nil
+	}
+	return it.errorf(n, err)
+}
+
+// loopItems splits a loop list expression by commas and/or spaces.
+func loopItems(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		if item = str.Trim(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (it *interpreter) run(body []*Node, vars map[string]string) error {
+	for _, n := range body {
+		var err error
+
+		switch n.Kind {
+		case NodeCommand:
+			err = it.handle(n, it.exec(expandVars(n.Text, vars)))
+
+		case NodeOnError:
+			it.mode = n.Mode
+
+		case NodeIf:
+			if yes, cerr := n.Cond.Eval(it.env, vars); cerr != nil {
+				err = it.handle(n, cerr)
+			} else if yes {
+				err = it.run(n.Body, vars)
+			} else {
+				err = it.run(n.Else, vars)
+			}
+
+		case NodeFor:
+			list := expandEnv(expandVars(n.Text, vars), it.env)
+			for _, item := range loopItems(list) {
+				scope := make(map[string]string, len(vars)+1)
+				for k, v := range vars {
+					scope[k] = v
+				}
+				scope[n.Var] = item
+
+				if err = it.run(n.Body, scope); err != nil {
+					break
+				}
+			}
+
+		case NodeCall:
+			err = it.call(n, vars)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *interpreter) call(n *Node, vars map[string]string) error {
+	fn, found := it.prog.Funcs[n.Text]
+	if !found {
+		return it.handle(n, fmt.Errorf("call to undefined function '%s'", n.Text))
+	} else if it.depth >= MaxCallDepth {
+		return it.handle(n, fmt.Errorf("maximum call depth of %d reached calling '%s'", MaxCallDepth, fn.Name))
+	}
+
+	// functions only see their own arguments as $0, $1, ...
+	args := make(map[string]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[fmt.Sprintf("%d", i)] = expandVars(arg, vars)
+	}
+
+	// error handling changes done inside the function do not leak to the caller
+	mode := it.mode
+	it.depth++
+	defer func() {
+		it.depth--
+		it.mode = mode
+	}()
+
+	return it.run(fn.Body, args)
+}
@@ -37,6 +37,12 @@ func List() []*Caplet {
 		}
 	}
 
+	for _, pkg := range Installed() {
+		if err, caplet := Load(pkg.ID()); err == nil {
+			caplets = append(caplets, caplet)
+		}
+	}
+
 	sort.Slice(caplets, func(i, j int) bool {
 		return strings.Compare(caplets[i].Name, caplets[j].Name) == -1
 	})
@@ -44,6 +50,18 @@ func List() []*Caplet {
 	return caplets
 }
 
+// uncache removes the cached caplets of a package after it changed.
+func uncache(pkgName string) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	for key := range cache {
+		if name, _ := SplitID(strings.TrimSuffix(key, Suffix)); name == pkgName {
+			delete(cache, key)
+		}
+	}
+}
+
 func Load(name string) (error, *Caplet) {
 	cacheLock.Lock()
 	defer cacheLock.Unlock()
@@ -58,10 +76,21 @@ func Load(name string) (error, *Caplet) {
 		name += Suffix
 	}
 
-	if name[0] != '/' {
+	if strings.Contains(baseName, "@") {
+		// name@version refers to an installed package
+		if err, pkg := FindPackage(SplitID(baseName)); err != nil {
+			return err, nil
+		} else {
+			names = append(names, pkg.MainFile())
+		}
+	} else if name[0] != '/' {
 		for _, path := range LoadPaths {
 			names = append(names, filepath.Join(path, name))
 		}
+		// fallback to the latest installed version of a package with this name
+		if err, pkg := FindPackage(baseName, ""); err == nil {
+			names = append(names, pkg.MainFile())
+		}
 	} else {
 		names = append(names, name)
 	}
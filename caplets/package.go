@@ -0,0 +1,450 @@
+package caplets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/zip"
+)
+
+const ManifestFile = "manifest.json"
+
+var (
+	rePackageName    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-\.]*$`)
+	rePackageVersion = regexp.MustCompile(`^\d+(\.\d+)*$`)
+)
+
+type PackageFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a caplet package, its content and what it needs.
+type Manifest struct {
+	Name         string        `json:"name"`
+	Version      string        `json:"version"`
+	Description  string        `json:"description"`
+	Main         string        `json:"main"`
+	Dependencies []string      `json:"dependencies"`
+	Modules      []string      `json:"modules"`
+	Files        []PackageFile `json:"files"`
+	// path of the folder the package is installed into
+	Path string `json:"-"`
+}
+
+// ID returns the name@version identifier of the package.
+func (m *Manifest) ID() string {
+	return m.Name + "@" + m.Version
+}
+
+// MainFile returns the path of the caplet to run when the package is loaded.
+func (m *Manifest) MainFile() string {
+	main := m.Main
+	if main == "" {
+		main = m.Name + Suffix
+	}
+	return filepath.Join(m.Path, main)
+}
+
+func LoadManifest(path string) (error, *Manifest) {
+	raw, err := ioutil.ReadFile(filepath.Join(path, ManifestFile))
+	if err != nil {
+		return err, nil
+	}
+
+	m := &Manifest{}
+	if err = json.Unmarshal(raw, m); err != nil {
+		return fmt.Errorf("error parsing %s: %v", ManifestFile, err), nil
+	}
+	m.Path = path
+
+	if !rePackageName.MatchString(m.Name) {
+		return fmt.Errorf("invalid package name '%s'", m.Name), nil
+	} else if !rePackageVersion.MatchString(m.Version) {
+		return fmt.Errorf("invalid version '%s' for package %s", m.Version, m.Name), nil
+	} else if len(m.Files) == 0 {
+		return fmt.Errorf("package %s has no files", m.Name), nil
+	}
+
+	return nil, m
+}
+
+func isSafePath(path string) bool {
+	return path != "" && !filepath.IsAbs(path) && !strings.HasPrefix(filepath.Clean(path), "..")
+}
+
+func fileChecksum(fileName string) (string, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify makes sure every file declared in the manifest exists and matches its checksum.
+func (m *Manifest) Verify() error {
+	hasMain := false
+	mainFile := m.MainFile()
+
+	for _, f := range m.Files {
+		if !isSafePath(f.Path) {
+			return fmt.Errorf("package %s: illegal file path '%s'", m.ID(), f.Path)
+		}
+
+		fileName := filepath.Join(m.Path, f.Path)
+		if sum, err := fileChecksum(fileName); err != nil {
+			return fmt.Errorf("package %s: %v", m.ID(), err)
+		} else if !strings.EqualFold(sum, f.SHA256) {
+			return fmt.Errorf("package %s: checksum mismatch for %s (expected %s, got %s)", m.ID(), f.Path, f.SHA256, sum)
+		}
+
+		if fileName == mainFile {
+			hasMain = true
+		}
+	}
+
+	if !hasMain {
+		return fmt.Errorf("package %s: main caplet %s is not listed in the files", m.ID(), filepath.Base(mainFile))
+	}
+
+	return nil
+}
+
+// CompareVersions returns -1, 0 or 1 if a is lower, equal or greater than b.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		na, nb := 0, 0
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na < nb {
+			return -1
+		} else if na > nb {
+			return 1
+		}
+	}
+	return 0
+}
+
+// SplitID splits a name@version identifier, version is empty if not specified.
+func SplitID(id string) (name string, version string) {
+	if idx := strings.LastIndex(id, "@"); idx != -1 {
+		return id[:idx], id[idx+1:]
+	}
+	return id, ""
+}
+
+// Installed returns the installed packages sorted by name and version.
+func Installed() []*Manifest {
+	packages := make([]*Manifest, 0)
+	dirs, _ := filepath.Glob(filepath.Join(PackagesPath, "*", "*"))
+	for _, dir := range dirs {
+		// skip anything that is not in its NAME/VERSION folder
+		if err, m := LoadManifest(dir); err == nil && filepath.Base(dir) == m.Version && filepath.Base(filepath.Dir(dir)) == m.Name {
+			packages = append(packages, m)
+		}
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name == packages[j].Name {
+			return CompareVersions(packages[i].Version, packages[j].Version) < 0
+		}
+		return packages[i].Name < packages[j].Name
+	})
+
+	return packages
+}
+
+// FindPackage returns the installed package with the given name and version,
+// or its latest installed version if version is empty.
+func FindPackage(name string, version string) (error, *Manifest) {
+	var found *Manifest
+	for _, m := range Installed() {
+		if m.Name != name {
+			continue
+		} else if version == "" {
+			if found == nil || CompareVersions(m.Version, found.Version) > 0 {
+				found = m
+			}
+		} else if CompareVersions(m.Version, version) == 0 {
+			found = m
+		}
+	}
+
+	if found == nil {
+		if version != "" {
+			return fmt.Errorf("package %s@%s is not installed", name, version), nil
+		}
+		return fmt.Errorf("package %s is not installed", name), nil
+	}
+	return nil, found
+}
+
+// Package is a caplet package opened from a folder or an archive.
+type Package struct {
+	*Manifest
+	tmpDir string
+}
+
+func extractTarGz(src string, dest string) error {
+	fp, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	gz, err := gzip.NewReader(fp)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		fpath := filepath.Join(dest, header.Name)
+		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("%s: illegal file path", fpath)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(fpath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode)&0755)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, reader)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// findManifestDir looks for the manifest in the folder or, as archives
+// usually wrap their content, in its only subfolder.
+func findManifestDir(dir string) string {
+	if fs.Exists(filepath.Join(dir, ManifestFile)) {
+		return dir
+	}
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		sub := filepath.Join(dir, entries[0].Name())
+		if fs.Exists(filepath.Join(sub, ManifestFile)) {
+			return sub
+		}
+	}
+	return dir
+}
+
+// OpenPackage loads and verifies a package from a folder or a .zip, .tar.gz
+// or .tgz archive, Close must be called once done with it.
+func OpenPackage(src string) (error, *Package) {
+	src, _ = fs.Expand(src)
+	stat, err := os.Stat(src)
+	if err != nil {
+		return err, nil
+	}
+
+	pkg := &Package{}
+	dir := src
+	if !stat.IsDir() {
+		if pkg.tmpDir, err = ioutil.TempDir("", "bettercap-caplet-"); err != nil {
+			return err, nil
+		}
+
+		lower := strings.ToLower(src)
+		if strings.HasSuffix(lower, ".zip") {
+			_, err = zip.Unzip(src, pkg.tmpDir)
+		} else if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+			err = extractTarGz(src, pkg.tmpDir)
+		} else {
+			err = fmt.Errorf("unsupported archive format %s", src)
+		}
+
+		if err != nil {
+			pkg.Close()
+			return err, nil
+		}
+		dir = findManifestDir(pkg.tmpDir)
+	}
+
+	if err, pkg.Manifest = LoadManifest(dir); err != nil {
+		pkg.Close()
+		return err, nil
+	} else if err = pkg.Verify(); err != nil {
+		pkg.Close()
+		return err, nil
+	}
+
+	return nil, pkg
+}
+
+func (pkg *Package) Close() {
+	if pkg.tmpDir != "" {
+		os.RemoveAll(pkg.tmpDir)
+		pkg.tmpDir = ""
+	}
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// MissingDependencies returns the dependencies which are not installed.
+func (m *Manifest) MissingDependencies() []string {
+	missing := make([]string, 0)
+	for _, dep := range m.Dependencies {
+		if err, _ := FindPackage(SplitID(dep)); err != nil {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// Install copies the package files into PackagesPath, replacing the same
+// version if already installed.
+func (pkg *Package) Install() (error, *Manifest) {
+	if missing := pkg.MissingDependencies(); len(missing) > 0 {
+		return fmt.Errorf("package %s has missing dependencies: %s", pkg.ID(), strings.Join(missing, ", ")), nil
+	}
+
+	dest := filepath.Join(PackagesPath, pkg.Name, pkg.Version)
+	tmpDest := dest + ".tmp"
+	os.RemoveAll(tmpDest)
+
+	files := []string{ManifestFile}
+	for _, f := range pkg.Files {
+		files = append(files, f.Path)
+	}
+
+	for _, file := range files {
+		if err := copyFile(filepath.Join(pkg.Path, file), filepath.Join(tmpDest, file)); err != nil {
+			os.RemoveAll(tmpDest)
+			return err, nil
+		}
+	}
+
+	os.RemoveAll(dest)
+	if err := os.Rename(tmpDest, dest); err != nil {
+		return err, nil
+	}
+
+	uncache(pkg.Name)
+
+	return LoadManifest(dest)
+}
+
+// Remove uninstalls a package, all of its versions if version is empty.
+func Remove(name string, version string) (error, []*Manifest) {
+	removed := make([]*Manifest, 0)
+	installed := Installed()
+
+	for _, m := range installed {
+		if m.Name == name && (version == "" || CompareVersions(m.Version, version) == 0) {
+			removed = append(removed, m)
+		}
+	}
+
+	if len(removed) == 0 {
+		err, _ := FindPackage(name, version)
+		return err, nil
+	}
+
+	versions := 0
+	for _, m := range installed {
+		if m.Name == name {
+			versions++
+		}
+	}
+	left := versions - len(removed)
+
+	// refuse if another package needs what is being removed
+	for _, m := range installed {
+		if m.Name == name {
+			continue
+		}
+		for _, dep := range m.Dependencies {
+			depName, depVersion := SplitID(dep)
+			if depName != name {
+				continue
+			} else if depVersion == "" && left == 0 {
+				return fmt.Errorf("package %s is required by %s", name, m.ID()), nil
+			}
+			for _, r := range removed {
+				if depVersion != "" && CompareVersions(depVersion, r.Version) == 0 {
+					return fmt.Errorf("package %s is required by %s", r.ID(), m.ID()), nil
+				}
+			}
+		}
+	}
+
+	for _, m := range removed {
+		if err := os.RemoveAll(m.Path); err != nil {
+			return err, nil
+		}
+	}
+
+	// remove the package folder if no versions are left
+	if dirs, _ := filepath.Glob(filepath.Join(PackagesPath, name, "*")); len(dirs) == 0 {
+		os.RemoveAll(filepath.Join(PackagesPath, name))
+	}
+
+	uncache(name)
+
+	return nil, removed
+}
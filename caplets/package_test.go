@@ -0,0 +1,205 @@
+package caplets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withPackagesPath(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "bettercap-packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := PackagesPath
+	PackagesPath = dir
+	return func() {
+		PackagesPath = prev
+		os.RemoveAll(dir)
+	}
+}
+
+func makePackage(t *testing.T, name string, version string, deps []string, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "bettercap-package-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := Manifest{
+		Name:         name,
+		Version:      version,
+		Dependencies: deps,
+		Files:        make([]PackageFile, 0),
+	}
+
+	for fileName, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, fileName), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(data))
+		m.Files = append(m.Files, PackageFile{Path: fileName, SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	raw, _ := json.Marshal(m)
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestFile), raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func installPackage(t *testing.T, src string) *Manifest {
+	err, pkg := OpenPackage(src)
+	if err != nil {
+		t.Fatalf("unexpected error opening %s: %v", src, err)
+	}
+	defer pkg.Close()
+
+	err, m := pkg.Install()
+	if err != nil {
+		t.Fatalf("unexpected error installing %s: %v", src, err)
+	}
+	return m
+}
+
+func TestCompareVersions(t *testing.T) {
+	var units = []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0.0", 0},
+		{"1.2", "1.10", -1},
+		{"2", "1.9.9", 1},
+	}
+
+	for _, u := range units {
+		if got := CompareVersions(u.a, u.b); got != u.expected {
+			t.Fatalf("%s vs %s: expected %d, got %d", u.a, u.b, u.expected, got)
+		}
+	}
+}
+
+func TestPackageInstallAndLoad(t *testing.T) {
+	defer withPackagesPath(t)()
+
+	src1 := makePackage(t, "recon", "1.0", nil, map[string]string{"recon.cap": "net.recon on"})
+	defer os.RemoveAll(src1)
+	src2 := makePackage(t, "recon", "1.2", nil, map[string]string{"recon.cap": "net.probe on"})
+	defer os.RemoveAll(src2)
+
+	if m := installPackage(t, src1); m.ID() != "recon@1.0" {
+		t.Fatalf("unexpected package %s", m.ID())
+	}
+	installPackage(t, src2)
+
+	if installed := Installed(); len(installed) != 2 {
+		t.Fatalf("expected 2 installed packages, got %d", len(installed))
+	}
+
+	if err, caplet := Load("recon@1.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if caplet.Code[0] != "net.recon on" {
+		t.Fatalf("unexpected code %v", caplet.Code)
+	}
+
+	// without a version the latest one is used
+	if err, m := FindPackage("recon", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if m.Version != "1.2" {
+		t.Fatalf("expected version 1.2, got %s", m.Version)
+	}
+
+	if err, _ := Load("recon@3.0"); err == nil {
+		t.Fatal("expected error loading a version which is not installed")
+	}
+}
+
+func TestPackageChecksumMismatch(t *testing.T) {
+	defer withPackagesPath(t)()
+
+	src := makePackage(t, "bad", "1.0", nil, map[string]string{"bad.cap": "net.recon on"})
+	defer os.RemoveAll(src)
+
+	if err := ioutil.WriteFile(filepath.Join(src, "bad.cap"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err, _ := OpenPackage(src); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+func TestPackageDependencies(t *testing.T) {
+	defer withPackagesPath(t)()
+
+	lib := makePackage(t, "lib", "1.0", nil, map[string]string{"lib.cap": "set foo bar"})
+	defer os.RemoveAll(lib)
+	app := makePackage(t, "app", "1.0", []string{"lib@1.0"}, map[string]string{"app.cap": "lib"})
+	defer os.RemoveAll(app)
+
+	err, pkg := OpenPackage(app)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pkg.Close()
+
+	if err, _ := pkg.Install(); err == nil || !strings.Contains(err.Error(), "missing dependencies: lib@1.0") {
+		t.Fatalf("expected missing dependency error, got %v", err)
+	}
+
+	installPackage(t, lib)
+	installPackage(t, app)
+
+	if err, _ := Remove("lib", ""); err == nil || !strings.Contains(err.Error(), "required by app@1.0") {
+		t.Fatalf("expected dependency error, got %v", err)
+	}
+
+	if err, removed := Remove("app", ""); err != nil || len(removed) != 1 {
+		t.Fatalf("unexpected result removing app: %v %v", err, removed)
+	} else if err, removed := Remove("lib", "1.0"); err != nil || len(removed) != 1 {
+		t.Fatalf("unexpected result removing lib: %v %v", err, removed)
+	} else if len(Installed()) != 0 {
+		t.Fatalf("expected no installed packages, got %v", Installed())
+	}
+}
+
+func TestPackageFromArchive(t *testing.T) {
+	defer withPackagesPath(t)()
+
+	src := makePackage(t, "archived", "0.1", nil, map[string]string{"archived.cap": "net.recon on"})
+	defer os.RemoveAll(src)
+
+	archive := src + ".tar.gz"
+	defer os.Remove(archive)
+
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{ManifestFile, "archived.cap"} {
+		data, _ := ioutil.ReadFile(filepath.Join(src, name))
+		tw.WriteHeader(&tar.Header{Name: "archived-0.1/" + name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write(data)
+	}
+	tw.Close()
+	gz.Close()
+	out.Close()
+
+	if m := installPackage(t, archive); m.ID() != "archived@0.1" {
+		t.Fatalf("unexpected package %s", m.ID())
+	} else if err, caplet := Load("archived"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if caplet.Path != m.MainFile() {
+		t.Fatalf("expected %s, got %s", m.MainFile(), caplet.Path)
+	}
+}
@@ -0,0 +1,281 @@
+package caplets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/evilsocket/islazy/str"
+)
+
+type NodeKind int
+
+const (
+	NodeCommand NodeKind = iota
+	NodeIf
+	NodeFor
+	NodeCall
+	NodeOnError
+)
+
+type ErrorMode int
+
+const (
+	ErrorAbort ErrorMode = iota
+	ErrorContinue
+)
+
+// Node is a single statement of a parsed caplet.
+type Node struct {
+	Kind NodeKind
+	// 1-based line number in the caplet file
+	Line int
+	// raw command line, loop list expression or called function name
+	Text string
+	// loop variable name
+	Var string
+	// arguments of a call statement
+	Args []string
+	// compiled condition of an if statement
+	Cond *Condition
+	Body []*Node
+	Else []*Node
+	Mode ErrorMode
+}
+
+// Function is a named block declared with def ... end.
+type Function struct {
+	Name string
+	Line int
+	Body []*Node
+}
+
+// Program is the parsed representation of a caplet.
+type Program struct {
+	File  string
+	Body  []*Node
+	Funcs map[string]*Function
+}
+
+type ParseError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+var (
+	reForStatement  = regexp.MustCompile(`^for\s+([A-Za-z_][A-Za-z0-9_]*)\s+in\s+(.+)$`)
+	reDefStatement  = regexp.MustCompile(`^def\s+([A-Za-z_][A-Za-z0-9_.\-]*)$`)
+	reCallStatement = regexp.MustCompile(`^call\s+([A-Za-z_][A-Za-z0-9_.\-]*)(\s+.+)?$`)
+	reOnError       = regexp.MustCompile(`^on\s+error\s+(.+)$`)
+)
+
+type parser struct {
+	file  string
+	lines []string
+	pos   int
+	prog  *Program
+	calls []*Node
+}
+
+// Parse turns the lines of a caplet into a Program, reporting the first
+// syntax error with its file:line position.
+func Parse(file string, lines []string) (*Program, error) {
+	p := &parser{
+		file:  file,
+		lines: lines,
+		prog: &Program{
+			File:  file,
+			Body:  make([]*Node, 0),
+			Funcs: make(map[string]*Function),
+		},
+		calls: make([]*Node, 0),
+	}
+
+	body, term, line, err := p.block(0)
+	if err != nil {
+		return nil, err
+	} else if term != "" {
+		return nil, p.errorf(line, "unexpected '%s'", term)
+	}
+	p.prog.Body = body
+
+	// functions are hoisted, so calls are resolved only once everything has been parsed
+	for _, call := range p.calls {
+		if _, found := p.prog.Funcs[call.Text]; !found {
+			return nil, p.errorf(call.Line, "call to undefined function '%s'", call.Text)
+		}
+	}
+
+	return p.prog, nil
+}
+
+func (p *parser) errorf(line int, format string, args ...interface{}) error {
+	return ParseError{
+		File:    p.file,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// keyword returns the control flow keyword a line starts with, if any.
+func keyword(line string) string {
+	if line == "end" || line == "else" {
+		return line
+	}
+	for _, kw := range []string{"if", "else", "for", "def", "call", "on"} {
+		if line == kw || strings.HasPrefix(line, kw+" ") || strings.HasPrefix(line, kw+"\t") {
+			return kw
+		}
+	}
+	return ""
+}
+
+// next returns the next meaningful line, skipping empty lines and comments.
+func (p *parser) next() (line string, lineNum int, ok bool) {
+	for p.pos < len(p.lines) {
+		line = str.Trim(p.lines[p.pos])
+		p.pos++
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		return line, p.pos, true
+	}
+	return "", p.pos, false
+}
+
+// block parses statements until either the end of the file or one of the
+// "end" / "else" terminators is found, returning which one stopped it.
+func (p *parser) block(depth int) (body []*Node, term string, termLine int, err error) {
+	body = make([]*Node, 0)
+	for {
+		line, lineNum, ok := p.next()
+		if !ok {
+			return body, "", lineNum, nil
+		}
+
+		switch keyword(line) {
+		case "end":
+			return body, "end", lineNum, nil
+
+		case "else":
+			// keep the whole line so that 'else if' can be detected by the caller
+			return body, line, lineNum, nil
+
+		case "if":
+			node, err := p.ifStatement(str.Trim(line[2:]), lineNum, depth)
+			if err != nil {
+				return nil, "", lineNum, err
+			}
+			body = append(body, node)
+
+		case "for":
+			m := reForStatement.FindStringSubmatch(line)
+			if m == nil {
+				return nil, "", lineNum, p.errorf(lineNum, "invalid for statement, expected 'for NAME in LIST'")
+			}
+			node := &Node{Kind: NodeFor, Line: lineNum, Var: m[1], Text: str.Trim(m[2])}
+			if node.Body, err = p.closed("for", lineNum, depth); err != nil {
+				return nil, "", lineNum, err
+			}
+			body = append(body, node)
+
+		case "def":
+			m := reDefStatement.FindStringSubmatch(line)
+			if m == nil {
+				return nil, "", lineNum, p.errorf(lineNum, "invalid def statement, expected 'def NAME'")
+			} else if depth > 0 {
+				return nil, "", lineNum, p.errorf(lineNum, "functions can only be defined at the top level")
+			} else if prev, found := p.prog.Funcs[m[1]]; found {
+				return nil, "", lineNum, p.errorf(lineNum, "function '%s' already defined at line %d", m[1], prev.Line)
+			}
+			fn := &Function{Name: m[1], Line: lineNum}
+			if fn.Body, err = p.closed("def", lineNum, depth); err != nil {
+				return nil, "", lineNum, err
+			}
+			p.prog.Funcs[fn.Name] = fn
+
+		case "call":
+			m := reCallStatement.FindStringSubmatch(line)
+			if m == nil {
+				return nil, "", lineNum, p.errorf(lineNum, "invalid call statement, expected 'call NAME [ARGS]'")
+			}
+			node := &Node{Kind: NodeCall, Line: lineNum, Text: m[1], Args: strings.Fields(m[2])}
+			p.calls = append(p.calls, node)
+			body = append(body, node)
+
+		case "on":
+			m := reOnError.FindStringSubmatch(line)
+			if m == nil {
+				// not a control statement, let the session handle it
+				body = append(body, &Node{Kind: NodeCommand, Line: lineNum, Text: line})
+				break
+			}
+			node := &Node{Kind: NodeOnError, Line: lineNum}
+			switch mode := str.Trim(m[1]); mode {
+			case "continue":
+				node.Mode = ErrorContinue
+			case "abort":
+				node.Mode = ErrorAbort
+			default:
+				return nil, "", lineNum, p.errorf(lineNum, "invalid error mode '%s', expected continue or abort", mode)
+			}
+			body = append(body, node)
+
+		default:
+			body = append(body, &Node{Kind: NodeCommand, Line: lineNum, Text: line})
+		}
+	}
+}
+
+// closed parses the body of a block that must be terminated by 'end'.
+func (p *parser) closed(what string, openedAt int, depth int) ([]*Node, error) {
+	body, term, termLine, err := p.block(depth + 1)
+	if err != nil {
+		return nil, err
+	} else if term == "" {
+		return nil, p.errorf(openedAt, "missing 'end' for '%s' statement", what)
+	} else if term != "end" {
+		return nil, p.errorf(termLine, "unexpected 'else' inside '%s' statement opened at line %d", what, openedAt)
+	}
+	return body, nil
+}
+
+func (p *parser) ifStatement(expr string, lineNum int, depth int) (*Node, error) {
+	cond, err := ParseCondition(expr)
+	if err != nil {
+		return nil, p.errorf(lineNum, "%v", err)
+	}
+
+	node := &Node{Kind: NodeIf, Line: lineNum, Text: expr, Cond: cond}
+	body, term, termLine, err := p.block(depth + 1)
+	if err != nil {
+		return nil, err
+	} else if term == "" {
+		return nil, p.errorf(lineNum, "missing 'end' for 'if' statement")
+	}
+	node.Body = body
+
+	if term == "end" {
+		return node, nil
+	} else if term == "else" {
+		if node.Else, err = p.closed("else", termLine, depth); err != nil {
+			return nil, err
+		}
+		return node, nil
+	} else if strings.HasPrefix(term, "else if ") {
+		// 'else if' chains share the same 'end'
+		elseIf, err := p.ifStatement(str.Trim(term[7:]), termLine, depth)
+		if err != nil {
+			return nil, err
+		}
+		node.Else = []*Node{elseIf}
+		return node, nil
+	}
+
+	return nil, p.errorf(termLine, "invalid else statement '%s'", term)
+}
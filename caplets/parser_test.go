@@ -0,0 +1,227 @@
+package caplets
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseLines(t *testing.T, code string) *Program {
+	prog, err := Parse("test.cap", strings.Split(code, "\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return prog
+}
+
+func TestParseCommands(t *testing.T) {
+	prog := parseLines(t, "# comment\n\nset foo bar\n  net.probe on  \nevents.on x y")
+
+	if len(prog.Body) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(prog.Body))
+	}
+
+	expected := []struct {
+		line int
+		text string
+	}{
+		{3, "set foo bar"},
+		{4, "net.probe on"},
+		{5, "events.on x y"},
+	}
+	for i, e := range expected {
+		if n := prog.Body[i]; n.Kind != NodeCommand {
+			t.Fatalf("expected command, got %d", n.Kind)
+		} else if n.Line != e.line {
+			t.Fatalf("expected line %d, got %d", e.line, n.Line)
+		} else if n.Text != e.text {
+			t.Fatalf("expected '%s', got '%s'", e.text, n.Text)
+		}
+	}
+}
+
+func TestParseIfElse(t *testing.T) {
+	prog := parseLines(t, `
+if {env.foo} == bar
+  cmd1
+else
+  cmd2
+  cmd3
+end`)
+
+	if len(prog.Body) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(prog.Body))
+	}
+
+	n := prog.Body[0]
+	if n.Kind != NodeIf {
+		t.Fatalf("expected if, got %d", n.Kind)
+	} else if n.Line != 2 {
+		t.Fatalf("expected line 2, got %d", n.Line)
+	} else if n.Cond == nil || n.Cond.Op != "==" {
+		t.Fatalf("unexpected condition %+v", n.Cond)
+	} else if len(n.Body) != 1 || n.Body[0].Text != "cmd1" {
+		t.Fatalf("unexpected then block %+v", n.Body)
+	} else if len(n.Else) != 2 || n.Else[1].Text != "cmd3" {
+		t.Fatalf("unexpected else block %+v", n.Else)
+	}
+}
+
+func TestParseElseIfChain(t *testing.T) {
+	prog := parseLines(t, `
+if $0 == a
+  cmd1
+else if $0 == b
+  cmd2
+else
+  cmd3
+end
+cmd4`)
+
+	if len(prog.Body) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(prog.Body))
+	}
+
+	n := prog.Body[0]
+	if len(n.Else) != 1 || n.Else[0].Kind != NodeIf {
+		t.Fatalf("expected nested if in else block, got %+v", n.Else)
+	} else if elseIf := n.Else[0]; elseIf.Line != 4 || len(elseIf.Else) != 1 || elseIf.Else[0].Text != "cmd3" {
+		t.Fatalf("unexpected else if %+v", elseIf)
+	}
+}
+
+func TestParseFor(t *testing.T) {
+	prog := parseLines(t, `
+for target in 10.0.0.1, 10.0.0.2
+  for port in 80 443
+    syn.scan $target $port
+  end
+end`)
+
+	n := prog.Body[0]
+	if n.Kind != NodeFor || n.Var != "target" || n.Text != "10.0.0.1, 10.0.0.2" {
+		t.Fatalf("unexpected for statement %+v", n)
+	} else if len(n.Body) != 1 || n.Body[0].Kind != NodeFor || n.Body[0].Var != "port" {
+		t.Fatalf("unexpected nested for %+v", n.Body)
+	} else if n.Body[0].Body[0].Text != "syn.scan $target $port" {
+		t.Fatalf("unexpected loop body %+v", n.Body[0].Body)
+	}
+}
+
+func TestParseDefCall(t *testing.T) {
+	prog := parseLines(t, `
+call spoof 10.0.0.1 full
+def spoof
+  set arp.spoof.targets $0
+  arp.spoof on
+end`)
+
+	if len(prog.Body) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(prog.Body))
+	} else if n := prog.Body[0]; n.Kind != NodeCall || n.Text != "spoof" || len(n.Args) != 2 || n.Args[1] != "full" {
+		t.Fatalf("unexpected call %+v", n)
+	} else if fn, found := prog.Funcs["spoof"]; !found {
+		t.Fatal("expected function 'spoof' to be defined")
+	} else if fn.Line != 3 || len(fn.Body) != 2 {
+		t.Fatalf("unexpected function %+v", fn)
+	}
+}
+
+func TestParseOnError(t *testing.T) {
+	prog := parseLines(t, "on error continue\ncmd\non error abort\non.something else")
+
+	if len(prog.Body) != 4 {
+		t.Fatalf("expected 4 statements, got %d", len(prog.Body))
+	} else if n := prog.Body[0]; n.Kind != NodeOnError || n.Mode != ErrorContinue {
+		t.Fatalf("unexpected statement %+v", n)
+	} else if n := prog.Body[2]; n.Kind != NodeOnError || n.Mode != ErrorAbort {
+		t.Fatalf("unexpected statement %+v", n)
+	} else if n := prog.Body[3]; n.Kind != NodeCommand {
+		t.Fatalf("expected command, got %+v", n)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var units = []struct {
+		code string
+		line int
+		msg  string
+	}{
+		{"if foo\ncmd", 1, "missing 'end'"},
+		{"cmd\nend", 2, "unexpected 'end'"},
+		{"else", 1, "unexpected 'else'"},
+		{"for x\nend", 1, "invalid for statement"},
+		{"for x in a\nelse\nend", 2, "unexpected 'else'"},
+		{"if\nend", 1, "empty condition"},
+		{"if (a == b\nend", 1, "missing closing parenthesis"},
+		{"if a ==\nend", 1, "unexpected end of condition"},
+		{"if a b\nend", 1, "unexpected 'b'"},
+		{"if a =~ '(['\nend", 1, "invalid regular expression"},
+		{"if 'a\nend", 1, "unterminated quoted string"},
+		{"call nope", 1, "undefined function 'nope'"},
+		{"def f\nend\ndef f\nend", 3, "already defined at line 1"},
+		{"if a\ndef f\nend\nend", 2, "top level"},
+		{"on error retry", 1, "invalid error mode"},
+		{"def f\ncmd", 1, "missing 'end' for 'def'"},
+	}
+
+	for _, u := range units {
+		_, err := Parse("test.cap", strings.Split(u.code, "\n"))
+		if err == nil {
+			t.Fatalf("expected error parsing %q", u.code)
+		}
+
+		perr, ok := err.(ParseError)
+		if !ok {
+			t.Fatalf("expected ParseError, got %T", err)
+		} else if perr.Line != u.line {
+			t.Fatalf("parsing %q: expected line %d, got %d (%v)", u.code, u.line, perr.Line, err)
+		} else if !strings.Contains(perr.Message, u.msg) {
+			t.Fatalf("parsing %q: expected '%s' in '%s'", u.code, u.msg, perr.Message)
+		} else if !strings.HasPrefix(err.Error(), "test.cap:") {
+			t.Fatalf("expected file position in '%s'", err.Error())
+		}
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	env := mapEnv{"foo": "bar", "n": "10", "off": "false"}
+	vars := map[string]string{"0": "first", "x": "10.0.0.1"}
+
+	var units = []struct {
+		expr     string
+		expected bool
+	}{
+		{"{env.foo}", true},
+		{"{env.off}", false},
+		{"{env.undefined}", false},
+		{"!{env.undefined}", true},
+		{"{env.foo} == bar", true},
+		{"{env.foo}==bar", true},
+		{"{env.foo} != bar", false},
+		{"{env.n} > 9", true},
+		{"{env.n} >= 10", true},
+		{"{env.n} < 9.5", false},
+		{"{env.n} <= 10", true},
+		{"$0 == first", true},
+		{"$x =~ '^10\\.0\\.'", true},
+		{"$x =~ ^192", false},
+		{`"" == {env.undefined}`, true},
+		{"'hello world' == \"hello world\"", true},
+		{"{env.foo} == bar && {env.n} > 100", false},
+		{"{env.foo} == bar || {env.n} > 100", true},
+		{"!({env.foo} == bar || {env.n} > 100)", false},
+		{"{env.off} || {env.n} == 10 && $0 == first", true},
+	}
+
+	for _, u := range units {
+		cond, err := ParseCondition(u.expr)
+		if err != nil {
+			t.Fatalf("unexpected error parsing '%s': %v", u.expr, err)
+		}
+		if got, err := cond.Eval(env, vars); err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %v", u.expr, err)
+		} else if got != u.expected {
+			t.Fatalf("'%s': expected %v, got %v", u.expr, u.expected, got)
+		}
+	}
+}
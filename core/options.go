@@ -6,13 +6,20 @@ type Options struct {
 	InterfaceName *string
 	Gateway       *string
 	Caplet        *string
+	Check         *string
 	AutoStart     *string
 	Debug         *bool
+	DryRun        *bool
+	Recover       *bool
+	Scope         *string
 	Silent        *bool
 	NoColors      *bool
 	NoHistory     *bool
 	PrintVersion  *bool
 	EnvFile       *string
+	AuditFile     *string
+	Workspace     *string
+	Capture       *string
 	Commands      *string
 	CpuProfile    *string
 	MemProfile    *string
@@ -24,12 +31,19 @@ func ParseOptions() (Options, error) {
 		Gateway:       flag.String("gateway-override", "", "Use the provided IP address instead of the default gateway. If not specified or invalid, the default gateway will be used."),
 		AutoStart:     flag.String("autostart", "events.stream", "Comma separated list of modules to auto start."),
 		Caplet:        flag.String("caplet", "", "Read commands from this file and execute them in the interactive session."),
+		Check:         flag.String("check", "", "Check this caplet and the ones it includes for errors without executing it, then exit."),
 		Debug:         flag.Bool("debug", false, "Print debug messages."),
+		Scope:         flag.String("scope", "", "Load the engagement scope from this JSON file, offensive actions against targets out of scope will be refused."),
+		Recover:       flag.Bool("recover", false, "Undo the firewall changes and heal the spoofed targets left behind by a session which did not exit cleanly, then exit."),
+		DryRun:        flag.Bool("dry-run", false, "Record the packets, firewall rules and listeners the session would create instead of touching the network."),
 		PrintVersion:  flag.Bool("version", false, "Print the version and exit."),
 		Silent:        flag.Bool("silent", false, "Suppress all logs which are not errors."),
 		NoColors:      flag.Bool("no-colors", false, "Disable output color effects."),
 		NoHistory:     flag.Bool("no-history", false, "Disable interactive session history file."),
 		EnvFile:       flag.String("env-file", "", "Load environment variables from this file if found, set to empty to disable environment persistence."),
+		AuditFile:     flag.String("audit-file", "", "If set, append every executed command and the changes it caused to this hash chained log file."),
+		Workspace:     flag.String("workspace", "", "Periodically save hosts, access points, devices, parameters, captures and events to this directory and restore them when it's opened again."),
+		Capture:       flag.String("capture-backend", "pcap", "Capture packets with this backend, either pcap or afpacket (Linux only)."),
 		Commands:      flag.String("eval", "", "Run one or more commands separated by ; in the interactive session, used to set variables via command line."),
 		CpuProfile:    flag.String("cpu-profile", "", "Write cpu profile `file`."),
 		MemProfile:    flag.String("mem-profile", "", "Write memory profile to `file`."),
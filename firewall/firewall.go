@@ -4,5 +4,19 @@ type FirewallManager interface {
 	IsForwardingEnabled() bool
 	EnableForwarding(enabled bool) error
 	EnableRedirection(r *Redirection, enabled bool) error
+	// Redirections returns the active redirections created by bettercap.
+	Redirections() []*Redirection
 	Restore()
 }
+
+type tracker interface {
+	Track(r *Redirection)
+}
+
+// Track makes the firewall aware of a redirection created by another
+// process, like one recovered from the journal, so that it can be removed.
+func Track(fw FirewallManager, r *Redirection) {
+	if t, ok := fw.(tracker); ok {
+		t.Track(r)
+	}
+}
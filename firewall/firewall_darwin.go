@@ -21,18 +21,20 @@ var (
 )
 
 type PfFirewall struct {
-	iface      *network.Endpoint
-	filename   string
-	forwarding bool
-	enabled    bool
+	iface        *network.Endpoint
+	filename     string
+	forwarding   bool
+	enabled      bool
+	redirections map[string]*Redirection
 }
 
 func Make(iface *network.Endpoint) FirewallManager {
 	firewall := &PfFirewall{
-		iface:      iface,
-		filename:   pfFilePath,
-		forwarding: false,
-		enabled:    false,
+		iface:        iface,
+		filename:     pfFilePath,
+		forwarding:   false,
+		enabled:      false,
+		redirections: make(map[string]*Redirection),
 	}
 
 	firewall.forwarding = firewall.IsForwardingEnabled()
@@ -121,10 +123,19 @@ func (f *PfFirewall) enable(enabled bool) {
 	}
 }
 
+func (f PfFirewall) Redirections() []*Redirection {
+	return sorted(f.redirections)
+}
+
 func (f PfFirewall) EnableRedirection(r *Redirection, enabled bool) error {
 	rule := f.generateRule(r)
 
 	if enabled {
+		if !r.IsSimple() {
+			return fmt.Errorf("redirection %s uses features which are not supported by pf", r)
+		}
+		f.redirections[r.String()] = r
+
 		fd, err := os.OpenFile(f.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
 		if err != nil {
 			return err
@@ -143,6 +154,8 @@ func (f PfFirewall) EnableRedirection(r *Redirection, enabled bool) error {
 			return err
 		}
 	} else {
+		delete(f.redirections, r.String())
+
 		fd, err := os.Open(f.filename)
 		if err == nil {
 			defer fd.Close()
@@ -174,4 +187,7 @@ func (f PfFirewall) Restore() {
 		f.enable(false)
 	}
 	os.Remove(f.filename)
+	for rkey := range f.redirections {
+		delete(f.redirections, rkey)
+	}
 }
@@ -0,0 +1,78 @@
+package firewall
+
+import (
+	"fmt"
+)
+
+// DryRunFirewall is a FirewallManager that only records what would be done
+// to the system firewall, without changing anything.
+type DryRunFirewall struct {
+	forwarding   bool
+	original     bool
+	redirections map[string]*Redirection
+	record       func(action string, details string)
+}
+
+func NewDryRun(real FirewallManager, record func(action string, details string)) *DryRunFirewall {
+	forwarding := false
+	if real != nil {
+		forwarding = real.IsForwardingEnabled()
+	}
+
+	return &DryRunFirewall{
+		forwarding:   forwarding,
+		original:     forwarding,
+		redirections: make(map[string]*Redirection),
+		record:       record,
+	}
+}
+
+func (f *DryRunFirewall) IsForwardingEnabled() bool {
+	return f.forwarding
+}
+
+func (f *DryRunFirewall) EnableForwarding(enabled bool) error {
+	f.forwarding = enabled
+	if enabled {
+		f.record("forwarding", "enable packet forwarding")
+	} else {
+		f.record("forwarding", "disable packet forwarding")
+	}
+	return nil
+}
+
+func (f *DryRunFirewall) EnableRedirection(r *Redirection, enabled bool) error {
+	rkey := r.String()
+	_, found := f.redirections[rkey]
+
+	if enabled {
+		if found {
+			return fmt.Errorf("Redirection '%s' already enabled.", rkey)
+		}
+		f.redirections[rkey] = r
+		f.record("redirection", fmt.Sprintf("add %s", rkey))
+	} else if found {
+		delete(f.redirections, rkey)
+		f.record("redirection", fmt.Sprintf("remove %s", rkey))
+	}
+
+	return nil
+}
+
+func (f *DryRunFirewall) Track(r *Redirection) {
+	f.redirections[r.String()] = r
+}
+
+func (f *DryRunFirewall) Redirections() []*Redirection {
+	return sorted(f.redirections)
+}
+
+func (f *DryRunFirewall) Restore() {
+	for _, r := range f.redirections {
+		f.EnableRedirection(r, false)
+	}
+
+	if f.forwarding != f.original {
+		f.EnableForwarding(f.original)
+	}
+}
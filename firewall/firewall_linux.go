@@ -8,17 +8,33 @@ import (
 	"github.com/bettercap/bettercap/core"
 	"github.com/bettercap/bettercap/network"
 
+	"github.com/evilsocket/islazy/fs"
 	"github.com/evilsocket/islazy/str"
 )
 
+// linuxBackend applies the redirections to the kernel, active is the whole
+// set of redirections after the change. Add might change the FORWARD policy,
+// Flush puts back the previous one.
+type linuxBackend interface {
+	Name() string
+	Add(r *Redirection, active []*Redirection) error
+	Del(r *Redirection, active []*Redirection) error
+	Flush(active []*Redirection) error
+}
+
 type LinuxFirewall struct {
 	iface        *network.Endpoint
 	forwarding   bool
+	forwarding6  bool
+	backend      linuxBackend
 	redirections map[string]*Redirection
 }
 
 const (
 	IPV4ForwardingFile = "/proc/sys/net/ipv4/ip_forward"
+	IPV6ForwardingFile = "/proc/sys/net/ipv6/conf/all/forwarding"
+	// routing table delivering the packets marked by tproxy to the local stack
+	TProxyRouteTable = "6263"
 )
 
 func Make(iface *network.Endpoint) FirewallManager {
@@ -29,10 +45,25 @@ func Make(iface *network.Endpoint) FirewallManager {
 	}
 
 	firewall.forwarding = firewall.IsForwardingEnabled()
+	firewall.forwarding6 = isFeatureEnabled(IPV6ForwardingFile)
 
 	return firewall
 }
 
+// getBackend picks nftables if the kernel supports it, iptables otherwise.
+// The choice is delayed until the first redirection so that creating the
+// firewall has no side effects.
+func (f *LinuxFirewall) getBackend() linuxBackend {
+	if f.backend == nil {
+		if err := probeNftables(); err == nil {
+			f.backend = newNftablesBackend()
+		} else {
+			f.backend = newIptablesBackend()
+		}
+	}
+	return f.backend
+}
+
 func (f LinuxFirewall) enableFeature(filename string, enable bool) error {
 	var value string
 	if enable {
@@ -51,92 +82,137 @@ func (f LinuxFirewall) enableFeature(filename string, enable bool) error {
 	return err
 }
 
-func (f LinuxFirewall) IsForwardingEnabled() bool {
-
-	if out, err := ioutil.ReadFile(IPV4ForwardingFile); err != nil {
+func isFeatureEnabled(filename string) bool {
+	if out, err := ioutil.ReadFile(filename); err != nil {
 		return false
 	} else {
 		return str.Trim(string(out)) == "1"
 	}
 }
 
+func (f LinuxFirewall) IsForwardingEnabled() bool {
+	return isFeatureEnabled(IPV4ForwardingFile)
+}
+
+// EnableForwarding toggles both IPv4 and, if available, IPv6 forwarding.
 func (f LinuxFirewall) EnableForwarding(enabled bool) error {
-	return f.enableFeature(IPV4ForwardingFile, enabled)
+	if err := f.enableFeature(IPV4ForwardingFile, enabled); err != nil {
+		return err
+	} else if fs.Exists(IPV6ForwardingFile) {
+		return f.enableFeature(IPV6ForwardingFile, enabled)
+	}
+	return nil
+}
+
+func (f *LinuxFirewall) active() []*Redirection {
+	return sorted(f.redirections)
+}
+
+func (f *LinuxFirewall) Redirections() []*Redirection {
+	return f.active()
 }
 
-func (f *LinuxFirewall) getCommandLine(r *Redirection, enabled bool) (cmdLine []string) {
-	action := "-A"
-	if !enabled {
-		action = "-D"
+// tproxyRouting adds or removes the policy routing needed by a tproxy
+// redirection, the route is shared by all the redirections of a family.
+func tproxyRouting(r *Redirection, enabled bool, active []*Redirection) error {
+	family := "-4"
+	if r.IsIPv6() {
+		family = "-6"
 	}
+	mark := fmt.Sprintf("0x%x/0x%x", r.Mark, r.Mark)
 
-	if r.SrcAddress == "" {
-		cmdLine = []string{
-			"-t", "nat",
-			action, "PREROUTING",
-			"-i", r.Interface,
-			"-p", r.Protocol,
-			"--dport", fmt.Sprintf("%d", r.SrcPort),
-			"-j", "DNAT",
-			"--to", fmt.Sprintf("%s:%d", r.DstAddress, r.DstPort),
+	if enabled {
+		if _, err := core.Exec("ip", []string{family, "rule", "add", "fwmark", mark, "lookup", TProxyRouteTable}); err != nil {
+			return err
 		}
-	} else {
-		cmdLine = []string{
-			"-t", "nat",
-			action, "PREROUTING",
-			"-i", r.Interface,
-			"-p", r.Protocol,
-			"-d", r.SrcAddress,
-			"--dport", fmt.Sprintf("%d", r.SrcPort),
-			"-j", "DNAT",
-			"--to", fmt.Sprintf("%s:%d", r.DstAddress, r.DstPort),
+		_, err := core.Exec("ip", []string{family, "route", "replace", "local", "default", "dev", "lo", "table", TProxyRouteTable})
+		return err
+	}
+
+	_, err := core.Exec("ip", []string{family, "rule", "del", "fwmark", mark, "lookup", TProxyRouteTable})
+	for _, other := range active {
+		if other.IsTProxy() && other.IsIPv6() == r.IsIPv6() {
+			return err
 		}
 	}
 
-	return
+	if _, ferr := core.Exec("ip", []string{family, "route", "flush", "table", TProxyRouteTable}); err == nil {
+		err = ferr
+	}
+	return err
 }
 
 func (f *LinuxFirewall) EnableRedirection(r *Redirection, enabled bool) error {
-	cmdLine := f.getCommandLine(r, enabled)
+	backend := f.getBackend()
 	rkey := r.String()
 	_, found := f.redirections[rkey]
 
 	if enabled {
 		if found {
 			return fmt.Errorf("Redirection '%s' already enabled.", rkey)
+		} else if err := r.Validate(); err != nil {
+			return err
 		}
 
 		f.redirections[rkey] = r
-
-		// accept all
-		if _, err := core.Exec("iptables", []string{"-P", "FORWARD", "ACCEPT"}); err != nil {
-			return err
-		} else if _, err := core.Exec("iptables", cmdLine); err != nil {
-			return err
+		if err := backend.Add(r, f.active()); err != nil {
+			delete(f.redirections, rkey)
+			return fmt.Errorf("%s: %v", backend.Name(), err)
+		} else if r.IsTProxy() {
+			if err := tproxyRouting(r, true, f.active()); err != nil {
+				delete(f.redirections, rkey)
+				backend.Del(r, f.active())
+				return fmt.Errorf("error while setting up tproxy routing: %v", err)
+			}
 		}
 	} else {
 		if !found {
 			return nil
 		}
 
-		delete(f.redirections, r.String())
+		delete(f.redirections, rkey)
 
-		if _, err := core.Exec("iptables", cmdLine); err != nil {
-			return err
+		if err := backend.Del(r, f.active()); err != nil {
+			return fmt.Errorf("%s: %v", backend.Name(), err)
+		} else if r.IsTProxy() {
+			if err := tproxyRouting(r, false, f.active()); err != nil {
+				return fmt.Errorf("error while removing tproxy routing: %v", err)
+			}
 		}
 	}
 
 	return nil
 }
 
+// Track adds a redirection which is already in place to the ones this
+// firewall is allowed to remove.
+func (f *LinuxFirewall) Track(r *Redirection) {
+	f.getBackend()
+	f.redirections[r.String()] = r
+}
+
 func (f LinuxFirewall) Restore() {
-	for _, r := range f.redirections {
-		if err := f.EnableRedirection(r, false); err != nil {
-			fmt.Printf("%s", err)
+	if f.backend != nil {
+		active := f.active()
+		if err := f.backend.Flush(active); err != nil {
+			fmt.Printf("%s: %s\n", f.backend.Name(), err)
+		}
+
+		for i, r := range active {
+			delete(f.redirections, r.String())
+			if r.IsTProxy() {
+				if err := tproxyRouting(r, false, active[i+1:]); err != nil {
+					fmt.Printf("%s\n", err)
+				}
+			}
 		}
 	}
 
-	if err := f.EnableForwarding(f.forwarding); err != nil {
+	if err := f.enableFeature(IPV4ForwardingFile, f.forwarding); err != nil {
 		fmt.Printf("%s", err)
+	} else if fs.Exists(IPV6ForwardingFile) {
+		if err := f.enableFeature(IPV6ForwardingFile, f.forwarding6); err != nil {
+			fmt.Printf("%s", err)
+		}
 	}
 }
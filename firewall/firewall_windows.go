@@ -85,7 +85,15 @@ func (f *WindowsFirewall) AllowPort(port int, address string, proto string, allo
 	return nil
 }
 
+func (f WindowsFirewall) Redirections() []*Redirection {
+	return sorted(f.redirections)
+}
+
 func (f *WindowsFirewall) EnableRedirection(r *Redirection, enabled bool) error {
+	if enabled && !r.IsSimple() {
+		return fmt.Errorf("redirection %s uses features which are not supported by netsh", r)
+	}
+
 	if err := f.AllowPort(r.SrcPort, r.DstAddress, r.Protocol, enabled); err != nil {
 		return err
 	} else if err := f.AllowPort(r.DstPort, r.DstAddress, r.Protocol, enabled); err != nil {
@@ -103,6 +111,12 @@ func (f *WindowsFirewall) EnableRedirection(r *Redirection, enabled bool) error
 		return err
 	}
 
+	if enabled {
+		f.redirections[r.String()] = r
+	} else {
+		delete(f.redirections, r.String())
+	}
+
 	return nil
 }
 
@@ -0,0 +1,226 @@
+package firewall
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/bettercap/bettercap/core"
+)
+
+// iptablesBackend shells out to iptables and ip6tables, it is used when
+// the kernel does not support nftables.
+//
+// Every redirection gets its own chain, jumped to from PREROUTING, where
+// the exclusions return early and each combination of sources and
+// destinations has its own rule.
+type iptablesBackend struct {
+	// binary -> FORWARD policy before we changed it
+	policies map[string]string
+}
+
+func newIptablesBackend() *iptablesBackend {
+	return &iptablesBackend{
+		policies: make(map[string]string),
+	}
+}
+
+func (b *iptablesBackend) Name() string {
+	return "iptables"
+}
+
+func (b *iptablesBackend) binary(r *Redirection) string {
+	if r.IsIPv6() {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+func (b *iptablesBackend) table(r *Redirection) string {
+	if r.IsTProxy() {
+		return "mangle"
+	}
+	return "nat"
+}
+
+func (b *iptablesBackend) chain(r *Redirection) string {
+	h := fnv.New32a()
+	h.Write([]byte(r.String()))
+	return fmt.Sprintf("BETTERCAP-%08x", h.Sum32())
+}
+
+func (b *iptablesBackend) jump(r *Redirection, action string) []string {
+	ports := fmt.Sprintf("%d", r.SrcPort)
+	if first, last := r.Ports(); first != last {
+		ports = fmt.Sprintf("%d:%d", first, last)
+	}
+
+	return []string{
+		"-t", b.table(r),
+		action, "PREROUTING",
+		"-i", r.Interface,
+		"-p", r.Protocol,
+		"--dport", ports,
+		"-j", b.chain(r),
+	}
+}
+
+func (b *iptablesBackend) target(r *Redirection) []string {
+	if r.IsTProxy() {
+		return []string{
+			"-j", "TPROXY",
+			"--on-ip", r.DstAddress,
+			"--on-port", fmt.Sprintf("%d", r.DstPort),
+			"--tproxy-mark", fmt.Sprintf("0x%x/0x%x", r.Mark, r.Mark),
+		}
+	}
+
+	to := fmt.Sprintf("%s:%d", r.DstAddress, r.DstPort)
+	if r.IsIPv6() {
+		to = fmt.Sprintf("[%s]:%d", r.DstAddress, r.DstPort)
+	}
+	return []string{"-j", "DNAT", "--to", to}
+}
+
+// getCommandLines returns the arguments needed to create the chain of the
+// redirection and to jump to it.
+func (b *iptablesBackend) getCommandLines(r *Redirection) [][]string {
+	table, chain := b.table(r), b.chain(r)
+	cmds := [][]string{
+		{"-t", table, "-N", chain},
+	}
+
+	for _, addr := range r.ExcludeSources {
+		cmds = append(cmds, []string{"-t", table, "-A", chain, "-s", addr, "-j", "RETURN"})
+	}
+	for _, addr := range r.ExcludeDestinations {
+		cmds = append(cmds, []string{"-t", table, "-A", chain, "-d", addr, "-j", "RETURN"})
+	}
+
+	sources, destinations := r.Sources, r.DestinationFilter()
+	// no filter means any address
+	if len(sources) == 0 {
+		sources = []string{""}
+	}
+	if len(destinations) == 0 {
+		destinations = []string{""}
+	}
+
+	for _, src := range sources {
+		for _, dst := range destinations {
+			// DNAT and TPROXY need the protocol to be matched by the same rule
+			match := []string{"-t", table, "-A", chain, "-p", r.Protocol}
+			if src != "" {
+				match = append(match, "-s", src)
+			}
+			if dst != "" {
+				match = append(match, "-d", dst)
+			}
+
+			rule := func(target ...string) []string {
+				return append(append([]string{}, match...), target...)
+			}
+
+			// tproxy marks the packets by itself
+			if r.Mark != 0 && !r.IsTProxy() {
+				cmds = append(cmds, rule("-j", "MARK", "--set-mark", fmt.Sprintf("0x%x", r.Mark)))
+			}
+			cmds = append(cmds, rule(b.target(r)...))
+		}
+	}
+
+	return append(cmds, b.jump(r, "-A"))
+}
+
+// parseForwardPolicy returns the policy from the output of 'iptables -S FORWARD'.
+func parseForwardPolicy(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "-P" && fields[1] == "FORWARD" {
+			return fields[2]
+		}
+	}
+	return ""
+}
+
+// acceptForward sets the FORWARD policy to ACCEPT, the previous one is only
+// read the first time and put back by restoreForward.
+func (b *iptablesBackend) acceptForward(r *Redirection) error {
+	bin := b.binary(r)
+	if _, saved := b.policies[bin]; saved {
+		return nil
+	}
+
+	out, err := core.Exec(bin, []string{"-S", "FORWARD"})
+	if err != nil {
+		return err
+	}
+
+	policy := parseForwardPolicy(out)
+	if policy == "" {
+		return fmt.Errorf("could not read the %s FORWARD policy", bin)
+	} else if policy != "ACCEPT" {
+		if _, err := core.Exec(bin, []string{"-P", "FORWARD", "ACCEPT"}); err != nil {
+			return err
+		}
+	}
+
+	b.policies[bin] = policy
+	return nil
+}
+
+// restoreForward puts back the FORWARD policies changed by acceptForward.
+func (b *iptablesBackend) restoreForward() error {
+	var firstErr error
+	for bin, policy := range b.policies {
+		if policy == "ACCEPT" {
+			continue
+		} else if _, err := core.Exec(bin, []string{"-P", "FORWARD", policy}); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error while restoring the %s FORWARD policy: %v", bin, err)
+		}
+	}
+	b.policies = make(map[string]string)
+	return firstErr
+}
+
+func (b *iptablesBackend) Add(r *Redirection, active []*Redirection) error {
+	bin := b.binary(r)
+	if err := b.acceptForward(r); err != nil {
+		return err
+	}
+
+	for _, cmdLine := range b.getCommandLines(r) {
+		if _, err := core.Exec(bin, cmdLine); err != nil {
+			// remove what has been created so far
+			b.Del(r, active)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *iptablesBackend) Del(r *Redirection, active []*Redirection) error {
+	bin, table, chain := b.binary(r), b.table(r), b.chain(r)
+	cmdLines := [][]string{
+		b.jump(r, "-D"),
+		{"-t", table, "-F", chain},
+		{"-t", table, "-X", chain},
+	}
+
+	var firstErr error
+	for _, cmdLine := range cmdLines {
+		if _, err := core.Exec(bin, cmdLine); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (b *iptablesBackend) Flush(active []*Redirection) error {
+	for _, r := range active {
+		if err := b.Del(r, nil); err != nil {
+			fmt.Printf("%s\n", err)
+		}
+	}
+	return b.restoreForward()
+}
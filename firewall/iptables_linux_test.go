@@ -0,0 +1,159 @@
+package firewall
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIptablesCommandLines(t *testing.T) {
+	b := newIptablesBackend()
+
+	tests := []struct {
+		name   string
+		edit   func(r *Redirection)
+		binary string
+		cmds   []string
+	}{
+		{"simple", func(r *Redirection) {}, "iptables", []string{
+			"-t nat -N CHAIN",
+			"-t nat -A CHAIN -p TCP -j DNAT --to 192.168.1.2:8080",
+			"-t nat -A PREROUTING -i eth0 -p TCP --dport 80 -j CHAIN",
+		}},
+		{"port range and address", func(r *Redirection) { r.SrcPortEnd = 90; r.SrcAddress = "10.0.0.1" }, "iptables", []string{
+			"-t nat -N CHAIN",
+			"-t nat -A CHAIN -p TCP -d 10.0.0.1 -j DNAT --to 192.168.1.2:8080",
+			"-t nat -A PREROUTING -i eth0 -p TCP --dport 80:90 -j CHAIN",
+		}},
+		{"filters", func(r *Redirection) {
+			r.Sources = []string{"10.0.0.1", "10.0.0.2"}
+			r.Destinations = []string{"1.1.1.0/24"}
+			r.ExcludeSources = []string{"10.0.0.3"}
+			r.ExcludeDestinations = []string{"1.1.1.1"}
+		}, "iptables", []string{
+			"-t nat -N CHAIN",
+			"-t nat -A CHAIN -s 10.0.0.3 -j RETURN",
+			"-t nat -A CHAIN -d 1.1.1.1 -j RETURN",
+			"-t nat -A CHAIN -p TCP -s 10.0.0.1 -d 1.1.1.0/24 -j DNAT --to 192.168.1.2:8080",
+			"-t nat -A CHAIN -p TCP -s 10.0.0.2 -d 1.1.1.0/24 -j DNAT --to 192.168.1.2:8080",
+			"-t nat -A PREROUTING -i eth0 -p TCP --dport 80 -j CHAIN",
+		}},
+		{"dnat with mark", func(r *Redirection) { r.Mark = 0x10 }, "iptables", []string{
+			"-t nat -N CHAIN",
+			"-t nat -A CHAIN -p TCP -j MARK --set-mark 0x10",
+			"-t nat -A CHAIN -p TCP -j DNAT --to 192.168.1.2:8080",
+			"-t nat -A PREROUTING -i eth0 -p TCP --dport 80 -j CHAIN",
+		}},
+		{"tproxy", func(r *Redirection) { r.Mode = RedirectionTProxy; r.Mark = 1 }, "iptables", []string{
+			"-t mangle -N CHAIN",
+			"-t mangle -A CHAIN -p TCP -j TPROXY --on-ip 192.168.1.2 --on-port 8080 --tproxy-mark 0x1/0x1",
+			"-t mangle -A PREROUTING -i eth0 -p TCP --dport 80 -j CHAIN",
+		}},
+		{"ipv6", func(r *Redirection) { r.DstAddress = "fe80::1"; r.ExcludeSources = []string{"fe80::2"} }, "ip6tables", []string{
+			"-t nat -N CHAIN",
+			"-t nat -A CHAIN -s fe80::2 -j RETURN",
+			"-t nat -A CHAIN -p TCP -j DNAT --to [fe80::1]:8080",
+			"-t nat -A PREROUTING -i eth0 -p TCP --dport 80 -j CHAIN",
+		}},
+	}
+
+	for _, tt := range tests {
+		r := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+		tt.edit(r)
+
+		chain := b.chain(r)
+		if !strings.HasPrefix(chain, "BETTERCAP-") || len(chain) > 28 {
+			t.Errorf("%s: invalid chain name %s", tt.name, chain)
+		} else if bin := b.binary(r); bin != tt.binary {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.binary, bin)
+		}
+
+		cmds := b.getCommandLines(r)
+		if len(cmds) != len(tt.cmds) {
+			t.Errorf("%s: expected %d commands, got %d: %v", tt.name, len(tt.cmds), len(cmds), cmds)
+			continue
+		}
+		for i, cmd := range cmds {
+			want := strings.Replace(tt.cmds[i], "CHAIN", chain, -1)
+			if got := strings.Join(cmd, " "); got != want {
+				t.Errorf("%s: expected '%s', got '%s'", tt.name, want, got)
+			}
+		}
+	}
+
+	// every redirection has its own chain
+	a := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	c := NewRedirection("eth0", "TCP", 443, "192.168.1.2", 8080)
+	if b.chain(a) == b.chain(c) {
+		t.Fatalf("expected different chains for %s and %s", a, c)
+	} else if b.chain(a) != b.chain(NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)) {
+		t.Fatalf("expected the chain name to be stable")
+	}
+}
+
+func TestParseForwardPolicy(t *testing.T) {
+	tests := []struct {
+		out    string
+		policy string
+	}{
+		{"-P FORWARD DROP", "DROP"},
+		{"-P FORWARD ACCEPT\n-A FORWARD -j DOCKER-USER", "ACCEPT"},
+		{"-A FORWARD -j DOCKER-USER\n-P FORWARD DROP", "DROP"},
+		{"-P INPUT DROP", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseForwardPolicy(tt.out); got != tt.policy {
+			t.Errorf("%q: expected '%s', got '%s'", tt.out, tt.policy, got)
+		}
+	}
+}
+
+func TestIptablesForwardPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-iptables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a fake iptables logging its arguments, with a DROP policy
+	log := filepath.Join(dir, "log")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n[ \"$1\" = \"-S\" ] && echo '-P FORWARD DROP'\nexit 0\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "iptables"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	defer os.Setenv("PATH", path)
+
+	b := newIptablesBackend()
+	r := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	for i := 0; i < 2; i++ {
+		if err = b.acceptForward(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = b.restoreForward(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-S FORWARD\n-P FORWARD ACCEPT\n-P FORWARD DROP\n"
+	if string(raw) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, raw)
+	}
+
+	// nothing to put back anymore
+	if err = b.restoreForward(); err != nil {
+		t.Fatal(err)
+	} else if raw, _ = ioutil.ReadFile(log); strings.Count(string(raw), "\n") != 3 {
+		t.Fatalf("unexpected commands:\n%s", raw)
+	}
+}
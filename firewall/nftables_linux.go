@@ -0,0 +1,620 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/bettercap/bettercap/core"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	nftTable       = "bettercap"
+	nftPrerouting  = "prerouting"
+	nftPostrouting = "postrouting"
+	nftMangle      = "mangle"
+	// same priorities as the dstnat, srcnat and mangle hooks of nft
+	nftPreroutingPriority  = -100
+	nftPostroutingPriority = 100
+	nftManglePriority      = -150
+
+	// not defined by x/sys
+	nftaTProxyFamily  = 1
+	nftaTProxyRegAddr = 2
+	nftaTProxyRegPort = 3
+
+	nfAccept       = 1
+	sizeofNfgenmsg = 4
+	ifNameSize     = 16
+	netlinkTimeout = 5 * time.Second
+)
+
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+func nlAlign(size int) int {
+	return (size + unix.NLA_ALIGNTO - 1) & ^(unix.NLA_ALIGNTO - 1)
+}
+
+func nlAttr(typ uint16, data []byte) []byte {
+	size := unix.SizeofNlAttr + len(data)
+	attr := make([]byte, nlAlign(size))
+	nativeEndian.PutUint16(attr[0:], uint16(size))
+	nativeEndian.PutUint16(attr[2:], typ)
+	copy(attr[unix.SizeofNlAttr:], data)
+	return attr
+}
+
+func nlNested(typ uint16, attrs ...[]byte) []byte {
+	data := make([]byte, 0)
+	for _, attr := range attrs {
+		data = append(data, attr...)
+	}
+	return nlAttr(typ|unix.NLA_F_NESTED, data)
+}
+
+// nlParse returns the attributes by type, nested ones without their flag.
+func nlParse(raw []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(raw) >= unix.SizeofNlAttr {
+		size := int(nativeEndian.Uint16(raw[0:]))
+		if size < unix.SizeofNlAttr || size > len(raw) {
+			break
+		}
+		attrs[nativeEndian.Uint16(raw[2:])&^(unix.NLA_F_NESTED|unix.NLA_F_NET_BYTEORDER)] = raw[unix.SizeofNlAttr:size]
+		if aligned := nlAlign(size); aligned < len(raw) {
+			raw = raw[aligned:]
+		} else {
+			break
+		}
+	}
+	return attrs
+}
+
+func nlString(typ uint16, s string) []byte {
+	return nlAttr(typ, append([]byte(s), 0))
+}
+
+// nftables expects integers in network byte order
+func nlU32(typ uint16, v uint32) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, v)
+	return nlAttr(typ, data)
+}
+
+func nftExpr(name string, attrs ...[]byte) []byte {
+	return nlNested(unix.NFTA_LIST_ELEM,
+		nlString(unix.NFTA_EXPR_NAME, name),
+		nlNested(unix.NFTA_EXPR_DATA, attrs...))
+}
+
+func nftMeta(key uint32, reg uint32) []byte {
+	return nftExpr("meta",
+		nlU32(unix.NFTA_META_DREG, reg),
+		nlU32(unix.NFTA_META_KEY, key))
+}
+
+func nftSetMeta(key uint32, reg uint32) []byte {
+	return nftExpr("meta",
+		nlU32(unix.NFTA_META_SREG, reg),
+		nlU32(unix.NFTA_META_KEY, key))
+}
+
+func nftPayload(base uint32, offset uint32, size uint32, reg uint32) []byte {
+	return nftExpr("payload",
+		nlU32(unix.NFTA_PAYLOAD_DREG, reg),
+		nlU32(unix.NFTA_PAYLOAD_BASE, base),
+		nlU32(unix.NFTA_PAYLOAD_OFFSET, offset),
+		nlU32(unix.NFTA_PAYLOAD_LEN, size))
+}
+
+func nftCmp(reg uint32, op uint32, data []byte) []byte {
+	return nftExpr("cmp",
+		nlU32(unix.NFTA_CMP_SREG, reg),
+		nlU32(unix.NFTA_CMP_OP, op),
+		nlNested(unix.NFTA_CMP_DATA, nlAttr(unix.NFTA_DATA_VALUE, data)))
+}
+
+func nftBitwise(reg uint32, mask []byte) []byte {
+	return nftExpr("bitwise",
+		nlU32(unix.NFTA_BITWISE_SREG, reg),
+		nlU32(unix.NFTA_BITWISE_DREG, reg),
+		nlU32(unix.NFTA_BITWISE_LEN, uint32(len(mask))),
+		nlNested(unix.NFTA_BITWISE_MASK, nlAttr(unix.NFTA_DATA_VALUE, mask)),
+		nlNested(unix.NFTA_BITWISE_XOR, nlAttr(unix.NFTA_DATA_VALUE, make([]byte, len(mask)))))
+}
+
+func nftImmediate(reg uint32, data []byte) []byte {
+	return nftExpr("immediate",
+		nlU32(unix.NFTA_IMMEDIATE_DREG, reg),
+		nlNested(unix.NFTA_IMMEDIATE_DATA, nlAttr(unix.NFTA_DATA_VALUE, data)))
+}
+
+func nftDNAT(family uint32, addrReg uint32, portReg uint32) []byte {
+	return nftExpr("nat",
+		nlU32(unix.NFTA_NAT_TYPE, unix.NFT_NAT_DNAT),
+		nlU32(unix.NFTA_NAT_FAMILY, family),
+		nlU32(unix.NFTA_NAT_REG_ADDR_MIN, addrReg),
+		nlU32(unix.NFTA_NAT_REG_PROTO_MIN, portReg))
+}
+
+func nftTProxy(family uint32, addrReg uint32, portReg uint32) []byte {
+	return nftExpr("tproxy",
+		nlU32(nftaTProxyFamily, family),
+		nlU32(nftaTProxyRegAddr, addrReg),
+		nlU32(nftaTProxyRegPort, portReg))
+}
+
+// nftAddress compares the source or destination address at the given
+// offset of the network header with a network.
+func nftAddress(offset uint32, cidr *net.IPNet, op uint32) [][]byte {
+	exprs := [][]byte{
+		nftPayload(unix.NFT_PAYLOAD_NETWORK_HEADER, offset, uint32(len(cidr.IP)), unix.NFT_REG_1),
+	}
+	if ones, bits := cidr.Mask.Size(); ones < bits {
+		exprs = append(exprs, nftBitwise(unix.NFT_REG_1, cidr.Mask))
+	}
+	return append(exprs, nftCmp(unix.NFT_REG_1, op, cidr.IP))
+}
+
+func port16(port int) []byte {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, uint16(port))
+	return data
+}
+
+func parseAddresses(addrs []string) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, 0, len(addrs))
+	for _, addr := range addrs {
+		cidr, err := ParseAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// nftRules compiles the redirection to one rule for each combination of
+// its sources and destinations:
+//
+//	iifname IFACE meta l4proto PROTO [ip saddr SRC] [ip daddr DST]
+//	  [ip saddr != EXCLUDED ...] [ip daddr != EXCLUDED ...] th dport PORT[-END]
+//	  [meta mark set MARK] dnat|tproxy to ADDR:PORT
+//
+// and returns the family and the chain they belong to.
+func nftRules(r *Redirection) (err error, family uint8, chain string, rules [][]byte) {
+	if err = r.Validate(); err != nil {
+		return
+	} else if len(r.Interface) >= ifNameSize {
+		return fmt.Errorf("invalid interface name '%s'", r.Interface), 0, "", nil
+	}
+
+	proto := byte(unix.IPPROTO_TCP)
+	if strings.ToLower(r.Protocol) == "udp" {
+		proto = unix.IPPROTO_UDP
+	}
+
+	to := net.ParseIP(r.DstAddress)
+	family, saddrOffset, daddrOffset := uint8(unix.NFPROTO_IPV4), uint32(12), uint32(16)
+	if r.IsIPv6() {
+		family, saddrOffset, daddrOffset = unix.NFPROTO_IPV6, 8, 24
+	} else {
+		to = to.To4()
+	}
+
+	var sources, destinations, excludeSources, excludeDestinations []*net.IPNet
+	if sources, err = parseAddresses(r.Sources); err != nil {
+		return
+	} else if destinations, err = parseAddresses(r.DestinationFilter()); err != nil {
+		return
+	} else if excludeSources, err = parseAddresses(r.ExcludeSources); err != nil {
+		return
+	} else if excludeDestinations, err = parseAddresses(r.ExcludeDestinations); err != nil {
+		return
+	}
+
+	// no filter means any address
+	if len(sources) == 0 {
+		sources = []*net.IPNet{nil}
+	}
+	if len(destinations) == 0 {
+		destinations = []*net.IPNet{nil}
+	}
+
+	iface := make([]byte, ifNameSize)
+	copy(iface, r.Interface)
+
+	for _, src := range sources {
+		for _, dst := range destinations {
+			exprs := [][]byte{
+				nftMeta(unix.NFT_META_IIFNAME, unix.NFT_REG_1),
+				nftCmp(unix.NFT_REG_1, unix.NFT_CMP_EQ, iface),
+				nftMeta(unix.NFT_META_L4PROTO, unix.NFT_REG_1),
+				nftCmp(unix.NFT_REG_1, unix.NFT_CMP_EQ, []byte{proto}),
+			}
+
+			if src != nil {
+				exprs = append(exprs, nftAddress(saddrOffset, src, unix.NFT_CMP_EQ)...)
+			}
+			if dst != nil {
+				exprs = append(exprs, nftAddress(daddrOffset, dst, unix.NFT_CMP_EQ)...)
+			}
+			for _, excluded := range excludeSources {
+				exprs = append(exprs, nftAddress(saddrOffset, excluded, unix.NFT_CMP_NEQ)...)
+			}
+			for _, excluded := range excludeDestinations {
+				exprs = append(exprs, nftAddress(daddrOffset, excluded, unix.NFT_CMP_NEQ)...)
+			}
+
+			// the destination port is at the same offset for TCP and UDP
+			exprs = append(exprs, nftPayload(unix.NFT_PAYLOAD_TRANSPORT_HEADER, 2, 2, unix.NFT_REG_1))
+			if first, last := r.Ports(); first == last {
+				exprs = append(exprs, nftCmp(unix.NFT_REG_1, unix.NFT_CMP_EQ, port16(first)))
+			} else {
+				exprs = append(exprs,
+					nftCmp(unix.NFT_REG_1, unix.NFT_CMP_GTE, port16(first)),
+					nftCmp(unix.NFT_REG_1, unix.NFT_CMP_LTE, port16(last)))
+			}
+
+			if r.Mark != 0 {
+				// marks are in host byte order
+				mark := make([]byte, 4)
+				nativeEndian.PutUint32(mark, r.Mark)
+				exprs = append(exprs,
+					nftImmediate(unix.NFT_REG_1, mark),
+					nftSetMeta(unix.NFT_META_MARK, unix.NFT_REG_1))
+			}
+
+			exprs = append(exprs,
+				nftImmediate(unix.NFT_REG_1, to),
+				nftImmediate(unix.NFT_REG_2, port16(r.DstPort)))
+
+			if r.IsTProxy() {
+				exprs = append(exprs, nftTProxy(uint32(family), unix.NFT_REG_1, unix.NFT_REG_2))
+			} else {
+				exprs = append(exprs, nftDNAT(uint32(family), unix.NFT_REG_1, unix.NFT_REG_2))
+			}
+
+			rules = append(rules, nlNested(unix.NFTA_RULE_EXPRESSIONS, exprs...))
+		}
+	}
+
+	chain = nftPrerouting
+	if r.IsTProxy() {
+		chain = nftMangle
+	}
+
+	return nil, family, chain, rules
+}
+
+// nftMessages is a sequence of nfnetlink messages sent at once, when
+// enclosed in a batch the kernel applies them as a single transaction.
+type nftMessages struct {
+	seq  uint32
+	raw  []byte
+	acks int
+}
+
+func newNftMessages() *nftMessages {
+	return &nftMessages{
+		seq: uint32(time.Now().Unix()),
+		raw: make([]byte, 0),
+	}
+}
+
+func (m *nftMessages) message(typ uint16, family uint8, flags uint16, resID uint16, attrs ...[]byte) {
+	data := make([]byte, 0)
+	for _, attr := range attrs {
+		data = append(data, attr...)
+	}
+
+	size := unix.NLMSG_HDRLEN + sizeofNfgenmsg + len(data)
+	msg := make([]byte, unix.NLMSG_HDRLEN+sizeofNfgenmsg, size)
+
+	m.seq++
+	nativeEndian.PutUint32(msg[0:], uint32(size))
+	nativeEndian.PutUint16(msg[4:], typ)
+	nativeEndian.PutUint16(msg[6:], flags)
+	nativeEndian.PutUint32(msg[8:], m.seq)
+	msg[unix.NLMSG_HDRLEN] = family
+	msg[unix.NLMSG_HDRLEN+1] = unix.NFNETLINK_V0
+	binary.BigEndian.PutUint16(msg[unix.NLMSG_HDRLEN+2:], resID)
+
+	m.raw = append(m.raw, append(msg, data...)...)
+	if flags&unix.NLM_F_ACK != 0 {
+		m.acks++
+	}
+}
+
+func (m *nftMessages) begin() {
+	m.message(unix.NFNL_MSG_BATCH_BEGIN, unix.AF_UNSPEC, unix.NLM_F_REQUEST, unix.NFNL_SUBSYS_NFTABLES)
+}
+
+func (m *nftMessages) end() {
+	m.message(unix.NFNL_MSG_BATCH_END, unix.AF_UNSPEC, unix.NLM_F_REQUEST, unix.NFNL_SUBSYS_NFTABLES)
+}
+
+func (m *nftMessages) add(msg uint16, family uint8, flags uint16, attrs ...[]byte) {
+	m.message(unix.NFNL_SUBSYS_NFTABLES<<8|msg, family, unix.NLM_F_REQUEST|unix.NLM_F_ACK|flags, 0, attrs...)
+}
+
+// send writes the messages to the kernel and waits for all of them to be
+// acknowledged, returning the first error.
+func (m *nftMessages) send() error {
+	_, err := m.exchange()
+	return err
+}
+
+// exchange is like send but also returns the replies which are not acks.
+func (m *nftMessages) exchange() ([]syscall.NetlinkMessage, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	kernel := &unix.SockaddrNetlink{Family: unix.AF_NETLINK}
+	timeout := unix.NsecToTimeval(netlinkTimeout.Nanoseconds())
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	} else if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		return nil, err
+	} else if err = unix.Sendto(fd, m.raw, 0, kernel); err != nil {
+		return nil, err
+	}
+
+	received := make([]syscall.NetlinkMessage, 0)
+	buf := make([]byte, os.Getpagesize()*8)
+	for pending := m.acks; pending > 0; {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err == unix.EAGAIN {
+			return nil, fmt.Errorf("timeout while waiting for netlink replies")
+		} else if err != nil {
+			return nil, err
+		}
+
+		replies, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, reply := range replies {
+			if reply.Header.Type != unix.NLMSG_ERROR {
+				received = append(received, reply)
+				continue
+			} else if len(reply.Data) < 4 {
+				return nil, fmt.Errorf("short netlink error message")
+			} else if code := int32(nativeEndian.Uint32(reply.Data)); code != 0 {
+				return nil, syscall.Errno(-code)
+			}
+			pending--
+		}
+	}
+
+	return received, nil
+}
+
+// probeNftables checks that nf_tables is available and that we are allowed
+// to talk to it, without changing anything.
+func probeNftables() error {
+	m := newNftMessages()
+	m.add(unix.NFT_MSG_GETGEN, unix.AF_UNSPEC, 0)
+	return m.send()
+}
+
+// nftablesBackend keeps the redirections in a dedicated bettercap table for
+// each family, which is rebuilt or removed atomically on every change.
+//
+// Accepting the forwarded packets in our own table is not enough, as they
+// would still be dropped by the FORWARD policy of the iptables ones, so
+// that policy is changed and the previous one put back on Flush.
+type nftablesBackend struct {
+	// family -> FORWARD policy of the iptables-nft filter table
+	policies map[uint8]uint32
+	// for the FORWARD policy of iptables-legacy
+	legacy *iptablesBackend
+}
+
+func newNftablesBackend() *nftablesBackend {
+	return &nftablesBackend{
+		policies: make(map[uint8]uint32),
+		legacy:   newIptablesBackend(),
+	}
+}
+
+func (b *nftablesBackend) Name() string {
+	return "nftables"
+}
+
+// batch returns the transaction replacing the bettercap tables with the
+// ones needed by the active redirections.
+func (b *nftablesBackend) batch(active []*Redirection) (error, *nftMessages) {
+	// family -> chain -> rules
+	rules := make(map[uint8]map[string][][]byte)
+	for _, r := range active {
+		err, family, chain, compiled := nftRules(r)
+		if err != nil {
+			return err, nil
+		} else if _, found := rules[family]; !found {
+			rules[family] = make(map[string][][]byte)
+		}
+		rules[family][chain] = append(rules[family][chain], compiled...)
+	}
+
+	table := nlString(unix.NFTA_TABLE_NAME, nftTable)
+	chain := func(name string, kind string, hook uint32, priority int32) [][]byte {
+		return [][]byte{
+			nlString(unix.NFTA_CHAIN_TABLE, nftTable),
+			nlString(unix.NFTA_CHAIN_NAME, name),
+			nlNested(unix.NFTA_CHAIN_HOOK,
+				nlU32(unix.NFTA_HOOK_HOOKNUM, hook),
+				nlU32(unix.NFTA_HOOK_PRIORITY, uint32(priority))),
+			nlString(unix.NFTA_CHAIN_TYPE, kind),
+		}
+	}
+
+	m := newNftMessages()
+	m.begin()
+	for _, family := range []uint8{unix.NFPROTO_IPV4, unix.NFPROTO_IPV6} {
+		// creating the table first makes deleting it never fail
+		m.add(unix.NFT_MSG_NEWTABLE, family, unix.NLM_F_CREATE, table)
+		m.add(unix.NFT_MSG_DELTABLE, family, 0, table)
+
+		chains, found := rules[family]
+		if !found {
+			continue
+		}
+
+		m.add(unix.NFT_MSG_NEWTABLE, family, unix.NLM_F_CREATE, table)
+		if _, found := chains[nftPrerouting]; found {
+			m.add(unix.NFT_MSG_NEWCHAIN, family, unix.NLM_F_CREATE, chain(nftPrerouting, "nat", unix.NF_INET_PRE_ROUTING, nftPreroutingPriority)...)
+			// older kernels only perform NAT if both chains are registered
+			m.add(unix.NFT_MSG_NEWCHAIN, family, unix.NLM_F_CREATE, chain(nftPostrouting, "nat", unix.NF_INET_POST_ROUTING, nftPostroutingPriority)...)
+		}
+		if _, found := chains[nftMangle]; found {
+			m.add(unix.NFT_MSG_NEWCHAIN, family, unix.NLM_F_CREATE, chain(nftMangle, "filter", unix.NF_INET_PRE_ROUTING, nftManglePriority)...)
+		}
+
+		for _, name := range []string{nftPrerouting, nftMangle} {
+			for _, exprs := range chains[name] {
+				m.add(unix.NFT_MSG_NEWRULE, family, unix.NLM_F_CREATE|unix.NLM_F_APPEND,
+					nlString(unix.NFTA_RULE_TABLE, nftTable),
+					nlString(unix.NFTA_RULE_CHAIN, name),
+					exprs)
+			}
+		}
+	}
+	m.end()
+
+	return nil, m
+}
+
+func (b *nftablesBackend) sync(active []*Redirection) error {
+	err, m := b.batch(active)
+	if err != nil {
+		return err
+	}
+	return m.send()
+}
+
+// nftChainPolicy returns the policy of a chain, it fails if there's none.
+func nftChainPolicy(family uint8, table string, chain string) (uint32, error) {
+	m := newNftMessages()
+	m.add(unix.NFT_MSG_GETCHAIN, family, 0,
+		nlString(unix.NFTA_CHAIN_TABLE, table),
+		nlString(unix.NFTA_CHAIN_NAME, chain))
+
+	replies, err := m.exchange()
+	if err != nil {
+		return 0, err
+	}
+	return nftParsePolicy(replies)
+}
+
+func nftParsePolicy(replies []syscall.NetlinkMessage) (uint32, error) {
+	for _, reply := range replies {
+		if reply.Header.Type != unix.NFNL_SUBSYS_NFTABLES<<8|unix.NFT_MSG_NEWCHAIN || len(reply.Data) < sizeofNfgenmsg {
+			continue
+		} else if policy, found := nlParse(reply.Data[sizeofNfgenmsg:])[unix.NFTA_CHAIN_POLICY]; found && len(policy) == 4 {
+			return binary.BigEndian.Uint32(policy), nil
+		}
+	}
+	return 0, fmt.Errorf("chain policy not found")
+}
+
+func nftSetChainPolicy(family uint8, table string, chain string, policy uint32) error {
+	m := newNftMessages()
+	m.begin()
+	m.add(unix.NFT_MSG_NEWCHAIN, family, 0,
+		nlString(unix.NFTA_CHAIN_TABLE, table),
+		nlString(unix.NFTA_CHAIN_NAME, chain),
+		nlU32(unix.NFTA_CHAIN_POLICY, policy))
+	m.end()
+	return m.send()
+}
+
+// acceptForward is the equivalent of 'iptables -P FORWARD ACCEPT' for the
+// FORWARD chain created by iptables-nft, it fails if there's none. The
+// previous policy is only read the first time.
+func (b *nftablesBackend) acceptForward(family uint8) error {
+	if _, saved := b.policies[family]; saved {
+		return nil
+	}
+
+	policy, err := nftChainPolicy(family, "filter", "FORWARD")
+	if err != nil {
+		return err
+	} else if policy != nfAccept {
+		if err = nftSetChainPolicy(family, "filter", "FORWARD", nfAccept); err != nil {
+			return err
+		}
+	}
+
+	b.policies[family] = policy
+	return nil
+}
+
+// restoreForward puts back the FORWARD policies changed by acceptForward.
+func (b *nftablesBackend) restoreForward() error {
+	var firstErr error
+	for family, policy := range b.policies {
+		if policy == nfAccept {
+			continue
+		} else if err := nftSetChainPolicy(family, "filter", "FORWARD", policy); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error while restoring the FORWARD policy: %v", err)
+		}
+	}
+	b.policies = make(map[uint8]uint32)
+
+	if err := b.legacy.restoreForward(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+func (b *nftablesBackend) Add(r *Redirection, active []*Redirection) error {
+	family := uint8(unix.NFPROTO_IPV4)
+	if r.IsIPv6() {
+		family = unix.NFPROTO_IPV6
+	}
+
+	if err := b.acceptForward(family); err == unix.ENOENT {
+		// no iptables-nft FORWARD chain, the policy might still be set by
+		// iptables-legacy (i.e. by docker) so it's changed there if possible
+		if bin := b.legacy.binary(r); core.HasBinary(bin) {
+			if err := b.legacy.acceptForward(r); err != nil {
+				return fmt.Errorf("error while setting the %s FORWARD policy: %v", bin, err)
+			}
+		}
+	} else if err != nil {
+		return fmt.Errorf("error while setting the FORWARD policy: %v", err)
+	}
+
+	return b.sync(active)
+}
+
+func (b *nftablesBackend) Del(r *Redirection, active []*Redirection) error {
+	return b.sync(active)
+}
+
+func (b *nftablesBackend) Flush(active []*Redirection) error {
+	err := b.sync(nil)
+	if perr := b.restoreForward(); err == nil {
+		err = perr
+	}
+	return err
+}
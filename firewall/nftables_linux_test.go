@@ -0,0 +1,439 @@
+package firewall
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func nlTestHeader(size int, typ uint16) []byte {
+	hdr := make([]byte, unix.SizeofNlAttr)
+	nativeEndian.PutUint16(hdr[0:], uint16(size))
+	nativeEndian.PutUint16(hdr[2:], typ)
+	return hdr
+}
+
+func nlTestJoin(parts ...[]byte) []byte {
+	raw := make([]byte, 0)
+	for _, part := range parts {
+		raw = append(raw, part...)
+	}
+	return raw
+}
+
+type nlTestAttr struct {
+	typ  uint16
+	data []byte
+}
+
+func nlTestParse(t *testing.T, raw []byte) []nlTestAttr {
+	attrs := make([]nlTestAttr, 0)
+	for len(raw) > 0 {
+		if len(raw) < unix.SizeofNlAttr {
+			t.Fatalf("truncated attribute header %x", raw)
+		}
+		size := int(nativeEndian.Uint16(raw[0:]))
+		if size < unix.SizeofNlAttr || size > len(raw) {
+			t.Fatalf("invalid attribute size %d in %x", size, raw)
+		}
+		attrs = append(attrs, nlTestAttr{
+			typ:  nativeEndian.Uint16(raw[2:]),
+			data: raw[unix.SizeofNlAttr:size],
+		})
+		if aligned := nlAlign(size); aligned < len(raw) {
+			raw = raw[aligned:]
+		} else {
+			raw = nil
+		}
+	}
+	return attrs
+}
+
+type nftTestExpr struct {
+	name  string
+	attrs []nlTestAttr
+}
+
+// nftTestExprs decodes the NFTA_RULE_EXPRESSIONS attribute of a rule.
+func nftTestExprs(t *testing.T, rule []byte) []nftTestExpr {
+	outer := nlTestParse(t, rule)
+	if len(outer) != 1 || outer[0].typ != unix.NFTA_RULE_EXPRESSIONS|unix.NLA_F_NESTED {
+		t.Fatalf("unexpected rule attributes %+v", outer)
+	}
+
+	exprs := make([]nftTestExpr, 0)
+	for _, elem := range nlTestParse(t, outer[0].data) {
+		if elem.typ != unix.NFTA_LIST_ELEM|unix.NLA_F_NESTED {
+			t.Fatalf("unexpected list element type %d", elem.typ)
+		}
+
+		expr := nftTestExpr{}
+		for _, attr := range nlTestParse(t, elem.data) {
+			switch attr.typ {
+			case unix.NFTA_EXPR_NAME:
+				expr.name = strings.TrimRight(string(attr.data), "\x00")
+			case unix.NFTA_EXPR_DATA | unix.NLA_F_NESTED:
+				expr.attrs = nlTestParse(t, attr.data)
+			default:
+				t.Fatalf("unexpected expression attribute %d", attr.typ)
+			}
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs
+}
+
+func nftTestNames(exprs []nftTestExpr) string {
+	names := make([]string, len(exprs))
+	for i, expr := range exprs {
+		names[i] = expr.name
+	}
+	return strings.Join(names, ",")
+}
+
+// nftTestValue returns the NFTA_DATA_VALUE nested in the given attribute.
+func nftTestValue(t *testing.T, expr nftTestExpr, typ uint16) []byte {
+	for _, attr := range expr.attrs {
+		if attr.typ == typ|unix.NLA_F_NESTED {
+			values := nlTestParse(t, attr.data)
+			if len(values) != 1 || values[0].typ != unix.NFTA_DATA_VALUE {
+				t.Fatalf("unexpected data attributes %+v", values)
+			}
+			return values[0].data
+		}
+	}
+	t.Fatalf("attribute %d not found in %s expression", typ, expr.name)
+	return nil
+}
+
+func TestNetlinkAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want []byte
+	}{
+		{"empty", nlAttr(3, nil), nlTestHeader(4, 3)},
+		{"padded", nlAttr(1, []byte{0xaa}), nlTestJoin(nlTestHeader(5, 1), []byte{0xaa, 0, 0, 0})},
+		{"aligned", nlAttr(2, []byte{1, 2, 3, 4}), nlTestJoin(nlTestHeader(8, 2), []byte{1, 2, 3, 4})},
+		{"string", nlString(1, "nat"), nlTestJoin(nlTestHeader(8, 1), []byte{'n', 'a', 't', 0})},
+		{"string padded", nlString(1, "bettercap"), nlTestJoin(nlTestHeader(14, 1), []byte("bettercap\x00\x00\x00"))},
+		{"u32 big endian", nlU32(2, 0x01020304), nlTestJoin(nlTestHeader(8, 2), []byte{1, 2, 3, 4})},
+		{"nested", nlNested(5, nlU32(1, 1), nlAttr(2, []byte{9})), nlTestJoin(
+			nlTestHeader(20, 5|unix.NLA_F_NESTED),
+			nlTestHeader(8, 1), []byte{0, 0, 0, 1},
+			nlTestHeader(5, 2), []byte{9, 0, 0, 0})},
+	}
+
+	for _, tt := range tests {
+		if !bytes.Equal(tt.got, tt.want) {
+			t.Errorf("%s: expected %x, got %x", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestNftExpressionLayout(t *testing.T) {
+	// cmp reg 1 == 0x06
+	want := nlTestJoin(
+		nlTestHeader(44, unix.NFTA_LIST_ELEM|unix.NLA_F_NESTED),
+		nlTestHeader(8, unix.NFTA_EXPR_NAME), []byte{'c', 'm', 'p', 0},
+		nlTestHeader(32, unix.NFTA_EXPR_DATA|unix.NLA_F_NESTED),
+		nlTestHeader(8, unix.NFTA_CMP_SREG), []byte{0, 0, 0, unix.NFT_REG_1},
+		nlTestHeader(8, unix.NFTA_CMP_OP), []byte{0, 0, 0, unix.NFT_CMP_EQ},
+		nlTestHeader(12, unix.NFTA_CMP_DATA|unix.NLA_F_NESTED),
+		nlTestHeader(5, unix.NFTA_DATA_VALUE), []byte{6, 0, 0, 0})
+
+	if got := nftCmp(unix.NFT_REG_1, unix.NFT_CMP_EQ, []byte{6}); !bytes.Equal(got, want) {
+		t.Fatalf("expected %x, got %x", want, got)
+	}
+
+	// payload load of the destination port
+	want = nlTestJoin(
+		nlTestHeader(52, unix.NFTA_LIST_ELEM|unix.NLA_F_NESTED),
+		nlTestHeader(12, unix.NFTA_EXPR_NAME), []byte{'p', 'a', 'y', 'l', 'o', 'a', 'd', 0},
+		nlTestHeader(36, unix.NFTA_EXPR_DATA|unix.NLA_F_NESTED),
+		nlTestHeader(8, unix.NFTA_PAYLOAD_DREG), []byte{0, 0, 0, unix.NFT_REG_1},
+		nlTestHeader(8, unix.NFTA_PAYLOAD_BASE), []byte{0, 0, 0, unix.NFT_PAYLOAD_TRANSPORT_HEADER},
+		nlTestHeader(8, unix.NFTA_PAYLOAD_OFFSET), []byte{0, 0, 0, 2},
+		nlTestHeader(8, unix.NFTA_PAYLOAD_LEN), []byte{0, 0, 0, 2})
+
+	if got := nftPayload(unix.NFT_PAYLOAD_TRANSPORT_HEADER, 2, 2, unix.NFT_REG_1); !bytes.Equal(got, want) {
+		t.Fatalf("expected %x, got %x", want, got)
+	}
+}
+
+func TestNftRules(t *testing.T) {
+	simple := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+
+	ranged := NewRedirection("eth0", "udp", 1000, "192.168.1.2", 5353)
+	ranged.SrcPortEnd = 2000
+	ranged.Mark = 0x10
+
+	filtered := NewRedirection("eth0", "TCP", 443, "192.168.1.2", 8083)
+	filtered.Sources = []string{"10.0.0.0/24", "10.0.1.1"}
+	filtered.ExcludeDestinations = []string{"192.168.1.1"}
+
+	tproxy := NewRedirection("wlan0", "TCP", 80, "fe80::1", 8080)
+	tproxy.Mode = RedirectionTProxy
+	tproxy.Mark = 1
+
+	tests := []struct {
+		name   string
+		r      *Redirection
+		family uint8
+		chain  string
+		rules  int
+		exprs  string
+	}{
+		{"simple", simple, unix.NFPROTO_IPV4, nftPrerouting, 1,
+			"meta,cmp,meta,cmp,payload,cmp,immediate,immediate,nat"},
+		{"range and mark", ranged, unix.NFPROTO_IPV4, nftPrerouting, 1,
+			"meta,cmp,meta,cmp,payload,cmp,cmp,immediate,meta,immediate,immediate,nat"},
+		{"filters", filtered, unix.NFPROTO_IPV4, nftPrerouting, 2,
+			"meta,cmp,meta,cmp,payload,bitwise,cmp,payload,cmp,payload,cmp,immediate,immediate,nat"},
+		{"tproxy", tproxy, unix.NFPROTO_IPV6, nftMangle, 1,
+			"meta,cmp,meta,cmp,payload,cmp,immediate,meta,immediate,immediate,tproxy"},
+	}
+
+	for _, tt := range tests {
+		err, family, chain, rules := nftRules(tt.r)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		} else if family != tt.family || chain != tt.chain || len(rules) != tt.rules {
+			t.Errorf("%s: unexpected family %d, chain %s or %d rules", tt.name, family, chain, len(rules))
+			continue
+		} else if names := nftTestNames(nftTestExprs(t, rules[0])); names != tt.exprs {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.exprs, names)
+		}
+	}
+
+	// check the values of the simple redirection
+	_, _, _, rules := nftRules(simple)
+	exprs := nftTestExprs(t, rules[0])
+
+	iface := make([]byte, ifNameSize)
+	copy(iface, "eth0")
+	if v := nftTestValue(t, exprs[1], unix.NFTA_CMP_DATA); !bytes.Equal(v, iface) {
+		t.Fatalf("unexpected interface %x", v)
+	} else if v := nftTestValue(t, exprs[3], unix.NFTA_CMP_DATA); !bytes.Equal(v, []byte{unix.IPPROTO_TCP}) {
+		t.Fatalf("unexpected protocol %x", v)
+	} else if v := nftTestValue(t, exprs[5], unix.NFTA_CMP_DATA); binary.BigEndian.Uint16(v) != 80 {
+		t.Fatalf("unexpected port %x", v)
+	} else if v := nftTestValue(t, exprs[6], unix.NFTA_IMMEDIATE_DATA); !bytes.Equal(v, []byte{192, 168, 1, 2}) {
+		t.Fatalf("unexpected address %x", v)
+	} else if v := nftTestValue(t, exprs[7], unix.NFTA_IMMEDIATE_DATA); binary.BigEndian.Uint16(v) != 8080 {
+		t.Fatalf("unexpected destination port %x", v)
+	}
+
+	// the range is matched with >= and <=, the mark in host byte order
+	_, _, _, rules = nftRules(ranged)
+	exprs = nftTestExprs(t, rules[0])
+	mark := make([]byte, 4)
+	nativeEndian.PutUint32(mark, 0x10)
+	if v := nftTestValue(t, exprs[5], unix.NFTA_CMP_DATA); binary.BigEndian.Uint16(v) != 1000 {
+		t.Fatalf("unexpected first port %x", v)
+	} else if v := nftTestValue(t, exprs[6], unix.NFTA_CMP_DATA); binary.BigEndian.Uint16(v) != 2000 {
+		t.Fatalf("unexpected last port %x", v)
+	} else if v := nftTestValue(t, exprs[7], unix.NFTA_IMMEDIATE_DATA); !bytes.Equal(v, mark) {
+		t.Fatalf("unexpected mark %x", v)
+	}
+
+	// the /24 source is masked, the excluded destination compared with !=
+	_, _, _, rules = nftRules(filtered)
+	exprs = nftTestExprs(t, rules[0])
+	if v := nftTestValue(t, exprs[5], unix.NFTA_BITWISE_MASK); !bytes.Equal(v, []byte{255, 255, 255, 0}) {
+		t.Fatalf("unexpected mask %x", v)
+	} else if v := nftTestValue(t, exprs[6], unix.NFTA_CMP_DATA); !bytes.Equal(v, []byte{10, 0, 0, 0}) {
+		t.Fatalf("unexpected source %x", v)
+	} else if v := nftTestValue(t, exprs[8], unix.NFTA_CMP_DATA); !bytes.Equal(v, []byte{192, 168, 1, 1}) {
+		t.Fatalf("unexpected excluded destination %x", v)
+	}
+
+	invalid := NewRedirection("an-interface-name-too-long", "TCP", 80, "192.168.1.2", 8080)
+	if err, _, _, _ := nftRules(invalid); err == nil {
+		t.Fatalf("expected an error for a too long interface name")
+	}
+	invalid = NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	invalid.Sources = []string{"fe80::1"}
+	if err, _, _, _ := nftRules(invalid); err == nil {
+		t.Fatalf("expected an error for mixed families")
+	}
+}
+
+type nftTestMessage struct {
+	typ    uint16
+	flags  uint16
+	seq    uint32
+	family uint8
+	resID  uint16
+	attrs  []byte
+}
+
+func nftTestMessages(t *testing.T, m *nftMessages) []nftTestMessage {
+	msgs := make([]nftTestMessage, 0)
+	for raw := m.raw; len(raw) > 0; {
+		size := int(nativeEndian.Uint32(raw[0:]))
+		if size < unix.NLMSG_HDRLEN+sizeofNfgenmsg || size > len(raw) {
+			t.Fatalf("invalid message size %d", size)
+		} else if raw[unix.NLMSG_HDRLEN+1] != unix.NFNETLINK_V0 {
+			t.Fatalf("unexpected nfnetlink version %d", raw[unix.NLMSG_HDRLEN+1])
+		}
+
+		msgs = append(msgs, nftTestMessage{
+			typ:    nativeEndian.Uint16(raw[4:]),
+			flags:  nativeEndian.Uint16(raw[6:]),
+			seq:    nativeEndian.Uint32(raw[8:]),
+			family: raw[unix.NLMSG_HDRLEN],
+			resID:  binary.BigEndian.Uint16(raw[unix.NLMSG_HDRLEN+2:]),
+			attrs:  raw[unix.NLMSG_HDRLEN+sizeofNfgenmsg : size],
+		})
+		raw = raw[size:]
+	}
+	return msgs
+}
+
+func TestNftMessages(t *testing.T) {
+	m := newNftMessages()
+	first := m.seq
+	m.begin()
+	m.add(unix.NFT_MSG_NEWTABLE, unix.NFPROTO_IPV4, unix.NLM_F_CREATE, nlString(unix.NFTA_TABLE_NAME, nftTable))
+	m.end()
+
+	msgs := nftTestMessages(t, m)
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(msgs))
+	} else if m.acks != 1 {
+		t.Fatalf("expected 1 ack, got %d", m.acks)
+	}
+
+	for i, msg := range msgs {
+		if msg.seq != first+uint32(i)+1 {
+			t.Fatalf("unexpected sequence number %d for message %d", msg.seq, i)
+		}
+	}
+
+	if b := msgs[0]; b.typ != unix.NFNL_MSG_BATCH_BEGIN || b.flags != unix.NLM_F_REQUEST || b.resID != unix.NFNL_SUBSYS_NFTABLES {
+		t.Fatalf("unexpected batch begin %+v", b)
+	} else if e := msgs[2]; e.typ != unix.NFNL_MSG_BATCH_END || e.flags != unix.NLM_F_REQUEST || e.resID != unix.NFNL_SUBSYS_NFTABLES {
+		t.Fatalf("unexpected batch end %+v", e)
+	}
+
+	msg := msgs[1]
+	if msg.typ != unix.NFNL_SUBSYS_NFTABLES<<8|unix.NFT_MSG_NEWTABLE {
+		t.Fatalf("unexpected message type 0x%x", msg.typ)
+	} else if msg.flags != unix.NLM_F_REQUEST|unix.NLM_F_ACK|unix.NLM_F_CREATE {
+		t.Fatalf("unexpected flags 0x%x", msg.flags)
+	} else if msg.family != unix.NFPROTO_IPV4 || msg.resID != 0 {
+		t.Fatalf("unexpected nfgenmsg %+v", msg)
+	} else if !bytes.Equal(msg.attrs, nlString(unix.NFTA_TABLE_NAME, nftTable)) {
+		t.Fatalf("unexpected attributes %x", msg.attrs)
+	}
+}
+
+func TestNftBatch(t *testing.T) {
+	newTable := unix.NFNL_SUBSYS_NFTABLES<<8 | unix.NFT_MSG_NEWTABLE
+	delTable := unix.NFNL_SUBSYS_NFTABLES<<8 | unix.NFT_MSG_DELTABLE
+	newChain := unix.NFNL_SUBSYS_NFTABLES<<8 | unix.NFT_MSG_NEWCHAIN
+	newRule := unix.NFNL_SUBSYS_NFTABLES<<8 | unix.NFT_MSG_NEWRULE
+
+	type step struct {
+		typ    int
+		family uint8
+	}
+	v4, v6 := uint8(unix.NFPROTO_IPV4), uint8(unix.NFPROTO_IPV6)
+
+	dnat := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	tproxy := NewRedirection("eth0", "TCP", 443, "fe80::1", 8083)
+	tproxy.Mode = RedirectionTProxy
+	tproxy.Mark = 1
+
+	tests := []struct {
+		name   string
+		active []*Redirection
+		steps  []step
+	}{
+		{"flush", nil, []step{
+			{unix.NFNL_MSG_BATCH_BEGIN, unix.AF_UNSPEC},
+			{newTable, v4}, {delTable, v4},
+			{newTable, v6}, {delTable, v6},
+			{unix.NFNL_MSG_BATCH_END, unix.AF_UNSPEC},
+		}},
+		{"dnat and tproxy", []*Redirection{dnat, tproxy}, []step{
+			{unix.NFNL_MSG_BATCH_BEGIN, unix.AF_UNSPEC},
+			{newTable, v4}, {delTable, v4},
+			{newTable, v4}, {newChain, v4}, {newChain, v4}, {newRule, v4},
+			{newTable, v6}, {delTable, v6},
+			{newTable, v6}, {newChain, v6}, {newRule, v6},
+			{unix.NFNL_MSG_BATCH_END, unix.AF_UNSPEC},
+		}},
+	}
+
+	b := &nftablesBackend{}
+	for _, tt := range tests {
+		err, m := b.batch(tt.active)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		msgs := nftTestMessages(t, m)
+		if len(msgs) != len(tt.steps) {
+			t.Fatalf("%s: expected %d messages, got %d", tt.name, len(tt.steps), len(msgs))
+		}
+		for i, s := range tt.steps {
+			if int(msgs[i].typ) != s.typ || msgs[i].family != s.family {
+				t.Fatalf("%s: message %d is 0x%x/%d, expected 0x%x/%d", tt.name, i, msgs[i].typ, msgs[i].family, s.typ, s.family)
+			}
+		}
+	}
+
+	invalid := NewRedirection("eth0", "ICMP", 80, "192.168.1.2", 8080)
+	if err, _ := b.batch([]*Redirection{dnat, invalid}); err == nil {
+		t.Fatalf("expected an error for an invalid redirection")
+	}
+}
+
+func TestNftParsePolicy(t *testing.T) {
+	chain := func(typ uint16, attrs ...[]byte) syscall.NetlinkMessage {
+		return syscall.NetlinkMessage{
+			Header: syscall.NlMsghdr{Type: typ},
+			Data:   nlTestJoin(append([][]byte{{unix.NFPROTO_IPV4, unix.NFNETLINK_V0, 0, 0}}, attrs...)...),
+		}
+	}
+	newChain := uint16(unix.NFNL_SUBSYS_NFTABLES<<8 | unix.NFT_MSG_NEWCHAIN)
+	hook := nlNested(unix.NFTA_CHAIN_HOOK, nlU32(unix.NFTA_HOOK_HOOKNUM, unix.NF_INET_FORWARD))
+
+	tests := []struct {
+		name    string
+		replies []syscall.NetlinkMessage
+		policy  uint32
+		found   bool
+	}{
+		{"drop", []syscall.NetlinkMessage{chain(newChain, nlString(unix.NFTA_CHAIN_NAME, "FORWARD"), hook, nlU32(unix.NFTA_CHAIN_POLICY, 0))}, 0, true},
+		{"accept", []syscall.NetlinkMessage{chain(newChain, nlU32(unix.NFTA_CHAIN_POLICY, nfAccept))}, nfAccept, true},
+		{"no policy", []syscall.NetlinkMessage{chain(newChain, nlString(unix.NFTA_CHAIN_NAME, "FORWARD"))}, 0, false},
+		{"other message", []syscall.NetlinkMessage{chain(unix.NFNL_SUBSYS_NFTABLES<<8|unix.NFT_MSG_NEWTABLE, nlU32(unix.NFTA_CHAIN_POLICY, 0))}, 0, false},
+		{"no replies", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		policy, err := nftParsePolicy(tt.replies)
+		if !tt.found {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		} else if policy != tt.policy {
+			t.Errorf("%s: expected policy %d, got %d", tt.name, tt.policy, policy)
+		}
+	}
+
+	// nested attributes are found by their type
+	if attrs := nlParse(hook); len(attrs) != 1 || attrs[unix.NFTA_CHAIN_HOOK] == nil {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+}
@@ -1,14 +1,41 @@
 package firewall
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	// the destination of the packets is rewritten to DstAddress:DstPort
+	RedirectionDNAT = "dnat"
+	// the packets are delivered to the socket listening on DstAddress:DstPort
+	// without being rewritten, so that the proxy can read the original destination
+	RedirectionTProxy = "tproxy"
+)
 
 type Redirection struct {
-	Interface  string
-	Protocol   string
+	Interface string
+	Protocol  string
+	// if set, only the packets sent to this address are redirected
 	SrcAddress string
 	SrcPort    int
+	// if greater than SrcPort, the whole SrcPort-SrcPortEnd range is redirected
+	SrcPortEnd int `json:",omitempty"`
 	DstAddress string
 	DstPort    int
+
+	// addresses or CIDRs the packets must be sent from or to, if any
+	Sources      []string `json:",omitempty"`
+	Destinations []string `json:",omitempty"`
+	// addresses or CIDRs that are never redirected
+	ExcludeSources      []string `json:",omitempty"`
+	ExcludeDestinations []string `json:",omitempty"`
+
+	Mode string `json:",omitempty"`
+	// if not zero the redirected packets are marked, required by tproxy
+	Mark uint32 `json:",omitempty"`
 }
 
 func NewRedirection(iface string, proto string, port_from int, addr_to string, port_to int) *Redirection {
@@ -22,6 +49,148 @@ func NewRedirection(iface string, proto string, port_from int, addr_to string, p
 	}
 }
 
+// sorted returns the redirections of a firewall sorted by key.
+func sorted(redirections map[string]*Redirection) []*Redirection {
+	list := make([]*Redirection, 0, len(redirections))
+	for _, r := range redirections {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+	return list
+}
+
+// ParseAddress parses an address or a CIDR, single addresses are converted
+// to a /32 or /128 network.
+func ParseAddress(addr string) (*net.IPNet, error) {
+	if strings.Contains(addr, "/") {
+		_, cidr, err := net.ParseCIDR(addr)
+		return cidr, err
+	} else if ip := net.ParseIP(addr); ip == nil {
+		return nil, fmt.Errorf("invalid address '%s'", addr)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	} else {
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+}
+
+// IsIPv6 returns true if the traffic is redirected to an IPv6 address.
+func (r Redirection) IsIPv6() bool {
+	ip := net.ParseIP(r.DstAddress)
+	return ip != nil && ip.To4() == nil
+}
+
+func (r Redirection) IsTProxy() bool {
+	return strings.ToLower(r.Mode) == RedirectionTProxy
+}
+
+// IsSimple returns true if the redirection only uses the fields supported
+// by every firewall.
+func (r Redirection) IsSimple() bool {
+	return r.SrcPortEnd <= r.SrcPort &&
+		len(r.Sources) == 0 &&
+		len(r.Destinations) == 0 &&
+		len(r.ExcludeSources) == 0 &&
+		len(r.ExcludeDestinations) == 0 &&
+		!r.IsTProxy() &&
+		r.Mark == 0
+}
+
+// Ports returns the first and last port to redirect.
+func (r Redirection) Ports() (int, int) {
+	if r.SrcPortEnd > r.SrcPort {
+		return r.SrcPort, r.SrcPortEnd
+	}
+	return r.SrcPort, r.SrcPort
+}
+
+// DestinationFilter returns the addresses the packets must be sent to in
+// order to be redirected, including SrcAddress.
+func (r Redirection) DestinationFilter() []string {
+	if r.SrcAddress == "" {
+		return r.Destinations
+	}
+	return append([]string{r.SrcAddress}, r.Destinations...)
+}
+
+// Validate checks the fields of the redirection, every address must belong
+// to the same family of DstAddress.
+func (r Redirection) Validate() error {
+	switch strings.ToLower(r.Protocol) {
+	case "tcp", "udp":
+	default:
+		return fmt.Errorf("unsupported protocol '%s'", r.Protocol)
+	}
+
+	switch strings.ToLower(r.Mode) {
+	case "", RedirectionDNAT:
+	case RedirectionTProxy:
+		if r.Mark == 0 {
+			return fmt.Errorf("tproxy redirections require a mark")
+		}
+	default:
+		return fmt.Errorf("unknown redirection mode '%s'", r.Mode)
+	}
+
+	if r.Interface == "" {
+		return fmt.Errorf("no interface given")
+	} else if r.SrcPort <= 0 || r.SrcPort > 65535 || r.SrcPortEnd < 0 || r.SrcPortEnd > 65535 {
+		return fmt.Errorf("invalid source port in %s", r)
+	} else if r.DstPort <= 0 || r.DstPort > 65535 {
+		return fmt.Errorf("invalid destination port in %s", r)
+	} else if net.ParseIP(r.DstAddress) == nil {
+		return fmt.Errorf("invalid destination address '%s'", r.DstAddress)
+	}
+
+	ipv6 := r.IsIPv6()
+	lists := [][]string{
+		r.Sources,
+		r.DestinationFilter(),
+		r.ExcludeSources,
+		r.ExcludeDestinations,
+	}
+	for _, list := range lists {
+		for _, addr := range list {
+			if cidr, err := ParseAddress(addr); err != nil {
+				return err
+			} else if (cidr.IP.To4() == nil) != ipv6 {
+				return fmt.Errorf("address '%s' does not belong to the family of '%s'", addr, r.DstAddress)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (r Redirection) String() string {
-	return fmt.Sprintf("[%s] (%s) %s:%d -> %s:%d", r.Interface, r.Protocol, r.SrcAddress, r.SrcPort, r.DstAddress, r.DstPort)
+	s := fmt.Sprintf("[%s] (%s) %s:%d -> %s:%d", r.Interface, r.Protocol, r.SrcAddress, r.SrcPort, r.DstAddress, r.DstPort)
+	if r.SrcPortEnd > r.SrcPort {
+		s = fmt.Sprintf("[%s] (%s) %s:%d-%d -> %s:%d", r.Interface, r.Protocol, r.SrcAddress, r.SrcPort, r.SrcPortEnd, r.DstAddress, r.DstPort)
+	}
+
+	filters := []struct {
+		name string
+		list []string
+	}{
+		{"from", r.Sources},
+		{"to", r.Destinations},
+		{"not from", r.ExcludeSources},
+		{"not to", r.ExcludeDestinations},
+	}
+	for _, f := range filters {
+		if len(f.list) > 0 {
+			s += fmt.Sprintf(" %s %s", f.name, strings.Join(f.list, ","))
+		}
+	}
+
+	if r.IsTProxy() {
+		s += " tproxy"
+	}
+	if r.Mark != 0 {
+		s += fmt.Sprintf(" mark 0x%x", r.Mark)
+	}
+
+	return s
 }
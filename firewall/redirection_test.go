@@ -0,0 +1,142 @@
+package firewall
+
+import (
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+		fail bool
+	}{
+		{"192.168.1.1", "192.168.1.1/32", false},
+		{"192.168.1.0/24", "192.168.1.0/24", false},
+		{"192.168.1.7/24", "192.168.1.0/24", false},
+		{"fe80::1", "fe80::1/128", false},
+		{"fe80::/64", "fe80::/64", false},
+		{"::ffff:10.0.0.1", "10.0.0.1/32", false},
+		{"192.168.1.256", "", true},
+		{"192.168.1.0/33", "", true},
+		{"localhost", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		cidr, err := ParseAddress(tt.addr)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("expected '%s' to fail", tt.addr)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error for '%s': %v", tt.addr, err)
+		} else if cidr.String() != tt.want {
+			t.Errorf("'%s': expected %s, got %s", tt.addr, tt.want, cidr)
+		}
+	}
+}
+
+func TestRedirectionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(r *Redirection)
+		fail bool
+	}{
+		{"simple", func(r *Redirection) {}, false},
+		{"udp", func(r *Redirection) { r.Protocol = "UDP" }, false},
+		{"port range", func(r *Redirection) { r.SrcPortEnd = 90 }, false},
+		{"filters", func(r *Redirection) {
+			r.SrcAddress = "10.0.0.1"
+			r.Sources = []string{"192.168.1.0/24"}
+			r.Destinations = []string{"10.0.0.0/8"}
+			r.ExcludeSources = []string{"192.168.1.1"}
+			r.ExcludeDestinations = []string{"10.0.0.2"}
+		}, false},
+		{"dnat", func(r *Redirection) { r.Mode = "DNAT" }, false},
+		{"tproxy", func(r *Redirection) { r.Mode = RedirectionTProxy; r.Mark = 1 }, false},
+		{"ipv6", func(r *Redirection) { r.DstAddress = "fe80::1"; r.Sources = []string{"fe80::/64"} }, false},
+		{"protocol", func(r *Redirection) { r.Protocol = "icmp" }, true},
+		{"mode", func(r *Redirection) { r.Mode = "masquerade" }, true},
+		{"tproxy without mark", func(r *Redirection) { r.Mode = RedirectionTProxy }, true},
+		{"no interface", func(r *Redirection) { r.Interface = "" }, true},
+		{"source port", func(r *Redirection) { r.SrcPort = 0 }, true},
+		{"source port too big", func(r *Redirection) { r.SrcPort = 65536 }, true},
+		{"port range end", func(r *Redirection) { r.SrcPortEnd = 70000 }, true},
+		{"destination port", func(r *Redirection) { r.DstPort = -1 }, true},
+		{"destination address", func(r *Redirection) { r.DstAddress = "nope" }, true},
+		{"invalid source", func(r *Redirection) { r.Sources = []string{"nope"} }, true},
+		{"invalid excluded destination", func(r *Redirection) { r.ExcludeDestinations = []string{"10.0.0.0/40"} }, true},
+		{"mixed source family", func(r *Redirection) { r.Sources = []string{"fe80::1"} }, true},
+		{"mixed excluded family", func(r *Redirection) { r.DstAddress = "fe80::1"; r.ExcludeSources = []string{"10.0.0.1"} }, true},
+		{"mixed address family", func(r *Redirection) { r.SrcAddress = "fe80::2" }, true},
+	}
+
+	for _, tt := range tests {
+		r := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+		tt.edit(r)
+		if err := r.Validate(); tt.fail && err == nil {
+			t.Errorf("%s: expected %s to be invalid", tt.name, r)
+		} else if !tt.fail && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+}
+
+func TestRedirectionFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(r *Redirection)
+		str    string
+		simple bool
+		first  int
+		last   int
+		tproxy bool
+		ipv6   bool
+	}{
+		{"simple", func(r *Redirection) {},
+			"[eth0] (TCP) :80 -> 192.168.1.2:8080", true, 80, 80, false, false},
+		{"address", func(r *Redirection) { r.SrcAddress = "10.0.0.1" },
+			"[eth0] (TCP) 10.0.0.1:80 -> 192.168.1.2:8080", true, 80, 80, false, false},
+		{"port range", func(r *Redirection) { r.SrcPortEnd = 90 },
+			"[eth0] (TCP) :80-90 -> 192.168.1.2:8080", false, 80, 90, false, false},
+		{"empty port range", func(r *Redirection) { r.SrcPortEnd = 80 },
+			"[eth0] (TCP) :80 -> 192.168.1.2:8080", true, 80, 80, false, false},
+		{"filters", func(r *Redirection) {
+			r.Sources = []string{"10.0.0.1", "10.0.0.2"}
+			r.Destinations = []string{"1.1.1.1"}
+			r.ExcludeSources = []string{"10.0.0.3"}
+			r.ExcludeDestinations = []string{"8.8.8.8"}
+		}, "[eth0] (TCP) :80 -> 192.168.1.2:8080 from 10.0.0.1,10.0.0.2 to 1.1.1.1 not from 10.0.0.3 not to 8.8.8.8",
+			false, 80, 80, false, false},
+		{"excluded source", func(r *Redirection) { r.ExcludeSources = []string{"10.0.0.3"} },
+			"[eth0] (TCP) :80 -> 192.168.1.2:8080 not from 10.0.0.3", false, 80, 80, false, false},
+		{"dnat with mark", func(r *Redirection) { r.Mode = RedirectionDNAT; r.Mark = 0x10 },
+			"[eth0] (TCP) :80 -> 192.168.1.2:8080 mark 0x10", false, 80, 80, false, false},
+		{"tproxy", func(r *Redirection) { r.Mode = "TPROXY"; r.Mark = 1; r.DstAddress = "fe80::1" },
+			"[eth0] (TCP) :80 -> fe80::1:8080 tproxy mark 0x1", false, 80, 80, true, true},
+	}
+
+	for _, tt := range tests {
+		r := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+		tt.edit(r)
+		first, last := r.Ports()
+		if s := r.String(); s != tt.str {
+			t.Errorf("%s: expected '%s', got '%s'", tt.name, tt.str, s)
+		} else if r.IsSimple() != tt.simple {
+			t.Errorf("%s: expected IsSimple() to be %v", tt.name, tt.simple)
+		} else if first != tt.first || last != tt.last {
+			t.Errorf("%s: expected ports %d-%d, got %d-%d", tt.name, tt.first, tt.last, first, last)
+		} else if r.IsTProxy() != tt.tproxy {
+			t.Errorf("%s: expected IsTProxy() to be %v", tt.name, tt.tproxy)
+		} else if r.IsIPv6() != tt.ipv6 {
+			t.Errorf("%s: expected IsIPv6() to be %v", tt.name, tt.ipv6)
+		}
+	}
+
+	r := NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	r.SrcAddress = "10.0.0.1"
+	r.Destinations = []string{"10.0.0.2"}
+	if dsts := r.DestinationFilter(); len(dsts) != 2 || dsts[0] != "10.0.0.1" || dsts[1] != "10.0.0.2" {
+		t.Fatalf("unexpected destination filter %v", dsts)
+	}
+}
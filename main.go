@@ -46,14 +46,29 @@ func main() {
 	// Load all modules
 	modules.LoadModules(sess)
 
+	// Caplets are checked against the loaded modules before
+	// starting the session, so that nothing is executed.
+	if *sess.Options.Check != "" {
+		os.Exit(checkCaplet(sess, *sess.Options.Check))
+	}
+
 	if err = sess.Start(); err != nil {
 		log.Fatal("%s", err)
 	}
 
+	// Undo what a previous session left behind, without
+	// starting any module.
+	if *sess.Options.Recover {
+		if err = sess.Recover(); err != nil {
+			log.Fatal("%s", err)
+		}
+		return
+	}
+
 	// Some modules are enabled by default in order
 	// to make the interactive session useful.
 	for _, modName := range str.Comma(*sess.Options.AutoStart) {
-		if err = sess.Run(modName + " on"); err != nil {
+		if err = sess.Exec(session.SourceStartup, modName+" on"); err != nil {
 			log.Fatal("error while starting module %s: %s", modName, err)
 		}
 	}
@@ -63,14 +78,14 @@ func main() {
 	// line, therefore they need to be executed first otherwise
 	// modules might already be started.
 	for _, cmd := range session.ParseCommands(*sess.Options.Commands) {
-		if err = sess.Run(cmd); err != nil {
+		if err = sess.Exec(session.SourceStartup, cmd); err != nil {
 			log.Error("error while running '%s': %s", tui.Bold(cmd), tui.Red(err.Error()))
 		}
 	}
 
 	// Then run the caplet if specified.
 	if *sess.Options.Caplet != "" {
-		if err = sess.RunCaplet(*sess.Options.Caplet); err != nil {
+		if err = sess.Exec(session.SourceStartup, "include "+*sess.Options.Caplet); err != nil {
 			log.Error("error while running caplet %s: %s", tui.Bold(*sess.Options.Caplet), tui.Red(err.Error()))
 		}
 	}
@@ -98,6 +113,26 @@ func main() {
 	}
 }
 
+func checkCaplet(sess *session.Session, name string) int {
+	err, problems := sess.CheckCaplet(name)
+	if err != nil {
+		log.Error("%s", err)
+		return 1
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("%s:%d: %s\n", tui.Bold(problem.File), problem.Line, tui.Red(problem.Message))
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("\n%d problems found in caplet %s.\n", len(problems), tui.Bold(name))
+		return 1
+	}
+
+	fmt.Printf("caplet %s is valid.\n", tui.Bold(name))
+	return 0
+}
+
 func exitPrompt() bool {
 	var ans string
 	fmt.Printf("Are you sure you want to quit this session? y/n ")
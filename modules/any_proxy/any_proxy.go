@@ -1,8 +1,14 @@
 package any_proxy
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/bettercap/bettercap/firewall"
 	"github.com/bettercap/bettercap/session"
+
+	"github.com/evilsocket/islazy/str"
 )
 
 type AnyProxy struct {
@@ -25,18 +31,44 @@ func NewAnyProxy(s *session.Session) *AnyProxy {
 		"(TCP|UDP)",
 		"Proxy protocol."))
 
-	mod.AddParam(session.NewIntParameter("any.proxy.src_port",
+	mod.AddParam(session.NewStringParameter("any.proxy.src_port",
 		"80",
-		"Remote port to redirect when the module is activated."))
+		`^\d+(-\d+)?$`,
+		"Remote port or range of ports (8000-8100) to redirect when the module is activated."))
 
 	mod.AddParam(session.NewStringParameter("any.proxy.src_address",
 		"",
 		"",
-		"Leave empty to intercept any source address."))
+		"Comma separated list of addresses or CIDRs the packets must be sent to, leave empty to intercept any destination address."))
+
+	mod.AddParam(session.NewStringParameter("any.proxy.sources",
+		"",
+		"",
+		"Comma separated list of addresses or CIDRs the packets must be sent from, leave empty to intercept any source address."))
+
+	mod.AddParam(session.NewStringParameter("any.proxy.exclude_sources",
+		"",
+		"",
+		"Comma separated list of addresses or CIDRs whose packets are never redirected."))
+
+	mod.AddParam(session.NewStringParameter("any.proxy.exclude_destinations",
+		"",
+		"",
+		"Comma separated list of addresses or CIDRs the packets sent to are never redirected."))
+
+	mod.AddParam(session.NewStringParameter("any.proxy.mode",
+		firewall.RedirectionDNAT,
+		"^(dnat|tproxy)$",
+		"Redirect the packets rewriting their destination (dnat) or preserving it for transparent proxies (tproxy)."))
+
+	mod.AddParam(session.NewStringParameter("any.proxy.mark",
+		"0",
+		`^(0x[a-fA-F0-9]+|\d+)$`,
+		"If not 0, mark the redirected packets with this value, required by the tproxy mode."))
 
 	mod.AddParam(session.NewStringParameter("any.proxy.dst_address",
 		session.ParamIfaceAddress,
-		session.IPv4Validator,
+		"",
 		"Address where the proxy is listening."))
 
 	mod.AddParam(session.NewIntParameter("any.proxy.dst_port",
@@ -70,14 +102,40 @@ func (mod *AnyProxy) Author() string {
 	return "Simone Margaritelli <evilsocket@gmail.com>"
 }
 
+// parsePorts parses a port or a range of ports.
+func parsePorts(ports string) (error, int, int) {
+	parts := strings.SplitN(ports, "-", 2)
+	first, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return err, 0, 0
+	} else if len(parts) == 1 {
+		return nil, first, 0
+	}
+
+	last, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return err, 0, 0
+	} else if last < first {
+		return fmt.Errorf("invalid port range %s", ports), 0, 0
+	}
+	return nil, first, last
+}
+
 func (mod *AnyProxy) Configure() error {
 	var err error
 	var srcPort int
+	var srcPortEnd int
 	var dstPort int
 	var iface string
 	var protocol string
+	var ports string
 	var srcAddress string
 	var dstAddress string
+	var sources string
+	var excludeSources string
+	var excludeDestinations string
+	var mode string
+	var mark string
 
 	if mod.Running() {
 		return session.ErrAlreadyStarted(mod.Name())
@@ -85,7 +143,9 @@ func (mod *AnyProxy) Configure() error {
 		return err
 	} else if err, protocol = mod.StringParam("any.proxy.protocol"); err != nil {
 		return err
-	} else if err, srcPort = mod.IntParam("any.proxy.src_port"); err != nil {
+	} else if err, ports = mod.StringParam("any.proxy.src_port"); err != nil {
+		return err
+	} else if err, srcPort, srcPortEnd = parsePorts(ports); err != nil {
 		return err
 	} else if err, dstPort = mod.IntParam("any.proxy.dst_port"); err != nil {
 		return err
@@ -93,6 +153,16 @@ func (mod *AnyProxy) Configure() error {
 		return err
 	} else if err, dstAddress = mod.StringParam("any.proxy.dst_address"); err != nil {
 		return err
+	} else if err, sources = mod.StringParam("any.proxy.sources"); err != nil {
+		return err
+	} else if err, excludeSources = mod.StringParam("any.proxy.exclude_sources"); err != nil {
+		return err
+	} else if err, excludeDestinations = mod.StringParam("any.proxy.exclude_destinations"); err != nil {
+		return err
+	} else if err, mode = mod.StringParam("any.proxy.mode"); err != nil {
+		return err
+	} else if err, mark = mod.StringParam("any.proxy.mark"); err != nil {
+		return err
 	}
 
 	if !mod.Session.Firewall.IsForwardingEnabled() {
@@ -106,8 +176,24 @@ func (mod *AnyProxy) Configure() error {
 		dstAddress,
 		dstPort)
 
-	if srcAddress != "" {
-		mod.Redirection.SrcAddress = srcAddress
+	// keep SrcAddress for single addresses so that the redirection works
+	// with every firewall
+	if dsts := str.Comma(srcAddress); len(dsts) == 1 {
+		mod.Redirection.SrcAddress = dsts[0]
+	} else {
+		mod.Redirection.Destinations = dsts
+	}
+
+	mod.Redirection.SrcPortEnd = srcPortEnd
+	mod.Redirection.Sources = str.Comma(sources)
+	mod.Redirection.ExcludeSources = str.Comma(excludeSources)
+	mod.Redirection.ExcludeDestinations = str.Comma(excludeDestinations)
+	mod.Redirection.Mode = mode
+
+	if n, err := strconv.ParseUint(mark, 0, 32); err != nil {
+		return fmt.Errorf("invalid mark %s: %v", mark, err)
+	} else {
+		mod.Redirection.Mark = uint32(n)
 	}
 
 	if err := mod.Session.Firewall.EnableRedirection(mod.Redirection, true); err != nil {
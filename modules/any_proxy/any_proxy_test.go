@@ -0,0 +1,37 @@
+package any_proxy
+
+import (
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		ports string
+		first int
+		last  int
+		fail  bool
+	}{
+		{"80", 80, 0, false},
+		{"1000-2000", 1000, 2000, false},
+		{"80-80", 80, 80, false},
+		{"2000-1000", 0, 0, true},
+		{"http", 0, 0, true},
+		{"80-", 0, 0, true},
+		{"-80", 0, 0, true},
+		{"80-90-100", 0, 0, true},
+		{"", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		err, first, last := parsePorts(tt.ports)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("expected '%s' to fail", tt.ports)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error for '%s': %v", tt.ports, err)
+		} else if first != tt.first || last != tt.last {
+			t.Errorf("'%s': expected %d-%d, got %d-%d", tt.ports, tt.first, tt.last, first, last)
+		}
+	}
+}
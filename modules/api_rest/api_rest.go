@@ -246,16 +246,20 @@ func (mod *RestAPI) Configure() error {
 	router.HandleFunc("/api/session/hid", mod.sessionRoute)
 	router.HandleFunc("/api/session/hid/{mac}", mod.sessionRoute)
 	router.HandleFunc("/api/session/env", mod.sessionRoute)
+	router.HandleFunc("/api/session/flows", mod.sessionRoute)
 	router.HandleFunc("/api/session/gateway", mod.sessionRoute)
 	router.HandleFunc("/api/session/interface", mod.sessionRoute)
 	router.HandleFunc("/api/session/modules", mod.sessionRoute)
 	router.HandleFunc("/api/session/lan", mod.sessionRoute)
 	router.HandleFunc("/api/session/lan/{mac}", mod.sessionRoute)
+	router.HandleFunc("/api/session/lan/{mac}/history", mod.sessionRoute)
 	router.HandleFunc("/api/session/options", mod.sessionRoute)
 	router.HandleFunc("/api/session/packets", mod.sessionRoute)
 	router.HandleFunc("/api/session/started-at", mod.sessionRoute)
 	router.HandleFunc("/api/session/wifi", mod.sessionRoute)
 	router.HandleFunc("/api/session/wifi/{mac}", mod.sessionRoute)
+	router.HandleFunc("/api/session/jobs", mod.sessionRoute)
+	router.HandleFunc("/api/session/jobs/{id}", mod.sessionRoute)
 
 	mod.server.Handler = router
 
@@ -10,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bettercap/bettercap/session"
 
@@ -18,6 +19,10 @@ import (
 
 type CommandRequest struct {
 	Command string `json:"cmd"`
+	// seconds, overrides session.jobs.timeout
+	Timeout int `json:"timeout"`
+	// queue the commands and return their jobs without waiting
+	Async bool `json:"async"`
 }
 
 type APIResponse struct {
@@ -158,6 +163,10 @@ func (mod *RestAPI) showEnv(w http.ResponseWriter, r *http.Request) {
 	mod.toJSON(w, mod.Session.Env)
 }
 
+func (mod *RestAPI) showFlows(w http.ResponseWriter, r *http.Request) {
+	mod.toJSON(w, mod.Session.Queue.Flows)
+}
+
 func (mod *RestAPI) showGateway(w http.ResponseWriter, r *http.Request) {
 	mod.toJSON(w, mod.Session.Gateway)
 }
@@ -176,6 +185,12 @@ func (mod *RestAPI) showLAN(w http.ResponseWriter, r *http.Request) {
 
 	if mac == "" {
 		mod.toJSON(w, mod.Session.Lan)
+	} else if strings.HasSuffix(r.URL.Path, "/history") {
+		if history, found := mod.Session.Lan.History().Get(mac); found {
+			mod.toJSON(w, history)
+		} else {
+			http.Error(w, "Not Found", 404)
+		}
 	} else if host, found := mod.Session.Lan.Get(mac); found {
 		mod.toJSON(w, host)
 	} else {
@@ -220,14 +235,54 @@ func (mod *RestAPI) runSessionCommand(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Bad Request", 400)
 	}
 
+	source := session.SourceAPI + ":" + r.RemoteAddr
+	timeout := time.Duration(cmd.Timeout) * time.Second
+	jobs := make([]session.Job, 0)
+
 	for _, aCommand := range session.ParseCommands(cmd.Command) {
-		if err = mod.Session.Run(aCommand); err != nil {
+		if cmd.Async {
+			jobs = append(jobs, mod.Session.Jobs.Submit(source, aCommand, timeout))
+		} else if cmd.Timeout > 0 {
+			err = mod.Session.Jobs.Exec(source, aCommand, timeout)
+		} else {
+			err = mod.Session.Exec(source, aCommand)
+		}
+
+		if err != nil {
 			http.Error(w, err.Error(), 400)
 			return
 		}
 	}
 
-	mod.toJSON(w, APIResponse{Success: true})
+	if cmd.Async {
+		mod.toJSON(w, jobs)
+	} else {
+		mod.toJSON(w, APIResponse{Success: true})
+	}
+}
+
+func (mod *RestAPI) showJobs(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	if params["id"] == "" {
+		mod.toJSON(w, mod.Session.Jobs.List())
+	} else if id, err := strconv.ParseUint(params["id"], 10, 64); err != nil {
+		http.Error(w, "Bad Request", 400)
+	} else if job, found := mod.Session.Jobs.Get(id); found {
+		mod.toJSON(w, job)
+	} else {
+		http.Error(w, "Not Found", 404)
+	}
+}
+
+func (mod *RestAPI) killJob(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	if id, err := strconv.ParseUint(params["id"], 10, 64); err != nil {
+		http.Error(w, "Bad Request", 400)
+	} else if err = mod.Session.Jobs.Kill(id); err != nil {
+		http.Error(w, err.Error(), 404)
+	} else {
+		mod.toJSON(w, APIResponse{Success: true})
+	}
 }
 
 func (mod *RestAPI) getEvents(limit int) []session.Event {
@@ -312,6 +367,9 @@ func (mod *RestAPI) sessionRoute(w http.ResponseWriter, r *http.Request) {
 	} else if r.Method == "POST" {
 		mod.runSessionCommand(w, r)
 		return
+	} else if r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/session/jobs/") {
+		mod.killJob(w, r)
+		return
 	} else if r.Method != "GET" {
 		http.Error(w, "Bad Request", 400)
 		return
@@ -328,6 +386,9 @@ func (mod *RestAPI) sessionRoute(w http.ResponseWriter, r *http.Request) {
 	case path == "/api/session/env":
 		mod.showEnv(w, r)
 
+	case path == "/api/session/flows":
+		mod.showFlows(w, r)
+
 	case path == "/api/session/gateway":
 		mod.showGateway(w, r)
 
@@ -358,6 +419,9 @@ func (mod *RestAPI) sessionRoute(w http.ResponseWriter, r *http.Request) {
 	case strings.HasPrefix(path, "/api/session/wifi"):
 		mod.showWiFi(w, r)
 
+	case strings.HasPrefix(path, "/api/session/jobs"):
+		mod.showJobs(w, r)
+
 	default:
 		http.Error(w, "Not Found", 404)
 	}
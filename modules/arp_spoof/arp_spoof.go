@@ -15,10 +15,14 @@ import (
 
 type ArpSpoofer struct {
 	session.SessionModule
+	targets    *network.Targets
+	whitelist  *network.Targets
+	lock       *sync.Mutex
 	addresses  []net.IP
 	macs       []net.HardwareAddr
 	wAddresses []net.IP
 	wMacs      []net.HardwareAddr
+	outOfScope map[string]bool
 	fullDuplex bool
 	internal   bool
 	ban        bool
@@ -28,10 +32,12 @@ type ArpSpoofer struct {
 func NewArpSpoofer(s *session.Session) *ArpSpoofer {
 	mod := &ArpSpoofer{
 		SessionModule: session.NewSessionModule("arp.spoof", s),
+		lock:          &sync.Mutex{},
 		addresses:     make([]net.IP, 0),
 		macs:          make([]net.HardwareAddr, 0),
 		wAddresses:    make([]net.IP, 0),
 		wMacs:         make([]net.HardwareAddr, 0),
+		outOfScope:    make(map[string]bool),
 		ban:           false,
 		internal:      false,
 		fullDuplex:    false,
@@ -40,9 +46,9 @@ func NewArpSpoofer(s *session.Session) *ArpSpoofer {
 
 	mod.SessionModule.Requires("net.recon")
 
-	mod.AddParam(session.NewStringParameter("arp.spoof.targets", session.ParamSubnet, "", "Comma separated list of IP addresses, MAC addresses or aliases to spoof, also supports nmap style IP ranges."))
+	mod.AddParam(session.NewStringParameter("arp.spoof.targets", session.ParamSubnet, "", "Comma separated list of IP addresses, MAC addresses, aliases, hostnames or vendor:, meta: and tag: selectors to spoof, also supports nmap style IP ranges and ! exclusions."))
 
-	mod.AddParam(session.NewStringParameter("arp.spoof.whitelist", "", "", "Comma separated list of IP addresses, MAC addresses or aliases to skip while spoofing."))
+	mod.AddParam(session.NewStringParameter("arp.spoof.whitelist", "", "", "Comma separated list of IP addresses, MAC addresses, aliases, hostnames or vendor:, meta: and tag: selectors to skip while spoofing."))
 
 	mod.AddParam(session.NewBoolParameter("arp.spoof.internal",
 		"false",
@@ -105,12 +111,16 @@ func (mod *ArpSpoofer) Configure() error {
 		return err
 	} else if err, whitelist = mod.StringParam("arp.spoof.whitelist"); err != nil {
 		return err
-	} else if mod.addresses, mod.macs, err = network.ParseTargets(targets, mod.Session.Lan.Aliases()); err != nil {
+	} else if mod.targets, err = network.ParseTargetExpression(targets); err != nil {
 		return err
-	} else if mod.wAddresses, mod.wMacs, err = network.ParseTargets(whitelist, mod.Session.Lan.Aliases()); err != nil {
+	} else if mod.whitelist, err = network.ParseTargetExpression(whitelist); err != nil {
+		return err
+	} else if err = mod.resolveTargets(true); err != nil {
 		return err
 	}
 
+	mod.outOfScope = make(map[string]bool)
+
 	mod.Debug(" addresses=%v macs=%v whitelisted-addresses=%v whitelisted-macs=%v", mod.addresses, mod.macs, mod.wAddresses, mod.wMacs)
 
 	if mod.ban {
@@ -124,15 +134,75 @@ func (mod *ArpSpoofer) Configure() error {
 	return nil
 }
 
+// resolveTargets evaluates the targets and whitelist expressions against
+// the hosts currently on the network, if strict the selection is refused
+// when any host is out of scope, otherwise those hosts are left out.
+func (mod *ArpSpoofer) resolveTargets(strict bool) error {
+	addresses, macs, err := mod.targets.Resolve(mod.Session.Lan)
+	if err != nil {
+		return err
+	} else if strict {
+		if err = network.CheckTargetsScope(addresses, macs, "target selection"); err != nil {
+			return err
+		}
+	} else {
+		addresses, macs = mod.inScope(addresses, macs)
+	}
+
+	wAddresses, wMacs, err := mod.whitelist.Resolve(mod.Session.Lan)
+	if err != nil {
+		return err
+	}
+
+	mod.lock.Lock()
+	defer mod.lock.Unlock()
+	mod.addresses, mod.macs = addresses, macs
+	mod.wAddresses, mod.wMacs = wAddresses, wMacs
+	return nil
+}
+
+// inScope filters out the hosts which are out of scope, warning about each
+// of them only the first time it's selected.
+func (mod *ArpSpoofer) inScope(addresses []net.IP, macs []net.HardwareAddr) ([]net.IP, []net.HardwareAddr) {
+	allowed := func(target string, err error) bool {
+		if err == nil {
+			return true
+		} else if !mod.outOfScope[target] {
+			mod.outOfScope[target] = true
+			mod.Warning("not spoofing new target: %v", err)
+		}
+		return false
+	}
+
+	scope := network.GetScope()
+	inAddresses := make([]net.IP, 0, len(addresses))
+	for _, ip := range addresses {
+		if allowed(ip.String(), scope.CheckIP(ip, "target selection")) {
+			inAddresses = append(inAddresses, ip)
+		}
+	}
+
+	inMacs := make([]net.HardwareAddr, 0, len(macs))
+	for _, hw := range macs {
+		if allowed(hw.String(), scope.CheckMAC(hw, "target selection")) {
+			inMacs = append(inMacs, hw)
+		}
+	}
+
+	return inAddresses, inMacs
+}
+
 func (mod *ArpSpoofer) Start() error {
 	if err := mod.Configure(); err != nil {
 		return err
 	}
 
 	nTargets := len(mod.addresses) + len(mod.macs)
-	if nTargets == 0 {
+	if mod.targets.Empty() {
 		mod.Warning("list of targets is empty, module not starting.")
 		return nil
+	} else if nTargets == 0 {
+		mod.Warning("no host matches %s yet, waiting for new hosts.", mod.targets)
 	}
 
 	return mod.SetRunning(true, func() {
@@ -158,6 +228,11 @@ func (mod *ArpSpoofer) Start() error {
 		gwIP := mod.Session.Gateway.IP
 		myMAC := mod.Session.Interface.HW
 		for mod.Running() {
+			// selectors might match hosts discovered in the meantime
+			if err := mod.resolveTargets(false); err != nil {
+				mod.Debug("error while resolving targets: %v", err)
+			}
+
 			mod.arpSpoofTargets(gwIP, myMAC, true, false)
 			for _, address := range neighbours {
 				if !mod.Session.Skip(address) {
@@ -190,16 +265,31 @@ func (mod *ArpSpoofer) unSpoof() error {
 	return nil
 }
 
+func (mod *ArpSpoofer) track(addr net.IP, hw net.HardwareAddr, target string, targetHW net.HardwareAddr) {
+	mod.Session.TrackSpoof(session.SpoofState{
+		Module:   mod.Name(),
+		Protocol: "arp",
+		Address:  addr.String(),
+		HW:       hw.String(),
+		Target:   target,
+		TargetHW: targetHW.String(),
+	})
+}
+
 func (mod *ArpSpoofer) Stop() error {
 	return mod.SetRunning(false, func() {
 		mod.Info("waiting for ARP spoofer to stop ...")
 		mod.unSpoof()
 		mod.ban = false
 		mod.waitGroup.Wait()
+		mod.Session.UntrackSpoofs(mod.Name())
 	})
 }
 
 func (mod *ArpSpoofer) isWhitelisted(ip string, mac net.HardwareAddr) bool {
+	mod.lock.Lock()
+	defer mod.lock.Unlock()
+
 	for _, addr := range mod.wAddresses {
 		if ip == addr.String() {
 			return true
@@ -218,8 +308,12 @@ func (mod *ArpSpoofer) isWhitelisted(ip string, mac net.HardwareAddr) bool {
 func (mod *ArpSpoofer) getTargets(probe bool) map[string]net.HardwareAddr {
 	targets := make(map[string]net.HardwareAddr)
 
+	mod.lock.Lock()
+	addresses, macs := mod.addresses, mod.macs
+	mod.lock.Unlock()
+
 	// add targets specified by IP address
-	for _, ip := range mod.addresses {
+	for _, ip := range addresses {
 		if mod.Session.Skip(ip) {
 			continue
 		}
@@ -229,7 +323,7 @@ func (mod *ArpSpoofer) getTargets(probe bool) map[string]net.HardwareAddr {
 		}
 	}
 	// add targets specified by MAC address
-	for _, hw := range mod.macs {
+	for _, hw := range macs {
 		if ip, err := network.ArpInverseLookup(mod.Session.Interface.Name(), hw.String(), false); err == nil {
 			if mod.Session.Skip(net.ParseIP(ip)) {
 				continue
@@ -260,6 +354,17 @@ func (mod *ArpSpoofer) arpSpoofTargets(saddr net.IP, smac net.HardwareAddr, chec
 		}
 	}
 
+	// the real MAC of the spoofed address is journaled so that the
+	// targets can be healed even if we don't exit cleanly
+	var saddrHW net.HardwareAddr
+	if check_running {
+		if isGW {
+			saddrHW = gwHW
+		} else if hw, err := mod.Session.FindMAC(saddr, false); err == nil {
+			saddrHW = hw
+		}
+	}
+
 	for ip, mac := range mod.getTargets(probe) {
 		if check_running && !mod.Running() {
 			return
@@ -276,6 +381,9 @@ func (mod *ArpSpoofer) arpSpoofTargets(saddr net.IP, smac net.HardwareAddr, chec
 		} else {
 			mod.Debug("sending %d bytes of ARP packet to %s:%s.", len(pkt), ip, mac.String())
 			mod.Session.Queue.Send(pkt)
+			if saddrHW != nil {
+				mod.track(saddr, saddrHW, ip, mac)
+			}
 		}
 
 		if mod.fullDuplex && isGW {
@@ -288,6 +396,8 @@ func (mod *ArpSpoofer) arpSpoofTargets(saddr net.IP, smac net.HardwareAddr, chec
 				// gateway that we are the target
 				if err, gwPacket = packets.NewARPReply(rawIP, ourHW, gwIP, gwHW); err != nil {
 					mod.Error("error while creating ARP spoof packet: %s", err)
+				} else {
+					mod.track(rawIP, mac, gwIP.String(), gwHW)
 				}
 			} else {
 				mod.Debug("telling the gw %s is %s", ip, mac)
@@ -6,6 +6,7 @@ package ble
 import (
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/bettercap/bettercap/network"
@@ -62,7 +63,8 @@ func (mod *BLERecon) doFilter(dev *network.BLEDevice) bool {
 	}
 	return mod.selector.Expression.MatchString(dev.Device.ID()) ||
 		mod.selector.Expression.MatchString(dev.Device.Name()) ||
-		mod.selector.Expression.MatchString(dev.Vendor)
+		mod.selector.Expression.MatchString(dev.Vendor) ||
+		mod.selector.Expression.MatchString(strings.Join(network.GetAnnotations().Get(dev.Device.ID()).Tags, " "))
 }
 
 func (mod *BLERecon) doSelection() (err error, devices []*network.BLEDevice) {
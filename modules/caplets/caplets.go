@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/bettercap/bettercap/caplets"
 	"github.com/bettercap/bettercap/session"
@@ -12,6 +13,7 @@ import (
 	"github.com/dustin/go-humanize"
 
 	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/str"
 	"github.com/evilsocket/islazy/tui"
 	"github.com/evilsocket/islazy/zip"
 )
@@ -31,12 +33,39 @@ func NewCapletsModule(s *session.Session) *CapletsModule {
 			return mod.Show()
 		}))
 
+	mod.AddHandler(session.NewModuleHandler("caplets.list", `caplets\.list(\s+--installed)?`,
+		"Show a list of caplets or, if --installed is specified, of the installed caplet packages.",
+		func(args []string) error {
+			if args[0] != "" {
+				return mod.ListInstalled()
+			}
+			return mod.Show()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("caplets.install PATH", `caplets\.install\s+(.+)`,
+		"Install a caplet package from a local folder or a .zip, .tar.gz or .tgz archive, verifying its manifest checksums.",
+		func(args []string) error {
+			return mod.Install(args[0])
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("caplets.remove NAME", `caplets\.remove\s+(.+)`,
+		"Remove an installed caplet package, use NAME@VERSION to only remove a specific version.",
+		func(args []string) error {
+			return mod.Remove(args[0])
+		}))
+
 	mod.AddHandler(session.NewModuleHandler("caplets.paths", "",
 		"Show a list caplet search paths.",
 		func(args []string) error {
 			return mod.Paths()
 		}))
 
+	mod.AddHandler(session.NewModuleHandler("caplets.check NAME", `caplets\.check\s+(.+)`,
+		"Check the caplet NAME and the caplets it includes for errors without executing it.",
+		func(args []string) error {
+			return mod.Check(args[0])
+		}))
+
 	mod.AddHandler(session.NewModuleHandler("caplets.update", "",
 		"Install/updates the caplets.",
 		func(args []string) error {
@@ -51,7 +80,7 @@ func (mod *CapletsModule) Name() string {
 }
 
 func (mod *CapletsModule) Description() string {
-	return "A module to list and update caplets."
+	return "A module to list, check, install and update caplets."
 }
 
 func (mod *CapletsModule) Author() string {
@@ -96,6 +125,74 @@ func (mod *CapletsModule) Show() error {
 	return nil
 }
 
+func (mod *CapletsModule) ListInstalled() error {
+	packages := caplets.Installed()
+	if len(packages) == 0 {
+		return fmt.Errorf("no caplet packages installed in %s, use the caplets.install command to install them", caplets.PackagesPath)
+	}
+
+	colNames := []string{
+		"Name",
+		"Version",
+		"Description",
+		"Modules",
+		"Dependencies",
+		"Path",
+	}
+	rows := [][]string{}
+
+	for _, pkg := range packages {
+		rows = append(rows, []string{
+			tui.Bold(pkg.Name),
+			pkg.Version,
+			tui.Dim(pkg.Description),
+			strings.Join(pkg.Modules, ", "),
+			strings.Join(pkg.Dependencies, ", "),
+			pkg.Path,
+		})
+	}
+
+	tui.Table(os.Stdout, colNames, rows)
+
+	return nil
+}
+
+func (mod *CapletsModule) Install(path string) error {
+	err, pkg := caplets.OpenPackage(str.Trim(path))
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+
+	for _, modName := range pkg.Modules {
+		if err, _ := mod.Session.Module(modName); err != nil {
+			return fmt.Errorf("package %s requires module %s which is not available", pkg.ID(), modName)
+		}
+	}
+
+	mod.Info("installing %s to %s ...", pkg.ID(), caplets.PackagesPath)
+
+	err, installed := pkg.Install()
+	if err != nil {
+		return err
+	}
+
+	mod.Info("%s installed, run it with %s", installed.ID(), tui.Bold(installed.ID()))
+	return nil
+}
+
+func (mod *CapletsModule) Remove(id string) error {
+	err, removed := caplets.Remove(caplets.SplitID(str.Trim(id)))
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range removed {
+		mod.Info("%s removed.", pkg.ID())
+	}
+	return nil
+}
+
 func (mod *CapletsModule) Paths() error {
 	colNames := []string{
 		"Path",
@@ -112,6 +209,35 @@ func (mod *CapletsModule) Paths() error {
 	return nil
 }
 
+func (mod *CapletsModule) Check(name string) error {
+	err, problems := mod.Session.CheckCaplet(name)
+	if err != nil {
+		return err
+	} else if len(problems) == 0 {
+		mod.Info("caplet %s is valid.", name)
+		return nil
+	}
+
+	colNames := []string{
+		"File",
+		"Line",
+		"Problem",
+	}
+	rows := [][]string{}
+
+	for _, problem := range problems {
+		rows = append(rows, []string{
+			tui.Bold(problem.File),
+			fmt.Sprintf("%d", problem.Line),
+			tui.Red(problem.Message),
+		})
+	}
+
+	tui.Table(os.Stdout, colNames, rows)
+
+	return fmt.Errorf("%d problems found in caplet %s", len(problems), name)
+}
+
 func (mod *CapletsModule) Update() error {
 	if !fs.Exists(caplets.InstallBase) {
 		mod.Info("creating caplets install path %s ...", caplets.InstallBase)
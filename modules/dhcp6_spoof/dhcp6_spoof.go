@@ -14,7 +14,6 @@ import (
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
 
 	// TODO: refactor to use gopacket when gopacket folks
 	// will fix this > https://github.com/google/gopacket/issues/334
@@ -26,7 +25,7 @@ import (
 
 type DHCP6Spoofer struct {
 	session.SessionModule
-	Handle        *pcap.Handle
+	Handle        *packets.Subscription
 	DUID          *dhcp6opts.DUIDLLT
 	DUIDRaw       []byte
 	Domains       []string
@@ -83,12 +82,7 @@ func (mod *DHCP6Spoofer) Configure() error {
 		return session.ErrAlreadyStarted(mod.Name())
 	}
 
-	if mod.Handle, err = pcap.OpenLive(mod.Session.Interface.Name(), 65536, true, pcap.BlockForever); err != nil {
-		return err
-	}
-
-	err = mod.Handle.SetBPFFilter("ip6 and udp")
-	if err != nil {
+	if err, mod.Handle = packets.Subscribe(mod.Session.Interface.Name(), "ip6 and udp"); err != nil {
 		return err
 	}
 
@@ -11,14 +11,13 @@ import (
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
 
 	"github.com/evilsocket/islazy/tui"
 )
 
 type DNSSpoofer struct {
 	session.SessionModule
-	Handle        *pcap.Handle
+	Handle        *packets.Subscription
 	Hosts         Hosts
 	All           bool
 	waitGroup     *sync.WaitGroup
@@ -90,9 +89,7 @@ func (mod *DNSSpoofer) Configure() error {
 
 	if mod.Running() {
 		return session.ErrAlreadyStarted(mod.Name())
-	} else if mod.Handle, err = pcap.OpenLive(mod.Session.Interface.Name(), 65536, true, pcap.BlockForever); err != nil {
-		return err
-	} else if err = mod.Handle.SetBPFFilter("udp"); err != nil {
+	} else if err, mod.Handle = packets.Subscribe(mod.Session.Interface.Name(), "udp"); err != nil {
 		return err
 	} else if err, mod.All = mod.BoolParam("dns.spoof.all"); err != nil {
 		return err
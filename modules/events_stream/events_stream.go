@@ -44,7 +44,7 @@ func NewEventsStream(s *session.Session) *EventsStream {
 		output:        os.Stdout,
 		timeFormat:    "15:04:05",
 		quit:          make(chan bool),
-		waitChan:      make(chan *session.Event),
+		waitChan:      make(chan *session.Event, 1),
 		waitFor:       "",
 		triggerList:   NewTriggerList(),
 	}
@@ -323,24 +323,32 @@ func (mod *EventsStream) Show(limit int) error {
 }
 
 func (mod *EventsStream) startWaitingFor(tag string, timeout int) error {
+	var expired <-chan time.Time
 	if timeout == 0 {
 		mod.Info("waiting for event %s ...", tui.Green(tag))
 	} else {
 		mod.Info("waiting for event %s for %d seconds ...", tui.Green(tag), timeout)
-		go func() {
-			time.Sleep(time.Duration(timeout) * time.Second)
-			mod.waitFor = ""
-			mod.waitChan <- nil
-		}()
+		expired = time.After(time.Duration(timeout) * time.Second)
+	}
+
+	// discard an event that arrived after a previous wait gave up
+	select {
+	case <-mod.waitChan:
+	default:
 	}
 
 	mod.waitFor = tag
-	event := <-mod.waitChan
+	ctx := mod.Session.Jobs.Context()
 
-	if event == nil {
-		return fmt.Errorf("'events.waitFor %s %d' timed out.", tag, timeout)
-	} else {
+	select {
+	case event := <-mod.waitChan:
 		mod.Debug("got event: %v", event)
+	case <-expired:
+		mod.waitFor = ""
+		return fmt.Errorf("'events.waitFor %s %d' timed out.", tag, timeout)
+	case <-ctx.Done():
+		mod.waitFor = ""
+		return ctx.Err()
 	}
 
 	return nil
@@ -54,7 +54,7 @@ func (mod *EventsStream) dispatchTriggers(e session.Event) {
 	} else if found {
 		mod.Debug("running trigger %s (cmds:'%s') for event %v", id, cmds, e)
 		for _, cmd := range session.ParseCommands(cmds) {
-			if err := mod.Session.Run(cmd); err != nil {
+			if err := mod.Session.Exec(session.SourceTrigger+":"+id, cmd); err != nil {
 				mod.Error("%s", err.Error())
 			}
 		}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/bettercap/bettercap/network"
+	"github.com/bettercap/bettercap/packets"
 	"github.com/bettercap/bettercap/session"
 
 	"github.com/bettercap/bettercap/modules/net_sniff"
@@ -27,6 +28,16 @@ func (mod *EventsStream) viewLogEvent(e session.Event) {
 }
 
 func (mod *EventsStream) viewEndpointEvent(e session.Event) {
+	if change, ok := e.Data.(network.EndpointChange); ok {
+		fmt.Fprintf(mod.output, "[%s] [%s] endpoint %s changed address from %s to %s.\n",
+			e.Time.Format(mod.timeFormat),
+			tui.Green(e.Tag),
+			tui.Green(change.Endpoint.HwAddress),
+			tui.Red(change.Previous),
+			tui.Bold(change.Endpoint.IpAddress))
+		return
+	}
+
 	t := e.Data.(*network.Endpoint)
 	vend := ""
 	name := ""
@@ -87,13 +98,35 @@ func (mod *EventsStream) viewSnifferEvent(e session.Event) {
 
 func (mod *EventsStream) viewSynScanEvent(e session.Event) {
 	se := e.Data.(syn_scan.SynScanEvent)
-	fmt.Fprintf(mod.output, "[%s] [%s] found open port %d for %s\n",
+	fmt.Fprintf(mod.output, "[%s] [%s] found open %s port %d for %s\n",
 		e.Time.Format(mod.timeFormat),
 		tui.Green(e.Tag),
+		se.Proto,
 		se.Port,
 		tui.Bold(se.Address))
 }
 
+func (mod *EventsStream) viewSynScanServiceEvent(e session.Event) {
+	se := e.Data.(syn_scan.SynScanEvent)
+	service := se.Service.Service
+	if se.Service.Tunnel != "" {
+		service = se.Service.Tunnel + "/" + service
+	}
+
+	fmt.Fprintf(mod.output, "[%s] [%s] %s port %d/%s is %s %s\n",
+		e.Time.Format(mod.timeFormat),
+		tui.Green(e.Tag),
+		tui.Bold(se.Address),
+		se.Port,
+		se.Proto,
+		tui.Yellow(service),
+		se.Service.Description())
+
+	for _, cpe := range se.Service.CPE {
+		fmt.Fprintf(mod.output, "  %s\n", tui.Dim(cpe))
+	}
+}
+
 func (mod *EventsStream) viewUpdateEvent(e session.Event) {
 	update := e.Data.(*github.RepositoryRelease)
 
@@ -151,6 +184,27 @@ func (mod *EventsStream) doRotation() {
 	}
 }
 
+func (mod *EventsStream) viewScopeEvent(e session.Event) {
+	v := e.Data.(network.ScopeViolation)
+	fmt.Fprintf(mod.output, "[%s] [%s] %s refused for %s: %s\n",
+		e.Time.Format(mod.timeFormat),
+		tui.Red(e.Tag),
+		tui.Bold(v.Action),
+		tui.Yellow(v.Target),
+		v.Reason)
+}
+
+func (mod *EventsStream) viewNetWatchEvent(e session.Event) {
+	alert := e.Data.(*packets.WatchAlert)
+	fmt.Fprintf(mod.output, "[%s] [%s] %s\n",
+		e.Time.Format(mod.timeFormat),
+		tui.Red(e.Tag),
+		alert.Message)
+	for _, evidence := range alert.Evidence {
+		fmt.Fprintf(mod.output, "  %s\n", tui.Dim(evidence))
+	}
+}
+
 func (mod *EventsStream) View(e session.Event, refresh bool) {
 	var err error
 	if err, mod.timeFormat = mod.StringParam("events.stream.time.format"); err != nil {
@@ -174,8 +228,14 @@ func (mod *EventsStream) View(e session.Event, refresh bool) {
 		mod.viewSnifferEvent(e)
 	} else if e.Tag == "syn.scan" {
 		mod.viewSynScanEvent(e)
+	} else if e.Tag == "syn.scan.service" {
+		mod.viewSynScanServiceEvent(e)
 	} else if e.Tag == "update.available" {
 		mod.viewUpdateEvent(e)
+	} else if e.Tag == "scope.violation" {
+		mod.viewScopeEvent(e)
+	} else if e.Tag == "net.watch.alert" {
+		mod.viewNetWatchEvent(e)
 	} else {
 		fmt.Fprintf(mod.output, "[%s] [%s] %v\n", e.Time.Format(mod.timeFormat), tui.Green(e.Tag), e)
 	}
@@ -0,0 +1,157 @@
+package flow_export
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bettercap/bettercap/packets"
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+type FlowExport struct {
+	session.SessionModule
+	exporter *packets.FlowExporter
+	quit     chan bool
+}
+
+func NewFlowExport(s *session.Session) *FlowExport {
+	mod := &FlowExport{
+		SessionModule: session.NewSessionModule("flow.export", s),
+		quit:          make(chan bool),
+	}
+
+	mod.AddParam(session.NewStringParameter("flow.export.collector",
+		"127.0.0.1:2055",
+		"",
+		"Address and port of the collector the flows are sent to."))
+
+	mod.AddParam(session.NewStringParameter("flow.export.protocol",
+		"ipfix",
+		"^(netflow9|ipfix)$",
+		"Export protocol, either netflow9 or ipfix."))
+
+	mod.AddParam(session.NewIntParameter("flow.export.active_timeout",
+		"60",
+		"Export long running flows every this number of seconds."))
+
+	mod.AddParam(session.NewIntParameter("flow.export.inactive_timeout",
+		"15",
+		"Export flows once they have been idle for this number of seconds."))
+
+	mod.AddParam(session.NewIntParameter("flow.export.template_refresh",
+		"60",
+		"Send the templates to the collector every this number of seconds."))
+
+	mod.AddParam(session.NewIntParameter("flow.export.source_id",
+		"0",
+		"Source id (NetFlow v9) or observation domain id (IPFIX) of the exported flows."))
+
+	mod.AddHandler(session.NewModuleHandler("flow.export on", "",
+		"Start exporting the flows seen by the packet queue.",
+		func(args []string) error {
+			return mod.Start()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("flow.export off", "",
+		"Export the pending flows and stop.",
+		func(args []string) error {
+			return mod.Stop()
+		}))
+
+	return mod
+}
+
+func (mod *FlowExport) Name() string {
+	return "flow.export"
+}
+
+func (mod *FlowExport) Description() string {
+	return "Export the flows seen by the packet queue to a NetFlow v9 or IPFIX collector."
+}
+
+func (mod *FlowExport) Author() string {
+	return "Simone Margaritelli <evilsocket@gmail.com>"
+}
+
+func (mod *FlowExport) Configure() (err error) {
+	var collector, protocol string
+	var active, inactive, refresh, sourceID int
+
+	if mod.Running() {
+		return session.ErrAlreadyStarted(mod.Name())
+	} else if err, collector = mod.StringParam("flow.export.collector"); err != nil {
+		return
+	} else if err, protocol = mod.StringParam("flow.export.protocol"); err != nil {
+		return
+	} else if err, active = mod.IntParam("flow.export.active_timeout"); err != nil {
+		return
+	} else if err, inactive = mod.IntParam("flow.export.inactive_timeout"); err != nil {
+		return
+	} else if err, refresh = mod.IntParam("flow.export.template_refresh"); err != nil {
+		return
+	} else if err, sourceID = mod.IntParam("flow.export.source_id"); err != nil {
+		return
+	}
+
+	if active <= 0 || inactive <= 0 || refresh <= 0 {
+		return fmt.Errorf("timeouts must be greater than zero")
+	} else if time.Duration(inactive)*time.Second >= packets.FlowIdleTimeout {
+		return fmt.Errorf("flow.export.inactive_timeout must be lower than %s or idle flows would be removed before being exported", packets.FlowIdleTimeout)
+	} else if mod.Session.Interface.IsMonitor() {
+		return fmt.Errorf("the packet queue is not active on monitor interfaces")
+	}
+
+	version := packets.IPFIX
+	if protocol == "netflow9" {
+		version = packets.NetFlowV9
+	}
+
+	if err, mod.exporter = packets.NewFlowExporter(collector, version); err != nil {
+		return
+	}
+
+	mod.exporter.SourceID = uint32(sourceID)
+	mod.exporter.ActiveTimeout = time.Duration(active) * time.Second
+	mod.exporter.InactiveTimeout = time.Duration(inactive) * time.Second
+	mod.exporter.TemplateRefresh = time.Duration(refresh) * time.Second
+
+	mod.Info("exporting flows to %s with %s", tui.Bold(collector), protocol)
+
+	return nil
+}
+
+func (mod *FlowExport) export(force bool) {
+	if err := mod.exporter.Update(mod.Session.Queue.Flows.Flows(), time.Now(), force); err != nil {
+		mod.Warning("error while exporting flows: %v", err)
+	}
+}
+
+func (mod *FlowExport) Start() error {
+	if err := mod.Configure(); err != nil {
+		return err
+	}
+
+	return mod.SetRunning(true, func() {
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-tick.C:
+				mod.export(false)
+			case <-mod.quit:
+				mod.export(true)
+				mod.exporter.Close()
+				return
+			}
+		}
+	})
+}
+
+func (mod *FlowExport) Stop() error {
+	return mod.SetRunning(false, func() {
+		mod.quit <- true
+	})
+}
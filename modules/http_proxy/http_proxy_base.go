@@ -379,6 +379,15 @@ func (p *HTTPProxy) httpsWorker() error {
 }
 
 func (p *HTTPProxy) Start() {
+	if p.sess.IsDryRun() {
+		proto := "http"
+		if p.isTLS {
+			proto = "https"
+		}
+		p.sess.DryRun.Record(session.DryRunListener, p.Name, "%s proxy on tcp %s", proto, p.Server.Addr)
+		return
+	}
+
 	go func() {
 		var err error
 
@@ -414,7 +423,9 @@ func (p *HTTPProxy) Stop() error {
 
 	if p.isTLS {
 		p.isRunning = false
-		p.sniListener.Close()
+		if p.sniListener != nil {
+			p.sniListener.Close()
+		}
 		return nil
 	} else {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -16,7 +16,6 @@ import (
 	"github.com/elazarl/goproxy"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
 
 	"github.com/evilsocket/islazy/tui"
 )
@@ -37,7 +36,7 @@ type SSLStripper struct {
 	session       *session.Session
 	cookies       *CookieTracker
 	hosts         *HostTracker
-	handle        *pcap.Handle
+	handle        *packets.Subscription
 	pktSourceChan chan gopacket.Packet
 	redirs        map[string]int
 }
@@ -164,11 +163,7 @@ func (s *SSLStripper) Enable(enabled bool) {
 	if enabled && s.handle == nil {
 		var err error
 
-		if s.handle, err = pcap.OpenLive(s.session.Interface.Name(), 65536, true, pcap.BlockForever); err != nil {
-			panic(err)
-		}
-
-		if err = s.handle.SetBPFFilter("udp"); err != nil {
+		if err, s.handle = packets.Subscribe(s.session.Interface.Name(), "udp"); err != nil {
 			panic(err)
 		}
 
@@ -178,16 +173,15 @@ func (s *SSLStripper) Enable(enabled bool) {
 				s.handle = nil
 			}()
 
-			for s.enabled {
-				src := gopacket.NewPacketSource(s.handle, s.handle.LinkType())
-				s.pktSourceChan = src.Packets()
-				for packet := range s.pktSourceChan {
-					if !s.enabled {
-						break
-					}
-
-					s.onPacket(packet)
+			// the channel is only closed if the capture ends
+			src := gopacket.NewPacketSource(s.handle, s.handle.LinkType())
+			s.pktSourceChan = src.Packets()
+			for packet := range s.pktSourceChan {
+				if !s.enabled {
+					break
 				}
+
+				s.onPacket(packet)
 			}
 		}()
 	}
@@ -93,6 +93,11 @@ func (mod *MacChanger) setMac(mac net.HardwareAddr) error {
 		return fmt.Errorf("OS %s is not supported by mac.changer module.", os)
 	}
 
+	if mod.Session.IsDryRun() {
+		mod.Session.DryRun.Record(session.DryRunMAC, "mac.changer", "ifconfig %s", strings.Join(args, " "))
+		return nil
+	}
+
 	_, err := core.Exec("ifconfig", args)
 	if err == nil {
 		mod.Session.Interface.HW = mac
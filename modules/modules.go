@@ -9,6 +9,7 @@ import (
 	"github.com/bettercap/bettercap/modules/dhcp6_spoof"
 	"github.com/bettercap/bettercap/modules/dns_spoof"
 	"github.com/bettercap/bettercap/modules/events_stream"
+	"github.com/bettercap/bettercap/modules/flow_export"
 	"github.com/bettercap/bettercap/modules/gps"
 	"github.com/bettercap/bettercap/modules/hid"
 	"github.com/bettercap/bettercap/modules/http_proxy"
@@ -18,10 +19,13 @@ import (
 	"github.com/bettercap/bettercap/modules/mac_changer"
 	"github.com/bettercap/bettercap/modules/mdns_server"
 	"github.com/bettercap/bettercap/modules/mysql_server"
+	"github.com/bettercap/bettercap/modules/net_fingerprint"
 	"github.com/bettercap/bettercap/modules/net_probe"
 	"github.com/bettercap/bettercap/modules/net_recon"
 	"github.com/bettercap/bettercap/modules/net_sniff"
+	"github.com/bettercap/bettercap/modules/net_watch"
 	"github.com/bettercap/bettercap/modules/packet_proxy"
+	"github.com/bettercap/bettercap/modules/schedule"
 	"github.com/bettercap/bettercap/modules/syn_scan"
 	"github.com/bettercap/bettercap/modules/tcp_proxy"
 	"github.com/bettercap/bettercap/modules/ticker"
@@ -42,6 +46,7 @@ func LoadModules(sess *session.Session) {
 	sess.Register(net_recon.NewDiscovery(sess))
 	sess.Register(dns_spoof.NewDNSSpoofer(sess))
 	sess.Register(events_stream.NewEventsStream(sess))
+	sess.Register(flow_export.NewFlowExport(sess))
 	sess.Register(gps.NewGPS(sess))
 	sess.Register(http_proxy.NewHttpProxy(sess))
 	sess.Register(http_server.NewHttpServer(sess))
@@ -51,11 +56,14 @@ func LoadModules(sess *session.Session) {
 	sess.Register(mysql_server.NewMySQLServer(sess))
 	sess.Register(mdns_server.NewMDNSServer(sess))
 	sess.Register(net_sniff.NewSniffer(sess))
+	sess.Register(net_fingerprint.NewNetFingerprint(sess))
+	sess.Register(net_watch.NewNetWatch(sess))
 	sess.Register(packet_proxy.NewPacketProxy(sess))
 	sess.Register(net_probe.NewProber(sess))
 	sess.Register(syn_scan.NewSynScanner(sess))
 	sess.Register(tcp_proxy.NewTcpProxy(sess))
 	sess.Register(ticker.NewTicker(sess))
+	sess.Register(schedule.NewSchedule(sess))
 	sess.Register(wifi.NewWiFiModule(sess))
 	sess.Register(wol.NewWOL(sess))
 	sess.Register(hid.NewHIDRecon(sess))
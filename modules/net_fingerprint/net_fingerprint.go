@@ -0,0 +1,189 @@
+package net_fingerprint
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/bettercap/bettercap/packets"
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+
+	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/tui"
+)
+
+// tcp SYNs, http requests, dhcp, mdns and ssdp
+const fingerprintFilter = "tcp or udp port 67 or udp port 68 or udp port 5353 or udp port 1900"
+
+type NetFingerprint struct {
+	session.SessionModule
+	fingerprinter *packets.Fingerprinter
+	handle        packets.Handle
+	source        string
+	waitGroup     *sync.WaitGroup
+}
+
+func NewNetFingerprint(s *session.Session) *NetFingerprint {
+	mod := &NetFingerprint{
+		SessionModule: session.NewSessionModule("net.fingerprint", s),
+		waitGroup:     &sync.WaitGroup{},
+	}
+
+	mod.AddParam(session.NewStringParameter("net.fingerprint.source",
+		"",
+		"",
+		"If set, the module will read from this pcap file instead of the current interface."))
+
+	mod.AddParam(session.NewStringParameter("net.fingerprint.signatures",
+		"",
+		"",
+		"Comma separated list of signature files in p0f format to load in addition to the built-in ones."))
+
+	mod.AddHandler(session.NewModuleHandler("net.fingerprint on", "",
+		"Start passively fingerprinting the OS and device type of the hosts from their traffic.",
+		func(args []string) error {
+			return mod.Start()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("net.fingerprint off", "",
+		"Stop fingerprinting hosts.",
+		func(args []string) error {
+			return mod.Stop()
+		}))
+
+	return mod
+}
+
+func (mod *NetFingerprint) Name() string {
+	return "net.fingerprint"
+}
+
+func (mod *NetFingerprint) Description() string {
+	return "Passively infer the OS, device type and model of the hosts from TCP SYNs, DHCP requests, HTTP user agents and mDNS/SSDP announcements."
+}
+
+func (mod *NetFingerprint) Author() string {
+	return "Simone Margaritelli <evilsocket@gmail.com>"
+}
+
+func (mod *NetFingerprint) loadSignatures() (*packets.Fingerprints, error) {
+	err, fileNames := mod.ListParam("net.fingerprint.signatures")
+	if err != nil {
+		return nil, err
+	}
+
+	db := packets.BuiltinFingerprints()
+	for _, fileName := range fileNames {
+		if fileName, err = fs.Expand(fileName); err != nil {
+			return nil, err
+		}
+
+		loaded, err := packets.LoadFingerprints(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading signatures from %s: %v", fileName, err)
+		}
+
+		mod.Info("loaded %d signatures from %s (%d unsupported signatures skipped)", loaded.Size(), fileName, loaded.Skipped)
+		db.Merge(loaded)
+	}
+	return db, nil
+}
+
+func (mod *NetFingerprint) Configure() (err error) {
+	var db *packets.Fingerprints
+
+	if mod.Running() {
+		return session.ErrAlreadyStarted(mod.Name())
+	} else if err, mod.source = mod.StringParam("net.fingerprint.source"); err != nil {
+		return
+	} else if db, err = mod.loadSignatures(); err != nil {
+		return
+	}
+
+	mod.fingerprinter = packets.NewFingerprinter(db)
+	// when replaying a capture our network has nothing to do with it
+	if mod.source == "" {
+		iface := mod.Session.Interface
+		mod.fingerprinter.Ignore[iface.HwAddress] = true
+		if iface.Net != nil {
+			mod.fingerprinter.Networks = append(mod.fingerprinter.Networks, iface.Net)
+		}
+		if iface.IPv6 != nil && !iface.IPv6.IsLinkLocalUnicast() {
+			mask := net.CIDRMask(64, 128)
+			mod.fingerprinter.Networks = append(mod.fingerprinter.Networks, &net.IPNet{
+				IP:   iface.IPv6.Mask(mask),
+				Mask: mask,
+			})
+		}
+	}
+
+	if mod.source == "" {
+		if err, mod.handle = packets.Subscribe(mod.Session.Interface.Name(), fingerprintFilter); err != nil {
+			return
+		}
+	} else {
+		handle, err := pcap.OpenOffline(mod.source)
+		if err != nil {
+			return err
+		} else if err = handle.SetBPFFilter(fingerprintFilter); err != nil {
+			handle.Close()
+			return err
+		}
+		mod.handle = handle
+	}
+
+	return nil
+}
+
+func (mod *NetFingerprint) onFingerprint(mac string, fp *packets.Fingerprint) {
+	host, found := mod.Session.Lan.Get(mac)
+	if !found {
+		// the matches are kept and applied with the next ones
+		return
+	}
+
+	if prev, _ := host.Meta.GetOr("fingerprint:os", "").(string); prev != fp.OS && fp.OS != "" {
+		mod.Debug("%s looks like %s (%d%%)", host.HwAddress, fp.OS, fp.Confidence)
+	}
+	host.OnMeta(fp.Meta())
+}
+
+func (mod *NetFingerprint) Start() error {
+	if err := mod.Configure(); err != nil {
+		return err
+	}
+
+	return mod.SetRunning(true, func() {
+		mod.waitGroup.Add(1)
+		defer mod.waitGroup.Done()
+
+		if mod.source != "" {
+			mod.Info("replaying %s", tui.Bold(mod.source))
+		}
+
+		src := gopacket.NewPacketSource(mod.handle, mod.handle.LinkType())
+		for packet := range src.Packets() {
+			if !mod.Running() {
+				break
+			}
+
+			if mac, fp := mod.fingerprinter.Process(packet); fp != nil {
+				mod.onFingerprint(mac, fp)
+			}
+		}
+
+		if mod.source != "" && mod.Running() {
+			mod.Info("done replaying %s", mod.source)
+		}
+	})
+}
+
+func (mod *NetFingerprint) Stop() error {
+	return mod.SetRunning(false, func() {
+		mod.handle.Close()
+		mod.waitGroup.Wait()
+	})
+}
@@ -0,0 +1,117 @@
+package net_fingerprint
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+	"github.com/bettercap/bettercap/packets"
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/evilsocket/islazy/data"
+)
+
+func newTestSession(t *testing.T) *session.Session {
+	env, err := session.NewEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := network.NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "mock0", 24)
+	gateway := network.NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+
+	return &session.Session{
+		Env:       env,
+		Events:    session.NewEventPool(false, true),
+		Interface: iface,
+		Gateway:   gateway,
+		Lan:       network.NewLAN(iface, gateway, aliases, func(e *network.Endpoint) {}, func(e *network.Endpoint) {}, func(e *network.Endpoint, previous string) {}),
+	}
+}
+
+func linuxSYN(t *testing.T, from net.HardwareAddr, ip string) []byte {
+	eth := layers.Ethernet{
+		SrcMAC:       from,
+		DstMAC:       net.HardwareAddr{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip4 := layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Flags:    layers.IPv4DontFragment,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(ip),
+		DstIP:    net.ParseIP("1.1.1.1"),
+	}
+	tcp := layers.TCP{
+		SrcPort: 40000,
+		DstPort: 443,
+		Seq:     1,
+		SYN:     true,
+		Window:  64240,
+		Options: []layers.TCPOption{
+			{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}},
+			{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
+			{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: []byte{0, 0, 0, 1, 0, 0, 0, 0}},
+			{OptionType: layers.TCPOptionKindNop, OptionLength: 1},
+			{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+		},
+	}
+	tcp.SetNetworkLayerForChecksum(&ip4)
+
+	err, raw := packets.Serialize(&eth, &ip4, &tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestNetFingerprintMockCapture(t *testing.T) {
+	mock := packets.NewMockBackend(layers.LinkTypeEthernet)
+	prev := packets.GetCaptureBackend()
+	packets.UseCaptureBackend(mock)
+	defer packets.UseCaptureBackend(prev)
+
+	s := newTestSession(t)
+	s.Lan.AddIfNew("10.0.0.20", "00:00:00:00:00:20")
+	host, found := s.Lan.Get("00:00:00:00:00:20")
+	if !found {
+		t.Fatal("expected the host to be in the lan")
+	}
+
+	mod := NewNetFingerprint(s)
+	if err := mod.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	hostMAC := net.HardwareAddr{0, 0, 0, 0, 0, 0x20}
+	// our own traffic is ignored
+	mock.Inject(linuxSYN(t, s.Interface.HW, "10.0.0.2"))
+	mock.Inject(linuxSYN(t, hostMAC, "10.0.0.20"))
+
+	deadline := time.Now().Add(time.Second)
+	for host.Meta.Get("fingerprint:os") == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if os, _ := host.Meta.GetOr("fingerprint:os", "").(string); os != "Linux 3.11 and newer" {
+		t.Fatalf("unexpected fingerprint '%s'", os)
+	} else if mod.fingerprinter.Ignore[s.Interface.HwAddress] != true {
+		t.Fatalf("expected the interface to be ignored")
+	}
+
+	if err := mod.Stop(); err != nil {
+		t.Fatal(err)
+	} else if mock.Opened() != 1 {
+		t.Fatalf("expected one capture handle, got %d", mock.Opened())
+	}
+}
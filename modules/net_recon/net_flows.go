@@ -0,0 +1,213 @@
+package net_recon
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bettercap/bettercap/packets"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// hostName returns display followed by the alias or hostname of the endpoint
+// with address addr, if known.
+func (mod *Discovery) hostName(addr string, display string) string {
+	if e := mod.Session.Lan.GetByIp(addr); e != nil {
+		if e.Alias != "" {
+			return fmt.Sprintf("%s (%s)", display, tui.Green(e.Alias))
+		} else if e.Hostname != "" {
+			return fmt.Sprintf("%s (%s)", display, tui.Yellow(e.Hostname))
+		}
+	}
+	return display
+}
+
+func windowName(window time.Duration) string {
+	if window%time.Minute == 0 {
+		return fmt.Sprintf("%dm", window/time.Minute)
+	}
+	return fmt.Sprintf("%ds", window/time.Second)
+}
+
+func (mod *Discovery) filterFlow(flow *packets.Flow) bool {
+	if mod.flowSelector.Expression == nil {
+		return true
+	}
+	return mod.flowSelector.Expression.MatchString(flow.Src()) ||
+		mod.flowSelector.Expression.MatchString(flow.Dst()) ||
+		mod.flowSelector.Expression.MatchString(flow.Protocol) ||
+		mod.flowSelector.Expression.MatchString(flow.Application) ||
+		mod.flowSelector.Expression.MatchString(flow.State)
+}
+
+func (mod *Discovery) selectFlows() (err error, flows []packets.Flow) {
+	if err = mod.flowSelector.Update(); err != nil {
+		return
+	}
+
+	for _, flow := range mod.Session.Queue.Flows.Flows() {
+		if mod.filterFlow(&flow) {
+			flows = append(flows, flow)
+		}
+	}
+
+	less := map[string]func(a, b *packets.Flow) bool{
+		"bytes":   func(a, b *packets.Flow) bool { return a.Bytes() < b.Bytes() },
+		"packets": func(a, b *packets.Flow) bool { return a.Packets() < b.Packets() },
+		"started": func(a, b *packets.Flow) bool { return a.FirstSeen.Before(b.FirstSeen) },
+		"seen":    func(a, b *packets.Flow) bool { return a.LastSeen.Before(b.LastSeen) },
+		"src":     func(a, b *packets.Flow) bool { return a.Src() < b.Src() },
+		"dst":     func(a, b *packets.Flow) bool { return a.Dst() < b.Dst() },
+		"app":     func(a, b *packets.Flow) bool { return a.Application < b.Application },
+	}[mod.flowSelector.SortField]
+
+	sort.SliceStable(flows, func(i, j int) bool {
+		if mod.flowSelector.Sort == "desc" {
+			return less(&flows[j], &flows[i])
+		}
+		return less(&flows[i], &flows[j])
+	})
+
+	if limit := mod.flowSelector.Limit; limit > 0 && limit < len(flows) {
+		flows = flows[0:limit]
+	}
+
+	return
+}
+
+func (mod *Discovery) showFlows() error {
+	err, flows := mod.selectFlows()
+	if err != nil {
+		return err
+	} else if len(flows) == 0 {
+		fmt.Printf("\nno flows.\n\n")
+		return nil
+	}
+
+	colNames := []string{"Proto", "Source", "Destination", "App", "State", "Sent", "Recvd", "Pkts", "Duration", "Seen"}
+	sortCols := map[string]int{"src": 1, "dst": 2, "app": 3, "bytes": 5, "packets": 7, "started": 8, "seen": 9}
+	if idx, found := sortCols[mod.flowSelector.SortField]; found {
+		colNames[idx] += " " + mod.flowSelector.SortSymbol
+	}
+
+	rows := [][]string{}
+	for _, flow := range flows {
+		app := flow.Application
+		if app == "" {
+			app = tui.Dim("?")
+		}
+
+		state := flow.State
+		switch state {
+		case "":
+			state = tui.Dim("-")
+		case packets.TCPStateEstablished:
+			state = tui.Green(state)
+		case packets.TCPStateReset:
+			state = tui.Red(state)
+		case packets.TCPStateClosed, packets.TCPStateClosing:
+			state = tui.Dim(state)
+		}
+
+		seen := flow.LastSeen.Format("15:04:05")
+		if time.Since(flow.LastSeen) <= AliveTimeInterval {
+			seen = tui.Bold(seen)
+		}
+
+		rows = append(rows, []string{
+			flow.Protocol,
+			mod.hostName(flow.SrcIP.String(), flow.Src()),
+			mod.hostName(flow.DstIP.String(), flow.Dst()),
+			app,
+			state,
+			humanize.Bytes(flow.SentBytes),
+			humanize.Bytes(flow.RecvBytes),
+			fmt.Sprintf("%d", flow.Packets()),
+			flow.LastSeen.Sub(flow.FirstSeen).Round(time.Second).String(),
+			seen,
+		})
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, colNames, rows)
+	fmt.Println()
+
+	mod.Session.Refresh()
+
+	return nil
+}
+
+func (mod *Discovery) showTalkers() error {
+	if err := mod.talkersSelector.Update(); err != nil {
+		return err
+	}
+
+	hosts := []packets.HostBandwidth{}
+	for _, host := range mod.Session.Queue.Flows.Bandwidth(time.Now()) {
+		if mod.talkersSelector.Expression == nil || mod.talkersSelector.Expression.MatchString(mod.hostName(host.Address, host.Address)) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	if len(hosts) == 0 {
+		fmt.Printf("\nno traffic.\n\n")
+		return nil
+	}
+
+	// sort by the rates of the first window
+	less := map[string]func(a, b packets.HostBandwidth) bool{
+		"ip":    func(a, b packets.HostBandwidth) bool { return a.Address < b.Address },
+		"sent":  func(a, b packets.HostBandwidth) bool { return a.Rates[0].Sent < b.Rates[0].Sent },
+		"rcvd":  func(a, b packets.HostBandwidth) bool { return a.Rates[0].Received < b.Rates[0].Received },
+		"total": func(a, b packets.HostBandwidth) bool { return a.Total(0) < b.Total(0) },
+	}[mod.talkersSelector.SortField]
+
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if mod.talkersSelector.Sort == "desc" {
+			return less(hosts[j], hosts[i])
+		}
+		return less(hosts[i], hosts[j])
+	})
+
+	if limit := mod.talkersSelector.Limit; limit > 0 && limit < len(hosts) {
+		hosts = hosts[0:limit]
+	}
+
+	colNames := []string{"Host"}
+	for _, window := range packets.RateWindows {
+		name := windowName(window)
+		colNames = append(colNames, fmt.Sprintf("↑ %s", name), fmt.Sprintf("↓ %s", name))
+	}
+
+	switch mod.talkersSelector.SortField {
+	case "ip":
+		colNames[0] += " " + mod.talkersSelector.SortSymbol
+	case "sent", "total":
+		colNames[1] += " " + mod.talkersSelector.SortSymbol
+	case "rcvd":
+		colNames[2] += " " + mod.talkersSelector.SortSymbol
+	}
+
+	rows := [][]string{}
+	for _, host := range hosts {
+		row := []string{mod.hostName(host.Address, host.Address)}
+		for _, rate := range host.Rates {
+			row = append(row,
+				humanize.Bytes(uint64(rate.Sent))+"/s",
+				humanize.Bytes(uint64(rate.Received))+"/s")
+		}
+		rows = append(rows, row)
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, colNames, rows)
+	fmt.Println()
+
+	mod.Session.Refresh()
+
+	return nil
+}
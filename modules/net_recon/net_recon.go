@@ -10,7 +10,9 @@ import (
 
 type Discovery struct {
 	session.SessionModule
-	selector *utils.ViewSelector
+	selector        *utils.ViewSelector
+	flowSelector    *utils.ViewSelector
+	talkersSelector *utils.ViewSelector
 }
 
 func NewDiscovery(s *session.Session) *Discovery {
@@ -34,6 +36,7 @@ func NewDiscovery(s *session.Session) *Discovery {
 		"Clear all endpoints collected by the hosts discovery module.",
 		func(args []string) error {
 			mod.Session.Lan.Clear()
+			mod.Session.Queue.Flows.Clear()
 			return nil
 		}))
 
@@ -59,9 +62,33 @@ func NewDiscovery(s *session.Session) *Discovery {
 			return mod.showMeta(args[0])
 		}))
 
+	mod.AddHandler(session.NewModuleHandler("net.show.history MAC", `net\.show\.history\s+([a-fA-F0-9:\-]{11,17})`,
+		"Show the addresses, hostnames, vendors and presence timeline of a host, even if it left the network.",
+		func(args []string) error {
+			return mod.showHistory(args[0])
+		}))
+
 	mod.selector = utils.ViewSelectorFor(&mod.SessionModule, "net.show", []string{"ip", "mac", "seen", "sent", "rcvd"},
 		"ip asc")
 
+	mod.AddHandler(session.NewModuleHandler("net.flows", "",
+		"Show the conversations seen by the packet queue (default sorting by bytes).",
+		func(args []string) error {
+			return mod.showFlows()
+		}))
+
+	mod.flowSelector = utils.ViewSelectorFor(&mod.SessionModule, "net.flows",
+		[]string{"bytes", "packets", "started", "seen", "src", "dst", "app"}, "bytes desc")
+
+	mod.AddHandler(session.NewModuleHandler("net.talkers", "",
+		"Show the bandwidth used by each host averaged over the last 10 seconds, minute and 5 minutes (default sorting by total bandwidth).",
+		func(args []string) error {
+			return mod.showTalkers()
+		}))
+
+	mod.talkersSelector = utils.ViewSelectorFor(&mod.SessionModule, "net.talkers",
+		[]string{"ip", "sent", "rcvd", "total"}, "total desc")
+
 	return mod
 }
 
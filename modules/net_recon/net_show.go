@@ -32,7 +32,18 @@ func (p ProtoPairList) Len() int           { return len(p) }
 func (p ProtoPairList) Less(i, j int) bool { return p[i].Hits < p[j].Hits }
 func (p ProtoPairList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-func (mod *Discovery) getRow(e *network.Endpoint, withMeta bool) [][]string {
+// os, model and device type inferred by net.fingerprint
+func fingerprintOf(e *network.Endpoint) string {
+	parts := []string{}
+	for _, key := range []string{"fingerprint:os", "fingerprint:model", "fingerprint:device"} {
+		if value, _ := e.Meta.GetOr(key, "").(string); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (mod *Discovery) getRow(e *network.Endpoint, withFingerprint bool, withMeta bool) [][]string {
 	sinceStarted := time.Since(mod.Session.StartedAt)
 	sinceFirstSeen := time.Since(e.FirstSeen)
 
@@ -80,15 +91,31 @@ func (mod *Discovery) getRow(e *network.Endpoint, withMeta bool) [][]string {
 		seen = tui.Dim(seen)
 	}
 
+	tags := tui.Dim("-")
+	if len(e.Tags) > 0 {
+		tags = tui.Blue(strings.Join(e.Tags, ", "))
+	}
+
 	row := []string{
 		addr,
 		mac,
 		name,
 		tui.Dim(e.Vendor),
+	}
+
+	if withFingerprint {
+		fingerprint := tui.Dim("-")
+		if confidence, _ := e.Meta.GetOr("fingerprint:confidence", "").(string); confidence != "" {
+			fingerprint = fmt.Sprintf("%s %s", fingerprintOf(e), tui.Dim(confidence+"%"))
+		}
+		row = append(row, fingerprint)
+	}
+
+	row = append(row,
+		tags,
 		humanize.Bytes(traffic.Sent),
 		humanize.Bytes(traffic.Received),
-		seen,
-	}
+		seen)
 
 	if !withMeta {
 		return [][]string{row}
@@ -114,7 +141,7 @@ func (mod *Discovery) getRow(e *network.Endpoint, withMeta bool) [][]string {
 		if i == 0 {
 			rows = append(rows, append(row, m))
 		} else {
-			rows = append(rows, []string{"", "", "", "", "", "", "", m})
+			rows = append(rows, append(make([]string, len(row)), m))
 		}
 	}
 
@@ -130,7 +157,9 @@ func (mod *Discovery) doFilter(target *network.Endpoint) bool {
 		mod.selector.Expression.MatchString(target.HwAddress) ||
 		mod.selector.Expression.MatchString(target.Hostname) ||
 		mod.selector.Expression.MatchString(target.Alias) ||
-		mod.selector.Expression.MatchString(target.Vendor)
+		mod.selector.Expression.MatchString(target.Vendor) ||
+		mod.selector.Expression.MatchString(fingerprintOf(target)) ||
+		mod.selector.Expression.MatchString(strings.Join(target.Tags, " "))
 }
 
 func (mod *Discovery) doSelection(arg string) (err error, targets []*network.Endpoint) {
@@ -190,23 +219,29 @@ func (mod *Discovery) doSelection(arg string) (err error, targets []*network.End
 	return
 }
 
-func (mod *Discovery) colNames(hasMeta bool) []string {
-	colNames := []string{"IP", "MAC", "Name", "Vendor", "Sent", "Recvd", "Seen"}
+func (mod *Discovery) colNames(hasFingerprint bool, hasMeta bool) []string {
+	colNames := []string{"IP", "MAC", "Name", "Vendor"}
+	if hasFingerprint {
+		colNames = append(colNames, "OS")
+	}
+	colNames = append(colNames, "Tags", "Sent", "Recvd", "Seen")
 	if hasMeta {
 		colNames = append(colNames, "Meta")
 	}
 
-	switch mod.selector.SortField {
-	case "mac":
-		colNames[1] += " " + mod.selector.SortSymbol
-	case "sent":
-		colNames[4] += " " + mod.selector.SortSymbol
-	case "rcvd":
-		colNames[5] += " " + mod.selector.SortSymbol
-	case "seen":
-		colNames[6] += " " + mod.selector.SortSymbol
-	case "ip":
-		colNames[0] += " " + mod.selector.SortSymbol
+	sortCols := map[string]string{
+		"ip":   "IP",
+		"mac":  "MAC",
+		"sent": "Sent",
+		"rcvd": "Recvd",
+		"seen": "Seen",
+	}
+	if sortCol, found := sortCols[mod.selector.SortField]; found {
+		for i, name := range colNames {
+			if name == sortCol {
+				colNames[i] += " " + mod.selector.SortSymbol
+			}
+		}
 	}
 
 	return colNames
@@ -223,6 +258,10 @@ func (mod *Discovery) showStatusBar() {
 		parts = append(parts, fmt.Sprintf("%d errs", nErrors))
 	}
 
+	if nDropped := mod.Session.Queue.Stats.Dropped; nDropped > 0 {
+		parts = append(parts, fmt.Sprintf("%d dropped", nDropped))
+	}
+
 	fmt.Printf("\n%s\n\n", strings.Join(parts, " / "))
 }
 
@@ -252,12 +291,20 @@ func (mod *Discovery) Show(arg string) (err error) {
 		}
 	}
 
-	colNames := mod.colNames(hasMeta)
+	hasFingerprint := false
+	for _, t := range targets {
+		if t.Meta.GetOr("fingerprint:confidence", nil) != nil {
+			hasFingerprint = true
+			break
+		}
+	}
+
+	colNames := mod.colNames(hasFingerprint, hasMeta)
 	padCols := make([]string, len(colNames))
 
 	rows := make([][]string, 0)
 	for i, t := range targets {
-		rows = append(rows, mod.getRow(t, hasMeta)...)
+		rows = append(rows, mod.getRow(t, hasFingerprint, hasMeta)...)
 		if i == pad {
 			rows = append(rows, padCols)
 		}
@@ -0,0 +1,64 @@
+package net_recon
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+const historyTimeFormat = "2006-01-02 15:04:05"
+
+func (mod *Discovery) showHistory(mac string) error {
+	history, found := mod.Session.Lan.History().Get(mac)
+	if !found {
+		return fmt.Errorf("no history for %s", mac)
+	}
+
+	rows := [][]string{}
+	for _, field := range []struct {
+		name   string
+		values []*network.HistoryValue
+	}{
+		{"ipv4", history.IpAddresses},
+		{"ipv6", history.Ip6Addresses},
+		{"hostname", history.Hostnames},
+		{"vendor", history.Vendors},
+	} {
+		for _, v := range field.values {
+			rows = append(rows, []string{
+				tui.Green(field.name),
+				tui.Yellow(v.Value),
+				v.FirstSeen.Format(historyTimeFormat),
+				v.LastSeen.Format(historyTimeFormat),
+			})
+		}
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, []string{"Field", "Value", "First Seen", "Last Seen"}, rows)
+
+	rows = [][]string{}
+	for i, p := range history.Presence {
+		to := p.To.Format(historyTimeFormat)
+		duration := p.To.Sub(p.From)
+		if history.Online && i == len(history.Presence)-1 {
+			to = tui.Green("online")
+			duration = time.Since(p.From)
+		}
+		rows = append(rows, []string{
+			p.From.Format(historyTimeFormat),
+			to,
+			duration.Round(time.Second).String(),
+		})
+	}
+
+	tui.Table(os.Stdout, []string{"From", "To", "Duration"}, rows)
+
+	mod.Session.Refresh()
+
+	return nil
+}
@@ -3,9 +3,9 @@ package net_sniff
 import (
 	"os"
 	"regexp"
-	"time"
 
 	"github.com/bettercap/bettercap/log"
+	"github.com/bettercap/bettercap/packets"
 	"github.com/bettercap/bettercap/session"
 
 	"github.com/google/gopacket/pcap"
@@ -15,7 +15,7 @@ import (
 )
 
 type SnifferContext struct {
-	Handle       *pcap.Handle
+	Handle       packets.Handle
 	Source       string
 	DumpLocal    bool
 	Verbose      bool
@@ -37,18 +37,17 @@ func (mod *Sniffer) GetContext() (error, *SnifferContext) {
 	}
 
 	if ctx.Source == "" {
-		/*
-		 * We don't want to pcap.BlockForever otherwise pcap_close(handle)
-		 * could hang waiting for a timeout to expire ...
-		 */
-		readTimeout := 500 * time.Millisecond
-		if ctx.Handle, err = pcap.OpenLive(mod.Session.Interface.Name(), 65536, true, readTimeout); err != nil {
+		err, sub := packets.Subscribe(mod.Session.Interface.Name(), "")
+		if err != nil {
 			return err, ctx
 		}
+		ctx.Handle = sub
 	} else {
-		if ctx.Handle, err = pcap.OpenOffline(ctx.Source); err != nil {
+		handle, err := pcap.OpenOffline(ctx.Source)
+		if err != nil {
 			return err, ctx
 		}
+		ctx.Handle = handle
 	}
 
 	if err, ctx.Verbose = mod.BoolParam("net.sniff.verbose"); err != nil {
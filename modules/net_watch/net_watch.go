@@ -0,0 +1,212 @@
+package net_watch
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/packets"
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// only what the watcher looks at
+const watchFilter = "arp or icmp6 or udp port 67 or udp port 68 or udp port 546 or udp port 547"
+
+type NetWatch struct {
+	session.SessionModule
+	watcher   *packets.NetWatcher
+	handle    packets.Handle
+	source    string
+	waitGroup *sync.WaitGroup
+}
+
+func NewNetWatch(s *session.Session) *NetWatch {
+	mod := &NetWatch{
+		SessionModule: session.NewSessionModule("net.watch", s),
+		waitGroup:     &sync.WaitGroup{},
+	}
+
+	mod.AddParam(session.NewStringParameter("net.watch.source",
+		"",
+		"",
+		"If set, the watcher will read from this pcap file instead of the current interface."))
+
+	mod.AddParam(session.NewStringParameter("net.watch.trusted.servers",
+		"",
+		"",
+		"Comma separated list of IP or MAC addresses of the DHCP and DHCPv6 servers allowed on the network, if empty the gateway and the first server seen are trusted."))
+
+	mod.AddParam(session.NewStringParameter("net.watch.trusted.routers",
+		"",
+		"",
+		"Comma separated list of IP or MAC addresses of the IPv6 routers allowed to send router advertisements, if empty the gateway and the first router seen are trusted."))
+
+	mod.AddParam(session.NewIntParameter("net.watch.flap_window",
+		"300",
+		"An address claimed by another MAC within this number of seconds is reported as flapping."))
+
+	mod.AddParam(session.NewIntParameter("net.watch.storm_threshold",
+		"10",
+		"Number of gratuitous ARPs or unsolicited neighbor advertisements from the same MAC reported as a storm."))
+
+	mod.AddParam(session.NewIntParameter("net.watch.storm_window",
+		"10",
+		"Number of seconds net.watch.storm_threshold announcements must be received within to be reported as a storm."))
+
+	mod.AddParam(session.NewIntParameter("net.watch.max_addresses",
+		"3",
+		"MACs claiming more IPv4 or IPv6 addresses than this are reported."))
+
+	mod.AddParam(session.NewIntParameter("net.watch.alert_interval",
+		"60",
+		"Don't repeat the same alert more often than this number of seconds."))
+
+	mod.AddHandler(session.NewModuleHandler("net.watch on", "",
+		"Start watching ARP, NDP, DHCP and router advertisements for spoofing and rogue servers.",
+		func(args []string) error {
+			return mod.Start()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("net.watch off", "",
+		"Stop watching the network.",
+		func(args []string) error {
+			return mod.Stop()
+		}))
+
+	return mod
+}
+
+func (mod *NetWatch) Name() string {
+	return "net.watch"
+}
+
+func (mod *NetWatch) Description() string {
+	return "Detect ARP and NDP spoofing, gratuitous ARP storms, duplicate gateways, rogue DHCP servers and router advertisements."
+}
+
+func (mod *NetWatch) Author() string {
+	return "Simone Margaritelli <evilsocket@gmail.com>"
+}
+
+// trustedList normalizes a list of IP and MAC addresses.
+func trustedList(values []string) (map[string]bool, error) {
+	trusted := make(map[string]bool)
+	for _, v := range values {
+		if ip := net.ParseIP(v); ip != nil {
+			trusted[ip.String()] = true
+		} else if hw, err := net.ParseMAC(v); err == nil {
+			trusted[hw.String()] = true
+		} else {
+			return nil, fmt.Errorf("'%s' is not a valid IP or MAC address", v)
+		}
+	}
+	return trusted, nil
+}
+
+func (mod *NetWatch) Configure() (err error) {
+	var servers, routers []string
+	var flapWindow, stormThreshold, stormWindow, maxAddresses, alertInterval int
+
+	if mod.Running() {
+		return session.ErrAlreadyStarted(mod.Name())
+	} else if err, mod.source = mod.StringParam("net.watch.source"); err != nil {
+		return
+	} else if err, servers = mod.ListParam("net.watch.trusted.servers"); err != nil {
+		return
+	} else if err, routers = mod.ListParam("net.watch.trusted.routers"); err != nil {
+		return
+	} else if err, flapWindow = mod.IntParam("net.watch.flap_window"); err != nil {
+		return
+	} else if err, stormThreshold = mod.IntParam("net.watch.storm_threshold"); err != nil {
+		return
+	} else if err, stormWindow = mod.IntParam("net.watch.storm_window"); err != nil {
+		return
+	} else if err, maxAddresses = mod.IntParam("net.watch.max_addresses"); err != nil {
+		return
+	} else if err, alertInterval = mod.IntParam("net.watch.alert_interval"); err != nil {
+		return
+	}
+
+	if flapWindow <= 0 || stormThreshold <= 0 || stormWindow <= 0 || maxAddresses <= 0 || alertInterval < 0 {
+		return fmt.Errorf("windows, thresholds and the number of addresses must be greater than zero")
+	}
+
+	mod.watcher = packets.NewNetWatcher()
+	if mod.watcher.TrustedServers, err = trustedList(servers); err != nil {
+		return
+	} else if mod.watcher.TrustedRouters, err = trustedList(routers); err != nil {
+		return
+	}
+
+	mod.watcher.FlapWindow = time.Duration(flapWindow) * time.Second
+	mod.watcher.StormThreshold = stormThreshold
+	mod.watcher.StormWindow = time.Duration(stormWindow) * time.Second
+	mod.watcher.MaxAddresses = maxAddresses
+	mod.watcher.AlertInterval = time.Duration(alertInterval) * time.Second
+
+	// when replaying a capture our gateway has nothing to do with it
+	if mod.source == "" && mod.Session.Gateway != mod.Session.Interface {
+		mod.watcher.Gateway = mod.Session.Gateway.IP
+		mod.watcher.GatewayMAC = mod.Session.Gateway.HW
+	}
+
+	if mod.source == "" {
+		if err, mod.handle = packets.Subscribe(mod.Session.Interface.Name(), watchFilter); err != nil {
+			return
+		}
+	} else {
+		handle, err := pcap.OpenOffline(mod.source)
+		if err != nil {
+			return err
+		} else if err = handle.SetBPFFilter(watchFilter); err != nil {
+			handle.Close()
+			return err
+		}
+		mod.handle = handle
+	}
+
+	return nil
+}
+
+func (mod *NetWatch) Start() error {
+	if err := mod.Configure(); err != nil {
+		return err
+	}
+
+	return mod.SetRunning(true, func() {
+		mod.waitGroup.Add(1)
+		defer mod.waitGroup.Done()
+
+		if mod.source != "" {
+			mod.Info("replaying %s", tui.Bold(mod.source))
+		}
+
+		src := gopacket.NewPacketSource(mod.handle, mod.handle.LinkType())
+		for packet := range src.Packets() {
+			if !mod.Running() {
+				break
+			}
+
+			for _, alert := range mod.watcher.Process(packet) {
+				mod.Session.Events.Add("net.watch.alert", alert)
+			}
+		}
+
+		if mod.source != "" && mod.Running() {
+			mod.Info("done replaying %s", mod.source)
+		}
+	})
+}
+
+func (mod *NetWatch) Stop() error {
+	return mod.SetRunning(false, func() {
+		mod.handle.Close()
+		mod.waitGroup.Wait()
+	})
+}
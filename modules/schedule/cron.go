@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how far in the future the next activation of a cron expression is searched
+const cronMaxYears = 5
+
+type cronField struct {
+	values map[int]bool
+	any    bool
+}
+
+// Cron is a standard five fields cron expression:
+// minute hour day-of-month month day-of-week
+type Cron struct {
+	Expr   string
+	minute cronField
+	hour   cronField
+	dom    cronField
+	month  cronField
+	dow    cronField
+}
+
+func parseCronField(field string, min int, max int) (error, cronField) {
+	f := cronField{
+		values: make(map[int]bool),
+		any:    field == "*",
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.IndexRune(part, '/'); idx != -1 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step in '%s'", part), f
+			}
+			step = n
+			part = part[:idx]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			if idx := strings.IndexRune(part, '-'); idx != -1 {
+				var err error
+				if from, err = strconv.Atoi(part[:idx]); err != nil {
+					return fmt.Errorf("invalid range '%s'", part), f
+				} else if to, err = strconv.Atoi(part[idx+1:]); err != nil {
+					return fmt.Errorf("invalid range '%s'", part), f
+				}
+			} else if n, err := strconv.Atoi(part); err != nil {
+				return fmt.Errorf("invalid value '%s'", part), f
+			} else if step > 1 {
+				// 5/15 means from 5 to the end every 15
+				from = n
+			} else {
+				from, to = n, n
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return fmt.Errorf("'%s' out of range %d-%d", part, min, max), f
+		}
+
+		for i := from; i <= to; i += step {
+			f.values[i] = true
+		}
+	}
+
+	return nil, f
+}
+
+func ParseCron(expr string) (error, *Cron) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return fmt.Errorf("cron expression '%s' must have 5 fields", expr), nil
+	}
+
+	c := &Cron{Expr: strings.Join(fields, " ")}
+	var err error
+	if err, c.minute = parseCronField(fields[0], 0, 59); err != nil {
+		return fmt.Errorf("minute: %v", err), nil
+	} else if err, c.hour = parseCronField(fields[1], 0, 23); err != nil {
+		return fmt.Errorf("hour: %v", err), nil
+	} else if err, c.dom = parseCronField(fields[2], 1, 31); err != nil {
+		return fmt.Errorf("day of month: %v", err), nil
+	} else if err, c.month = parseCronField(fields[3], 1, 12); err != nil {
+		return fmt.Errorf("month: %v", err), nil
+	} else if err, c.dow = parseCronField(fields[4], 0, 7); err != nil {
+		return fmt.Errorf("day of week: %v", err), nil
+	}
+
+	// both 0 and 7 are sunday
+	if c.dow.values[7] {
+		c.dow.values[0] = true
+	}
+
+	return nil, c
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom.values[t.Day()]
+	dow := c.dow.values[int(t.Weekday())]
+	// when both are restricted, either one matching is enough
+	if !c.dom.any && !c.dow.any {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the first activation strictly after t, or the zero time
+// if the expression never matches (i.e. February 30th).
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronMaxYears, 0, 0)
+
+	for t.Before(limit) {
+		if !c.month.values[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		} else if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		} else if !c.hour.values[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		} else if !c.minute.values[t.Minute()] {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field  string
+		min    int
+		max    int
+		values []int
+		any    bool
+		fail   bool
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}, true, false},
+		{"3", 0, 59, []int{3}, false, false},
+		{"1,3,5", 0, 59, []int{1, 3, 5}, false, false},
+		{"2-4", 0, 59, []int{2, 3, 4}, false, false},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}, false, false},
+		{"10-20/5", 0, 59, []int{10, 15, 20}, false, false},
+		{"50/5", 0, 59, []int{50, 55}, false, false},
+		{"1-2,7", 0, 7, []int{1, 2, 7}, false, false},
+		{"60", 0, 59, nil, false, true},
+		{"0", 1, 31, nil, false, true},
+		{"5-2", 0, 59, nil, false, true},
+		{"*/0", 0, 59, nil, false, true},
+		{"*/x", 0, 59, nil, false, true},
+		{"a-b", 0, 59, nil, false, true},
+		{"mon", 0, 7, nil, false, true},
+		{"", 0, 59, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		err, f := parseCronField(tt.field, tt.min, tt.max)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("expected '%s' to fail", tt.field)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("unexpected error for '%s': %v", tt.field, err)
+			continue
+		}
+
+		if f.any != tt.any {
+			t.Errorf("'%s': expected any=%v", tt.field, tt.any)
+		} else if len(f.values) != len(tt.values) {
+			t.Errorf("'%s': expected %v, got %v", tt.field, tt.values, f.values)
+		} else {
+			for _, v := range tt.values {
+				if !f.values[v] {
+					t.Errorf("'%s': expected %d to match", tt.field, v)
+				}
+			}
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		fail bool
+	}{
+		{"* * * * *", false},
+		{"  0   3 * *   1-5 ", false},
+		{"*/5 8-18 1,15 * 7", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+	}
+
+	for _, tt := range tests {
+		err, c := ParseCron(tt.expr)
+		if tt.fail && err == nil {
+			t.Errorf("expected '%s' to fail", tt.expr)
+		} else if !tt.fail && err != nil {
+			t.Errorf("unexpected error for '%s': %v", tt.expr, err)
+		} else if !tt.fail && c.Expr == "" {
+			t.Errorf("expected a normalized expression for '%s'", tt.expr)
+		}
+	}
+
+	if _, c := ParseCron("  0   3 * *   1-5 "); c.Expr != "0 3 * * 1-5" {
+		t.Fatalf("unexpected normalized expression '%s'", c.Expr)
+	} else if _, c := ParseCron("0 0 * * 7"); !c.dow.values[0] {
+		t.Fatalf("expected 7 to also match sunday as 0")
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// 2018-03-14 is a wednesday
+	tests := []struct {
+		expr string
+		from string
+		next string
+	}{
+		{"* * * * *", "2018-03-14 10:00", "2018-03-14 10:01"},
+		{"*/15 * * * *", "2018-03-14 10:07", "2018-03-14 10:15"},
+		{"30 2 * * *", "2018-03-14 10:00", "2018-03-15 02:30"},
+		{"0 0 1 * *", "2018-03-14 10:00", "2018-04-01 00:00"},
+		{"0 0 1 1 *", "2018-03-14 10:00", "2019-01-01 00:00"},
+		{"0 9 * * 1-5", "2018-03-16 10:00", "2018-03-19 09:00"},
+		{"0 12 * * 0", "2018-03-14 10:00", "2018-03-18 12:00"},
+		{"0 12 * * 7", "2018-03-14 10:00", "2018-03-18 12:00"},
+		// both day fields restricted, either one matching is enough
+		{"0 0 20 * 5", "2018-03-14 10:00", "2018-03-16 00:00"},
+		{"0 0 29 2 *", "2018-03-14 10:00", "2020-02-29 00:00"},
+		{"59 23 31 12 *", "2018-12-31 23:59", "2019-12-31 23:59"},
+	}
+
+	for _, tt := range tests {
+		_, c := ParseCron(tt.expr)
+		if got := c.Next(at(tt.from)); !got.Equal(at(tt.next)) {
+			t.Errorf("'%s' from %s: expected %s, got %s", tt.expr, tt.from, tt.next, got.Format("2006-01-02 15:04"))
+		}
+	}
+
+	// seconds are truncated and the result is strictly after the given time
+	_, c := ParseCron("* * * * *")
+	from := at("2018-03-14 10:00").Add(30 * time.Second)
+	if got := c.Next(from); !got.Equal(at("2018-03-14 10:01")) {
+		t.Fatalf("unexpected next activation %s", got)
+	}
+
+	// february 30th never happens
+	_, c = ParseCron("0 0 30 2 *")
+	if got := c.Next(at("2018-03-14 10:00")); !got.IsZero() {
+		t.Fatalf("expected no activation, got %s", got)
+	}
+}
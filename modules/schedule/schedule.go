@@ -0,0 +1,298 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// the jobs are kept in this variable so that they are saved
+// together with the rest of the environment (see -env-file)
+const jobsVariable = "schedule.jobs"
+
+type Schedule struct {
+	session.SessionModule
+	jobs  *JobList
+	saved string
+	quit  chan bool
+}
+
+func NewSchedule(s *session.Session) *Schedule {
+	mod := &Schedule{
+		SessionModule: session.NewSessionModule("schedule", s),
+		jobs:          NewJobList(),
+		quit:          make(chan bool),
+	}
+
+	mod.AddHandler(session.NewModuleHandler("schedule on", "",
+		"Start running the scheduled jobs.",
+		func(args []string) error {
+			return mod.Start()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("schedule off", "",
+		"Stop running the scheduled jobs.",
+		func(args []string) error {
+			return mod.Stop()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("schedule.add NAME every|cron|at WHEN jitter DURATION? COMMANDS",
+		`schedule\.add\s+([^\s]+)\s+(every|cron|at)\s+(.+)`,
+		"Add a job named NAME running COMMANDS every DURATION (every 10s), following a cron expression (cron */5 * * * *) or once (at 14:30, at 2006-01-02T15:04 or at +10m), optionally delaying each run by a random jitter.",
+		func(args []string) error {
+			return mod.addJob(args[0], args[1], args[2])
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("schedule.list", "",
+		"Show the scheduled jobs.",
+		func(args []string) error {
+			return mod.showJobs()
+		}))
+
+	del := session.NewModuleHandler("schedule.del NAME", `schedule\.del\s+([^\s]+)`,
+		"Remove the job NAME.",
+		func(args []string) error {
+			return mod.delJob(args[0])
+		})
+	del.Complete("schedule.del", mod.jobs.Completer)
+	mod.AddHandler(del)
+
+	pause := session.NewModuleHandler("schedule.pause NAME", `schedule\.pause\s+([^\s]+)`,
+		"Pause the job NAME.",
+		func(args []string) error {
+			return mod.pauseJob(args[0], true)
+		})
+	pause.Complete("schedule.pause", mod.jobs.Completer)
+	mod.AddHandler(pause)
+
+	resume := session.NewModuleHandler("schedule.resume NAME", `schedule\.resume\s+([^\s]+)`,
+		"Resume the paused job NAME.",
+		func(args []string) error {
+			return mod.pauseJob(args[0], false)
+		})
+	resume.Complete("schedule.resume", mod.jobs.Completer)
+	mod.AddHandler(resume)
+
+	mod.loadJobs()
+
+	return mod
+}
+
+func (mod *Schedule) Name() string {
+	return "schedule"
+}
+
+func (mod *Schedule) Description() string {
+	return "Run named lists of commands at fixed intervals, following cron expressions or once at a given time."
+}
+
+func (mod *Schedule) Author() string {
+	return "Simone Margaritelli <evilsocket@gmail.com>"
+}
+
+func (mod *Schedule) loadJobs() {
+	found, raw := mod.Session.Env.Get(jobsVariable)
+	if !found || raw == "" || raw == mod.saved {
+		return
+	}
+
+	mod.jobs.Clear()
+	err, expired := mod.jobs.Load(raw, time.Now())
+	if err != nil {
+		mod.Error("error while loading scheduled jobs: %v", err)
+	}
+	for _, job := range expired {
+		mod.Warning("job %s was scheduled %s while the session was not running, removing it", tui.Bold(job.Name), job.When())
+	}
+	mod.saveJobs()
+}
+
+func (mod *Schedule) saveJobs() {
+	raw, err := mod.jobs.MarshalJSON()
+	if err != nil {
+		mod.Error("error while saving scheduled jobs: %v", err)
+		return
+	}
+	mod.saved = string(raw)
+	mod.Session.Env.Set(jobsVariable, mod.saved)
+}
+
+// parseJob parses what follows the type of schedule:
+// WHEN [jitter DURATION] COMMANDS
+func parseJob(name string, kind string, rest string) (error, *Job) {
+	fields := strings.Fields(rest)
+	nWhen := 1
+	if kind == KindCron {
+		nWhen = 5
+	}
+
+	if len(fields) <= nWhen {
+		return fmt.Errorf("usage: schedule.add NAME %s WHEN [jitter DURATION] COMMANDS", kind), nil
+	}
+
+	job := &Job{
+		Name: name,
+		Kind: kind,
+		Spec: strings.Join(fields[:nWhen], " "),
+	}
+
+	fields = fields[nWhen:]
+	if fields[0] == "jitter" {
+		if len(fields) < 3 {
+			return fmt.Errorf("usage: schedule.add NAME %s WHEN [jitter DURATION] COMMANDS", kind), nil
+		}
+
+		jitter, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid jitter '%s': %v", fields[1], err), nil
+		}
+		job.Jitter = jitter
+		fields = fields[2:]
+	}
+
+	job.Commands = strings.Join(fields, " ")
+
+	return nil, job
+}
+
+func (mod *Schedule) addJob(name string, kind string, rest string) error {
+	err, job := parseJob(name, kind, rest)
+	if err != nil {
+		return err
+	} else if err = mod.jobs.Add(job, time.Now()); err != nil {
+		return err
+	}
+
+	mod.saveJobs()
+	mod.Info("job %s added, next run at %s", tui.Bold(name), job.Next.Format("2006-01-02 15:04:05"))
+	if !mod.Running() {
+		mod.Warning("the scheduler is not running, use 'schedule on' to start it")
+	}
+
+	return nil
+}
+
+func (mod *Schedule) delJob(name string) error {
+	if err := mod.jobs.Del(name); err != nil {
+		return err
+	}
+	mod.saveJobs()
+	return nil
+}
+
+func (mod *Schedule) pauseJob(name string, paused bool) error {
+	if err := mod.jobs.SetPaused(name, paused, time.Now()); err != nil {
+		return err
+	}
+	mod.saveJobs()
+	return nil
+}
+
+func (mod *Schedule) showJobs() error {
+	colNames := []string{
+		"Name",
+		"When",
+		"Jitter",
+		"Commands",
+		"Next Run",
+		"Last Run",
+		"Runs",
+	}
+	rows := [][]string{}
+
+	mod.jobs.Each(func(job *Job) {
+		next := job.Next.Format("2006-01-02 15:04:05")
+		if job.Paused {
+			next = tui.Yellow("paused")
+		} else if job.Next.IsZero() {
+			next = tui.Red("never")
+		}
+
+		last := tui.Dim("-")
+		if !job.LastRun.IsZero() {
+			last = job.LastRun.Format("2006-01-02 15:04:05")
+		}
+
+		jitter := tui.Dim("-")
+		if job.Jitter > 0 {
+			jitter = job.Jitter.String()
+		}
+
+		rows = append(rows, []string{
+			tui.Bold(job.Name),
+			tui.Green(job.When()),
+			jitter,
+			job.Commands,
+			next,
+			last,
+			fmt.Sprintf("%d", job.Runs),
+		})
+	})
+
+	if len(rows) == 0 {
+		fmt.Printf("\nno scheduled jobs.\n\n")
+		return nil
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, colNames, rows)
+	fmt.Println()
+
+	return nil
+}
+
+func (mod *Schedule) run(job Job) {
+	defer mod.jobs.Done(job.Name)
+
+	mod.Debug("running job %s (%s)", job.Name, job.Commands)
+	for _, cmd := range session.ParseCommands(job.Commands) {
+		if err := mod.Session.Exec(session.SourceSchedule+":"+job.Name, cmd); err != nil {
+			mod.Error("job %s: %s", job.Name, err)
+		}
+	}
+}
+
+func (mod *Schedule) Configure() error {
+	if mod.Running() {
+		return session.ErrAlreadyStarted(mod.Name())
+	}
+	// the jobs might have been restored from a workspace
+	mod.loadJobs()
+	return nil
+}
+
+func (mod *Schedule) Start() error {
+	if err := mod.Configure(); err != nil {
+		return err
+	}
+
+	return mod.SetRunning(true, func() {
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+
+		for {
+			select {
+			case now := <-tick.C:
+				if due := mod.jobs.Due(now); len(due) > 0 {
+					mod.saveJobs()
+					for _, job := range due {
+						go mod.run(job)
+					}
+				}
+			case <-mod.quit:
+				return
+			}
+		}
+	})
+}
+
+func (mod *Schedule) Stop() error {
+	return mod.SetRunning(false, func() {
+		mod.quit <- true
+	})
+}
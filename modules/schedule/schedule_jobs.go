@@ -0,0 +1,292 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evilsocket/islazy/str"
+	"github.com/evilsocket/islazy/tui"
+)
+
+const (
+	KindEvery = "every"
+	KindCron  = "cron"
+	KindAt    = "at"
+)
+
+// Job is a named list of commands executed at fixed intervals, following a
+// cron expression or only once at a given time.
+type Job struct {
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+	Spec     string        `json:"spec"`
+	Jitter   time.Duration `json:"jitter"`
+	Commands string        `json:"commands"`
+	Paused   bool          `json:"paused"`
+	Created  time.Time     `json:"created"`
+	LastRun  time.Time     `json:"last_run"`
+	Runs     uint64        `json:"runs"`
+
+	Next    time.Time `json:"-"`
+	running bool
+	every   time.Duration
+	cron    *Cron
+	at      time.Time
+}
+
+// parseAt accepts a clock time (today or tomorrow if already passed), a
+// date and time or an offset from now like +10m.
+func parseAt(spec string, now time.Time) (error, time.Time) {
+	if strings.HasPrefix(spec, "+") {
+		d, err := time.ParseDuration(spec[1:])
+		if err != nil {
+			return fmt.Errorf("invalid offset '%s': %v", spec, err), time.Time{}
+		}
+		return nil, now.Add(d)
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, spec, now.Location()); err == nil {
+			return nil, t
+		}
+	}
+
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, spec, now.Location()); err == nil {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+			return nil, t
+		}
+	}
+
+	return fmt.Errorf("invalid time '%s', use HH:MM, YYYY-MM-DDTHH:MM or +DURATION", spec), time.Time{}
+}
+
+// compile parses the spec of the job, one shot jobs are converted to an
+// absolute time so that they survive a restart.
+func (j *Job) compile(now time.Time) (err error) {
+	switch j.Kind {
+	case KindEvery:
+		if j.every, err = time.ParseDuration(j.Spec); err != nil {
+			return fmt.Errorf("invalid interval '%s': %v", j.Spec, err)
+		} else if j.every < time.Second {
+			return fmt.Errorf("interval '%s' is too short, the minimum is 1s", j.Spec)
+		}
+	case KindCron:
+		if err, j.cron = ParseCron(j.Spec); err != nil {
+			return err
+		}
+		j.Spec = j.cron.Expr
+	case KindAt:
+		if err, j.at = parseAt(j.Spec, now); err != nil {
+			return err
+		}
+		j.Spec = j.at.Format(time.RFC3339)
+	default:
+		return fmt.Errorf("unknown schedule type '%s'", j.Kind)
+	}
+
+	if j.Jitter < 0 {
+		return fmt.Errorf("jitter can't be negative")
+	}
+
+	return nil
+}
+
+// schedule computes the next activation after now.
+func (j *Job) schedule(now time.Time) {
+	switch j.Kind {
+	case KindEvery:
+		j.Next = now.Add(j.every)
+	case KindCron:
+		j.Next = j.cron.Next(now)
+	case KindAt:
+		j.Next = j.at
+	}
+
+	if j.Jitter > 0 && !j.Next.IsZero() {
+		j.Next = j.Next.Add(time.Duration(rand.Int63n(int64(j.Jitter))))
+	}
+}
+
+func (j *Job) When() string {
+	switch j.Kind {
+	case KindEvery:
+		return "every " + j.Spec
+	case KindCron:
+		return "cron " + j.Spec
+	default:
+		return "at " + j.at.Format("2006-01-02 15:04:05")
+	}
+}
+
+type JobList struct {
+	sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewJobList() *JobList {
+	return &JobList{
+		jobs: make(map[string]*Job),
+	}
+}
+
+func (l *JobList) Add(job *Job, now time.Time) error {
+	l.Lock()
+	defer l.Unlock()
+
+	job.Commands = str.Trim(job.Commands)
+	if _, found := l.jobs[job.Name]; found {
+		return fmt.Errorf("a job named '%s' already exists", tui.Bold(job.Name))
+	} else if job.Commands == "" {
+		return fmt.Errorf("no commands given for job '%s'", job.Name)
+	} else if err := job.compile(now); err != nil {
+		return err
+	}
+
+	if job.Created.IsZero() {
+		job.Created = now
+	}
+	job.schedule(now)
+	l.jobs[job.Name] = job
+
+	return nil
+}
+
+func (l *JobList) Del(name string) error {
+	l.Lock()
+	defer l.Unlock()
+	if _, found := l.jobs[name]; !found {
+		return fmt.Errorf("job '%s' not found", tui.Bold(name))
+	}
+	delete(l.jobs, name)
+	return nil
+}
+
+func (l *JobList) SetPaused(name string, paused bool, now time.Time) error {
+	l.Lock()
+	defer l.Unlock()
+	job, found := l.jobs[name]
+	if !found {
+		return fmt.Errorf("job '%s' not found", tui.Bold(name))
+	}
+
+	job.Paused = paused
+	// don't catch up with the activations missed while paused
+	if !paused && job.Kind != KindAt {
+		job.schedule(now)
+	}
+	return nil
+}
+
+// Each iterates the jobs sorted by name.
+func (l *JobList) Each(cb func(job *Job)) {
+	l.Lock()
+	defer l.Unlock()
+
+	names := make([]string, 0, len(l.jobs))
+	for name := range l.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cb(l.jobs[name])
+	}
+}
+
+// Due returns the jobs that should run at the given time and reschedules
+// them, one shot jobs are removed.
+func (l *JobList) Due(now time.Time) []Job {
+	l.Lock()
+	defer l.Unlock()
+
+	due := make([]Job, 0)
+	for name, job := range l.jobs {
+		if job.Paused || job.Next.IsZero() || job.Next.After(now) {
+			continue
+		}
+
+		if job.Kind == KindAt {
+			delete(l.jobs, name)
+		} else {
+			job.schedule(now)
+		}
+
+		// still running since the previous activation
+		if job.running {
+			continue
+		}
+
+		job.running = true
+		job.LastRun = now
+		job.Runs++
+		due = append(due, *job)
+	}
+
+	return due
+}
+
+func (l *JobList) Done(name string) {
+	l.Lock()
+	defer l.Unlock()
+	if job, found := l.jobs[name]; found {
+		job.running = false
+	}
+}
+
+func (l *JobList) Clear() {
+	l.Lock()
+	defer l.Unlock()
+	l.jobs = make(map[string]*Job)
+}
+
+func (l *JobList) Completer(prefix string) []string {
+	names := []string{}
+	l.Each(func(job *Job) {
+		if strings.HasPrefix(job.Name, prefix) {
+			names = append(names, job.Name)
+		}
+	})
+	return names
+}
+
+func (l *JobList) MarshalJSON() ([]byte, error) {
+	jobs := make([]Job, 0)
+	l.Each(func(job *Job) {
+		jobs = append(jobs, *job)
+	})
+	return json.Marshal(jobs)
+}
+
+// Load restores the jobs saved with MarshalJSON, one shot jobs whose time
+// has passed are returned and not loaded.
+func (l *JobList) Load(raw string, now time.Time) (error, []*Job) {
+	jobs := make([]*Job, 0)
+	if err := json.Unmarshal([]byte(raw), &jobs); err != nil {
+		return err, nil
+	}
+
+	expired := make([]*Job, 0)
+	for _, job := range jobs {
+		if job.Kind == KindAt {
+			if err := job.compile(now); err == nil && !job.at.After(now) {
+				expired = append(expired, job)
+				continue
+			}
+		}
+
+		if err := l.Add(job, now); err != nil {
+			return fmt.Errorf("job %s: %v", job.Name, err), expired
+		}
+	}
+
+	return nil, expired
+}
@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var jobsNow = time.Date(2018, 3, 14, 10, 0, 0, 0, time.UTC)
+
+func TestParseAt(t *testing.T) {
+	tests := []struct {
+		spec string
+		want time.Time
+		fail bool
+	}{
+		{"+10m", jobsNow.Add(10 * time.Minute), false},
+		{"12:30", time.Date(2018, 3, 14, 12, 30, 0, 0, time.UTC), false},
+		{"09:15:10", time.Date(2018, 3, 15, 9, 15, 10, 0, time.UTC), false},
+		{"10:00", time.Date(2018, 3, 15, 10, 0, 0, 0, time.UTC), false},
+		{"2018-04-01T08:00", time.Date(2018, 4, 1, 8, 0, 0, 0, time.UTC), false},
+		{"2018-04-01T08:00:05Z", time.Date(2018, 4, 1, 8, 0, 5, 0, time.UTC), false},
+		{"+10x", time.Time{}, true},
+		{"tomorrow", time.Time{}, true},
+		{"25:00", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		err, got := parseAt(tt.spec, jobsNow)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("expected '%s' to fail", tt.spec)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error for '%s': %v", tt.spec, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("'%s': expected %s, got %s", tt.spec, tt.want, got)
+		}
+	}
+}
+
+func TestJobListAdd(t *testing.T) {
+	tests := []struct {
+		job  Job
+		next time.Time
+		fail bool
+	}{
+		{Job{Name: "every", Kind: KindEvery, Spec: "30s", Commands: "net.probe on"}, jobsNow.Add(30 * time.Second), false},
+		{Job{Name: "cron", Kind: KindCron, Spec: "0 12 * * *", Commands: "net.show"}, time.Date(2018, 3, 14, 12, 0, 0, 0, time.UTC), false},
+		{Job{Name: "at", Kind: KindAt, Spec: "+1h", Commands: "quit"}, jobsNow.Add(time.Hour), false},
+		{Job{Name: "short", Kind: KindEvery, Spec: "500ms", Commands: "net.show"}, time.Time{}, true},
+		{Job{Name: "bad", Kind: KindEvery, Spec: "often", Commands: "net.show"}, time.Time{}, true},
+		{Job{Name: "badcron", Kind: KindCron, Spec: "* * *", Commands: "net.show"}, time.Time{}, true},
+		{Job{Name: "kind", Kind: "sometimes", Spec: "1m", Commands: "net.show"}, time.Time{}, true},
+		{Job{Name: "empty", Kind: KindEvery, Spec: "1m", Commands: "  "}, time.Time{}, true},
+		{Job{Name: "jitter", Kind: KindEvery, Spec: "1m", Commands: "net.show", Jitter: -time.Second}, time.Time{}, true},
+		{Job{Name: "every", Kind: KindEvery, Spec: "1m", Commands: "net.show"}, time.Time{}, true},
+	}
+
+	l := NewJobList()
+	for _, tt := range tests {
+		job := tt.job
+		err := l.Add(&job, jobsNow)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("expected job '%s' to be rejected", tt.job.Name)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error for job '%s': %v", tt.job.Name, err)
+		} else if !job.Next.Equal(tt.next) {
+			t.Errorf("job '%s': expected next run at %s, got %s", job.Name, tt.next, job.Next)
+		} else if !job.Created.Equal(jobsNow) {
+			t.Errorf("job '%s': unexpected creation time %s", job.Name, job.Created)
+		}
+	}
+
+	names := []string{}
+	l.Each(func(job *Job) {
+		names = append(names, job.Name)
+	})
+	if len(names) != 3 || names[0] != "at" || names[1] != "cron" || names[2] != "every" {
+		t.Fatalf("unexpected jobs %v", names)
+	}
+}
+
+func TestJobListDue(t *testing.T) {
+	l := NewJobList()
+	l.Add(&Job{Name: "every", Kind: KindEvery, Spec: "1m", Commands: "a"}, jobsNow)
+	l.Add(&Job{Name: "at", Kind: KindAt, Spec: "+90s", Commands: "b"}, jobsNow)
+	l.Add(&Job{Name: "paused", Kind: KindEvery, Spec: "1m", Commands: "c"}, jobsNow)
+	l.SetPaused("paused", true, jobsNow)
+
+	if due := l.Due(jobsNow.Add(30 * time.Second)); len(due) != 0 {
+		t.Fatalf("expected no due jobs, got %v", due)
+	}
+
+	now := jobsNow.Add(time.Minute)
+	due := l.Due(now)
+	if len(due) != 1 || due[0].Name != "every" || due[0].Runs != 1 || !due[0].LastRun.Equal(now) {
+		t.Fatalf("unexpected due jobs %+v", due)
+	}
+
+	// still running, the activation is skipped but the job is rescheduled
+	now = now.Add(time.Minute)
+	if due := l.Due(now); len(due) != 1 || due[0].Name != "at" {
+		t.Fatalf("unexpected due jobs %+v", due)
+	}
+
+	l.Done("every")
+	now = now.Add(time.Minute)
+	if due := l.Due(now); len(due) != 1 || due[0].Name != "every" || due[0].Runs != 2 {
+		t.Fatalf("unexpected due jobs %+v", due)
+	}
+
+	// one shot jobs are removed once due
+	found := false
+	l.Each(func(job *Job) {
+		found = found || job.Name == "at"
+	})
+	if found {
+		t.Fatalf("expected the one shot job to be removed")
+	}
+
+	// resuming doesn't catch up with the missed activations
+	l.SetPaused("paused", false, now)
+	if due := l.Due(now); len(due) != 0 {
+		t.Fatalf("expected no due jobs right after resuming, got %+v", due)
+	} else if due := l.Due(now.Add(time.Minute)); len(due) != 1 || due[0].Name != "paused" {
+		t.Fatalf("unexpected due jobs %+v", due)
+	}
+
+	if err := l.SetPaused("nope", true, now); err == nil {
+		t.Fatalf("expected an error pausing an unknown job")
+	} else if err := l.Del("nope"); err == nil {
+		t.Fatalf("expected an error deleting an unknown job")
+	} else if err := l.Del("every"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobListPersistence(t *testing.T) {
+	l := NewJobList()
+	l.Add(&Job{Name: "every", Kind: KindEvery, Spec: "1m", Commands: "a", Jitter: time.Second}, jobsNow)
+	l.Add(&Job{Name: "cron", Kind: KindCron, Spec: "0  12 * * *", Commands: "b"}, jobsNow)
+	l.Add(&Job{Name: "later", Kind: KindAt, Spec: "+2h", Commands: "c"}, jobsNow)
+	l.Add(&Job{Name: "soon", Kind: KindAt, Spec: "+1m", Commands: "d"}, jobsNow)
+	l.SetPaused("cron", true, jobsNow)
+
+	raw, err := json.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewJobList()
+	err, expired := loaded.Load(string(raw), jobsNow.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(expired) != 1 || expired[0].Name != "soon" {
+		t.Fatalf("unexpected expired jobs %+v", expired)
+	}
+
+	jobs := make(map[string]*Job)
+	loaded.Each(func(job *Job) {
+		jobs[job.Name] = job
+	})
+
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 jobs, got %d", len(jobs))
+	} else if j := jobs["every"]; j.Jitter != time.Second || j.Commands != "a" {
+		t.Fatalf("unexpected job %+v", j)
+	} else if j := jobs["cron"]; !j.Paused || j.Spec != "0 12 * * *" {
+		t.Fatalf("unexpected job %+v", j)
+	} else if j := jobs["later"]; !j.Next.Equal(jobsNow.Add(2 * time.Hour)) {
+		t.Fatalf("expected the one shot job to keep its absolute time, got %s", j.Next)
+	}
+
+	if err, _ := NewJobList().Load("{", jobsNow); err == nil {
+		t.Fatalf("expected an error loading invalid json")
+	}
+}
@@ -1,41 +1,57 @@
 package syn_scan
 
 import (
-	"fmt"
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bettercap/bettercap/network"
+
 	"github.com/evilsocket/islazy/async"
 )
 
 const bannerGrabTimeout = time.Duration(5) * time.Second
 
-type bannerGrabberFn func(mod *SynScanner, ip string, port int) string
-
 type grabberJob struct {
 	IP   string
+	Host *network.Endpoint
 	Port *OpenPort
 }
 
+func cleanBanner(banner string) string {
+	clean := ""
+	for _, c := range banner {
+		if strconv.IsPrint(c) {
+			clean += string(c)
+		}
+	}
+	return clean
+}
+
 func (mod *SynScanner) bannerGrabber(arg async.Job) {
 	job := arg.(grabberJob)
-	if job.Port.Proto != "tcp" {
-		return
+	ip := job.IP
+	port := job.Port
+	// link-local addresses are only meaningful with their zone
+	if addr := net.ParseIP(ip); addr.To4() == nil && addr.IsLinkLocalUnicast() {
+		ip += "%" + mod.Session.Interface.Name()
 	}
 
-	ip := job.IP
-	port := job.Port.Port
-	sport := fmt.Sprintf("%d", port)
-
-	fn := tcpGrabber
-	if port == 80 || port == 443 || sport[0] == '8' {
-		fn = httpGrabber
-	} else if port == 53 || port == 5353 {
-		fn = dnsGrabber
+	mod.Debug("detecting service for %s:%d/%s", ip, port.Port, port.Proto)
+	response := mod.detectService(ip, port)
+
+	if port.Service == "http" {
+		port.Banner = httpGrabber(mod, ip, port.Port, port.Tunnel == "ssl")
+	} else if len(response) > 0 {
+		line, _ := bufio.NewReader(bytes.NewReader(response)).ReadString('\n')
+		port.Banner = cleanBanner(strings.Trim(line, "\r\n\t "))
 	}
 
-	mod.Debug("grabbing banner for %s:%d", ip, port)
-	job.Port.Banner = fn(mod, ip, port)
-	if job.Port.Banner != "" {
-		mod.Info("found banner for %s:%d -> %s", ip, port, job.Port.Banner)
+	if port.Product != "" || port.Banner != "" {
+		mod.Info("found %s service for %s:%d/%s -> %s", port.Service, job.IP, port.Port, port.Proto, port.Description())
+		NewSynScanEvent(job.IP, job.Host, port).PushService()
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"golang.org/x/net/html"
+	"net"
 	"net/http"
 	"strings"
 )
@@ -27,7 +28,7 @@ func searchForTitle(n *html.Node) string {
 	return ""
 }
 
-func httpGrabber(mod *SynScanner, ip string, port int) string {
+func httpGrabber(mod *SynScanner, ip string, port int, ssl bool) string {
 	schema := "http"
 	client := &http.Client{
 		Timeout: bannerGrabTimeout,
@@ -37,7 +38,7 @@ func httpGrabber(mod *SynScanner, ip string, port int) string {
 	}
 
 	sport := fmt.Sprintf("%d", port)
-	if strings.Contains(sport, "443") {
+	if ssl {
 		schema = "https"
 		client = &http.Client{
 			Timeout: bannerGrabTimeout,
@@ -55,7 +56,7 @@ func httpGrabber(mod *SynScanner, ip string, port int) string {
 		}
 	}
 
-	url := fmt.Sprintf("%s://%s:%d/", schema, ip, port)
+	url := fmt.Sprintf("%s://%s/", schema, net.JoinHostPort(ip, sport))
 	resp, err := client.Get(url)
 	if err != nil {
 		mod.Debug("error while grabbing banner from %s: %v", url, err)
@@ -0,0 +1,185 @@
+package syn_scan
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// only try the most common probes on ports without specific ones, like
+	// nmap --version-light does
+	serviceProbeIntensity = 2
+	maxProbeWait          = time.Duration(3) * time.Second
+	maxProbeResponse      = 64 * 1024
+)
+
+var (
+	builtinProbesOnce sync.Once
+	builtinProbes     *ServiceProbes
+)
+
+func getBuiltinProbes() *ServiceProbes {
+	builtinProbesOnce.Do(func() {
+		var err error
+		if builtinProbes, err = ParseServiceProbes(strings.NewReader(builtinServiceProbes)); err != nil {
+			panic(err)
+		}
+	})
+	return builtinProbes
+}
+
+type Certificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SHA256    string    `json:"sha256"`
+}
+
+func (mod *SynScanner) grabCertificate(address string) *Certificate {
+	dialer := &net.Dialer{Timeout: bannerGrabTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		mod.Debug("tls handshake with %s failed: %v", address, err)
+		return nil
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+
+	cert := certs[0]
+	fingerprint := sha256.Sum256(cert.Raw)
+	return &Certificate{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		SHA256:    hex.EncodeToString(fingerprint[:]),
+	}
+}
+
+// sends the probe and reads the response until it's identified or the
+// probe wait time expires
+func (mod *SynScanner) exchange(address string, probe *serviceProbe, ssl bool) ([]byte, *ServiceResult, error) {
+	dialer := net.Dialer{Timeout: bannerGrabTimeout}
+	conn, err := dialer.Dial(probe.proto, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	wait := probe.wait
+	if wait > maxProbeWait {
+		wait = maxProbeWait
+	}
+	conn.SetDeadline(time.Now().Add(wait))
+
+	if ssl {
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		if err = tlsConn.Handshake(); err != nil {
+			return nil, nil, err
+		}
+		conn = tlsConn
+	}
+
+	if len(probe.payload) > 0 {
+		if _, err = conn.Write(probe.payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	buf := make([]byte, 4096)
+	response := make([]byte, 0)
+	for len(response) < maxProbeResponse {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			response = append(response, buf[:n]...)
+			if result := mod.serviceProbes.Match(probe, response); result != nil && !result.Soft {
+				return response, result, nil
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	return response, mod.serviceProbes.Match(probe, response), nil
+}
+
+// sends the probes until one identifies the service, returning the result
+// and the first response received
+func (mod *SynScanner) runProbes(address string, port *OpenPort, ssl bool) (*ServiceResult, []byte) {
+	var soft *ServiceResult
+	var banner []byte
+
+	for _, probe := range mod.serviceProbes.Probes(port.Proto, port.Port, ssl, serviceProbeIntensity) {
+		// once we know what it is, only send the probes that can tell us more
+		if soft != nil && !probe.HasMatchesFor(soft.Service) {
+			continue
+		} else if ssl && probe.HasMatchesFor("ssl") {
+			continue
+		}
+
+		mod.Debug("sending probe %s to %s/%s", probe.name, address, port.Proto)
+		response, result, err := mod.exchange(address, probe, ssl)
+		if err != nil {
+			mod.Debug("probe %s to %s failed: %v", probe.name, address, err)
+			break
+		}
+
+		if banner == nil && len(response) > 0 {
+			banner = response
+		}
+
+		if result == nil || (ssl && result.Service == "ssl") {
+			continue
+		} else if !result.Soft {
+			return result, banner
+		} else if soft == nil {
+			soft = result
+		}
+	}
+
+	return soft, banner
+}
+
+// detectService identifies the service listening on the port, unwrapping
+// it from ssl if needed.
+func (mod *SynScanner) detectService(ip string, port *OpenPort) []byte {
+	address := net.JoinHostPort(ip, strconv.Itoa(port.Port))
+	result, banner := mod.runProbes(address, port, false)
+
+	if result != nil && result.Service == "ssl" && port.Proto == "tcp" {
+		if port.Certificate = mod.grabCertificate(address); port.Certificate != nil {
+			port.Tunnel = "ssl"
+			if wrapped, wrappedBanner := mod.runProbes(address, port, true); wrapped != nil {
+				result = wrapped
+				banner = wrappedBanner
+			}
+		}
+	}
+
+	if result != nil {
+		port.Service = result.Service
+		port.Product = result.Product
+		port.Version = result.Version
+		port.Info = result.Info
+		port.Hostname = result.Hostname
+		port.OS = result.OS
+		port.DeviceType = result.DeviceType
+		port.CPE = result.CPE
+	}
+
+	return banner
+}
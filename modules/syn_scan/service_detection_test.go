@@ -0,0 +1,199 @@
+package syn_scan
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/bettercap/bettercap/session"
+)
+
+func TestServiceProbesMatch(t *testing.T) {
+	db := parseTestProbes(t)
+
+	tests := []struct {
+		probe    string
+		response string
+		service  string
+		product  string
+		version  string
+		info     string
+		hostname string
+		soft     bool
+	}{
+		{"tcp/NULL", "SSH-2.0-OpenSSH_7.4\r\n", "ssh", "OpenSSH", "7.4", "protocol 2.0", "", false},
+		{"tcp/NULL", "220 ftp.example.com FTP server (Version 6_00LS) ready.\r\n", "ftp", "BSD ftpd", "6.00LS", "", "ftp.example.com", false},
+		{"tcp/NULL", "220 welcome\r\n", "ftp", "", "", "", "", true},
+		{"tcp/NULL", "aa", "", "", "", "", "", false},
+		{"tcp/NULL", "", "", "", "", "", "", false},
+		{"tcp/GetRequest", "HTTP/1.1 200 OK\r\nServer: nginx/1.14.0\r\n\r\n", "http", "nginx", "1.14.0", "", "", false},
+		{"tcp/GetRequest", "HTTP/1.1 200 OK\r\nServer: Apache\r\n\r\n", "http", "", "", "", "", true},
+		// the fallback probe matches
+		{"tcp/GetRequest", "foo bar\x00", "foo", "Foo server", "bar", "", "", false},
+		// tcp probes fall back to the NULL one
+		{"tcp/GetRequest", "SSH-2.0-OpenSSH_8.0\n", "ssh", "OpenSSH", "8.0", "protocol 2.0", "", false},
+		{"tcp/FooRequest", "HTTP/1.1 200 OK\r\n\r\n", "", "", "", "", "", false},
+		{"udp/Counter", "\x02\x01\x02", "counter", "Counter", "", "count 258 513", "", false},
+		// but udp ones don't
+		{"udp/Counter", "SSH-2.0-OpenSSH_8.0\n", "", "", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		result := db.Match(db.byName[tt.probe], []byte(tt.response))
+		if tt.service == "" {
+			if result != nil {
+				t.Errorf("%s %q: unexpected match %+v", tt.probe, tt.response, result)
+			}
+			continue
+		} else if result == nil {
+			t.Errorf("%s %q: expected a match", tt.probe, tt.response)
+			continue
+		}
+
+		if result.Service != tt.service || result.Product != tt.product || result.Version != tt.version {
+			t.Errorf("%s %q: expected %s %s %s, got %+v", tt.probe, tt.response, tt.service, tt.product, tt.version, result)
+		} else if result.Info != tt.info || result.Hostname != tt.hostname {
+			t.Errorf("%s %q: expected info '%s' and hostname '%s', got %+v", tt.probe, tt.response, tt.info, tt.hostname, result)
+		} else if result.Soft != tt.soft {
+			t.Errorf("%s %q: expected soft=%v", tt.probe, tt.response, tt.soft)
+		}
+	}
+
+	result := db.Match(db.byName["tcp/NULL"], []byte("SSH-2.0-OpenSSH_7.4\r\n"))
+	if len(result.CPE) != 1 || result.CPE[0] != "cpe:/a:openbsd:openssh:7.4" {
+		t.Fatalf("unexpected cpe %v", result.CPE)
+	}
+}
+
+func TestServiceProbesOrder(t *testing.T) {
+	db := parseTestProbes(t)
+
+	tests := []struct {
+		proto     string
+		port      int
+		ssl       bool
+		intensity int
+		probes    string
+	}{
+		{"tcp", 80, false, 2, "NULL,GetRequest"},
+		{"tcp", 8005, false, 0, "NULL,GetRequest"},
+		{"tcp", 9999, false, 2, "NULL,FooRequest,GetRequest"},
+		{"tcp", 443, true, 0, "NULL,GetRequest"},
+		{"tcp", 443, false, 0, "NULL"},
+		{"tcp", 22, false, 9, "NULL,GetRequest,FooRequest"},
+		{"udp", 1234, false, 2, "Counter"},
+		{"udp", 53, false, 9, ""},
+	}
+
+	for _, tt := range tests {
+		names := []string{}
+		for _, probe := range db.Probes(tt.proto, tt.port, tt.ssl, tt.intensity) {
+			names = append(names, probe.name)
+		}
+		if got := strings.Join(names, ","); got != tt.probes {
+			t.Errorf("%s/%d (ssl=%v, intensity=%d): expected '%s', got '%s'", tt.proto, tt.port, tt.ssl, tt.intensity, tt.probes, got)
+		}
+	}
+}
+
+func TestBuiltinServiceProbes(t *testing.T) {
+	db := getBuiltinProbes()
+	if db.Skipped != 0 {
+		t.Fatalf("%d builtin matches are not supported", db.Skipped)
+	}
+
+	tests := []struct {
+		probe    string
+		response string
+		product  string
+		version  string
+	}{
+		{"tcp/NULL", "SSH-2.0-dropbear_2019.78\r\n", "Dropbear sshd", "2019.78"},
+		{"tcp/NULL", "220 (vsFTPd 3.0.3)\r\n", "vsftpd", "3.0.3"},
+		{"tcp/NULL", "J\x00\x00\x00\x0a5.7.33-log\x00", "MySQL", "5.7.33-log"},
+		{"tcp/NULL", "RFB 003.008\n", "VNC", ""},
+		{"tcp/GetRequest", "HTTP/1.1 404 Not Found\r\nDate: now\r\nServer: Apache/2.4.29 (Ubuntu)\r\n\r\n", "Apache httpd", "2.4.29"},
+		{"udp/NTPRequest", "\x1c\x02" + strings.Repeat("\x00", 46), "NTP", ""},
+	}
+
+	for _, tt := range tests {
+		result := db.Match(db.byName[tt.probe], []byte(tt.response))
+		if result == nil || result.Soft {
+			t.Errorf("%s %q: expected a match, got %+v", tt.probe, tt.response, result)
+		} else if result.Product != tt.product || result.Version != tt.version {
+			t.Errorf("%s %q: expected %s %s, got %+v", tt.probe, tt.response, tt.product, tt.version, result)
+		}
+	}
+}
+
+// serves the connections of a local listener with the given handler
+func serveTest(t *testing.T, handler func(conn net.Conn)) (net.Listener, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+
+	return l, l.Addr().(*net.TCPAddr).Port
+}
+
+func TestDetectService(t *testing.T) {
+	// don't wait for the banners longer than needed
+	db, err := ParseServiceProbes(strings.NewReader(strings.Replace(testServiceProbes, "totalwaitms 6000", "totalwaitms 200", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mod := &SynScanner{
+		SessionModule: session.NewSessionModule("syn.scan", &session.Session{Events: session.NewEventPool(false, true)}),
+		serviceProbes: db,
+	}
+
+	tests := []struct {
+		name    string
+		handler func(conn net.Conn)
+		service string
+		product string
+		version string
+		banner  string
+	}{
+		{"banner", func(conn net.Conn) {
+			conn.Write([]byte("SSH-2.0-OpenSSH_7.4\r\n"))
+		}, "ssh", "OpenSSH", "7.4", "SSH-2.0-OpenSSH_7.4\r\n"},
+		{"request", func(conn net.Conn) {
+			if line, _ := bufio.NewReader(conn).ReadString('\n'); strings.HasPrefix(line, "GET /") {
+				conn.Write([]byte("HTTP/1.0 200 OK\r\nServer: nginx/1.14.0\r\n\r\n"))
+			}
+		}, "http", "nginx", "1.14.0", "HTTP/1.0 200 OK\r\nServer: nginx/1.14.0\r\n\r\n"},
+		{"soft match", func(conn net.Conn) {
+			conn.Write([]byte("220 welcome\r\n"))
+		}, "ftp", "", "", "220 welcome\r\n"},
+		{"unknown", func(conn net.Conn) {}, "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		l, port := serveTest(t, tt.handler)
+		open := &OpenPort{Proto: "tcp", Port: port}
+		banner := mod.detectService("127.0.0.1", open)
+		l.Close()
+
+		if open.Service != tt.service || open.Product != tt.product || open.Version != tt.version {
+			t.Errorf("%s: expected %s %s %s, got %+v", tt.name, tt.service, tt.product, tt.version, open)
+		} else if string(banner) != tt.banner {
+			t.Errorf("%s: expected banner %q, got %q", tt.name, tt.banner, banner)
+		}
+	}
+}
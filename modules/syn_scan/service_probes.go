@@ -0,0 +1,520 @@
+package syn_scan
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Parser and matcher for a subset of the nmap-service-probes format, see
+// https://nmap.org/book/vscan-fileformat.html
+//
+// Patterns are compiled with the Go regexp engine, the ones using PCRE only
+// features such as backreferences or lookarounds are skipped. Responses are
+// matched as latin1 strings so that \xHH in patterns matches the byte 0xHH.
+
+const defaultProbeWait = time.Duration(5) * time.Second
+
+type portRange struct {
+	from int
+	to   int
+}
+
+type portSet []portRange
+
+func parsePortSet(spec string) (portSet, error) {
+	set := portSet{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%s'", part)
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid port range '%s'", part)
+			}
+		}
+		set = append(set, portRange{from, to})
+	}
+	return set, nil
+}
+
+func (s portSet) Contains(port int) bool {
+	for _, r := range s {
+		if port >= r.from && port <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceResult is what a match tells us about the service.
+type ServiceResult struct {
+	Service    string
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+	CPE        []string
+	Soft       bool
+}
+
+type serviceMatch struct {
+	soft       bool
+	service    string
+	pattern    *regexp.Regexp
+	product    string
+	version    string
+	info       string
+	hostname   string
+	os         string
+	deviceType string
+	cpe        []string
+}
+
+type serviceProbe struct {
+	proto    string
+	name     string
+	payload  []byte
+	ports    portSet
+	sslPorts portSet
+	rarity   int
+	wait     time.Duration
+	fallback []string
+	matches  []*serviceMatch
+}
+
+// ServiceProbes is a signature database.
+type ServiceProbes struct {
+	probes  []*serviceProbe
+	byName  map[string]*serviceProbe
+	Skipped int
+}
+
+func LoadServiceProbes(fileName string) (*ServiceProbes, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return ParseServiceProbes(fp)
+}
+
+func ParseServiceProbes(r io.Reader) (*ServiceProbes, error) {
+	db := &ServiceProbes{
+		probes: make([]*serviceProbe, 0),
+		byName: make(map[string]*serviceProbe),
+	}
+
+	var probe *serviceProbe
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		directive := line
+		args := ""
+		if idx := strings.IndexByte(line, ' '); idx != -1 {
+			directive, args = line[:idx], strings.TrimSpace(line[idx+1:])
+		}
+
+		if directive == "Probe" {
+			var err error
+			if probe, err = parseProbe(args); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			db.probes = append(db.probes, probe)
+			db.byName[probe.proto+"/"+probe.name] = probe
+			continue
+		} else if directive == "Exclude" {
+			continue
+		} else if probe == nil {
+			return nil, fmt.Errorf("line %d: %s outside of a probe", lineNo, directive)
+		}
+
+		var err error
+		switch directive {
+		case "match", "softmatch":
+			var m *serviceMatch
+			if m, err = parseMatch(args, directive == "softmatch"); err == nil {
+				if m.pattern == nil {
+					db.Skipped++
+				} else {
+					probe.matches = append(probe.matches, m)
+				}
+			}
+		case "ports":
+			probe.ports, err = parsePortSet(args)
+		case "sslports":
+			probe.sslPorts, err = parsePortSet(args)
+		case "rarity":
+			probe.rarity, err = strconv.Atoi(args)
+		case "totalwaitms":
+			var ms int
+			if ms, err = strconv.Atoi(args); err == nil {
+				probe.wait = time.Duration(ms) * time.Millisecond
+			}
+		case "fallback":
+			probe.fallback = strings.Split(args, ",")
+		case "tcpwrappedms":
+			// not supported
+		default:
+			err = fmt.Errorf("unknown directive %s", directive)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Probe <TCP|UDP> <name> q|<payload>| [no-payload]
+func parseProbe(args string) (*serviceProbe, error) {
+	parts := strings.SplitN(args, " ", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid probe '%s'", args)
+	}
+
+	proto := strings.ToLower(parts[0])
+	if proto != "tcp" && proto != "udp" {
+		return nil, fmt.Errorf("invalid probe protocol '%s'", parts[0])
+	}
+
+	data := parts[2]
+	if len(data) < 3 || data[0] != 'q' {
+		return nil, fmt.Errorf("invalid probe string '%s'", data)
+	}
+	delim := data[1]
+	end := strings.IndexByte(data[2:], delim)
+	if end == -1 {
+		return nil, fmt.Errorf("unterminated probe string '%s'", data)
+	}
+
+	return &serviceProbe{
+		proto:   proto,
+		name:    parts[1],
+		payload: unescapeProbe(data[2 : 2+end]),
+		wait:    defaultProbeWait,
+		matches: make([]*serviceMatch, 0),
+	}, nil
+}
+
+func unescapeProbe(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case '0':
+			out = append(out, 0)
+		case 'a':
+			out = append(out, '\a')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case 'x':
+			if i+2 < len(s) {
+				if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					out = append(out, byte(b))
+					i += 2
+					continue
+				}
+			}
+			out = append(out, 'x')
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out
+}
+
+func isHex(s string, i int) bool {
+	return i < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[i]) != -1
+}
+
+// PCRE accepts \0 as the NUL character and \x with a single hex digit, Go
+// only accepts the former as part of an octal escape and requires two digits.
+func pcreToGo(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			next := pattern[i+1]
+			if next == '0' && (i+2 == len(pattern) || pattern[i+2] < '0' || pattern[i+2] > '7') {
+				b.WriteString(`\x00`)
+			} else if next == 'x' && isHex(pattern, i+2) && !isHex(pattern, i+3) {
+				b.WriteString(`\x0`)
+			} else {
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			}
+			i++
+			continue
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// reads a <letter><delimiter>value<delimiter> field returning the value, the
+// optional trailing flags and what's left of the string
+func nextField(s string, prefix string) (value, flags, rest string, err error) {
+	s = s[len(prefix):]
+	if len(s) == 0 {
+		return "", "", "", fmt.Errorf("missing delimiter")
+	}
+	delim := s[0]
+	end := strings.IndexByte(s[1:], delim)
+	if end == -1 {
+		return "", "", "", fmt.Errorf("unterminated field")
+	}
+	value = s[1 : 1+end]
+	rest = s[2+end:]
+	for len(rest) > 0 && rest[0] != ' ' {
+		flags += rest[:1]
+		rest = rest[1:]
+	}
+	return value, flags, strings.TrimSpace(rest), nil
+}
+
+// match <service> m/<pattern>/[opts] [p/product/] [v/version/] [i/info/]
+// [h/hostname/] [o/os/] [d/devicetype/] [cpe:/cpe/[a]]
+func parseMatch(args string, soft bool) (*serviceMatch, error) {
+	idx := strings.IndexByte(args, ' ')
+	if idx == -1 || !strings.HasPrefix(args[idx+1:], "m") {
+		return nil, fmt.Errorf("invalid match '%s'", args)
+	}
+
+	m := &serviceMatch{
+		soft:    soft,
+		service: args[:idx],
+		cpe:     make([]string, 0),
+	}
+
+	pattern, flags, rest, err := nextField(args[idx+1:], "m")
+	if err != nil {
+		return nil, err
+	}
+
+	expr := pcreToGo(pattern)
+	if strings.Contains(flags, "s") {
+		expr = "(?s)" + expr
+	}
+	if strings.Contains(flags, "i") {
+		expr = "(?i)" + expr
+	}
+	// leave the pattern empty if it's not supported
+	m.pattern, _ = regexp.Compile(expr)
+
+	for rest != "" {
+		var value string
+		if strings.HasPrefix(rest, "cpe:") {
+			if value, _, rest, err = nextField(rest, "cpe:"); err != nil {
+				return nil, err
+			}
+			m.cpe = append(m.cpe, "cpe:/"+value)
+			continue
+		}
+
+		field := rest[:1]
+		if value, _, rest, err = nextField(rest, field); err != nil {
+			return nil, err
+		}
+
+		switch field {
+		case "p":
+			m.product = value
+		case "v":
+			m.version = value
+		case "i":
+			m.info = value
+		case "h":
+			m.hostname = value
+		case "o":
+			m.os = value
+		case "d":
+			m.deviceType = value
+		default:
+			return nil, fmt.Errorf("unknown version field '%s'", field)
+		}
+	}
+
+	return m, nil
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 128 && unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+var templateHelper = regexp.MustCompile(`\$(P|I|SUBST)\((\d)(?:,"([^"]*)")?(?:,"([^"]*)")?\)|\$(\d)`)
+
+// expands $1, $P(1), $SUBST(1,"from","to") and $I(1,">") with the submatches
+func expandTemplate(template string, submatches []string) string {
+	expanded := templateHelper.ReplaceAllStringFunc(template, func(helper string) string {
+		m := templateHelper.FindStringSubmatch(helper)
+		idx := m[2]
+		if m[5] != "" {
+			idx = m[5]
+		}
+
+		n, _ := strconv.Atoi(idx)
+		if n >= len(submatches) {
+			return ""
+		}
+		value := submatches[n]
+
+		switch m[1] {
+		case "P":
+			return printable(value)
+		case "SUBST":
+			return strings.Replace(value, m[3], m[4], -1)
+		case "I":
+			num := uint64(0)
+			runes := []rune(value)
+			for i := range runes {
+				if m[3] == "<" {
+					num |= uint64(runes[i]&0xff) << (8 * uint(i))
+				} else {
+					num = num<<8 | uint64(runes[i]&0xff)
+				}
+			}
+			return strconv.FormatUint(num, 10)
+		}
+		return value
+	})
+	return strings.TrimSpace(expanded)
+}
+
+func (m *serviceMatch) Match(response string) *ServiceResult {
+	submatches := m.pattern.FindStringSubmatch(response)
+	if submatches == nil {
+		return nil
+	}
+
+	result := &ServiceResult{
+		Service:    m.service,
+		Product:    expandTemplate(m.product, submatches),
+		Version:    expandTemplate(m.version, submatches),
+		Info:       expandTemplate(m.info, submatches),
+		Hostname:   expandTemplate(m.hostname, submatches),
+		OS:         expandTemplate(m.os, submatches),
+		DeviceType: expandTemplate(m.deviceType, submatches),
+		CPE:        make([]string, 0),
+		Soft:       m.soft,
+	}
+	for _, cpe := range m.cpe {
+		result.CPE = append(result.CPE, expandTemplate(cpe, submatches))
+	}
+	return result
+}
+
+// Match returns the first hard match of the response to the probe, trying
+// the probe's matches, the ones of its fallbacks and for tcp the ones of the
+// NULL probe, or the first soft match if no hard match was found.
+func (db *ServiceProbes) Match(probe *serviceProbe, response []byte) *ServiceResult {
+	candidates := []*serviceProbe{probe}
+	for _, name := range probe.fallback {
+		if fallback, found := db.byName[probe.proto+"/"+name]; found {
+			candidates = append(candidates, fallback)
+		}
+	}
+	if null, found := db.byName["tcp/NULL"]; found && probe.proto == "tcp" && probe != null {
+		candidates = append(candidates, null)
+	}
+
+	data := latin1(response)
+	var soft *ServiceResult
+	for _, candidate := range candidates {
+		for _, m := range candidate.matches {
+			if result := m.Match(data); result == nil {
+				continue
+			} else if !result.Soft {
+				return result
+			} else if soft == nil {
+				soft = result
+			}
+		}
+	}
+	return soft
+}
+
+// Probes returns the probes to send to a port in order: the NULL one
+// (which only waits for a banner), the ones for this port and the common
+// ones with a rarity up to the given intensity.
+func (db *ServiceProbes) Probes(proto string, port int, ssl bool, intensity int) []*serviceProbe {
+	probes := make([]*serviceProbe, 0)
+	rest := make([]*serviceProbe, 0)
+	for _, probe := range db.probes {
+		if probe.proto != proto {
+			continue
+		} else if probe.name == "NULL" {
+			probes = append([]*serviceProbe{probe}, probes...)
+		} else if probe.ports.Contains(port) || (ssl && probe.sslPorts.Contains(port)) {
+			probes = append(probes, probe)
+		} else if probe.rarity <= intensity && proto == "tcp" {
+			rest = append(rest, probe)
+		}
+	}
+	return append(probes, rest...)
+}
+
+// HasMatchesFor returns true if the probe can identify the service.
+func (probe *serviceProbe) HasMatchesFor(service string) bool {
+	for _, m := range probe.matches {
+		if m.service == service && !m.soft {
+			return true
+		}
+	}
+	return false
+}
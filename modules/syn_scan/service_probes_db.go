@@ -0,0 +1,91 @@
+package syn_scan
+
+// A small subset of the nmap-service-probes database covering the most
+// common services, it can be replaced with a complete one by setting the
+// syn.scan.probes parameter.
+const builtinServiceProbes = `
+Probe TCP NULL q||
+totalwaitms 6000
+
+match ssh m|^SSH-([\d.]+)-OpenSSH[_-]([\w.]+)[ -]*([^\r\n]*)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1 $3/ cpe:/a:openbsd:openssh:$2/
+match ssh m|^SSH-([\d.]+)-dropbear[_-]([\w.]+)\r?\n| p/Dropbear sshd/ v/$2/ i/protocol $1/ cpe:/a:matt_johnston:dropbear_ssh_server:$2/
+match ssh m|^SSH-([\d.]+)-([^\r\n]+)\r?\n| p/$P(2)/ i/protocol $1/
+match ftp m|^220 ProFTPD (\d\S+) Server| p/ProFTPD/ v/$1/ cpe:/a:proftpd:proftpd:$1/
+match ftp m|^220 \(vsFTPd (\d[\w.]+)\)| p/vsftpd/ v/$1/ cpe:/a:beasts:vsftpd:$1/
+match ftp m|^220[- ].*FileZilla Server(?: version)? ([\w.]+)|i p/FileZilla ftpd/ v/$1/ o/Windows/ cpe:/a:filezilla-project:filezilla_server:$1/ cpe:/o:microsoft:windows/a
+match ftp m|^220[- ]Microsoft FTP Service| p/Microsoft ftpd/ o/Windows/ cpe:/a:microsoft:ftp_service/ cpe:/o:microsoft:windows/a
+match ftp m|^220[- ].*Pure-FTPd| p/Pure-FTPd/ cpe:/a:pureftpd:pure-ftpd/
+softmatch ftp m|^220[- ][^\r\n]*ftp|i
+match smtp m|^220 ([-\w.]+) ESMTP Postfix| p/Postfix smtpd/ h/$1/ cpe:/a:postfix:postfix/
+match smtp m|^220 ([-\w.]+) ESMTP Exim (\d[\w.]+)| p/Exim smtpd/ v/$2/ h/$1/ cpe:/a:exim:exim:$2/
+match smtp m|^220 ([-\w.]+) ESMTP Sendmail ([\w.]+)| p/Sendmail/ v/$2/ h/$1/ cpe:/a:sendmail:sendmail:$2/
+softmatch smtp m|^220[- ][^\r\n]*SMTP|
+match pop3 m|^\+OK Dovecot| p/Dovecot pop3d/ cpe:/a:dovecot:dovecot/
+softmatch pop3 m|^\+OK |
+match imap m|^\* OK \[CAPABILITY [^\]]*\] Dovecot| p/Dovecot imapd/ cpe:/a:dovecot:dovecot/
+softmatch imap m|^\* OK |
+match mysql m|^.\0\0\0\x0a(?:5\.5\.5-)?(\d[\w.]+)-MariaDB|s p/MariaDB/ v/$1/ cpe:/a:mariadb:mariadb:$1/
+match mysql m|^.\0\0\0\x0a(\d[\w.-]+)\0|s p/MySQL/ v/$1/ cpe:/a:mysql:mysql:$1/
+match mysql m=^.\0\0\0\xffj\x04Host '[^']*' is not allowed to connect to this M(?:ySQL|ariaDB) server$=s p/MySQL/ i/unauthorized/ cpe:/a:mysql:mysql/
+match vnc m|^RFB 00(\d)\.00(\d)\n$| p/VNC/ i/protocol $1.$2/
+match telnet m|^\xff[\xfb-\xfe].*login: |s p/telnetd/
+softmatch telnet m|^\xff[\xfb-\xfe]|
+
+Probe TCP SSLSessionReq q|\x16\x03\x01\0o\x01\0\0k\x03\x03@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\x5c]^_\0\0\x1a\xc0/\xc00\xc0+\xc0,\xcc\xa8\xcc\xa9\xc0\x13\xc0\x14\0\x9c\0\x9d\0/\x005\0\x0a\x01\0\0(\0\x0a\0\x08\0\x06\0\x1d\0\x17\0\x18\0\x0b\0\x02\x01\0\0\x0d\0\x12\0\x10\x04\x01\x05\x01\x06\x01\x04\x03\x05\x03\x08\x04\x08\x05\x02\x01|
+rarity 1
+ports 443,465,636,853,989,990,992,993,994,995,2376,3269,5061,5986,6697,8443,9443
+
+match ssl m|^\x16\x03[\0-\x04]..\x02|s
+match ssl m|^\x15\x03[\0-\x04]\0\x02[\x01\x02]|
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+ports 80,81,88,443,591,631,3000,5000,7080,8000-8010,8080-8090,8443,8888,9000,9090,9443
+sslports 443,8443,9443
+
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: nginx/([\d.]+)|s p/nginx/ v/$1/ cpe:/a:igor_sysoev:nginx:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: nginx\r\n|s p/nginx/ cpe:/a:igor_sysoev:nginx/
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: Apache/([\d.]+) \(([^)]+)\)|s p/Apache httpd/ v/$1/ i/$2/ cpe:/a:apache:http_server:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: Apache/([\d.]+)|s p/Apache httpd/ v/$1/ cpe:/a:apache:http_server:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: Microsoft-IIS/([\d.]+)|s p/Microsoft IIS httpd/ v/$1/ o/Windows/ cpe:/a:microsoft:internet_information_services:$1/ cpe:/o:microsoft:windows/a
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: lighttpd/([\d.]+)|s p/lighttpd/ v/$1/ cpe:/a:lighttpd:lighttpd:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: Caddy\r\n|s p/Caddy httpd/ cpe:/a:caddyserver:caddy/
+match http m|^HTTP/1\.[01] \d\d\d .*\r\n[Ss]erver: ([^\r\n]+)|s p/$P(1)/
+softmatch http m|^HTTP/1\.[01] \d\d\d|
+
+Probe TCP DNSVersionBindReqTCP q|\0\x1e\0\x06\x01\0\0\x01\0\0\0\0\0\0\x07version\x04bind\0\0\x10\0\x03|
+rarity 1
+ports 53
+
+match domain m|^\0.\0\x06[\x81\x85].*dnsmasq-([\d.]+)|s p/dnsmasq/ v/$1/ cpe:/a:thekelleys:dnsmasq:$1/
+match domain m|^\0.\0\x06[\x81\x85].*\x07version\x04bind\0\0\x10\0\x03\xc0\x0c\0\x10\0\x03.{6}.(\d+\.\d+[-.\w]*)|s p/ISC BIND/ v/$1/ cpe:/a:isc:bind:$1/
+softmatch domain m|^\0.\0\x06[\x80-\xff]|s
+
+Probe UDP DNSVersionBindReq q|\0\x06\x01\0\0\x01\0\0\0\0\0\0\x07version\x04bind\0\0\x10\0\x03|
+rarity 1
+ports 53,5353
+
+match domain m|^\0\x06[\x81\x85].*dnsmasq-([\d.]+)|s p/dnsmasq/ v/$1/ cpe:/a:thekelleys:dnsmasq:$1/
+match domain m|^\0\x06[\x81\x85].*\x07version\x04bind\0\0\x10\0\x03\xc0\x0c\0\x10\0\x03.{6}.(\d+\.\d+[-.\w]*)|s p/ISC BIND/ v/$1/ cpe:/a:isc:bind:$1/
+softmatch domain m|^\0\x06[\x80-\xff]|s
+
+Probe UDP SNMPv1public q|0)\x02\x01\0\x04\x06public\xa0\x1c\x02\x04bett\x02\x01\0\x02\x01\0\x30\x0e\x30\x0c\x06\x08\x2b\x06\x01\x02\x01\x01\x01\0\x05\0|
+rarity 1
+ports 161
+
+match snmp m|^0.{1,3}\x02\x01\0\x04\x06public\xa2.*\x2b\x06\x01\x02\x01\x01\x01\0\x04[\x01-\x7f]Linux ([^ ]+) ([^ ]+)|s p/net-snmp/ i/public; Linux $2/ h/$1/ o/Linux/ cpe:/a:net-snmp:net-snmp/ cpe:/o:linux:linux_kernel:$2/
+match snmp m|^0.{1,3}\x02\x01\0\x04\x06public\xa2.*\x2b\x06\x01\x02\x01\x01\x01\0\x04[\x01-\x7f]([^\0]+)|s p/SNMPv1 server/ i/public; $P(1)/
+softmatch snmp m|^0.{1,3}\x02\x01\0\x04|s
+
+Probe UDP NTPRequest q|\xe3\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0\0|
+rarity 1
+ports 123
+
+match ntp m|^[\x04\x0c\x14\x1c\x24\x2c\x34\x3c\xc4\xcc\xd4\xdc\xe4\xec\xf4\xfc](.).{46}$|s p/NTP/ i/stratum $I(1,">")/
+
+Probe UDP NBTStat q|\x80\xf0\0\x10\0\x01\0\0\0\0\0\0\x20CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\0\0\x21\0\x01|
+rarity 1
+ports 137
+
+match netbios-ns m|^\x80\xf0\x84\0\0\0\0\x01\0\0\0\0\x20CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\0\0\x21\0\x01.{6}.(.{15})|s p/NetBIOS name service/ h/$P(1)/
+`
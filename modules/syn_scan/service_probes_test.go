@@ -0,0 +1,256 @@
+package syn_scan
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testServiceProbes = `
+# comment
+Exclude T:9100-9107
+
+Probe TCP NULL q||
+totalwaitms 6000
+tcpwrappedms 3000
+
+match ssh m|^SSH-([\d.]+)-OpenSSH[_-]([\w.]+)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1/ cpe:/a:openbsd:openssh:$2/
+match ftp m|^220 (\S+) FTP server \(Version ([\w.]+)\)| p/BSD ftpd/ v/$SUBST(2,"_",".")/ h/$1/
+match echo m|^(a+)\1$|
+softmatch ftp m|^220[- ]|
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+ports 80,8000-8010
+sslports 443
+fallback FooRequest
+
+match http m|^HTTP/1\.[01] \d\d\d .*\r\nServer: nginx/([\d.]+)|s p/nginx/ v/$1/ cpe:/a:igor_sysoev:nginx:$1/
+softmatch http m|^HTTP/1\.[01] \d\d\d|
+
+Probe TCP FooRequest q|FOO\0\x0a|
+rarity 5
+ports 9999
+
+match foo m=^FOO (\w+)\0=i p/Foo server/ v/$P(1)/ d/router/ o/Linux/ cpe:/h:foo:foo/a
+
+Probe UDP Counter q|\x01\0|
+rarity 1
+ports 1234
+totalwaitms 500
+
+match counter m|^\x02(..)|s p/Counter/ i/count $I(1,">") $I(1,"<")/
+`
+
+func parseTestProbes(t *testing.T) *ServiceProbes {
+	db, err := ParseServiceProbes(strings.NewReader(testServiceProbes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestParsePortSet(t *testing.T) {
+	tests := []struct {
+		spec string
+		in   []int
+		out  []int
+		fail bool
+	}{
+		{"80", []int{80}, []int{79, 81}, false},
+		{"80,443", []int{80, 443}, []int{81, 442}, false},
+		{"8000-8010, 22", []int{22, 8000, 8005, 8010}, []int{7999, 8011}, false},
+		{"", nil, []int{0, 80}, false},
+		{"http", nil, nil, true},
+		{"80-", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		set, err := parsePortSet(tt.spec)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("expected '%s' to fail", tt.spec)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("unexpected error for '%s': %v", tt.spec, err)
+			continue
+		}
+
+		for _, port := range tt.in {
+			if !set.Contains(port) {
+				t.Errorf("'%s': expected %d to be in the set", tt.spec, port)
+			}
+		}
+		for _, port := range tt.out {
+			if set.Contains(port) {
+				t.Errorf("'%s': expected %d not to be in the set", tt.spec, port)
+			}
+		}
+	}
+}
+
+func TestUnescapeProbe(t *testing.T) {
+	tests := []struct {
+		probe string
+		want  string
+	}{
+		{``, ""},
+		{`GET / HTTP/1.0\r\n\r\n`, "GET / HTTP/1.0\r\n\r\n"},
+		{`\0\x01\xff\t`, "\x00\x01\xff\t"},
+		{`\\\|`, `\|`},
+		{`\xzz`, "xzz"},
+		{`\x1`, "x1"},
+		{`end\`, `end\`},
+	}
+
+	for _, tt := range tests {
+		if got := string(unescapeProbe(tt.probe)); got != tt.want {
+			t.Errorf("'%s': expected %q, got %q", tt.probe, tt.want, got)
+		}
+	}
+}
+
+func TestPcreToGo(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`^SSH-`, `^SSH-`},
+		{`\0\0`, `\x00\x00`},
+		{`\0`, `\x00`},
+		{`\01`, `\01`},
+		{`\x5`, `\x05`},
+		{`\x5c`, `\x5c`},
+		{`\x0a\x5 `, `\x0a\x05 `},
+		{`a\\0`, `a\\0`},
+		{`\d+\.`, `\d+\.`},
+	}
+
+	for _, tt := range tests {
+		if got := pcreToGo(tt.pattern); got != tt.want {
+			t.Errorf("'%s': expected '%s', got '%s'", tt.pattern, tt.want, got)
+		}
+	}
+}
+
+func TestParseServiceProbes(t *testing.T) {
+	db := parseTestProbes(t)
+
+	tests := []struct {
+		key      string
+		payload  string
+		rarity   int
+		wait     time.Duration
+		matches  int
+		fallback []string
+	}{
+		{"tcp/NULL", "", 0, 6 * time.Second, 3, nil},
+		{"tcp/GetRequest", "GET / HTTP/1.0\r\n\r\n", 1, defaultProbeWait, 2, []string{"FooRequest"}},
+		{"tcp/FooRequest", "FOO\x00\n", 5, defaultProbeWait, 1, nil},
+		{"udp/Counter", "\x01\x00", 1, 500 * time.Millisecond, 1, nil},
+	}
+
+	if len(db.probes) != len(tests) {
+		t.Fatalf("expected %d probes, got %d", len(tests), len(db.probes))
+	} else if db.Skipped != 1 {
+		t.Fatalf("expected the backreference to be skipped, got %d skipped", db.Skipped)
+	}
+
+	for i, tt := range tests {
+		probe, found := db.byName[tt.key]
+		if !found {
+			t.Errorf("probe %s not found", tt.key)
+			continue
+		} else if db.probes[i] != probe {
+			t.Errorf("expected %s to be probe %d", tt.key, i)
+		}
+
+		if string(probe.payload) != tt.payload {
+			t.Errorf("%s: expected payload %q, got %q", tt.key, tt.payload, probe.payload)
+		} else if probe.rarity != tt.rarity {
+			t.Errorf("%s: expected rarity %d, got %d", tt.key, tt.rarity, probe.rarity)
+		} else if probe.wait != tt.wait {
+			t.Errorf("%s: expected wait %s, got %s", tt.key, tt.wait, probe.wait)
+		} else if len(probe.matches) != tt.matches {
+			t.Errorf("%s: expected %d matches, got %d", tt.key, tt.matches, len(probe.matches))
+		} else if strings.Join(probe.fallback, ",") != strings.Join(tt.fallback, ",") {
+			t.Errorf("%s: expected fallback %v, got %v", tt.key, tt.fallback, probe.fallback)
+		}
+	}
+
+	get := db.byName["tcp/GetRequest"]
+	if !get.ports.Contains(8005) || get.ports.Contains(443) || !get.sslPorts.Contains(443) {
+		t.Fatalf("unexpected ports %v and ssl ports %v", get.ports, get.sslPorts)
+	} else if !get.HasMatchesFor("http") || get.HasMatchesFor("ssh") {
+		t.Fatalf("unexpected matches for %s", get.name)
+	}
+
+	foo := db.byName["tcp/FooRequest"].matches[0]
+	if foo.service != "foo" || foo.product != "Foo server" || foo.deviceType != "router" || foo.os != "Linux" {
+		t.Fatalf("unexpected match %+v", foo)
+	} else if len(foo.cpe) != 1 || foo.cpe[0] != "cpe:/h:foo:foo" {
+		t.Fatalf("unexpected cpe %v", foo.cpe)
+	}
+
+	// the echo match uses a backreference and has been skipped
+	if null := db.byName["tcp/NULL"]; null.HasMatchesFor("echo") || !null.matches[2].soft {
+		t.Fatalf("unexpected matches for the NULL probe")
+	}
+}
+
+func TestParseServiceProbesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe string
+	}{
+		{"match outside of a probe", "match ssh m|^SSH|"},
+		{"unknown directive", "Probe TCP NULL q||\nretries 3"},
+		{"probe protocol", "Probe ICMP Echo q||"},
+		{"probe string", "Probe TCP Echo |abc|"},
+		{"unterminated probe", "Probe TCP Echo q|abc"},
+		{"incomplete probe", "Probe TCP"},
+		{"ports", "Probe TCP NULL q||\nports 80-http"},
+		{"rarity", "Probe TCP NULL q||\nrarity high"},
+		{"totalwaitms", "Probe TCP NULL q||\ntotalwaitms 1s"},
+		{"invalid match", "Probe TCP NULL q||\nmatch ssh x|^SSH|"},
+		{"unterminated pattern", "Probe TCP NULL q||\nmatch ssh m|^SSH"},
+		{"unknown version field", "Probe TCP NULL q||\nmatch ssh m|^SSH| z/zzz/"},
+		{"unterminated version field", "Probe TCP NULL q||\nmatch ssh m|^SSH| p/OpenSSH"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseServiceProbes(strings.NewReader(tt.probe)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		} else if !strings.HasPrefix(err.Error(), "line ") {
+			t.Errorf("%s: expected the line number in '%v'", tt.name, err)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		template   string
+		submatches []string
+		want       string
+	}{
+		{"", []string{"all"}, ""},
+		{"OpenSSH", []string{"all"}, "OpenSSH"},
+		{"$1", []string{"all", "7.4"}, "7.4"},
+		{"v$1.$2", []string{"all", "1", "2"}, "v1.2"},
+		{"protocol $1 $2", []string{"all", "2.0", ""}, "protocol 2.0"},
+		{"$3", []string{"all", "x"}, ""},
+		{"$P(1)", []string{"all", "a\x00b\x7fc\u00e9"}, "abc"},
+		{`$SUBST(1,"_",".")`, []string{"all", "6_00_1"}, "6.00.1"},
+		{`$I(1,">")`, []string{"all", "\x01\x02"}, "258"},
+		{`$I(1,"<")`, []string{"all", "\x01\x02"}, "513"},
+		{`stratum $I(1,">")`, []string{"all", "\x03"}, "stratum 3"},
+		{"cpe:/a:openbsd:openssh:$1", []string{"all", "8.0"}, "cpe:/a:openbsd:openssh:8.0"},
+	}
+
+	for _, tt := range tests {
+		if got := expandTemplate(tt.template, tt.submatches); got != tt.want {
+			t.Errorf("'%s' with %q: expected '%s', got '%s'", tt.template, tt.submatches, tt.want, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package syn_scan
 
 import (
 	"fmt"
+	"math/rand"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -11,33 +12,46 @@ import (
 	"github.com/bettercap/bettercap/session"
 
 	"github.com/evilsocket/islazy/async"
+	"github.com/evilsocket/islazy/fs"
 
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
 )
 
 const synSourcePort = 666
 
 type synScannerStats struct {
-	numPorts     uint64
-	numAddresses uint64
-	totProbes    uint64
-	doneProbes   uint64
-	openPorts    uint64
-	started      time.Time
+	numPorts        uint64
+	numAddresses    uint64
+	totProbes       uint64
+	doneProbes      uint64
+	completedProbes uint64
+	retransmissions uint64
+	openPorts       uint64
+	closedPorts     uint64
+	filteredPorts   uint64
+	started         time.Time
 }
 
 type SynScanner struct {
 	session.SessionModule
+	protocol      string
 	addresses     []net.IP
 	startPort     int
 	endPort       int
-	handle        *pcap.Handle
+	handle        *packets.Subscription
 	packets       chan gopacket.Packet
 	progressEvery time.Duration
 	stats         synScannerStats
+	maxRate       int
+	retries       int
+	rate          *rateController
+	probes        *probeTracker
+	serviceProbes *ServiceProbes
+	probesFile    string
+	report        *scanReport
+	outputFile    string
+	outputFormat  string
 	waitGroup     *sync.WaitGroup
-	scanQueue     *async.WorkQueue
 	bannerQueue   *async.WorkQueue
 }
 
@@ -49,7 +63,6 @@ func NewSynScanner(s *session.Session) *SynScanner {
 		progressEvery: time.Duration(1) * time.Second,
 	}
 
-	mod.scanQueue = async.NewQueue(0, mod.scanWorker)
 	mod.bannerQueue = async.NewQueue(0, mod.bannerGrabber)
 
 	mod.State.Store("scanning", &mod.addresses)
@@ -59,6 +72,34 @@ func NewSynScanner(s *session.Session) *SynScanner {
 		"1",
 		"Period in seconds for the scanning progress reporting."))
 
+	mod.AddParam(session.NewStringParameter("syn.scan.protocol",
+		"tcp",
+		"^(tcp|udp)$",
+		"Protocol to scan, tcp sends SYN packets while udp sends the payloads the services usually listening on each port answer to."))
+
+	mod.AddParam(session.NewIntParameter("syn.scan.rate",
+		"1000",
+		"Maximum number of packets per second, the scanner slows down when it detects packet loss."))
+
+	mod.AddParam(session.NewIntParameter("syn.scan.retries",
+		"2",
+		"Number of times a probe is retransmitted if no reply is received."))
+
+	mod.AddParam(session.NewStringParameter("syn.scan.probes",
+		"",
+		"",
+		"File in nmap-service-probes format to use for service detection instead of the built-in signatures."))
+
+	mod.AddParam(session.NewStringParameter("syn.scan.output",
+		"",
+		"",
+		"If set, the results of each scan will be saved to this file."))
+
+	mod.AddParam(session.NewStringParameter("syn.scan.output.format",
+		"xml",
+		"^(xml|json|grepable)$",
+		"Format of the syn.scan.output file, xml and grepable are compatible with the nmap -oX and -oG formats."))
+
 	mod.AddHandler(session.NewModuleHandler("syn.scan stop", "syn\\.scan (stop|off)",
 		"Stop the current syn scanning session.",
 		func(args []string) error {
@@ -69,7 +110,7 @@ func NewSynScanner(s *session.Session) *SynScanner {
 		}))
 
 	mod.AddHandler(session.NewModuleHandler("syn.scan IP-RANGE START-PORT END-PORT", "syn.scan ([^\\s]+) ?(\\d+)?([\\s\\d]*)?",
-		"Perform a syn port scanning against an IP address within the provided ports range.",
+		"Perform a port scanning against the targets (addresses, ranges, MACs, hostnames or selectors like vendor:NAME) within the provided ports range, using the syn.scan.protocol protocol.",
 		func(args []string) error {
 			period := 0
 			if mod.Running() {
@@ -80,12 +121,51 @@ func NewSynScanner(s *session.Session) *SynScanner {
 				return err
 			} else if err, period = mod.IntParam("syn.scan.show-progress-every"); err != nil {
 				return err
+			} else if err, mod.protocol = mod.StringParam("syn.scan.protocol"); err != nil {
+				return err
+			} else if mod.protocol == "udp" && mod.hasIPv6Targets() {
+				return fmt.Errorf("udp scanning of IPv6 targets is not supported")
+			} else if err, mod.maxRate = mod.IntParam("syn.scan.rate"); err != nil {
+				return err
+			} else if err, mod.retries = mod.IntParam("syn.scan.retries"); err != nil {
+				return err
+			} else if mod.maxRate < int(minScanRate) {
+				return fmt.Errorf("syn.scan.rate must be at least %d packets per second", int(minScanRate))
+			} else if mod.retries < 0 {
+				return fmt.Errorf("syn.scan.retries can not be negative")
+			} else if err = mod.loadServiceProbes(); err != nil {
+				return err
+			} else if err, mod.outputFile = mod.StringParam("syn.scan.output"); err != nil {
+				return err
+			} else if err, mod.outputFormat = mod.StringParam("syn.scan.output.format"); err != nil {
+				return err
+			} else if mod.outputFile, err = fs.Expand(mod.outputFile); err != nil {
+				return err
 			} else {
 				mod.progressEvery = time.Duration(period) * time.Second
 			}
+			mod.report = newScanReport(fmt.Sprintf("syn.scan %s %d %d", args[0], mod.startPort, mod.endPort),
+				mod.protocol, mod.startPort, mod.endPort)
 			return mod.synScan()
 		}))
 
+	mod.AddHandler(session.NewModuleHandler("syn.scan.import FILE", "syn\\.scan\\.import (.+)",
+		"Import the hosts and open ports of an nmap XML report.",
+		func(args []string) error {
+			fileName, err := fs.Expand(args[0])
+			if err != nil {
+				return err
+			}
+
+			imported, err := mod.importNmapXML(fileName)
+			if err != nil {
+				return err
+			}
+
+			mod.Info("imported %d host%s from %s", imported, plural(uint64(imported)), fileName)
+			return nil
+		}))
+
 	mod.AddHandler(session.NewModuleHandler("syn.scan.progress", "syn\\.scan\\.progress",
 		"Print progress of the current syn scanning session.",
 		func(args []string) error {
@@ -103,7 +183,7 @@ func (mod *SynScanner) Name() string {
 }
 
 func (mod *SynScanner) Description() string {
-	return "A module to perform SYN port scanning."
+	return "A module to perform SYN and UDP port scanning."
 }
 
 func (mod *SynScanner) Author() string {
@@ -114,14 +194,45 @@ func (mod *SynScanner) Configure() (err error) {
 	if mod.Running() {
 		return session.ErrAlreadyStarted(mod.Name())
 	}
+
+	filter := fmt.Sprintf("tcp dst port %d", synSourcePort)
+	if mod.protocol == "udp" {
+		filter = fmt.Sprintf("udp dst port %d or icmp[icmptype] == icmp-unreach", synSourcePort)
+	}
+
 	if mod.handle == nil {
-		if mod.handle, err = pcap.OpenLive(mod.Session.Interface.Name(), 65536, true, pcap.BlockForever); err != nil {
-			return err
-		} else if err = mod.handle.SetBPFFilter(fmt.Sprintf("tcp dst port %d", synSourcePort)); err != nil {
+		if err, mod.handle = packets.Subscribe(mod.Session.Interface.Name(), filter); err != nil {
 			return err
 		}
 		mod.packets = gopacket.NewPacketSource(mod.handle, mod.handle.LinkType()).Packets()
+	} else if err = mod.handle.SetBPFFilter(filter); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mod *SynScanner) loadServiceProbes() error {
+	err, fileName := mod.StringParam("syn.scan.probes")
+	if err != nil {
+		return err
+	} else if fileName == "" {
+		mod.serviceProbes = getBuiltinProbes()
+		mod.probesFile = ""
+		return nil
+	} else if fileName, err = fs.Expand(fileName); err != nil {
+		return err
+	} else if fileName == mod.probesFile {
+		return nil
+	}
+
+	db, err := LoadServiceProbes(fileName)
+	if err != nil {
+		return fmt.Errorf("error while loading service probes from %s: %v", fileName, err)
 	}
+
+	mod.Info("loaded %d service probes from %s (%d unsupported signatures skipped)", len(db.probes), fileName, db.Skipped)
+	mod.serviceProbes = db
+	mod.probesFile = fileName
 	return nil
 }
 
@@ -137,17 +248,26 @@ func plural(n uint64) string {
 }
 
 func (mod *SynScanner) showProgress() error {
-	progress := 100.0 * (float64(mod.stats.doneProbes) / float64(mod.stats.totProbes))
+	completed := atomic.LoadUint64(&mod.stats.completedProbes)
+	progress := 100.0 * (float64(completed) / float64(mod.stats.totProbes))
 	mod.State.Store("progress", progress)
-	mod.Info("[%.2f%%] found %d open port%s for %d address%s, sent %d/%d packets in %s",
+	mod.Info("[%.2f%%] found %d open port%s for %d address%s, sent %d/%d probes (%d retransmitted) at %.0f pps in %s",
 		progress,
 		mod.stats.openPorts,
 		plural(mod.stats.openPorts),
 		mod.stats.numAddresses,
 		plural(mod.stats.numAddresses),
-		mod.stats.doneProbes,
+		atomic.LoadUint64(&mod.stats.doneProbes),
 		mod.stats.totProbes,
+		atomic.LoadUint64(&mod.stats.retransmissions),
+		mod.rate.Rate(),
 		time.Since(mod.stats.started))
+	if mod.protocol == "udp" {
+		mod.Info("%d closed and %d filtered udp port%s, the ports that did not answer are either open or filtered",
+			mod.stats.closedPorts,
+			mod.stats.filteredPorts,
+			plural(mod.stats.closedPorts+mod.stats.filteredPorts))
+	}
 	return nil
 }
 
@@ -159,35 +279,117 @@ func (mod *SynScanner) Stop() error {
 	})
 }
 
-type scanJob struct {
+func (mod *SynScanner) hasIPv6Targets() bool {
+	for _, address := range mod.addresses {
+		if address.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// link-local targets are only reachable from a link-local address
+func (mod *SynScanner) ipv6SourceFor(target net.IP) net.IP {
+	linkLocal := target.IsLinkLocalUnicast()
+	if iface, err := net.InterfaceByName(mod.Session.Interface.Name()); err == nil {
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() == linkLocal {
+					return ipnet.IP
+				}
+			}
+		}
+	}
+	return mod.Session.Interface.IPv6
+}
+
+type scanTarget struct {
 	Address net.IP
 	Mac     net.HardwareAddr
+	From    net.IP
 }
 
-func (mod *SynScanner) scanWorker(job async.Job) {
-	scan := job.(scanJob)
-
-	for dstPort := mod.startPort; dstPort < mod.endPort+1; dstPort++ {
-		if !mod.Running() {
-			break
+// probeOrder calls cb with the index of every port and target until it
+// returns false, every port is probed on all the targets before moving to
+// the next one, both in random order.
+func probeOrder(rnd *rand.Rand, numPorts int, numTargets int, cb func(port, target int) bool) {
+	for _, i := range rnd.Perm(numPorts) {
+		for _, j := range rnd.Perm(numTargets) {
+			if !cb(i, j) {
+				return
+			}
 		}
+	}
+}
 
-		atomic.AddUint64(&mod.stats.doneProbes, 1)
+func (mod *SynScanner) send(p *probe, from net.IP) {
+	if !mod.probes.Sent(p) {
+		return
+	}
 
-		err, raw := packets.NewTCPSyn(mod.Session.Interface.IP, mod.Session.Interface.HW, scan.Address, scan.Mac, synSourcePort, dstPort)
-		if err != nil {
-			mod.Error("error creating SYN packet: %s", err)
+	var err error
+	var raw []byte
+
+	what := "SYN"
+	if mod.protocol == "udp" {
+		what = "UDP"
+		err, raw = packets.NewUDPPacket(from, mod.Session.Interface.HW, p.address, p.mac, synSourcePort, p.port, packets.UDPProbeFor(p.port))
+	} else if p.address.To4() == nil {
+		err, raw = packets.NewTCP6Syn(from, mod.Session.Interface.HW, p.address, p.mac, synSourcePort, p.port)
+	} else {
+		err, raw = packets.NewTCPSyn(from, mod.Session.Interface.HW, p.address, p.mac, synSourcePort, p.port)
+	}
+
+	if err != nil {
+		mod.Error("error creating %s packet: %s", what, err)
+		return
+	}
+
+	mod.rate.Wait()
+
+	if err := mod.Session.Queue.Send(raw); err != nil {
+		mod.Error("error sending %s packet: %s", what, err)
+	} else {
+		mod.Debug("sent %d bytes of %s packet to %s for port %d (try %d)", len(raw), what, p.address.String(), p.port, p.tries)
+	}
+}
+
+// retransmit the probes which have not been answered in time, giving up on
+// the ones that have been already retried too many times
+func (mod *SynScanner) retransmit(sources map[string]net.IP) (retried bool) {
+	for mod.Running() {
+		p := mod.probes.Expired(mod.rate.Timeout())
+		if p == nil {
+			break
+		} else if p.tries > mod.retries {
+			mod.probes.Drop(p)
+			atomic.AddUint64(&mod.stats.completedProbes, 1)
 			continue
 		}
 
-		if err := mod.Session.Queue.Send(raw); err != nil {
-			mod.Error("error sending SYN packet: %s", err)
-		} else {
-			mod.Debug("sent %d bytes of SYN packet to %s for port %d", len(raw), scan.Address.String(), dstPort)
-		}
+		atomic.AddUint64(&mod.stats.retransmissions, 1)
+		mod.send(p, sources[p.address.String()])
+		retried = true
+	}
+	return
+}
+
+// onAnswer is called for every reply to a probe and returns false if the
+// probe was not waiting for one.
+func (mod *SynScanner) onAnswer(address net.IP, port int) bool {
+	p := mod.probes.Answer(address, port)
+	if p == nil {
+		return false
+	}
 
-		time.Sleep(time.Duration(15) * time.Millisecond)
+	atomic.AddUint64(&mod.stats.completedProbes, 1)
+	if p.tries > 1 {
+		// the first probe or its reply got lost
+		mod.rate.OnDrop()
+	} else {
+		mod.rate.OnReply(time.Since(p.sent))
 	}
+	return true
 }
 
 func (mod *SynScanner) synScan() error {
@@ -195,12 +397,18 @@ func (mod *SynScanner) synScan() error {
 		return err
 	}
 
+	mod.probes = newProbeTracker()
+	mod.rate = newRateController(mod.maxRate)
+
 	mod.SetRunning(true, func() {
 		mod.waitGroup.Add(1)
 		defer mod.waitGroup.Done()
 
 		defer mod.SetRunning(false, func() {
 			mod.showProgress()
+			if mod.outputFile != "" {
+				go mod.saveReport(mod.report, mod.outputFile, mod.outputFormat)
+			}
 			mod.addresses = []net.IP{}
 			mod.State.Store("progress", 0.0)
 			mod.State.Store("scanning", &mod.addresses)
@@ -208,20 +416,24 @@ func (mod *SynScanner) synScan() error {
 		})
 
 		mod.stats.openPorts = 0
+		mod.stats.closedPorts = 0
+		mod.stats.filteredPorts = 0
 		mod.stats.numPorts = uint64(mod.endPort - mod.startPort + 1)
 		mod.stats.started = time.Now()
 		mod.stats.numAddresses = uint64(len(mod.addresses))
 		mod.stats.totProbes = mod.stats.numAddresses * mod.stats.numPorts
 		mod.stats.doneProbes = 0
+		mod.stats.completedProbes = 0
+		mod.stats.retransmissions = 0
 		plural := "es"
 		if mod.stats.numAddresses == 1 {
 			plural = ""
 		}
 
 		if mod.stats.numPorts > 1 {
-			mod.Info("scanning %d address%s from port %d to port %d ...", mod.stats.numAddresses, plural, mod.startPort, mod.endPort)
+			mod.Info("scanning %d address%s from %s port %d to port %d ...", mod.stats.numAddresses, plural, mod.protocol, mod.startPort, mod.endPort)
 		} else {
-			mod.Info("scanning %d address%s on port %d ...", mod.stats.numAddresses, plural, mod.startPort)
+			mod.Info("scanning %d address%s on %s port %d ...", mod.stats.numAddresses, plural, mod.protocol, mod.startPort)
 		}
 
 		mod.State.Store("progress", 0.0)
@@ -251,25 +463,61 @@ func (mod *SynScanner) synScan() error {
 			}
 		}()
 
-		// start sending SYN packets and wait
+		// the neighbors which are not known yet are probed all at once
+		macs, err := mod.Session.FindMACs(mod.addresses, true)
+		if err != nil {
+			mod.Warning("error while resolving the targets: %v", err)
+		} else if !mod.Running() {
+			return
+		}
+
+		targets := make([]scanTarget, 0)
+		sources := make(map[string]net.IP)
 		for _, address := range mod.addresses {
-			if !mod.Running() {
-				break
-			}
-			mac, err := mod.Session.FindMAC(address, true)
-			if err != nil {
-				atomic.AddUint64(&mod.stats.doneProbes, mod.stats.numPorts)
-				mod.Debug("could not get MAC for %s: %s", address.String(), err)
+			mac, found := macs[address.String()]
+			if !found {
+				atomic.AddUint64(&mod.stats.completedProbes, mod.stats.numPorts)
+				mod.Debug("could not get MAC for %s", address.String())
 				continue
 			}
 
-			mod.scanQueue.Add(async.Job(scanJob{
+			from := mod.Session.Interface.IP
+			if address.To4() == nil {
+				from = mod.ipv6SourceFor(address)
+			}
+
+			sources[address.String()] = from
+			targets = append(targets, scanTarget{
 				Address: address,
 				Mac:     mac,
-			}))
+				From:    from,
+			})
 		}
 
-		mod.scanQueue.WaitDone()
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		probeOrder(rnd, int(mod.stats.numPorts), len(targets), func(i, j int) bool {
+			if !mod.Running() {
+				return false
+			}
+
+			mod.retransmit(sources)
+
+			target := targets[j]
+			atomic.AddUint64(&mod.stats.doneProbes, 1)
+			mod.send(&probe{
+				address: target.Address,
+				mac:     target.Mac,
+				port:    mod.startPort + i,
+			}, target.From)
+			return true
+		})
+
+		// wait for the last replies
+		for mod.Running() && mod.probes.Pending() > 0 {
+			if !mod.retransmit(sources) {
+				time.Sleep(time.Duration(10) * time.Millisecond)
+			}
+		}
 	})
 
 	return nil
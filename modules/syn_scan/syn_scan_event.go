@@ -8,14 +8,18 @@ import (
 type SynScanEvent struct {
 	Address string
 	Host    *network.Endpoint
+	Proto   string
 	Port    int
+	Service *OpenPort
 }
 
-func NewSynScanEvent(address string, h *network.Endpoint, port int) SynScanEvent {
+func NewSynScanEvent(address string, h *network.Endpoint, port *OpenPort) SynScanEvent {
 	return SynScanEvent{
 		Address: address,
 		Host:    h,
-		Port:    port,
+		Proto:   port.Proto,
+		Port:    port.Port,
+		Service: port,
 	}
 }
 
@@ -23,3 +27,10 @@ func (e SynScanEvent) Push() {
 	session.I.Events.Add("syn.scan", e)
 	session.I.Refresh()
 }
+
+// PushService notifies that the service listening on the port has been
+// identified.
+func (e SynScanEvent) PushService() {
+	session.I.Events.Add("syn.scan.service", e)
+	session.I.Refresh()
+}
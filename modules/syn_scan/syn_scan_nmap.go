@@ -0,0 +1,373 @@
+package syn_scan
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bettercap/bettercap/core"
+	"github.com/bettercap/bettercap/network"
+)
+
+const nmapScanner = core.Name + " " + core.Version
+
+// subset of the nmap XML output format, see https://nmap.org/book/nmap-dtd.html
+type nmapRun struct {
+	XMLName          xml.Name     `xml:"nmaprun"`
+	Scanner          string       `xml:"scanner,attr"`
+	Args             string       `xml:"args,attr"`
+	Start            int64        `xml:"start,attr"`
+	StartStr         string       `xml:"startstr,attr"`
+	Version          string       `xml:"version,attr"`
+	XMLOutputVersion string       `xml:"xmloutputversion,attr"`
+	ScanInfo         nmapScanInfo `xml:"scaninfo"`
+	Hosts            []nmapHost   `xml:"host"`
+	RunStats         nmapRunStats `xml:"runstats"`
+}
+
+type nmapScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type nmapHost struct {
+	Status    nmapStatus     `xml:"status"`
+	Addresses []nmapAddress  `xml:"address"`
+	Hostnames []nmapHostname `xml:"hostnames>hostname"`
+	Ports     nmapPorts      `xml:"ports"`
+}
+
+type nmapStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr,omitempty"`
+}
+
+type nmapHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapPorts struct {
+	ExtraPorts []nmapExtraPorts `xml:"extraports"`
+	Ports      []nmapPort       `xml:"port"`
+}
+
+type nmapExtraPorts struct {
+	State string `xml:"state,attr"`
+	Count int    `xml:"count,attr"`
+}
+
+type nmapPort struct {
+	Protocol string       `xml:"protocol,attr"`
+	PortID   int          `xml:"portid,attr"`
+	State    nmapStatus   `xml:"state"`
+	Service  *nmapService `xml:"service"`
+	Scripts  []nmapScript `xml:"script"`
+}
+
+type nmapService struct {
+	Name       string   `xml:"name,attr"`
+	Product    string   `xml:"product,attr,omitempty"`
+	Version    string   `xml:"version,attr,omitempty"`
+	ExtraInfo  string   `xml:"extrainfo,attr,omitempty"`
+	Hostname   string   `xml:"hostname,attr,omitempty"`
+	OSType     string   `xml:"ostype,attr,omitempty"`
+	DeviceType string   `xml:"devicetype,attr,omitempty"`
+	Tunnel     string   `xml:"tunnel,attr,omitempty"`
+	Method     string   `xml:"method,attr"`
+	Conf       int      `xml:"conf,attr"`
+	CPE        []string `xml:"cpe"`
+}
+
+type nmapScript struct {
+	ID     string `xml:"id,attr"`
+	Output string `xml:"output,attr"`
+}
+
+type nmapRunStats struct {
+	Finished nmapFinished  `xml:"finished"`
+	Hosts    nmapHostStats `xml:"hosts"`
+}
+
+type nmapFinished struct {
+	Time    int64  `xml:"time,attr"`
+	TimeStr string `xml:"timestr,attr"`
+	Elapsed string `xml:"elapsed,attr"`
+	Exit    string `xml:"exit,attr"`
+}
+
+type nmapHostStats struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+func addrType(ip net.IP) string {
+	if ip.To4() == nil {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+func nmapPortFor(proto string, p *OpenPort) nmapPort {
+	reason := "syn-ack"
+	if proto == "udp" {
+		reason = "udp-response"
+	}
+
+	port := nmapPort{
+		Protocol: proto,
+		PortID:   p.Port,
+		State:    nmapStatus{State: "open", Reason: reason},
+		Scripts:  make([]nmapScript, 0),
+	}
+
+	if p.Service != "" {
+		// services only known by their port number are guessed from the table
+		method, conf := "table", 3
+		if p.Product != "" {
+			method, conf = "probed", 10
+		}
+		port.Service = &nmapService{
+			Name:       p.Service,
+			Product:    p.Product,
+			Version:    p.Version,
+			ExtraInfo:  p.Info,
+			Hostname:   p.Hostname,
+			OSType:     p.OS,
+			DeviceType: p.DeviceType,
+			Tunnel:     p.Tunnel,
+			Method:     method,
+			Conf:       conf,
+			CPE:        p.CPE,
+		}
+	}
+
+	if p.Banner != "" {
+		port.Scripts = append(port.Scripts, nmapScript{ID: "banner", Output: p.Banner})
+	}
+
+	if cert := p.Certificate; cert != nil {
+		port.Scripts = append(port.Scripts, nmapScript{
+			ID: "ssl-cert",
+			Output: fmt.Sprintf("Subject: %s\nIssuer: %s\nNot valid before: %s\nNot valid after:  %s\nSHA-256: %s",
+				cert.Subject,
+				cert.Issuer,
+				cert.NotBefore.Format(time.RFC3339),
+				cert.NotAfter.Format(time.RFC3339),
+				cert.SHA256),
+		})
+	}
+
+	return port
+}
+
+// ToXML returns the report in the nmap -oX format.
+func (r *scanReport) ToXML() ([]byte, error) {
+	scanType := "syn"
+	if r.Protocol == "udp" {
+		scanType = "udp"
+	}
+
+	run := nmapRun{
+		Scanner:          core.Name,
+		Args:             r.Command,
+		Start:            r.Started.Unix(),
+		StartStr:         r.Started.Format(time.ANSIC),
+		Version:          core.Version,
+		XMLOutputVersion: "1.05",
+		ScanInfo: nmapScanInfo{
+			Type:        scanType,
+			Protocol:    r.Protocol,
+			NumServices: r.EndPort - r.StartPort + 1,
+			Services:    r.Services(),
+		},
+		Hosts: make([]nmapHost, 0, len(r.Hosts)),
+		RunStats: nmapRunStats{
+			Finished: nmapFinished{
+				Time:    r.Finished.Unix(),
+				TimeStr: r.Finished.Format(time.ANSIC),
+				Elapsed: fmt.Sprintf("%.2f", r.Finished.Sub(r.Started).Seconds()),
+				Exit:    "success",
+			},
+			Hosts: nmapHostStats{
+				Up:    len(r.Hosts),
+				Total: len(r.Hosts),
+			},
+		},
+	}
+
+	for _, h := range r.Hosts {
+		host := nmapHost{
+			Status:    nmapStatus{State: "up", Reason: "user-set"},
+			Addresses: []nmapAddress{{Addr: h.Address, AddrType: addrType(h.ip)}},
+			Hostnames: make([]nmapHostname, 0),
+		}
+
+		if h.MAC != "" {
+			host.Addresses = append(host.Addresses, nmapAddress{
+				Addr:     strings.ToUpper(h.MAC),
+				AddrType: "mac",
+				Vendor:   h.Vendor,
+			})
+		}
+
+		if h.Hostname != "" {
+			host.Hostnames = append(host.Hostnames, nmapHostname{Name: h.Hostname, Type: "PTR"})
+		}
+
+		// the ports that did not answer are filtered for tcp, while a udp
+		// port could be open with a service ignoring our probe
+		silent := "filtered"
+		if r.Protocol == "udp" {
+			silent = "open|filtered"
+		}
+		for _, extra := range []nmapExtraPorts{
+			{State: "closed", Count: h.Closed},
+			{State: "filtered", Count: h.Filtered},
+			{State: silent, Count: h.NoResponse},
+		} {
+			if extra.Count == 0 {
+				continue
+			} else if n := len(host.Ports.ExtraPorts); n > 0 && host.Ports.ExtraPorts[n-1].State == extra.State {
+				host.Ports.ExtraPorts[n-1].Count += extra.Count
+			} else {
+				host.Ports.ExtraPorts = append(host.Ports.ExtraPorts, extra)
+			}
+		}
+
+		for _, p := range h.Ports {
+			host.Ports.Ports = append(host.Ports.Ports, nmapPortFor(r.Protocol, p))
+		}
+
+		run.Hosts = append(run.Hosts, host)
+	}
+
+	data, err := xml.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBufferString(xml.Header + "<!DOCTYPE nmaprun>\n")
+	buf.Write(data)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// openPortFrom converts a port of an nmap report, returning nil if it's
+// not open.
+func openPortFrom(p nmapPort) *OpenPort {
+	if p.State.State != "open" || portsMeta[p.Protocol] == "" {
+		return nil
+	}
+
+	port := &OpenPort{
+		Proto:   p.Protocol,
+		Port:    p.PortID,
+		Service: network.GetServiceByPort(p.PortID, p.Protocol),
+	}
+
+	if s := p.Service; s != nil {
+		if s.Name != "" {
+			port.Service = s.Name
+		}
+		port.Product = s.Product
+		port.Version = s.Version
+		port.Info = s.ExtraInfo
+		port.Hostname = s.Hostname
+		port.OS = s.OSType
+		port.DeviceType = s.DeviceType
+		port.Tunnel = s.Tunnel
+		port.CPE = s.CPE
+	}
+
+	for _, script := range p.Scripts {
+		if script.ID == "banner" {
+			port.Banner = cleanBanner(script.Output)
+		}
+	}
+
+	return port
+}
+
+// importNmapXML adds the hosts found up in the nmap report to the lan and
+// merges their open ports with the ones we know about, returning how many
+// hosts have been imported.
+func (mod *SynScanner) importNmapXML(fileName string) (int, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	var run nmapRun
+	if err = xml.Unmarshal(raw, &run); err != nil {
+		return 0, fmt.Errorf("error while parsing %s: %v", fileName, err)
+	}
+
+	imported := 0
+	for _, h := range run.Hosts {
+		if h.Status.State != "up" {
+			continue
+		}
+
+		ip, mac := "", ""
+		for _, addr := range h.Addresses {
+			switch addr.AddrType {
+			case "ipv4", "ipv6":
+				ip = addr.Addr
+			case "mac":
+				mac = addr.Addr
+			}
+		}
+
+		var host *network.Endpoint
+		if ip == mod.Session.Interface.IpAddress || ip == mod.Session.Interface.Ip6Address {
+			host = mod.Session.Interface
+		} else if ip == mod.Session.Gateway.IpAddress {
+			host = mod.Session.Gateway
+		} else if host = mod.Session.Lan.GetByIp(ip); host == nil && mac != "" {
+			mod.Session.Lan.AddIfNew(ip, mac)
+			host, _ = mod.Session.Lan.Get(mac)
+		}
+
+		// we can only keep track of hosts on our network
+		if host == nil {
+			mod.Debug("skipping %s (%s), not on the lan", ip, mac)
+			continue
+		}
+
+		if host.Hostname == "" {
+			for _, name := range h.Hostnames {
+				if name.Name != "" {
+					host.Hostname = name.Name
+					break
+				}
+			}
+		}
+
+		for _, p := range h.Ports.Ports {
+			if port := openPortFrom(p); port != nil {
+				key := portsMeta[port.Proto]
+				ports := host.Meta.GetOr(key, map[int]*OpenPort{}).(map[int]*OpenPort)
+				ports[port.Port] = port
+				host.Meta.Set(key, ports)
+			}
+		}
+
+		imported++
+	}
+
+	return imported, nil
+}
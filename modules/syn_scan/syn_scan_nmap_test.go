@@ -0,0 +1,232 @@
+package syn_scan
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/evilsocket/islazy/data"
+)
+
+func newNmapTestModule(t *testing.T) *SynScanner {
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := network.NewEndpointNoResolve("10.0.0.2", "aa:00:00:00:00:02", "eth0", 24)
+	gateway := network.NewEndpointNoResolve("10.0.0.1", "aa:00:00:00:00:01", "", 24)
+	s := &session.Session{
+		Events:    session.NewEventPool(false, true),
+		Interface: iface,
+		Gateway:   gateway,
+		Lan:       network.NewLAN(iface, gateway, aliases, func(e *network.Endpoint) {}, func(e *network.Endpoint) {}, func(e *network.Endpoint, previous string) {}),
+	}
+
+	return &SynScanner{SessionModule: session.NewSessionModule("syn.scan", s)}
+}
+
+func testScanReport() *scanReport {
+	started := time.Date(2018, 3, 14, 10, 0, 0, 0, time.UTC)
+	r := newScanReport("syn.scan 10.0.0.0/24 1 1000", "tcp", 1, 1000)
+	r.Started = started
+
+	target := network.NewEndpointNoResolve("10.0.0.10", "aa:00:00:00:00:10", "nas.lan", 24)
+	r.Open(target.IP, target, &OpenPort{
+		Proto:      "tcp",
+		Port:       22,
+		Service:    "ssh",
+		Product:    "OpenSSH",
+		Version:    "7.4",
+		Info:       "protocol 2.0",
+		CPE:        []string{"cpe:/a:openbsd:openssh:7.4"},
+		Banner:     "SSH-2.0-OpenSSH_7.4",
+		OS:         "Linux",
+		DeviceType: "storage-misc",
+	})
+	r.Open(target.IP, target, &OpenPort{
+		Proto:    "tcp",
+		Port:     443,
+		Service:  "http",
+		Tunnel:   "ssl",
+		Product:  "nginx",
+		Version:  "1.14.0",
+		Hostname: "nas.example.com",
+		CPE:      []string{"cpe:/a:igor_sysoev:nginx:1.14.0"},
+		Certificate: &Certificate{
+			Subject:   "CN=nas.example.com",
+			Issuer:    "CN=nas.example.com",
+			NotBefore: started.Add(-24 * time.Hour),
+			NotAfter:  started.Add(24 * time.Hour),
+			SHA256:    "00112233",
+		},
+	})
+	r.Closed(target.IP)
+	r.Closed(target.IP)
+
+	// only known by its port number
+	gateway := net.ParseIP("10.0.0.1")
+	r.Open(gateway, nil, &OpenPort{Proto: "tcp", Port: 53, Service: "domain"})
+	r.Filtered(gateway)
+
+	// we don't know its mac address
+	r.Open(net.ParseIP("192.168.1.1"), nil, &OpenPort{Proto: "tcp", Port: 80, Service: "http"})
+
+	r.finish()
+	r.Finished = started.Add(90 * time.Second)
+	return r
+}
+
+func TestNmapXMLExport(t *testing.T) {
+	r := testScanReport()
+	raw, err := r.ToXML()
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(string(raw), xml.Header+"<!DOCTYPE nmaprun>\n<nmaprun ") {
+		t.Fatalf("unexpected header in %s", raw)
+	}
+
+	var run nmapRun
+	if err = xml.Unmarshal(raw, &run); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Args != r.Command || run.ScanInfo.Type != "syn" || run.ScanInfo.Services != "1-1000" || run.ScanInfo.NumServices != 1000 {
+		t.Fatalf("unexpected scan info %+v (%s)", run.ScanInfo, run.Args)
+	} else if run.RunStats.Finished.Elapsed != "90.00" || run.RunStats.Hosts.Up != 3 {
+		t.Fatalf("unexpected run stats %+v", run.RunStats)
+	} else if len(run.Hosts) != 3 {
+		t.Fatalf("expected 3 hosts, got %d", len(run.Hosts))
+	}
+
+	tests := []struct {
+		address   string
+		addresses int
+		hostnames int
+		ports     []int
+		extra     map[string]int
+	}{
+		{"10.0.0.1", 1, 0, []int{53}, map[string]int{"filtered": 999}},
+		{"10.0.0.10", 2, 1, []int{22, 443}, map[string]int{"closed": 2, "filtered": 996}},
+		{"192.168.1.1", 1, 0, []int{80}, map[string]int{"filtered": 999}},
+	}
+
+	for i, tt := range tests {
+		h := run.Hosts[i]
+		if h.Addresses[0].Addr != tt.address || h.Addresses[0].AddrType != "ipv4" || h.Status.State != "up" {
+			t.Errorf("%s: unexpected host %+v", tt.address, h)
+		} else if len(h.Addresses) != tt.addresses || len(h.Hostnames) != tt.hostnames {
+			t.Errorf("%s: unexpected addresses %+v and hostnames %+v", tt.address, h.Addresses, h.Hostnames)
+		}
+
+		ports := []int{}
+		for _, p := range h.Ports.Ports {
+			ports = append(ports, p.PortID)
+		}
+		if !reflect.DeepEqual(ports, tt.ports) {
+			t.Errorf("%s: expected ports %v, got %v", tt.address, tt.ports, ports)
+		}
+
+		extra := make(map[string]int)
+		for _, e := range h.Ports.ExtraPorts {
+			if _, found := extra[e.State]; found {
+				t.Errorf("%s: %s extra ports reported twice", tt.address, e.State)
+			}
+			extra[e.State] = e.Count
+		}
+		if !reflect.DeepEqual(extra, tt.extra) {
+			t.Errorf("%s: expected extra ports %v, got %v", tt.address, tt.extra, extra)
+		}
+	}
+
+	nas := run.Hosts[1]
+	if mac := nas.Addresses[1]; mac.Addr != "AA:00:00:00:00:10" || mac.AddrType != "mac" {
+		t.Fatalf("unexpected mac address %+v", mac)
+	} else if s := nas.Ports.Ports[0].Service; s.Method != "probed" || s.Conf != 10 {
+		t.Fatalf("unexpected service %+v", s)
+	} else if s := run.Hosts[0].Ports.Ports[0].Service; s.Name != "domain" || s.Method != "table" || s.Conf != 3 {
+		t.Fatalf("unexpected service %+v", s)
+	} else if scripts := nas.Ports.Ports[1].Scripts; len(scripts) != 1 || scripts[0].ID != "ssl-cert" || !strings.Contains(scripts[0].Output, "SHA-256: 00112233") {
+		t.Fatalf("unexpected scripts %+v", scripts)
+	}
+}
+
+func TestNmapXMLRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-nmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := testScanReport()
+	fileName := filepath.Join(dir, "scan.xml")
+	if err = r.Save(fileName, "xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := newNmapTestModule(t)
+	imported, err := mod.importNmapXML(fileName)
+	if err != nil {
+		t.Fatal(err)
+	} else if imported != 2 {
+		t.Fatalf("expected 2 imported hosts, got %d", imported)
+	}
+
+	nas := mod.Session.Lan.GetByIp("10.0.0.10")
+	if nas == nil {
+		t.Fatal("expected 10.0.0.10 to be added to the lan")
+	} else if nas.HwAddress != "aa:00:00:00:00:10" || nas.Hostname != "nas.lan" {
+		t.Fatalf("unexpected host %s (%s)", nas.HwAddress, nas.Hostname)
+	} else if mod.Session.Lan.GetByIp("192.168.1.1") != nil {
+		t.Fatal("expected 192.168.1.1 to be skipped")
+	}
+
+	ports := nas.Meta.Get("ports").(map[int]*OpenPort)
+	for _, h := range r.Hosts {
+		if h.Address != "10.0.0.10" {
+			continue
+		}
+
+		if len(ports) != len(h.Ports) {
+			t.Fatalf("expected %d ports, got %d", len(h.Ports), len(ports))
+		}
+		for _, want := range h.Ports {
+			got := ports[want.Port]
+			// the certificate details are only exported for humans
+			exported := *want
+			exported.Certificate = nil
+			if !reflect.DeepEqual(got, &exported) {
+				t.Errorf("port %d: expected %+v, got %+v", want.Port, exported, got)
+			}
+		}
+	}
+
+	gwPorts, _ := mod.Session.Gateway.Meta.Get("ports").(map[int]*OpenPort)
+	if p := gwPorts[53]; p == nil || p.Service != "domain" || p.Product != "" {
+		t.Fatalf("unexpected gateway ports %+v", gwPorts)
+	}
+
+	// importing again updates the known ports
+	if imported, err = mod.importNmapXML(fileName); err != nil || imported != 2 {
+		t.Fatalf("unexpected second import: %d %v", imported, err)
+	} else if ports := nas.Meta.Get("ports").(map[int]*OpenPort); len(ports) != 2 {
+		t.Fatalf("expected 2 ports, got %d", len(ports))
+	}
+
+	if err = ioutil.WriteFile(fileName, []byte("<nmaprun"), 0644); err != nil {
+		t.Fatal(err)
+	} else if _, err = mod.importNmapXML(fileName); err == nil {
+		t.Fatal("expected an error importing an invalid report")
+	} else if err = r.Save(fileName, "html"); err == nil {
+		t.Fatal("expected an error saving in an unknown format")
+	}
+}
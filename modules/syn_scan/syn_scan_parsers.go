@@ -4,16 +4,36 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/bettercap/bettercap/network"
+
 	"github.com/evilsocket/islazy/str"
-	"github.com/malfunkt/iprange"
 )
 
+// targets selected by MAC address are scanned on their known addresses
 func (mod *SynScanner) parseTargets(arg string) error {
-	if list, err := iprange.Parse(arg); err != nil {
-		return fmt.Errorf("error while parsing IP range '%s': %s", arg, err)
-	} else {
-		mod.addresses = list.Expand()
+	ips, macs, err := network.ParseTargetsUnscoped(arg, mod.Session.Lan)
+	if err != nil {
+		return fmt.Errorf("error while parsing targets '%s': %s", arg, err)
+	}
+
+	for _, hw := range macs {
+		if e, found := mod.Session.Lan.Get(hw.String()); found {
+			if e.IP != nil {
+				ips = append(ips, e.IP)
+			}
+			if e.IPv6 != nil {
+				ips = append(ips, e.IPv6)
+			}
+		} else {
+			mod.Warning("%s is not a known host, skipping it", hw)
+		}
 	}
+
+	if err = network.CheckTargetsScope(ips, macs, mod.Name()); err != nil {
+		return err
+	}
+
+	mod.addresses = ips
 	return nil
 }
 
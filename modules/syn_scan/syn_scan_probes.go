@@ -0,0 +1,105 @@
+package syn_scan
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type probeKey struct {
+	address string
+	port    int
+}
+
+type probe struct {
+	address  net.IP
+	mac      net.HardwareAddr
+	port     int
+	sent     time.Time
+	tries    int
+	answered bool
+}
+
+func (p *probe) key() probeKey {
+	return probeKey{p.address.String(), p.port}
+}
+
+// probeTracker keeps the probes waiting for a reply, in the order they
+// have been sent so that the expired ones can be found without walking
+// through all of them.
+type probeTracker struct {
+	sync.Mutex
+	pending map[probeKey]*probe
+	queue   []*probe
+}
+
+func newProbeTracker() *probeTracker {
+	return &probeTracker{
+		pending: make(map[probeKey]*probe),
+		queue:   make([]*probe, 0),
+	}
+}
+
+// Sent starts waiting for a reply to the probe, returning false if it has
+// been answered while waiting to be retransmitted.
+func (t *probeTracker) Sent(p *probe) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if p.answered {
+		return false
+	}
+
+	p.sent = time.Now()
+	p.tries++
+	t.pending[p.key()] = p
+	t.queue = append(t.queue, p)
+	return true
+}
+
+// Answer marks the probe as answered, returning nil if it was not pending.
+func (t *probeTracker) Answer(address net.IP, port int) *probe {
+	t.Lock()
+	defer t.Unlock()
+
+	key := probeKey{address.String(), port}
+	if p, found := t.pending[key]; found {
+		delete(t.pending, key)
+		p.answered = true
+		return p
+	}
+	return nil
+}
+
+// Expired returns the oldest probe which has not been answered within the
+// timeout, if any.
+func (t *probeTracker) Expired(timeout time.Duration) *probe {
+	t.Lock()
+	defer t.Unlock()
+
+	for len(t.queue) > 0 {
+		p := t.queue[0]
+		if p.answered {
+			t.queue = t.queue[1:]
+		} else if time.Since(p.sent) >= timeout {
+			t.queue = t.queue[1:]
+			return p
+		} else {
+			break
+		}
+	}
+	return nil
+}
+
+// Drop stops waiting for a reply to the probe.
+func (t *probeTracker) Drop(p *probe) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.pending, p.key())
+}
+
+func (t *probeTracker) Pending() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.pending)
+}
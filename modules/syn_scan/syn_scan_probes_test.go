@@ -0,0 +1,177 @@
+package syn_scan
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeTracker(t *testing.T) {
+	tracker := newProbeTracker()
+	a := &probe{address: net.ParseIP("10.0.0.1"), port: 80}
+	b := &probe{address: net.ParseIP("10.0.0.2"), port: 80}
+	c := &probe{address: net.ParseIP("fe80::1"), port: 443}
+
+	for _, p := range []*probe{a, b, c} {
+		if !tracker.Sent(p) {
+			t.Fatalf("expected %s:%d to be sent", p.address, p.port)
+		}
+	}
+
+	tests := []struct {
+		address string
+		port    int
+		found   bool
+	}{
+		{"10.0.0.1", 80, true},
+		{"10.0.0.1", 80, false},
+		{"10.0.0.1", 81, false},
+		{"10.0.0.3", 80, false},
+		{"fe80:0::1", 443, true},
+	}
+
+	for _, tt := range tests {
+		p := tracker.Answer(net.ParseIP(tt.address), tt.port)
+		if tt.found && (p == nil || !p.answered || p.tries != 1) {
+			t.Errorf("%s:%d: expected an answered probe, got %+v", tt.address, tt.port, p)
+		} else if !tt.found && p != nil {
+			t.Errorf("%s:%d: unexpected probe %+v", tt.address, tt.port, p)
+		}
+	}
+
+	if pending := tracker.Pending(); pending != 1 {
+		t.Fatalf("expected 1 pending probe, got %d", pending)
+	}
+
+	// answered probes are skipped and the others only expire after the timeout
+	if p := tracker.Expired(time.Hour); p != nil {
+		t.Fatalf("unexpected expired probe %+v", p)
+	} else if p := tracker.Expired(0); p != b {
+		t.Fatalf("expected %+v to expire, got %+v", b, p)
+	} else if p := tracker.Expired(0); p != nil {
+		t.Fatalf("unexpected expired probe %+v", p)
+	}
+
+	tracker.Drop(b)
+	if pending := tracker.Pending(); pending != 0 {
+		t.Fatalf("expected no pending probes, got %d", pending)
+	}
+}
+
+func TestProbeTrackerRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		answerAt int
+		retries  int
+		tries    int
+		answered bool
+	}{
+		{"first try", 1, 2, 1, true},
+		{"second try", 2, 2, 2, true},
+		{"last try", 3, 2, 3, true},
+		{"never", 0, 2, 3, false},
+		{"no retries", 0, 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		tracker := newProbeTracker()
+		p := &probe{address: net.ParseIP("10.0.0.1"), port: 22}
+		tracker.Sent(p)
+
+		// what the scanner does with the expired probes
+		for {
+			if p.tries == tt.answerAt {
+				tracker.Answer(p.address, p.port)
+			}
+
+			expired := tracker.Expired(0)
+			if expired == nil {
+				break
+			} else if expired.tries > tt.retries {
+				tracker.Drop(expired)
+				break
+			}
+			tracker.Sent(expired)
+		}
+
+		if p.tries != tt.tries || p.answered != tt.answered {
+			t.Errorf("%s: expected tries=%d answered=%v, got tries=%d answered=%v", tt.name, tt.tries, tt.answered, p.tries, p.answered)
+		} else if pending := tracker.Pending(); pending != 0 {
+			t.Errorf("%s: expected no pending probes, got %d", tt.name, pending)
+		}
+	}
+
+	// a probe answered while waiting to be retransmitted is not sent again
+	tracker := newProbeTracker()
+	p := &probe{address: net.ParseIP("10.0.0.1"), port: 22}
+	tracker.Sent(p)
+	expired := tracker.Expired(0)
+	tracker.Answer(p.address, p.port)
+	if tracker.Sent(expired) {
+		t.Fatalf("expected the answered probe not to be retransmitted")
+	} else if p.tries != 1 {
+		t.Fatalf("expected 1 try, got %d", p.tries)
+	}
+}
+
+func TestProbeOrder(t *testing.T) {
+	tests := []struct {
+		ports   int
+		targets int
+	}{
+		{1, 1},
+		{1, 5},
+		{100, 1},
+		{20, 10},
+		{0, 10},
+		{10, 0},
+	}
+
+	for _, tt := range tests {
+		seen := make(map[[2]int]bool)
+		ports := []int{}
+		probeOrder(rand.New(rand.NewSource(1)), tt.ports, tt.targets, func(port, target int) bool {
+			key := [2]int{port, target}
+			if seen[key] {
+				t.Errorf("%dx%d: port %d of target %d probed twice", tt.ports, tt.targets, port, target)
+			} else if port < 0 || port >= tt.ports || target < 0 || target >= tt.targets {
+				t.Errorf("%dx%d: unexpected port %d of target %d", tt.ports, tt.targets, port, target)
+			}
+			seen[key] = true
+
+			if len(ports) == 0 || ports[len(ports)-1] != port {
+				ports = append(ports, port)
+			}
+			return true
+		})
+
+		if len(seen) != tt.ports*tt.targets {
+			t.Errorf("%dx%d: expected %d probes, got %d", tt.ports, tt.targets, tt.ports*tt.targets, len(seen))
+		} else if tt.targets > 0 && len(ports) != tt.ports {
+			t.Errorf("%dx%d: expected every port to be probed on all the targets at once, got %v", tt.ports, tt.targets, ports)
+		}
+	}
+
+	// the ports are not probed sequentially
+	sequential := true
+	next := 0
+	probeOrder(rand.New(rand.NewSource(1)), 100, 1, func(port, target int) bool {
+		sequential = sequential && port == next
+		next++
+		return true
+	})
+	if sequential {
+		t.Fatalf("expected the ports to be probed in random order")
+	}
+
+	// the callback stops the scan
+	n := 0
+	probeOrder(rand.New(rand.NewSource(1)), 10, 10, func(port, target int) bool {
+		n++
+		return n < 5
+	})
+	if n != 5 {
+		t.Fatalf("expected the scan to stop after 5 probes, got %d", n)
+	}
+}
@@ -0,0 +1,117 @@
+package syn_scan
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	minScanRate     = 10.0
+	initialScanRate = 100.0
+	initialProbeRTT = time.Second
+	minProbeTimeout = time.Duration(100) * time.Millisecond
+	maxProbeTimeout = time.Duration(3) * time.Second
+)
+
+// rateController paces the probes, starting slow and speeding up to the
+// configured rate as long as no probe gets lost, halving the rate when
+// the reply to a retransmitted probe tells us the first one was dropped.
+type rateController struct {
+	sync.Mutex
+	max        float64
+	current    float64
+	srtt       time.Duration
+	rttvar     time.Duration
+	next       time.Time
+	lastChange time.Time
+	lastDrop   time.Time
+}
+
+func newRateController(max int) *rateController {
+	now := time.Now()
+	return &rateController{
+		max:        float64(max),
+		current:    math.Min(float64(max), initialScanRate),
+		next:       now,
+		lastChange: now,
+	}
+}
+
+// Wait blocks until the next probe can be sent.
+func (r *rateController) Wait() {
+	r.Lock()
+	now := time.Now()
+	if now.Sub(r.lastChange) >= time.Second {
+		r.current = math.Min(r.max, r.current*1.5)
+		r.lastChange = now
+	}
+
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(time.Duration(float64(time.Second) / r.current))
+	r.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// OnReply updates the round trip time estimation as per RFC 6298.
+func (r *rateController) OnReply(rtt time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.srtt == 0 {
+		r.srtt = rtt
+		r.rttvar = rtt / 2
+	} else {
+		delta := r.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		r.rttvar = (3*r.rttvar + delta) / 4
+		r.srtt = (7*r.srtt + rtt) / 8
+	}
+}
+
+// OnDrop slows down, at most once per round trip time since the probes
+// sent in the meantime were sent at the same rate.
+func (r *rateController) OnDrop() {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastDrop) > r.srtt {
+		r.current = math.Max(minScanRate, r.current/2)
+		r.lastDrop = now
+		r.lastChange = now
+	}
+}
+
+// Timeout returns how long to wait for a reply before retransmitting a probe.
+func (r *rateController) Timeout() time.Duration {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.srtt == 0 {
+		return initialProbeRTT
+	}
+
+	timeout := r.srtt + 4*r.rttvar
+	if timeout < minProbeTimeout {
+		return minProbeTimeout
+	} else if timeout > maxProbeTimeout {
+		return maxProbeTimeout
+	}
+	return timeout
+}
+
+// Rate returns the current rate in packets per second.
+func (r *rateController) Rate() float64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.current
+}
@@ -0,0 +1,125 @@
+package syn_scan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateControllerInitialRate(t *testing.T) {
+	tests := []struct {
+		max  int
+		rate float64
+	}{
+		{1, 1},
+		{50, 50},
+		{100, 100},
+		{1000, initialScanRate},
+	}
+
+	for _, tt := range tests {
+		if rate := newRateController(tt.max).Rate(); rate != tt.rate {
+			t.Errorf("max %d: expected initial rate %f, got %f", tt.max, tt.rate, rate)
+		}
+	}
+}
+
+func TestRateControllerRTT(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		rtts    []time.Duration
+		srtt    time.Duration
+		rttvar  time.Duration
+		timeout time.Duration
+	}{
+		{"no replies", nil, 0, 0, initialProbeRTT},
+		{"first reply", []time.Duration{100 * ms}, 100 * ms, 50 * ms, 300 * ms},
+		{"stable", []time.Duration{100 * ms, 100 * ms}, 100 * ms, 37500 * time.Microsecond, 250 * ms},
+		{"slower", []time.Duration{100 * ms, 180 * ms}, 110 * ms, 57500 * time.Microsecond, 340 * ms},
+		{"fast lan", []time.Duration{time.Millisecond}, ms, 500 * time.Microsecond, minProbeTimeout},
+		{"slow link", []time.Duration{2 * time.Second}, 2 * time.Second, time.Second, maxProbeTimeout},
+	}
+
+	for _, tt := range tests {
+		r := newRateController(1000)
+		for _, rtt := range tt.rtts {
+			r.OnReply(rtt)
+		}
+
+		if r.srtt != tt.srtt || r.rttvar != tt.rttvar {
+			t.Errorf("%s: expected srtt=%s rttvar=%s, got srtt=%s rttvar=%s", tt.name, tt.srtt, tt.rttvar, r.srtt, r.rttvar)
+		} else if timeout := r.Timeout(); timeout != tt.timeout {
+			t.Errorf("%s: expected timeout %s, got %s", tt.name, tt.timeout, timeout)
+		}
+	}
+}
+
+func TestRateControllerDrops(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int
+		srtt     time.Duration
+		lastDrop time.Duration
+		rate     float64
+	}{
+		{"first drop", 1000, 0, time.Hour, 50},
+		{"drop after a round trip", 1000, 10 * time.Millisecond, time.Second, 50},
+		{"drop within a round trip", 1000, time.Second, 10 * time.Millisecond, 100},
+		{"minimum rate", 15, 0, time.Hour, minScanRate},
+	}
+
+	for _, tt := range tests {
+		r := newRateController(tt.max)
+		r.srtt = tt.srtt
+		r.lastDrop = time.Now().Add(-tt.lastDrop)
+		r.OnDrop()
+		if rate := r.Rate(); rate != tt.rate {
+			t.Errorf("%s: expected rate %f, got %f", tt.name, tt.rate, rate)
+		}
+	}
+
+	// only the first of many drops in the same round trip counts
+	r := newRateController(1000)
+	r.srtt = time.Second
+	for i := 0; i < 5; i++ {
+		r.OnDrop()
+	}
+	if rate := r.Rate(); rate != 50 {
+		t.Fatalf("expected rate 50, got %f", rate)
+	}
+}
+
+func TestRateControllerWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        int
+		current    float64
+		lastChange time.Duration
+		rate       float64
+	}{
+		{"no change yet", 1000, 100, 0, 100},
+		{"speed up", 1000, 100, time.Second, 150},
+		{"up to the max", 120, 100, time.Second, 120},
+		{"after a drop", 1000, 50, 2 * time.Second, 75},
+	}
+
+	for _, tt := range tests {
+		r := newRateController(tt.max)
+		r.current = tt.current
+		r.lastChange = time.Now().Add(-tt.lastChange)
+		r.Wait()
+		if rate := r.Rate(); rate != tt.rate {
+			t.Errorf("%s: expected rate %f, got %f", tt.name, tt.rate, rate)
+		}
+	}
+
+	// probes are spaced by the current rate
+	r := newRateController(100)
+	started := time.Now()
+	for i := 0; i < 6; i++ {
+		r.Wait()
+	}
+	if elapsed := time.Since(started); elapsed < 45*time.Millisecond {
+		t.Fatalf("expected 6 probes at 100 pps to take at least 50ms, took %s", elapsed)
+	}
+}
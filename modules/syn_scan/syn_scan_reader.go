@@ -1,6 +1,10 @@
 package syn_scan
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
 	"sync/atomic"
 
 	"github.com/bettercap/bettercap/network"
@@ -12,65 +16,214 @@ import (
 )
 
 type OpenPort struct {
-	Proto   string `json:"proto"`
-	Banner  string `json:"banner"`
-	Service string `json:"service"`
-	Port    int    `json:"port"`
+	Proto       string       `json:"proto"`
+	Banner      string       `json:"banner"`
+	Service     string       `json:"service"`
+	Port        int          `json:"port"`
+	Tunnel      string       `json:"tunnel,omitempty"`
+	Product     string       `json:"product,omitempty"`
+	Version     string       `json:"version,omitempty"`
+	Info        string       `json:"info,omitempty"`
+	Hostname    string       `json:"hostname,omitempty"`
+	OS          string       `json:"os,omitempty"`
+	DeviceType  string       `json:"device_type,omitempty"`
+	CPE         []string     `json:"cpe,omitempty"`
+	Certificate *Certificate `json:"certificate,omitempty"`
 }
 
-func (mod *SynScanner) onPacket(pkt gopacket.Packet) {
+// Description returns the product and version of the service if known, its
+// banner otherwise.
+func (p *OpenPort) Description() string {
+	desc := strings.TrimSpace(p.Product + " " + p.Version)
+	if p.Info != "" {
+		desc = strings.TrimSpace(desc + " (" + p.Info + ")")
+	}
+	if desc == "" {
+		desc = p.Banner
+	}
+	return desc
+}
+
+// meta keys of the open ports for each protocol
+var portsMeta = map[string]string{
+	"tcp": "ports",
+	"udp": "udp-ports",
+}
+
+func init() {
+	// open ports of the hosts restored from a workspace
+	for _, key := range portsMeta {
+		network.RegisterMetaDecoder(key, func(raw json.RawMessage) (interface{}, error) {
+			ports := make(map[int]*OpenPort)
+			err := json.Unmarshal(raw, &ports)
+			return ports, err
+		})
+	}
+}
+
+type portState int
+
+const (
+	portUnknown portState = iota
+	portOpen
+	portClosed
+	portFiltered
+)
+
+// reply is what a packet tells us about one of the probed ports.
+type reply struct {
+	address net.IP
+	proto   string
+	port    int
+	state   portState
+	reason  string
+}
+
+// parseReply returns nil if the packet is not a reply to one of our probes.
+func parseReply(pkt gopacket.Packet) *reply {
 	if pkt == nil || pkt.Data() == nil {
-		return
+		return nil
 	}
 
 	var eth layers.Ethernet
 	var ip layers.IPv4
+	var ip6 layers.IPv6
 	var tcp layers.TCP
+	var udp layers.UDP
+	var icmp layers.ICMPv4
 	foundLayerTypes := []gopacket.LayerType{}
 
 	parser := gopacket.NewDecodingLayerParser(
 		layers.LayerTypeEthernet,
 		&eth,
 		&ip,
+		&ip6,
 		&tcp,
+		&udp,
+		&icmp,
 	)
+	parser.IgnoreUnsupported = true
 
-	err := parser.DecodeLayers(pkt.Data(), &foundLayerTypes)
-	if err != nil {
-		return
+	if err := parser.DecodeLayers(pkt.Data(), &foundLayerTypes); err != nil || len(foundLayerTypes) < 3 {
+		return nil
 	}
 
-	if tcp.DstPort == synSourcePort && tcp.SYN && tcp.ACK {
-		atomic.AddUint64(&mod.stats.openPorts, 1)
-
-		from := ip.SrcIP.String()
-		port := int(tcp.SrcPort)
+	srcIP := ip.SrcIP
+	if foundLayerTypes[1] == layers.LayerTypeIPv6 {
+		srcIP = ip6.SrcIP
+	}
 
-		openPort := &OpenPort{
-			Proto:   "tcp",
-			Port:    port,
-			Service: network.GetServiceByPort(port, "tcp"),
+	switch foundLayerTypes[2] {
+	case layers.LayerTypeTCP:
+		if tcp.DstPort != synSourcePort {
+			return nil
+		} else if tcp.SYN && tcp.ACK {
+			return &reply{srcIP, "tcp", int(tcp.SrcPort), portOpen, ""}
+		} else if tcp.RST {
+			return &reply{srcIP, "tcp", int(tcp.SrcPort), portClosed, ""}
 		}
-
-		var host *network.Endpoint
-		if ip.SrcIP.Equal(mod.Session.Interface.IP) {
-			host = mod.Session.Interface
-		} else if ip.SrcIP.Equal(mod.Session.Gateway.IP) {
-			host = mod.Session.Gateway
-		} else {
-			host = mod.Session.Lan.GetByIp(from)
+	case layers.LayerTypeUDP:
+		if udp.DstPort == synSourcePort {
+			return &reply{srcIP, "udp", int(udp.SrcPort), portOpen, ""}
 		}
+	case layers.LayerTypeICMPv4:
+		if icmp.TypeCode.Type() == layers.ICMPv4TypeDestinationUnreachable {
+			return parseUnreachable(ip.SrcIP, icmp)
+		}
+	}
+	return nil
+}
 
-		if host != nil {
-			ports := host.Meta.GetOr("ports", map[int]*OpenPort{}).(map[int]*OpenPort)
-			if _, found := ports[port]; !found {
-				ports[port] = openPort
-			}
-			host.Meta.Set("ports", ports)
+// the payload of an icmp destination unreachable message carries the header
+// of the udp probe that triggered it
+func parseUnreachable(from net.IP, icmp layers.ICMPv4) *reply {
+	probe := gopacket.NewPacket(icmp.Payload, layers.LayerTypeIPv4, gopacket.Default)
+	lip := probe.Layer(layers.LayerTypeIPv4)
+	ludp := probe.Layer(layers.LayerTypeUDP)
+	if lip == nil || ludp == nil {
+		return nil
+	}
+
+	udp := ludp.(*layers.UDP)
+	if udp.SrcPort != synSourcePort {
+		return nil
+	}
+
+	r := &reply{
+		address: lip.(*layers.IPv4).DstIP,
+		proto:   "udp",
+		port:    int(udp.DstPort),
+		state:   portUnknown,
+		reason:  fmt.Sprintf("%s reported %s", from, icmp.TypeCode),
+	}
+
+	switch icmp.TypeCode.Code() {
+	case layers.ICMPv4CodePort:
+		r.state = portClosed
+	case layers.ICMPv4CodeHost,
+		layers.ICMPv4CodeProtocol,
+		layers.ICMPv4CodeNetAdminProhibited,
+		layers.ICMPv4CodeHostAdminProhibited,
+		layers.ICMPv4CodeCommAdminProhibited:
+		r.state = portFiltered
+	}
+	return r
+}
+
+func (mod *SynScanner) onPacket(pkt gopacket.Packet) {
+	r := parseReply(pkt)
+	if r == nil || !mod.onAnswer(r.address, r.port) {
+		return
+	}
+
+	switch r.state {
+	case portOpen:
+		mod.onOpenPort(r.address, r.proto, r.port)
+	case portClosed:
+		atomic.AddUint64(&mod.stats.closedPorts, 1)
+		mod.report.Closed(r.address)
+		if r.proto == "udp" {
+			mod.Debug("udp port %d of %s is closed", r.port, r.address)
 		}
+	case portFiltered:
+		atomic.AddUint64(&mod.stats.filteredPorts, 1)
+		mod.report.Filtered(r.address)
+		mod.Debug("udp port %d of %s is filtered (%s)", r.port, r.address, r.reason)
+	}
+}
 
-		mod.bannerQueue.Add(async.Job(grabberJob{from, openPort}))
+func (mod *SynScanner) onOpenPort(ip net.IP, proto string, port int) {
+	atomic.AddUint64(&mod.stats.openPorts, 1)
 
-		NewSynScanEvent(from, host, port).Push()
+	from := ip.String()
+	openPort := &OpenPort{
+		Proto:   proto,
+		Port:    port,
+		Service: network.GetServiceByPort(port, proto),
 	}
+
+	var host *network.Endpoint
+	if ip.Equal(mod.Session.Interface.IP) || ip.Equal(mod.Session.Interface.IPv6) {
+		host = mod.Session.Interface
+	} else if ip.Equal(mod.Session.Gateway.IP) {
+		host = mod.Session.Gateway
+	} else {
+		host = mod.Session.Lan.GetByIp(from)
+	}
+
+	if host != nil {
+		key := portsMeta[proto]
+		ports := host.Meta.GetOr(key, map[int]*OpenPort{}).(map[int]*OpenPort)
+		if known, found := ports[port]; !found {
+			ports[port] = openPort
+		} else {
+			openPort = known
+		}
+		host.Meta.Set(key, ports)
+	}
+
+	mod.report.Open(ip, host, openPort)
+	mod.bannerQueue.Add(async.Job(grabberJob{from, host, openPort}))
+
+	NewSynScanEvent(from, host, openPort).Push()
 }
@@ -0,0 +1,225 @@
+package syn_scan
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bettercap/bettercap/packets"
+	"github.com/bettercap/bettercap/session"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	scanOurMAC    = net.HardwareAddr{0xaa, 0, 0, 0, 0, 0x02}
+	scanTargetMAC = net.HardwareAddr{0xaa, 0, 0, 0, 0, 0x10}
+)
+
+func scanFrame(t *testing.T, from string, to string, l4 ...gopacket.SerializableLayer) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       scanTargetMAC,
+		DstMAC:       scanOurMAC,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+
+	var ip gopacket.NetworkLayer
+	var ipLayer gopacket.SerializableLayer
+	if src := net.ParseIP(from); src.To4() == nil {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ip6 := &layers.IPv6{Version: 6, HopLimit: 64, SrcIP: src, DstIP: net.ParseIP(to)}
+		ip, ipLayer = ip6, ip6
+	} else {
+		ip4 := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, SrcIP: src, DstIP: net.ParseIP(to)}
+		ip, ipLayer = ip4, ip4
+	}
+
+	for _, l := range l4 {
+		switch l := l.(type) {
+		case *layers.TCP:
+			l.SetNetworkLayerForChecksum(ip)
+			setNextHeader(ipLayer, layers.IPProtocolTCP)
+		case *layers.UDP:
+			l.SetNetworkLayerForChecksum(ip)
+			setNextHeader(ipLayer, layers.IPProtocolUDP)
+		case *layers.ICMPv4:
+			setNextHeader(ipLayer, layers.IPProtocolICMPv4)
+		}
+	}
+
+	err, raw := packets.Serialize(append([]gopacket.SerializableLayer{eth, ipLayer}, l4...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func setNextHeader(l gopacket.SerializableLayer, proto layers.IPProtocol) {
+	if ip4, ok := l.(*layers.IPv4); ok {
+		ip4.Protocol = proto
+	} else if ip6, ok := l.(*layers.IPv6); ok {
+		ip6.NextHeader = proto
+	}
+}
+
+func tcpReply(t *testing.T, from string, port int, dstPort int, flags string) gopacket.Packet {
+	tcp := &layers.TCP{
+		SrcPort: layers.TCPPort(port),
+		DstPort: layers.TCPPort(dstPort),
+		Window:  1024,
+	}
+	for _, f := range flags {
+		switch f {
+		case 'S':
+			tcp.SYN = true
+		case 'A':
+			tcp.ACK = true
+		case 'R':
+			tcp.RST = true
+		}
+	}
+
+	to := "10.0.0.2"
+	if net.ParseIP(from).To4() == nil {
+		to = "fe80::2"
+	}
+	return scanFrame(t, from, to, tcp)
+}
+
+func udpReply(t *testing.T, from string, port int, dstPort int) gopacket.Packet {
+	payload := gopacket.Payload("reply")
+	return scanFrame(t, from, "10.0.0.2", &layers.UDP{
+		SrcPort: layers.UDPPort(port),
+		DstPort: layers.UDPPort(dstPort),
+	}, &payload)
+}
+
+// the router or the target telling us that the udp probe sent from srcPort
+// to the target port could not be delivered
+func unreachable(t *testing.T, from string, target string, port int, srcPort int, code uint8) gopacket.Packet {
+	probeIP := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("10.0.0.2"),
+		DstIP:    net.ParseIP(target),
+	}
+	probeUDP := &layers.UDP{
+		SrcPort: layers.UDPPort(srcPort),
+		DstPort: layers.UDPPort(port),
+	}
+	probeUDP.SetNetworkLayerForChecksum(probeIP)
+
+	err, probe := packets.Serialize(probeIP, probeUDP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := gopacket.Payload(probe)
+	return scanFrame(t, from, "10.0.0.2", &layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, code),
+	}, &payload)
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkt     gopacket.Packet
+		address string
+		proto   string
+		port    int
+		state   portState
+	}{
+		{"syn ack", tcpReply(t, "10.0.0.10", 80, synSourcePort, "SA"), "10.0.0.10", "tcp", 80, portOpen},
+		{"rst", tcpReply(t, "10.0.0.10", 81, synSourcePort, "R"), "10.0.0.10", "tcp", 81, portClosed},
+		{"rst ack", tcpReply(t, "10.0.0.10", 82, synSourcePort, "RA"), "10.0.0.10", "tcp", 82, portClosed},
+		{"ipv6 syn ack", tcpReply(t, "fe80::10", 443, synSourcePort, "SA"), "fe80::10", "tcp", 443, portOpen},
+		{"ipv6 rst", tcpReply(t, "fe80::10", 444, synSourcePort, "RA"), "fe80::10", "tcp", 444, portClosed},
+		{"udp", udpReply(t, "10.0.0.10", 53, synSourcePort), "10.0.0.10", "udp", 53, portOpen},
+		{"port unreachable", unreachable(t, "10.0.0.10", "10.0.0.10", 161, synSourcePort, layers.ICMPv4CodePort), "10.0.0.10", "udp", 161, portClosed},
+		// the router answers for the target
+		{"host unreachable", unreachable(t, "10.0.0.1", "10.0.0.20", 161, synSourcePort, layers.ICMPv4CodeHost), "10.0.0.20", "udp", 161, portFiltered},
+		{"protocol unreachable", unreachable(t, "10.0.0.20", "10.0.0.20", 162, synSourcePort, layers.ICMPv4CodeProtocol), "10.0.0.20", "udp", 162, portFiltered},
+		{"net prohibited", unreachable(t, "10.0.0.1", "10.0.0.20", 163, synSourcePort, layers.ICMPv4CodeNetAdminProhibited), "10.0.0.20", "udp", 163, portFiltered},
+		{"host prohibited", unreachable(t, "10.0.0.1", "10.0.0.20", 164, synSourcePort, layers.ICMPv4CodeHostAdminProhibited), "10.0.0.20", "udp", 164, portFiltered},
+		{"communication prohibited", unreachable(t, "10.0.0.1", "10.0.0.20", 165, synSourcePort, layers.ICMPv4CodeCommAdminProhibited), "10.0.0.20", "udp", 165, portFiltered},
+		// answered but inconclusive
+		{"net unreachable", unreachable(t, "10.0.0.1", "10.0.0.20", 166, synSourcePort, layers.ICMPv4CodeNet), "10.0.0.20", "udp", 166, portUnknown},
+		{"fragmentation needed", unreachable(t, "10.0.0.1", "10.0.0.20", 167, synSourcePort, layers.ICMPv4CodeFragmentationNeeded), "10.0.0.20", "udp", 167, portUnknown},
+		// not ours
+		{"syn ack to another port", tcpReply(t, "10.0.0.10", 80, 12345, "SA"), "", "", 0, portUnknown},
+		{"ack", tcpReply(t, "10.0.0.10", 80, synSourcePort, "A"), "", "", 0, portUnknown},
+		{"udp to another port", udpReply(t, "10.0.0.10", 53, 12345), "", "", 0, portUnknown},
+		{"unreachable for another probe", unreachable(t, "10.0.0.10", "10.0.0.10", 161, 12345, layers.ICMPv4CodePort), "", "", 0, portUnknown},
+		{"echo reply", scanFrame(t, "10.0.0.10", "10.0.0.2", &layers.ICMPv4{
+			TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0),
+		}), "", "", 0, portUnknown},
+		{"nil", nil, "", "", 0, portUnknown},
+	}
+
+	for _, tt := range tests {
+		r := parseReply(tt.pkt)
+		if tt.address == "" {
+			if r != nil {
+				t.Errorf("%s: unexpected reply %+v", tt.name, r)
+			}
+			continue
+		} else if r == nil {
+			t.Errorf("%s: expected a reply", tt.name)
+			continue
+		}
+
+		if !r.address.Equal(net.ParseIP(tt.address)) || r.proto != tt.proto || r.port != tt.port {
+			t.Errorf("%s: expected %s %s/%d, got %s %s/%d", tt.name, tt.address, tt.proto, tt.port, r.address, r.proto, r.port)
+		} else if r.state != tt.state {
+			t.Errorf("%s: expected state %d, got %d", tt.name, tt.state, r.state)
+		}
+	}
+}
+
+func TestSynScanOnPacket(t *testing.T) {
+	mod := &SynScanner{
+		SessionModule: session.NewSessionModule("syn.scan", &session.Session{Events: session.NewEventPool(false, true)}),
+		probes:        newProbeTracker(),
+		rate:          newRateController(100),
+		report:        newScanReport("syn.scan 10.0.0.0/24 1 1000", "udp", 1, 1000),
+	}
+
+	for _, p := range []*probe{
+		{address: net.ParseIP("10.0.0.10"), port: 161},
+		{address: net.ParseIP("10.0.0.20"), port: 161},
+		{address: net.ParseIP("10.0.0.20"), port: 162},
+	} {
+		mod.probes.Sent(p)
+	}
+
+	replies := []gopacket.Packet{
+		unreachable(t, "10.0.0.10", "10.0.0.10", 161, synSourcePort, layers.ICMPv4CodePort),
+		unreachable(t, "10.0.0.1", "10.0.0.20", 161, synSourcePort, layers.ICMPv4CodeHost),
+		unreachable(t, "10.0.0.1", "10.0.0.20", 162, synSourcePort, layers.ICMPv4CodeNet),
+		// duplicates and replies to probes we never sent are ignored
+		unreachable(t, "10.0.0.10", "10.0.0.10", 161, synSourcePort, layers.ICMPv4CodePort),
+		unreachable(t, "10.0.0.10", "10.0.0.10", 999, synSourcePort, layers.ICMPv4CodePort),
+	}
+	for _, pkt := range replies {
+		mod.onPacket(pkt)
+	}
+
+	if mod.stats.closedPorts != 1 || mod.stats.filteredPorts != 1 {
+		t.Fatalf("expected 1 closed and 1 filtered port, got %d and %d", mod.stats.closedPorts, mod.stats.filteredPorts)
+	} else if mod.stats.completedProbes != 3 {
+		t.Fatalf("expected 3 completed probes, got %d", mod.stats.completedProbes)
+	} else if pending := mod.probes.Pending(); pending != 0 {
+		t.Fatalf("expected no pending probes, got %d", pending)
+	}
+
+	mod.report.finish()
+	if len(mod.report.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts in the report, got %d", len(mod.report.Hosts))
+	} else if h := mod.report.Hosts[0]; h.Address != "10.0.0.10" || h.Closed != 1 || h.Filtered != 0 {
+		t.Fatalf("unexpected host %+v", h)
+	} else if h := mod.report.Hosts[1]; h.Address != "10.0.0.20" || h.Closed != 0 || h.Filtered != 1 {
+		t.Fatalf("unexpected host %+v", h)
+	}
+}
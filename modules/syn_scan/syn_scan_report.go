@@ -0,0 +1,215 @@
+package syn_scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+)
+
+type reportHost struct {
+	Address    string      `json:"address"`
+	MAC        string      `json:"mac,omitempty"`
+	Vendor     string      `json:"vendor,omitempty"`
+	Hostname   string      `json:"hostname,omitempty"`
+	Ports      []*OpenPort `json:"ports"`
+	Closed     int         `json:"closed"`
+	Filtered   int         `json:"filtered"`
+	NoResponse int         `json:"no_response"`
+
+	ip   net.IP
+	host *network.Endpoint
+	open map[int]*OpenPort
+}
+
+// scanReport collects the results of a scan for every host that answered
+// to at least one probe.
+type scanReport struct {
+	sync.Mutex
+	Command   string        `json:"command"`
+	Protocol  string        `json:"protocol"`
+	StartPort int           `json:"start_port"`
+	EndPort   int           `json:"end_port"`
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	Hosts     []*reportHost `json:"hosts"`
+
+	byAddress map[string]*reportHost
+}
+
+func newScanReport(command string, protocol string, startPort int, endPort int) *scanReport {
+	return &scanReport{
+		Command:   command,
+		Protocol:  protocol,
+		StartPort: startPort,
+		EndPort:   endPort,
+		Started:   time.Now(),
+		Hosts:     make([]*reportHost, 0),
+		byAddress: make(map[string]*reportHost),
+	}
+}
+
+func (r *scanReport) hostFor(ip net.IP) *reportHost {
+	address := ip.String()
+	h, found := r.byAddress[address]
+	if !found {
+		h = &reportHost{
+			Address: address,
+			ip:      ip,
+			open:    make(map[int]*OpenPort),
+		}
+		r.byAddress[address] = h
+	}
+	return h
+}
+
+func (r *scanReport) Open(ip net.IP, host *network.Endpoint, port *OpenPort) {
+	r.Lock()
+	defer r.Unlock()
+	h := r.hostFor(ip)
+	h.host = host
+	h.open[port.Port] = port
+}
+
+func (r *scanReport) Closed(ip net.IP) {
+	r.Lock()
+	defer r.Unlock()
+	r.hostFor(ip).Closed++
+}
+
+func (r *scanReport) Filtered(ip net.IP) {
+	r.Lock()
+	defer r.Unlock()
+	r.hostFor(ip).Filtered++
+}
+
+// finish sorts the hosts and their ports and fills the details of the
+// hosts we know about.
+func (r *scanReport) finish() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.Finished = time.Now()
+	numPorts := r.EndPort - r.StartPort + 1
+	r.Hosts = make([]*reportHost, 0, len(r.byAddress))
+	for _, h := range r.byAddress {
+		h.Ports = make([]*OpenPort, 0, len(h.open))
+		for _, port := range h.open {
+			h.Ports = append(h.Ports, port)
+		}
+		sort.Slice(h.Ports, func(i, j int) bool {
+			return h.Ports[i].Port < h.Ports[j].Port
+		})
+
+		h.NoResponse = numPorts - len(h.Ports) - h.Closed - h.Filtered
+		if h.NoResponse < 0 {
+			h.NoResponse = 0
+		}
+
+		if h.host != nil {
+			h.MAC = h.host.HwAddress
+			h.Vendor = h.host.Vendor
+			h.Hostname = h.host.Hostname
+		}
+
+		r.Hosts = append(r.Hosts, h)
+	}
+
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		return bytes.Compare(r.Hosts[i].ip.To16(), r.Hosts[j].ip.To16()) < 0
+	})
+}
+
+func (r *scanReport) Services() string {
+	if r.StartPort == r.EndPort {
+		return fmt.Sprintf("%d", r.StartPort)
+	}
+	return fmt.Sprintf("%d-%d", r.StartPort, r.EndPort)
+}
+
+func (r *scanReport) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// grepable output fields can't contain the separators
+func grepableField(s string) string {
+	return strings.NewReplacer("/", "|", ",", " ", "\t", " ").Replace(s)
+}
+
+// ToGrepable returns the report in the nmap -oG format.
+func (r *scanReport) ToGrepable() []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "# %s initiated %s as: %s\n", nmapScanner, r.Started.Format(time.ANSIC), r.Command)
+	for _, h := range r.Hosts {
+		name := grepableField(h.Hostname)
+		ports := make([]string, 0, len(h.Ports))
+		for _, p := range h.Ports {
+			version := ""
+			if p.Product != "" {
+				version = grepableField(p.Description())
+			}
+			service := p.Service
+			if p.Tunnel != "" && service != "" {
+				service = p.Tunnel + "|" + service
+			}
+			ports = append(ports, fmt.Sprintf("%d/open/%s//%s//%s/", p.Port, r.Protocol, grepableField(service), version))
+		}
+
+		fmt.Fprintf(&buf, "Host: %s (%s)\tStatus: Up\n", h.Address, name)
+		if len(ports) > 0 {
+			fmt.Fprintf(&buf, "Host: %s (%s)\tPorts: %s", h.Address, name, strings.Join(ports, ", "))
+			if h.Closed > 0 {
+				fmt.Fprintf(&buf, "\tIgnored State: closed (%d)", h.Closed)
+			}
+			buf.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&buf, "# %s done at %s -- %d host%s up scanned in %.2f seconds\n",
+		nmapScanner,
+		r.Finished.Format(time.ANSIC),
+		len(r.Hosts),
+		plural(uint64(len(r.Hosts))),
+		r.Finished.Sub(r.Started).Seconds())
+	return buf.Bytes()
+}
+
+// Save writes the report to the file in the given format.
+func (r *scanReport) Save(fileName string, format string) error {
+	var err error
+	var data []byte
+
+	switch format {
+	case "xml":
+		data, err = r.ToXML()
+	case "json":
+		data, err = r.ToJSON()
+	case "grepable":
+		data = r.ToGrepable()
+	default:
+		err = fmt.Errorf("unknown output format %s", format)
+	}
+
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+// saveReport waits for the services of the open ports to be detected, then
+// writes the results of the scan.
+func (mod *SynScanner) saveReport(report *scanReport, fileName string, format string) {
+	mod.bannerQueue.WaitDone()
+	report.finish()
+	if err := report.Save(fileName, format); err != nil {
+		mod.Error("error while saving scan results to %s: %v", fileName, err)
+	} else {
+		mod.Info("saved %s results for %d host%s to %s", format, len(report.Hosts), plural(uint64(len(report.Hosts))), fileName)
+	}
+}
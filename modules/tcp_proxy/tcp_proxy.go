@@ -116,6 +116,11 @@ func (mod *TcpProxy) Configure() error {
 		return err
 	} else if mod.tunnelAddr, err = net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", tunnelAddress, tunnelPort)); err != nil {
 		return err
+	}
+
+	if mod.Session.IsDryRun() {
+		mod.listener = nil
+		mod.Session.DryRun.Record(session.DryRunListener, mod.Name(), "tcp proxy on %s to %s", mod.localAddr, mod.remoteAddr)
 	} else if mod.listener, err = net.ListenTCP("tcp", mod.localAddr); err != nil {
 		return err
 	}
@@ -222,7 +227,7 @@ func (mod *TcpProxy) Start() error {
 	return mod.SetRunning(true, func() {
 		mod.Info("started ( x -> %s -> %s )", mod.localAddr.String(), mod.remoteAddr.String())
 
-		for mod.Running() {
+		for mod.Running() && mod.listener != nil {
 			conn, err := mod.listener.AcceptTCP()
 			if err != nil {
 				mod.Warning("error while accepting TCP connection: %s", err)
@@ -245,6 +250,8 @@ func (mod *TcpProxy) Stop() error {
 	}
 
 	return mod.SetRunning(false, func() {
-		mod.listener.Close()
+		if mod.listener != nil {
+			mod.listener.Close()
+		}
 	})
 }
@@ -86,7 +86,7 @@ func (mod *Ticker) Start() error {
 			}
 
 			for _, cmd := range mod.Commands {
-				if err := mod.Session.Run(cmd); err != nil {
+				if err := mod.Session.Exec(session.SourceTicker, cmd); err != nil {
 					mod.Error("%s", err)
 				}
 			}
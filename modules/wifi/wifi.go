@@ -20,14 +20,13 @@ import (
 	"github.com/evilsocket/islazy/fs"
 	"github.com/evilsocket/islazy/ops"
 	"github.com/evilsocket/islazy/str"
-	"github.com/evilsocket/islazy/tui"
 )
 
 type WiFiModule struct {
 	session.SessionModule
 
 	iface               *network.Endpoint
-	handle              *pcap.Handle
+	handle              packets.Handle
 	source              string
 	region              string
 	txPower             int
@@ -42,10 +41,10 @@ type WiFiModule struct {
 	skipBroken          bool
 	pktSourceChan       chan gopacket.Packet
 	pktSourceChanClosed bool
-	deauthSkip          []net.HardwareAddr
+	deauthSkip          *network.Targets
 	deauthSilent        bool
 	deauthOpen          bool
-	assocSkip           []net.HardwareAddr
+	assocSkip           *network.Targets
 	assocSilent         bool
 	assocOpen           bool
 	apRunning           bool
@@ -69,10 +68,8 @@ func NewWiFiModule(s *session.Session) *WiFiModule {
 		ap:            nil,
 		skipBroken:    true,
 		apRunning:     false,
-		deauthSkip:    []net.HardwareAddr{},
 		deauthSilent:  false,
 		deauthOpen:    false,
-		assocSkip:     []net.HardwareAddr{},
 		assocSilent:   false,
 		assocOpen:     false,
 		showManuf:     false,
@@ -156,7 +153,7 @@ func NewWiFiModule(s *session.Session) *WiFiModule {
 	mod.AddParam(session.NewStringParameter("wifi.deauth.skip",
 		"",
 		"",
-		"Comma separated list of BSSID to skip while sending deauth packets."))
+		"Comma separated list of BSSID, MAC addresses, aliases or vendor:, meta: and tag: selectors to skip while sending deauth packets."))
 
 	mod.AddParam(session.NewBoolParameter("wifi.deauth.silent",
 		"false",
@@ -195,7 +192,7 @@ func NewWiFiModule(s *session.Session) *WiFiModule {
 	mod.AddParam(session.NewStringParameter("wifi.assoc.skip",
 		"",
 		"",
-		"Comma separated list of BSSID to skip while sending association requests."))
+		"Comma separated list of BSSID, aliases or vendor:, meta: and tag: selectors to skip while sending association requests."))
 
 	mod.AddParam(session.NewBoolParameter("wifi.assoc.silent",
 		"false",
@@ -326,12 +323,6 @@ func (mod WiFiModule) Author() string {
 	return "Simone Margaritelli <evilsocket@gmail.com> && Gianluca Braga <matrix86@gmail.com>"
 }
 
-const (
-	// Ugly, but gopacket folks are not exporting pcap errors, so ...
-	// ref. https://github.com/google/gopacket/blob/96986c90e3e5c7e01deed713ff8058e357c0c047/pcap/pcap.go#L281
-	ErrIfaceNotUp = "Interface Not Up"
-)
-
 func (mod *WiFiModule) setFrequencies(freqs []int) {
 	mod.Debug("new frequencies: %v", freqs)
 
@@ -378,9 +369,11 @@ func (mod *WiFiModule) Configure() error {
 	mod.Info("using interface %s (%s)", ifName, mod.iface.HwAddress)
 
 	if mod.source != "" {
-		if mod.handle, err = pcap.OpenOffline(mod.source); err != nil {
+		handle, err := pcap.OpenOffline(mod.source)
+		if err != nil {
 			return fmt.Errorf("error while opening file %s: %s", mod.source, err)
 		}
+		mod.handle = handle
 	} else {
 		if mod.region != "" {
 			if err := network.SetWiFiRegion(mod.region); err != nil {
@@ -398,37 +391,17 @@ func (mod *WiFiModule) Configure() error {
 			}
 		}
 
-		for retry := 0; ; retry++ {
-			ihandle, err := pcap.NewInactiveHandle(ifName)
-			if err != nil {
-				return fmt.Errorf("error while opening interface %s: %s", ifName, err)
-			}
-			defer ihandle.CleanUp()
-
-			if err = ihandle.SetRFMon(true); err != nil {
-				return fmt.Errorf("error while setting interface %s in monitor mode: %s", tui.Bold(ifName), err)
-			} else if err = ihandle.SetSnapLen(65536); err != nil {
-				return fmt.Errorf("error while settng span len: %s", err)
-			}
-			/*
-			 * We don't want to pcap.BlockForever otherwise pcap_close(handle)
-			 * could hang waiting for a timeout to expire ...
-			 */
-			readTimeout := 500 * time.Millisecond
-			if err = ihandle.SetTimeout(readTimeout); err != nil {
-				return fmt.Errorf("error while setting timeout: %s", err)
-			} else if mod.handle, err = ihandle.Activate(); err != nil {
-				if retry == 0 && err.Error() == ErrIfaceNotUp {
-					mod.Debug("interface %s is down, bringing it up ...", ifName)
-					if err := network.ActivateInterface(ifName); err != nil {
-						return err
-					}
-					continue
-				}
-				return fmt.Errorf("error while activating handle: %s", err)
-			}
-
-			break
+		/*
+		 * We don't want to pcap.BlockForever otherwise pcap_close(handle)
+		 * could hang waiting for a timeout to expire ...
+		 */
+		opts := packets.CaptureOptions{
+			Snaplen: 65536,
+			Timeout: 500 * time.Millisecond,
+			Monitor: true,
+		}
+		if err, mod.handle = packets.OpenCapture(ifName, opts); err != nil {
+			return err
 		}
 	}
 
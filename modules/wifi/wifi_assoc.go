@@ -24,13 +24,8 @@ func (mod *WiFiModule) sendAssocPacket(ap *network.AccessPoint) {
 	}
 }
 
-func (mod *WiFiModule) skipAssoc(to net.HardwareAddr) bool {
-	for _, mac := range mod.assocSkip {
-		if bytes.Equal(to, mac) {
-			return true
-		}
-	}
-	return false
+func (mod *WiFiModule) skipAssoc(to *network.Endpoint) bool {
+	return mod.assocSkip != nil && mod.assocSkip.Match(to)
 }
 
 func (mod *WiFiModule) isAssocSilent() bool {
@@ -55,10 +50,8 @@ func (mod *WiFiModule) startAssoc(to net.HardwareAddr) error {
 	// parse skip list
 	if err, assocSkip := mod.StringParam("wifi.assoc.skip"); err != nil {
 		return err
-	} else if macs, err := network.ParseMACs(assocSkip); err != nil {
+	} else if mod.assocSkip, err = network.ParseTargetExpression(assocSkip); err != nil {
 		return err
-	} else {
-		mod.assocSkip = macs
 	}
 
 	// if not already running, temporarily enable the pcap handle
@@ -70,11 +63,17 @@ func (mod *WiFiModule) startAssoc(to net.HardwareAddr) error {
 		defer mod.handle.Close()
 	}
 
+	scope := network.GetScope()
 	toAssoc := make([]*network.AccessPoint, 0)
 	isBcast := network.IsBroadcastMac(to)
 	for _, ap := range mod.Session.WiFi.List() {
 		if isBcast || bytes.Equal(ap.HW, to) {
-			if !mod.skipAssoc(ap.HW) {
+			if err := scope.CheckAP(ap.HW, ap.ESSID(), "wifi.assoc"); err != nil {
+				if !isBcast {
+					return err
+				}
+				mod.Debug("%v", err)
+			} else if !mod.skipAssoc(ap.Endpoint) {
 				toAssoc = append(toAssoc, ap)
 			} else {
 				mod.Debug("skipping ap:%v because skip list %v", ap, mod.assocSkip)
@@ -9,9 +9,16 @@ import (
 
 	"github.com/bettercap/bettercap/network"
 	"github.com/bettercap/bettercap/packets"
+
+	"github.com/google/gopacket/layers"
 )
 
 func (mod *WiFiModule) injectPacket(data []byte) {
+	if mod.Session.IsDryRun() {
+		mod.Session.DryRun.Packet("wifi", data, layers.LayerTypeRadioTap)
+		return
+	}
+
 	if err := mod.handle.WritePacketData(data); err != nil {
 		mod.Error("could not inject WiFi packet: %s", err)
 		mod.Session.Queue.TrackError()
@@ -40,13 +47,8 @@ func (mod *WiFiModule) sendDeauthPacket(ap net.HardwareAddr, client net.Hardware
 	}
 }
 
-func (mod *WiFiModule) skipDeauth(to net.HardwareAddr) bool {
-	for _, mac := range mod.deauthSkip {
-		if bytes.Equal(to, mac) {
-			return true
-		}
-	}
-	return false
+func (mod *WiFiModule) skipDeauth(to *network.Endpoint) bool {
+	return mod.deauthSkip != nil && mod.deauthSkip.Match(to)
 }
 
 func (mod *WiFiModule) isDeauthSilent() bool {
@@ -71,10 +73,8 @@ func (mod *WiFiModule) startDeauth(to net.HardwareAddr) error {
 	// parse skip list
 	if err, deauthSkip := mod.StringParam("wifi.deauth.skip"); err != nil {
 		return err
-	} else if macs, err := network.ParseMACs(deauthSkip); err != nil {
+	} else if mod.deauthSkip, err = network.ParseTargetExpression(deauthSkip); err != nil {
 		return err
-	} else {
-		mod.deauthSkip = macs
 	}
 
 	// if not already running, temporarily enable the pcap handle
@@ -91,13 +91,24 @@ func (mod *WiFiModule) startDeauth(to net.HardwareAddr) error {
 		Client *network.Station
 	}
 
+	scope := network.GetScope()
 	toDeauth := make([]flow, 0)
 	isBcast := network.IsBroadcastMac(to)
 	for _, ap := range mod.Session.WiFi.List() {
 		isAP := bytes.Equal(ap.HW, to)
 		for _, client := range ap.Clients() {
 			if isBcast || isAP || bytes.Equal(client.HW, to) {
-				if !mod.skipDeauth(ap.HW) && !mod.skipDeauth(client.HW) {
+				err := scope.CheckAP(ap.HW, ap.ESSID(), "wifi.deauth")
+				if err == nil {
+					err = scope.CheckMAC(client.HW, "wifi.deauth")
+				}
+
+				if err != nil {
+					if !isBcast {
+						return err
+					}
+					mod.Debug("%v", err)
+				} else if !mod.skipDeauth(ap.Endpoint) && !mod.skipDeauth(client.Endpoint) {
 					toDeauth = append(toDeauth, flow{Ap: ap, Client: client})
 				} else {
 					mod.Debug("skipping ap:%v client:%v because skip list %v", ap, client, mod.deauthSkip)
@@ -169,7 +169,8 @@ func (mod *WiFiModule) doFilter(station *network.Station) bool {
 		mod.selector.Expression.MatchString(station.ESSID()) ||
 		mod.selector.Expression.MatchString(station.Alias) ||
 		mod.selector.Expression.MatchString(station.Vendor) ||
-		mod.selector.Expression.MatchString(station.Encryption)
+		mod.selector.Expression.MatchString(station.Encryption) ||
+		mod.selector.Expression.MatchString(strings.Join(station.Tags, " "))
 }
 
 func (mod *WiFiModule) doSelection() (err error, stations []*network.Station) {
@@ -0,0 +1,219 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var TagValidator = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
+
+// Annotation is what has been written down about a host.
+type Annotation struct {
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+func (a *Annotation) HasTag(tag string) bool {
+	for _, t := range a.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Annotations keeps the tags and notes of hosts by MAC address, saving them
+// to a file every time they change.
+type Annotations struct {
+	sync.Mutex
+	fileName string
+	hosts    map[string]*Annotation
+}
+
+var (
+	annotationsLock   = &sync.Mutex{}
+	activeAnnotations *Annotations
+)
+
+// LoadAnnotations loads the annotations from the file if it exists, or
+// keeps them only in memory if the file name is empty.
+func LoadAnnotations(fileName string) (error, *Annotations) {
+	a := &Annotations{
+		fileName: fileName,
+		hosts:    make(map[string]*Annotation),
+	}
+
+	if fileName == "" {
+		return nil, a
+	}
+
+	raw, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, a
+	} else if err != nil {
+		return err, nil
+	} else if err = json.Unmarshal(raw, &a.hosts); err != nil {
+		return fmt.Errorf("error while parsing annotations file %s: %v", fileName, err), nil
+	}
+
+	return nil, a
+}
+
+// SetAnnotations sets the annotations applied to the hosts being found.
+func SetAnnotations(a *Annotations) {
+	annotationsLock.Lock()
+	defer annotationsLock.Unlock()
+	activeAnnotations = a
+}
+
+// GetAnnotations returns the annotations of this session or nil if not set.
+func GetAnnotations() *Annotations {
+	annotationsLock.Lock()
+	defer annotationsLock.Unlock()
+	return activeAnnotations
+}
+
+func (a *Annotations) flushUnlocked() error {
+	if a.fileName == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(a.hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(a.fileName, raw, 0600)
+}
+
+// Get returns a copy of the annotation of the host.
+func (a *Annotations) Get(mac string) Annotation {
+	if a == nil {
+		return Annotation{Tags: []string{}}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	ann := Annotation{Tags: []string{}}
+	if h, found := a.hosts[NormalizeMac(mac)]; found {
+		ann.Tags = append(ann.Tags, h.Tags...)
+		ann.Note = h.Note
+	}
+	return ann
+}
+
+func (a *Annotations) Tag(mac string, tags ...string) error {
+	for _, tag := range tags {
+		if !TagValidator.MatchString(tag) {
+			return fmt.Errorf("invalid tag '%s', only letters, digits, '_', '-' and '.' are allowed", tag)
+		}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	mac = NormalizeMac(mac)
+	h, found := a.hosts[mac]
+	if !found {
+		h = &Annotation{Tags: []string{}}
+		a.hosts[mac] = h
+	}
+
+	for _, tag := range tags {
+		if !h.HasTag(tag) {
+			h.Tags = append(h.Tags, tag)
+		}
+	}
+	sort.Strings(h.Tags)
+
+	return a.flushUnlocked()
+}
+
+// Untag removes the tags from the host, or all of them if none is given.
+func (a *Annotations) Untag(mac string, tags ...string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	mac = NormalizeMac(mac)
+	h, found := a.hosts[mac]
+	if !found {
+		return nil
+	}
+
+	if len(tags) == 0 {
+		h.Tags = []string{}
+	} else {
+		kept := make([]string, 0)
+		for _, t := range h.Tags {
+			removed := false
+			for _, tag := range tags {
+				if t == tag {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				kept = append(kept, t)
+			}
+		}
+		h.Tags = kept
+	}
+
+	if len(h.Tags) == 0 && h.Note == "" {
+		delete(a.hosts, mac)
+	}
+
+	return a.flushUnlocked()
+}
+
+// SetNote sets the note of the host, an empty one removes it.
+func (a *Annotations) SetNote(mac string, note string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	mac = NormalizeMac(mac)
+	h, found := a.hosts[mac]
+	if !found {
+		if note == "" {
+			return nil
+		}
+		h = &Annotation{Tags: []string{}}
+		a.hosts[mac] = h
+	}
+
+	h.Note = note
+	if len(h.Tags) == 0 && h.Note == "" {
+		delete(a.hosts, mac)
+	}
+
+	return a.flushUnlocked()
+}
+
+// Each calls the callback for every annotated host.
+func (a *Annotations) Each(cb func(mac string, ann Annotation)) {
+	a.Lock()
+	hosts := make(map[string]Annotation)
+	for mac, h := range a.hosts {
+		hosts[mac] = Annotation{
+			Tags: append([]string{}, h.Tags...),
+			Note: h.Note,
+		}
+	}
+	a.Unlock()
+
+	for mac, ann := range hosts {
+		cb(mac, ann)
+	}
+}
+
+// Apply copies the tags and note of the host to the endpoint.
+func (a *Annotations) Apply(e *Endpoint) {
+	ann := a.Get(e.HwAddress)
+	e.Tags = ann.Tags
+	e.Note = ann.Note
+}
@@ -0,0 +1,193 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/evilsocket/islazy/data"
+)
+
+func TestAnnotationsTagAndUntag(t *testing.T) {
+	err, a := LoadAnnotations("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Tag("AA-BB-CC-DD-EE-FF", "owned", "dc", "owned"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got := a.Get("aa:bb:cc:dd:ee:ff").Tags; len(got) != 2 || got[0] != "dc" || got[1] != "owned" {
+		t.Fatalf("expected [dc owned], got %v", got)
+	}
+
+	if err := a.Tag("aa:bb:cc:dd:ee:ff", "not valid"); err == nil {
+		t.Fatal("expected an error for an invalid tag")
+	}
+
+	if err := a.Untag("aa:bb:cc:dd:ee:ff", "dc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got := a.Get("aa:bb:cc:dd:ee:ff").Tags; len(got) != 1 || got[0] != "owned" {
+		t.Fatalf("expected [owned], got %v", got)
+	}
+
+	if err := a.Untag("aa:bb:cc:dd:ee:ff"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(a.hosts) != 0 {
+		t.Fatalf("expected the host to be removed, got %v", a.hosts)
+	}
+}
+
+func TestAnnotationsPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "annotations")
+	err, a := LoadAnnotations(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Tag("aa:bb:cc:dd:ee:ff", "router")
+	a.SetNote("aa:bb:cc:dd:ee:ff", "admin/admin")
+
+	// notes might contain credentials
+	if info, err := os.Stat(fileName); err != nil {
+		t.Fatal(err)
+	} else if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("expected mode 0600, got %o", mode)
+	}
+
+	err, loaded := LoadAnnotations(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEndpointNoResolve("10.0.0.1", "aa:bb:cc:dd:ee:ff", "", 24)
+	loaded.Apply(e)
+	if len(e.Tags) != 1 || e.Tags[0] != "router" {
+		t.Fatalf("expected [router], got %v", e.Tags)
+	} else if e.Note != "admin/admin" {
+		t.Fatalf("expected note 'admin/admin', got '%s'", e.Note)
+	}
+
+	loaded.SetNote("aa:bb:cc:dd:ee:ff", "")
+	if note := loaded.Get("aa:bb:cc:dd:ee:ff").Note; note != "" {
+		t.Fatalf("expected the note to be removed, got '%s'", note)
+	}
+}
+
+func TestAnnotationsApplyToLAN(t *testing.T) {
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err, a := LoadAnnotations("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "eth0", 24)
+	gateway := NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+	lan := NewLAN(iface, gateway, aliases, func(e *Endpoint) {}, func(e *Endpoint) {}, func(e *Endpoint, previous string) {})
+	lan.hosts["aa:aa:aa:aa:aa:10"] = NewEndpointNoResolve("10.0.0.10", "aa:aa:aa:aa:aa:10", "", 24)
+
+	a.Tag("aa:aa:aa:aa:aa:01", "router")
+	a.Tag("aa:aa:aa:aa:aa:10", "owned")
+
+	tests := []struct {
+		mac   string
+		found bool
+		tags  int
+	}{
+		{"AA-AA-AA-AA-AA-01", true, 1},
+		{"aa:aa:aa:aa:aa:10", true, 1},
+		{"aa:aa:aa:aa:aa:02", true, 0},
+		{"aa:aa:aa:aa:aa:11", false, 0},
+	}
+
+	for _, tt := range tests {
+		var updated *Endpoint
+		found := lan.Update(tt.mac, func(e *Endpoint) {
+			a.Apply(e)
+			updated = e
+		})
+
+		if found != tt.found {
+			t.Errorf("%s: expected found=%v", tt.mac, tt.found)
+		} else if found && len(updated.Tags) != tt.tags {
+			t.Errorf("%s: expected %d tags, got %v", tt.mac, tt.tags, updated.Tags)
+		}
+	}
+}
+
+func TestAnnotationsApplyToWiFi(t *testing.T) {
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err, a := LoadAnnotations("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wifi := NewWiFi(nil, aliases, nil, nil)
+	ap1 := NewAccessPoint("one", "bb:bb:bb:bb:bb:01", 2412, -40, aliases)
+	ap2 := NewAccessPoint("two", "bb:bb:bb:bb:bb:02", 2437, -50, aliases)
+	wifi.aps[ap1.HwAddress] = ap1
+	wifi.aps[ap2.HwAddress] = ap2
+	sta1, _ := ap1.AddClientIfNew("cc:cc:cc:cc:cc:01", 2412, -60)
+	sta2, _ := ap2.AddClientIfNew("cc:cc:cc:cc:cc:01", 2437, -70)
+
+	a.Tag("bb:bb:bb:bb:bb:01", "target")
+	a.SetNote("cc:cc:cc:cc:cc:01", "phone")
+
+	tests := []struct {
+		mac     string
+		found   bool
+		updated []*Endpoint
+	}{
+		{"BB-BB-BB-BB-BB-01", true, []*Endpoint{ap1.Endpoint}},
+		{"cc:cc:cc:cc:cc:01", true, []*Endpoint{sta1.Endpoint, sta2.Endpoint}},
+		{"cc:cc:cc:cc:cc:02", false, nil},
+	}
+
+	for _, tt := range tests {
+		updated := map[*Endpoint]bool{}
+		found := wifi.Update(tt.mac, func(e *Endpoint) {
+			a.Apply(e)
+			updated[e] = true
+		})
+
+		if found != tt.found {
+			t.Errorf("%s: expected found=%v", tt.mac, tt.found)
+		} else if len(updated) != len(tt.updated) {
+			t.Errorf("%s: expected %d endpoints, got %d", tt.mac, len(tt.updated), len(updated))
+		}
+		for _, e := range tt.updated {
+			if !updated[e] {
+				t.Errorf("%s: endpoint %s not updated", tt.mac, e.HwAddress)
+			}
+		}
+	}
+
+	if len(ap1.Tags) != 1 || ap1.Tags[0] != "target" {
+		t.Errorf("unexpected access point tags %v", ap1.Tags)
+	} else if sta1.Note != "phone" || sta2.Note != "phone" {
+		t.Errorf("unexpected station notes %q and %q", sta1.Note, sta2.Note)
+	}
+}
+
+func TestAnnotationsNil(t *testing.T) {
+	var a *Annotations
+	e := NewEndpointNoResolve("10.0.0.1", "aa:bb:cc:dd:ee:ff", "", 24)
+	a.Apply(e)
+	if len(e.Tags) != 0 || e.Note != "" {
+		t.Fatalf("expected no annotations, got %v '%s'", e.Tags, e.Note)
+	}
+}
@@ -16,28 +16,32 @@ type EndpointLostCallback func(e *Endpoint)
 
 type LAN struct {
 	sync.Mutex
-	hosts   map[string]*Endpoint
-	iface   *Endpoint
-	gateway *Endpoint
-	ttl     map[string]uint
-	aliases *data.UnsortedKV
-	newCb   EndpointNewCallback
-	lostCb  EndpointLostCallback
+	hosts     map[string]*Endpoint
+	iface     *Endpoint
+	gateway   *Endpoint
+	ttl       map[string]uint
+	aliases   *data.UnsortedKV
+	history   *LANHistory
+	newCb     EndpointNewCallback
+	lostCb    EndpointLostCallback
+	changedCb EndpointChangedCallback
 }
 
 type lanJSON struct {
 	Hosts []*Endpoint `json:"hosts"`
 }
 
-func NewLAN(iface, gateway *Endpoint, aliases *data.UnsortedKV, newcb EndpointNewCallback, lostcb EndpointLostCallback) *LAN {
+func NewLAN(iface, gateway *Endpoint, aliases *data.UnsortedKV, newcb EndpointNewCallback, lostcb EndpointLostCallback, changedcb EndpointChangedCallback) *LAN {
 	return &LAN{
-		iface:   iface,
-		gateway: gateway,
-		hosts:   make(map[string]*Endpoint),
-		ttl:     make(map[string]uint),
-		aliases: aliases,
-		newCb:   newcb,
-		lostCb:  lostcb,
+		iface:     iface,
+		gateway:   gateway,
+		hosts:     make(map[string]*Endpoint),
+		ttl:       make(map[string]uint),
+		aliases:   aliases,
+		history:   NewLANHistory(),
+		newCb:     newcb,
+		lostCb:    lostcb,
+		changedCb: changedcb,
 	}
 }
 
@@ -56,7 +60,23 @@ func (l *LAN) MarshalJSON() ([]byte, error) {
 func (lan *LAN) Get(mac string) (*Endpoint, bool) {
 	lan.Lock()
 	defer lan.Unlock()
+	return lan.getUnlocked(mac)
+}
+
+// Update calls cb with the endpoint of the given hardware address while
+// holding the lock, returning false if the endpoint is not known.
+func (lan *LAN) Update(mac string, cb func(e *Endpoint)) bool {
+	lan.Lock()
+	defer lan.Unlock()
 
+	if e, found := lan.getUnlocked(mac); found {
+		cb(e)
+		return true
+	}
+	return false
+}
+
+func (lan *LAN) getUnlocked(mac string) (*Endpoint, bool) {
 	mac = NormalizeMac(mac)
 
 	if mac == lan.iface.HwAddress {
@@ -75,14 +95,14 @@ func (lan *LAN) GetByIp(ip string) *Endpoint {
 	lan.Lock()
 	defer lan.Unlock()
 
-	if ip == lan.iface.IpAddress {
+	if ip == lan.iface.IpAddress || ip == lan.iface.Ip6Address {
 		return lan.iface
-	} else if ip == lan.gateway.IpAddress {
+	} else if ip == lan.gateway.IpAddress || ip == lan.gateway.Ip6Address {
 		return lan.gateway
 	}
 
 	for _, e := range lan.hosts {
-		if e.IpAddress == ip {
+		if e.IpAddress == ip || (e.Ip6Address != "" && e.Ip6Address == ip) {
 			return e
 		}
 	}
@@ -105,6 +125,10 @@ func (lan *LAN) Aliases() *data.UnsortedKV {
 	return lan.aliases
 }
 
+func (lan *LAN) History() *LANHistory {
+	return lan.history
+}
+
 func (lan *LAN) WasMissed(mac string) bool {
 	if mac == lan.iface.HwAddress || mac == lan.gateway.HwAddress {
 		return false
@@ -128,6 +152,7 @@ func (lan *LAN) Remove(ip, mac string) {
 		if lan.ttl[mac] == 0 {
 			delete(lan.hosts, mac)
 			delete(lan.ttl, mac)
+			lan.history.Lost(e)
 			lan.lostCb(e)
 		}
 		return
@@ -190,15 +215,32 @@ func (lan *LAN) AddIfNew(ip, mac string) *Endpoint {
 		if lan.ttl[mac] < LANDefaultttl {
 			lan.ttl[mac]++
 		}
+		if t.IpAddress != ip {
+			// the resolver of the previous address might still be running,
+			// so the host gets a new endpoint instead of being updated
+			t = t.withAddress(ip)
+			lan.hosts[mac] = t
+			defer t.resolve()
+		}
+		if previous := lan.history.Seen(t); previous != "" {
+			lan.changedCb(t, previous)
+		}
 		return t
 	}
 
-	e := NewEndpointWithAlias(ip, mac, lan.aliases.GetOr(mac, ""))
+	e := NewEndpointNoResolve(ip, mac, "", 0)
+	e.Alias = lan.aliases.GetOr(mac, "")
+	GetAnnotations().Apply(e)
 
 	lan.hosts[mac] = e
 	lan.ttl[mac] = LANDefaultttl
 
+	previous := lan.history.Seen(e)
+	e.resolve()
 	lan.newCb(e)
+	if previous != "" {
+		lan.changedCb(e, previous)
+	}
 
 	return nil
 }
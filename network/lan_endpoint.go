@@ -27,6 +27,8 @@ type Endpoint struct {
 	Hostname         string                 `json:"hostname"`
 	Alias            string                 `json:"alias"`
 	Vendor           string                 `json:"vendor"`
+	Tags             []string               `json:"tags"`
+	Note             string                 `json:"note,omitempty"`
 	ResolvedCallback OnHostResolvedCallback `json:"-"`
 	FirstSeen        time.Time              `json:"first_seen"`
 	LastSeen         time.Time              `json:"last_seen"`
@@ -48,6 +50,7 @@ func NewEndpointNoResolve(ip, mac, name string, bits uint32) *Endpoint {
 		HwAddress:        mac,
 		Hostname:         name,
 		Vendor:           ManufLookup(mac),
+		Tags:             []string{},
 		ResolvedCallback: nil,
 		FirstSeen:        now,
 		LastSeen:         now,
@@ -60,18 +63,38 @@ func NewEndpointNoResolve(ip, mac, name string, bits uint32) *Endpoint {
 	return e
 }
 
+// hostnames of the endpoints are resolved in the background
+var lookupAddr = net.LookupAddr
+
 func NewEndpoint(ip, mac string) *Endpoint {
 	e := NewEndpointNoResolve(ip, mac, "", 0)
-	// start resolver goroutine
+	e.resolve()
+	return e
+}
+
+// resolve starts the resolver goroutine, which only writes the hostname.
+func (t *Endpoint) resolve() {
+	address, cb, lookup := t.IpAddress, t.ResolvedCallback, lookupAddr
 	go func() {
-		if names, err := net.LookupAddr(e.IpAddress); err == nil && len(names) > 0 {
-			e.Hostname = names[0]
-			if e.ResolvedCallback != nil {
-				e.ResolvedCallback(e)
+		if names, err := lookup(address); err == nil && len(names) > 0 {
+			t.Hostname = names[0]
+			if cb != nil {
+				cb(t)
 			}
 		}
 	}()
+}
 
+// withAddress returns a copy of the endpoint with another address, the
+// hostname is not copied as it has to be resolved again.
+func (t *Endpoint) withAddress(ip string) *Endpoint {
+	e := NewEndpointNoResolve(ip, t.HwAddress, "", t.SubnetBits)
+	e.IPv6, e.Ip6Address = t.IPv6, t.Ip6Address
+	e.Alias = t.Alias
+	e.Tags, e.Note = t.Tags, t.Note
+	e.FirstSeen, e.LastSeen = t.FirstSeen, t.LastSeen
+	e.Meta = t.Meta
+	e.ResolvedCallback = t.ResolvedCallback
 	return e
 }
 
@@ -0,0 +1,230 @@
+package network
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// how many values and presence intervals are kept for every host
+const MaxHistoryEntries = 256
+
+// how many hosts are kept before the ones offline the longest are dropped
+const MaxHistoryHosts = 4096
+
+type EndpointChangedCallback func(e *Endpoint, previous string)
+
+// EndpointChange is the data of the endpoint.changed events.
+type EndpointChange struct {
+	Endpoint *Endpoint `json:"endpoint"`
+	Previous string    `json:"previous"`
+}
+
+// HistoryValue is a value a host had and when it was first and last seen.
+type HistoryValue struct {
+	Value     string    `json:"value"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// PresenceInterval is a period of time a host was on the network.
+type PresenceInterval struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// HostHistory is what we know a host has been over time.
+type HostHistory struct {
+	HwAddress    string              `json:"mac"`
+	Online       bool                `json:"online"`
+	IpAddresses  []*HistoryValue     `json:"ipv4"`
+	Ip6Addresses []*HistoryValue     `json:"ipv6"`
+	Hostnames    []*HistoryValue     `json:"hostnames"`
+	Vendors      []*HistoryValue     `json:"vendors"`
+	Presence     []*PresenceInterval `json:"presence"`
+}
+
+func trackValue(values []*HistoryValue, value string, now time.Time) []*HistoryValue {
+	if value == "" {
+		return values
+	} else if n := len(values); n > 0 && values[n-1].Value == value {
+		values[n-1].LastSeen = now
+		return values
+	}
+
+	values = append(values, &HistoryValue{
+		Value:     value,
+		FirstSeen: now,
+		LastSeen:  now,
+	})
+	if len(values) > MaxHistoryEntries {
+		values = values[1:]
+	}
+	return values
+}
+
+func lastValue(values []*HistoryValue) string {
+	if n := len(values); n > 0 {
+		return values[n-1].Value
+	}
+	return ""
+}
+
+func copyValues(values []*HistoryValue) []*HistoryValue {
+	copied := make([]*HistoryValue, len(values))
+	for i, v := range values {
+		c := *v
+		copied[i] = &c
+	}
+	return copied
+}
+
+func (h *HostHistory) copy() *HostHistory {
+	c := &HostHistory{
+		HwAddress:    h.HwAddress,
+		Online:       h.Online,
+		IpAddresses:  copyValues(h.IpAddresses),
+		Ip6Addresses: copyValues(h.Ip6Addresses),
+		Hostnames:    copyValues(h.Hostnames),
+		Vendors:      copyValues(h.Vendors),
+		Presence:     make([]*PresenceInterval, len(h.Presence)),
+	}
+	for i, p := range h.Presence {
+		interval := *p
+		c.Presence[i] = &interval
+	}
+	return c
+}
+
+func (h *HostHistory) lastSeen() time.Time {
+	if n := len(h.Presence); n > 0 {
+		return h.Presence[n-1].To
+	}
+	return time.Time{}
+}
+
+// LANHistory keeps the history of every host seen on the network, even
+// after it's been removed from the LAN.
+type LANHistory struct {
+	sync.Mutex
+	hosts map[string]*HostHistory
+}
+
+func NewLANHistory() *LANHistory {
+	return &LANHistory{
+		hosts: make(map[string]*HostHistory),
+	}
+}
+
+// Seen records the current state of the endpoint, returning its previous
+// IPv4 address if it changed or an empty string otherwise.
+func (h *LANHistory) Seen(e *Endpoint) string {
+	h.Lock()
+	defer h.Unlock()
+
+	now := time.Now()
+	host, found := h.hosts[e.HwAddress]
+	if !found {
+		host = &HostHistory{HwAddress: e.HwAddress}
+		h.hosts[e.HwAddress] = host
+	}
+
+	previous := lastValue(host.IpAddresses)
+	if previous == e.IpAddress {
+		previous = ""
+	}
+
+	host.IpAddresses = trackValue(host.IpAddresses, e.IpAddress, now)
+	host.Ip6Addresses = trackValue(host.Ip6Addresses, e.Ip6Address, now)
+	host.Hostnames = trackValue(host.Hostnames, e.Hostname, now)
+	host.Vendors = trackValue(host.Vendors, e.Vendor, now)
+
+	if n := len(host.Presence); host.Online && n > 0 {
+		host.Presence[n-1].To = now
+	} else {
+		host.Online = true
+		host.Presence = append(host.Presence, &PresenceInterval{From: now, To: now})
+		if len(host.Presence) > MaxHistoryEntries {
+			host.Presence = host.Presence[1:]
+		}
+	}
+
+	if !found {
+		h.pruneUnlocked()
+	}
+
+	return previous
+}
+
+// Lost marks the endpoint as gone from the network.
+func (h *LANHistory) Lost(e *Endpoint) {
+	h.Lock()
+	defer h.Unlock()
+
+	if host, found := h.hosts[e.HwAddress]; found && host.Online {
+		host.Online = false
+		host.Presence[len(host.Presence)-1].To = time.Now()
+	}
+}
+
+// Get returns a copy of the history of the host.
+func (h *LANHistory) Get(mac string) (*HostHistory, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	if host, found := h.hosts[NormalizeMac(mac)]; found {
+		return host.copy(), true
+	}
+	return nil, false
+}
+
+func (h *LANHistory) MarshalJSON() ([]byte, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	hosts := make([]*HostHistory, 0, len(h.hosts))
+	for _, host := range h.hosts {
+		hosts = append(hosts, host)
+	}
+	return json.Marshal(hosts)
+}
+
+// Restore merges the hosts of a previous session we don't know about yet,
+// which are all offline by now.
+func (h *LANHistory) Restore(hosts []*HostHistory) int {
+	h.Lock()
+	defer h.Unlock()
+
+	restored := 0
+	for _, host := range hosts {
+		mac := NormalizeMac(host.HwAddress)
+		if _, found := h.hosts[mac]; found || mac == "" {
+			continue
+		}
+
+		host.HwAddress = mac
+		host.Online = false
+		h.hosts[mac] = host
+		restored++
+	}
+	h.pruneUnlocked()
+	return restored
+}
+
+// pruneUnlocked drops the hosts which have been offline the longest until
+// there are at most MaxHistoryHosts left, online hosts are always kept.
+func (h *LANHistory) pruneUnlocked() {
+	for len(h.hosts) > MaxHistoryHosts {
+		var oldest *HostHistory
+		for _, host := range h.hosts {
+			if !host.Online && (oldest == nil || host.lastSeen().Before(oldest.lastSeen())) {
+				oldest = host
+			}
+		}
+
+		if oldest == nil {
+			return
+		}
+		delete(h.hosts, oldest.HwAddress)
+	}
+}
@@ -0,0 +1,216 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/evilsocket/islazy/data"
+)
+
+func TestLANHistoryAddressChange(t *testing.T) {
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []string{}
+	iface := NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "eth0", 24)
+	gateway := NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+	lan := NewLAN(iface, gateway, aliases, func(e *Endpoint) {}, func(e *Endpoint) {}, func(e *Endpoint, previous string) {
+		changes = append(changes, previous+" -> "+e.IpAddress)
+	})
+
+	lan.AddIfNew("10.0.0.10", "00:00:00:00:00:10")
+	lan.AddIfNew("10.0.0.10", "00:00:00:00:00:10")
+	if len(changes) != 0 {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+
+	lan.AddIfNew("10.0.0.11", "00:00:00:00:00:10")
+	if len(changes) != 1 || changes[0] != "10.0.0.10 -> 10.0.0.11" {
+		t.Fatalf("expected a change from 10.0.0.10 to 10.0.0.11, got %v", changes)
+	} else if e, _ := lan.Get("00:00:00:00:00:10"); e.IpAddress != "10.0.0.11" {
+		t.Fatalf("expected the host address to be updated, got %s", e.IpAddress)
+	}
+
+	// the host leaves and comes back with another address
+	for i := 0; i < LANDefaultttl; i++ {
+		lan.Remove("10.0.0.11", "00:00:00:00:00:10")
+	}
+	if _, found := lan.Get("00:00:00:00:00:10"); found {
+		t.Fatal("expected the host to be removed")
+	}
+
+	history, found := lan.History().Get("00:00:00:00:00:10")
+	if !found {
+		t.Fatal("expected the history to be kept")
+	} else if history.Online {
+		t.Fatal("expected the host to be offline")
+	}
+
+	lan.AddIfNew("10.0.0.12", "00:00:00:00:00:10")
+	if len(changes) != 2 || changes[1] != "10.0.0.11 -> 10.0.0.12" {
+		t.Fatalf("expected a change from 10.0.0.11 to 10.0.0.12, got %v", changes)
+	}
+
+	history, _ = lan.History().Get("00:00:00:00:00:10")
+	if !history.Online || len(history.Presence) != 2 {
+		t.Fatalf("expected two presence intervals, got %d", len(history.Presence))
+	} else if len(history.IpAddresses) != 3 {
+		t.Fatalf("expected three addresses, got %d", len(history.IpAddresses))
+	}
+}
+
+func TestLANAddressChangeResolvesHostname(t *testing.T) {
+	lookupAddr = func(addr string) ([]string, error) {
+		if addr == "10.0.0.11" {
+			return []string{"new.lan"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	defer func() {
+		lookupAddr = net.LookupAddr
+	}()
+
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "eth0", 24)
+	gateway := NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+	lan := NewLAN(iface, gateway, aliases, func(e *Endpoint) {}, func(e *Endpoint) {}, func(e *Endpoint, previous string) {})
+
+	resolved := make(chan string, 1)
+	lan.AddIfNew("10.0.0.10", "00:00:00:00:00:10")
+	lan.Update("00:00:00:00:00:10", func(e *Endpoint) {
+		e.Meta.Set("os", "linux")
+		e.ResolvedCallback = func(e *Endpoint) {
+			resolved <- e.Hostname
+		}
+	})
+
+	old, _ := lan.Get("00:00:00:00:00:10")
+	e := lan.AddIfNew("10.0.0.11", "00:00:00:00:00:10")
+	if e == old || e.IpAddress != "10.0.0.11" {
+		t.Fatalf("expected a new endpoint for 10.0.0.11, got %s", e.IpAddress)
+	} else if e.Meta.Get("os") != "linux" || !e.FirstSeen.Equal(old.FirstSeen) {
+		t.Fatal("expected the endpoint to keep the host details")
+	} else if history, _ := lan.History().Get(e.HwAddress); len(history.IpAddresses) != 2 {
+		t.Fatalf("expected 2 addresses in the history, got %d", len(history.IpAddresses))
+	}
+
+	select {
+	case name := <-resolved:
+		if name != "new.lan" {
+			t.Fatalf("expected new.lan, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the hostname of the new address to be resolved")
+	}
+}
+
+func TestLANHistoryValues(t *testing.T) {
+	h := NewLANHistory()
+	e := NewEndpointNoResolve("10.0.0.10", "00:00:00:00:00:10", "", 24)
+
+	h.Seen(e)
+	e.Hostname = "macbook.lan"
+	h.Seen(e)
+	e.Hostname = "macbook-pro.lan"
+	h.Seen(e)
+	h.Seen(e)
+
+	history, _ := h.Get("00:00:00:00:00:10")
+	if len(history.Hostnames) != 2 {
+		t.Fatalf("expected two hostnames, got %d", len(history.Hostnames))
+	} else if history.Hostnames[1].Value != "macbook-pro.lan" {
+		t.Fatalf("unexpected hostname %s", history.Hostnames[1].Value)
+	}
+
+	// changing the copy must not change the history
+	history.Hostnames[0].Value = "changed"
+	if again, _ := h.Get("00:00:00:00:00:10"); again.Hostnames[0].Value != "macbook.lan" {
+		t.Fatal("expected Get to return a copy")
+	}
+}
+
+func TestLANHistoryRestore(t *testing.T) {
+	h := NewLANHistory()
+	e := NewEndpointNoResolve("10.0.0.10", "00:00:00:00:00:10", "", 24)
+	h.Seen(e)
+
+	raw, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hosts []*HostHistory
+	if err = json.Unmarshal(raw, &hosts); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewLANHistory()
+	if n := restored.Restore(hosts); n != 1 {
+		t.Fatalf("expected one host restored, got %d", n)
+	} else if history, found := restored.Get("00:00:00:00:00:10"); !found || history.Online {
+		t.Fatal("expected the restored host to be offline")
+	}
+}
+
+func TestLANHistoryPrune(t *testing.T) {
+	h := NewLANHistory()
+
+	old := NewEndpointNoResolve("10.0.0.10", "00:00:00:00:00:10", "", 24)
+	h.Seen(old)
+	h.Lost(old)
+	h.hosts[old.HwAddress].Presence[0].To = time.Now().Add(-time.Hour)
+
+	online := NewEndpointNoResolve("10.0.0.11", "00:00:00:00:00:11", "", 24)
+	h.Seen(online)
+	h.hosts[online.HwAddress].Presence[0].From = time.Now().Add(-2 * time.Hour)
+	h.hosts[online.HwAddress].Presence[0].To = time.Now().Add(-2 * time.Hour)
+
+	for i := 0; i < MaxHistoryHosts-1; i++ {
+		e := NewEndpointNoResolve("10.0.1.1", fmt.Sprintf("02:00:00:00:%02x:%02x", i>>8, i&0xff), "", 24)
+		h.Seen(e)
+		h.Lost(e)
+	}
+
+	if n := len(h.hosts); n != MaxHistoryHosts {
+		t.Fatalf("expected %d hosts, got %d", MaxHistoryHosts, n)
+	} else if _, found := h.Get(old.HwAddress); found {
+		t.Fatal("expected the host offline the longest to be dropped")
+	} else if _, found := h.Get(online.HwAddress); !found {
+		t.Fatal("expected the online host to be kept")
+	}
+}
+
+func TestLANJSONWithoutHistory(t *testing.T) {
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "eth0", 24)
+	gateway := NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+	lan := NewLAN(iface, gateway, aliases, func(e *Endpoint) {}, func(e *Endpoint) {}, func(e *Endpoint, previous string) {})
+	lan.AddIfNew("10.0.0.10", "00:00:00:00:00:10")
+
+	raw, err := json.Marshal(lan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := map[string]interface{}{}
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	} else if _, found := doc["history"]; found {
+		t.Fatal("expected the history to be served on its own")
+	} else if _, found := lan.History().Get("00:00:00:00:00:10"); !found {
+		t.Fatal("expected the host to be in the history")
+	}
+}
@@ -22,6 +22,22 @@ type metaJSON struct {
 	Values map[string]interface{} `json:"values"`
 }
 
+// MetaDecoder converts the JSON of a meta value back to the type it had
+// before being saved, values without a decoder are restored as generic
+// JSON types.
+type MetaDecoder func(raw json.RawMessage) (interface{}, error)
+
+var (
+	metaDecodersLock = &sync.Mutex{}
+	metaDecoders     = make(map[string]MetaDecoder)
+)
+
+func RegisterMetaDecoder(name string, decoder MetaDecoder) {
+	metaDecodersLock.Lock()
+	defer metaDecodersLock.Unlock()
+	metaDecoders[name] = decoder
+}
+
 func NewMeta() *Meta {
 	return &Meta{
 		m: make(map[string]interface{}),
@@ -32,6 +48,38 @@ func (m *Meta) MarshalJSON() ([]byte, error) {
 	return json.Marshal(metaJSON{Values: m.m})
 }
 
+func (m *Meta) UnmarshalJSON(raw []byte) error {
+	doc := struct {
+		Values map[string]json.RawMessage `json:"values"`
+	}{}
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+
+	metaDecodersLock.Lock()
+	defer metaDecodersLock.Unlock()
+
+	m.m = make(map[string]interface{})
+	for name, value := range doc.Values {
+		if decoder, found := metaDecoders[name]; found {
+			if v, err := decoder(value); err != nil {
+				return fmt.Errorf("meta %s: %v", name, err)
+			} else {
+				m.m[name] = v
+			}
+		} else {
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return err
+			}
+			m.m[name] = v
+		}
+	}
+
+	return nil
+}
+
 func (m *Meta) Set(name string, value interface{}) {
 	m.Lock()
 	defer m.Unlock()
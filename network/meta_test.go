@@ -1,6 +1,7 @@
 package network
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 )
@@ -24,6 +25,32 @@ func TestMetaMarshalJSON(t *testing.T) {
 	}
 }
 
+func TestMetaUnmarshalJSON(t *testing.T) {
+	RegisterMetaDecoder("test:ints", func(raw json.RawMessage) (interface{}, error) {
+		ints := make([]int, 0)
+		err := json.Unmarshal(raw, &ints)
+		return ints, err
+	})
+
+	example := buildExampleMeta()
+	example.Set("picat", "<3")
+	example.Set("test:ints", []int{1, 2, 3})
+
+	raw, err := example.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Meta{}
+	if err = json.Unmarshal(raw, restored); err != nil {
+		t.Fatal(err)
+	} else if restored.Get("picat") != "<3" {
+		t.Fatalf("unexpected value %v", restored.Get("picat"))
+	} else if ints, ok := restored.Get("test:ints").([]int); !ok || len(ints) != 3 {
+		t.Fatalf("expected decoded ints, got %#v", restored.Get("test:ints"))
+	}
+}
+
 func TestMetaSet(t *testing.T) {
 	example := buildExampleMeta()
 	example.Set("picat", "<3")
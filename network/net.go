@@ -9,11 +9,8 @@ import (
 
 	"github.com/bettercap/bettercap/core"
 
-	"github.com/evilsocket/islazy/data"
 	"github.com/evilsocket/islazy/str"
 	"github.com/evilsocket/islazy/tui"
-
-	"github.com/malfunkt/iprange"
 )
 
 var ErrNoIfaces = errors.New("No active interfaces found.")
@@ -33,8 +30,7 @@ var (
 	IPv4RangeValidator = regexp.MustCompile(`^[0-9\.\-]+/?\d*$`)
 	MACValidator       = regexp.MustCompile(`(?i)^[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}$`)
 	// lulz this sounds like a hamburger
-	macParser   = regexp.MustCompile(`(?i)([a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2})`)
-	aliasParser = regexp.MustCompile(`(?i)([a-z_][a-z_0-9]+)`)
+	macParser = regexp.MustCompile(`(?i)([a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2}:[a-f0-9]{1,2})`)
 )
 
 func IsZeroMac(mac net.HardwareAddr) bool {
@@ -91,87 +87,6 @@ func ParseMACs(targets string) (macs []net.HardwareAddr, err error) {
 	return
 }
 
-func ParseTargets(targets string, aliasMap *data.UnsortedKV) (ips []net.IP, macs []net.HardwareAddr, err error) {
-	ips = make([]net.IP, 0)
-	macs = make([]net.HardwareAddr, 0)
-
-	if targets = str.Trim(targets); targets == "" {
-		return
-	}
-
-	// first isolate MACs and parse them
-	for _, mac := range macParser.FindAllString(targets, -1) {
-		mac = NormalizeMac(mac)
-		hw, err := net.ParseMAC(mac)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error while parsing MAC '%s': %s", mac, err)
-		}
-
-		macs = append(macs, hw)
-		targets = strings.Replace(targets, mac, "", -1)
-	}
-	targets = strings.Trim(targets, ", ")
-
-	// check and resolve aliases
-	for _, targetAlias := range aliasParser.FindAllString(targets, -1) {
-		found := false
-		aliasMap.Each(func(mac, alias string) bool {
-			if alias == targetAlias {
-				if hw, err := net.ParseMAC(mac); err == nil {
-					macs = append(macs, hw)
-					targets = strings.Replace(targets, targetAlias, "", -1)
-					found = true
-					return true
-				}
-			}
-			return false
-		})
-
-		if !found {
-			return nil, nil, fmt.Errorf("could not resolve alias %s", targetAlias)
-		}
-	}
-	targets = strings.Trim(targets, ", ")
-
-	// parse what's left
-	if targets != "" {
-		list, err := iprange.ParseList(targets)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error while parsing address list '%s': %s.", targets, err)
-		}
-
-		ips = list.Expand()
-	}
-
-	return
-}
-
-func ParseEndpoints(targets string, lan *LAN) ([]*Endpoint, error) {
-	ips, macs, err := ParseTargets(targets, lan.Aliases())
-	if err != nil {
-		return nil, err
-	}
-
-	tmp := make(map[string]*Endpoint)
-	for _, ip := range ips {
-		if e := lan.GetByIp(ip.String()); e != nil {
-			tmp[e.HW.String()] = e
-		}
-	}
-
-	for _, mac := range macs {
-		if e, found := lan.Get(mac.String()); found {
-			tmp[e.HW.String()] = e
-		}
-	}
-
-	ret := make([]*Endpoint, 0)
-	for _, e := range tmp {
-		ret = append(ret, e)
-	}
-	return ret, nil
-}
-
 func buildEndpointFromInterface(iface net.Interface) (*Endpoint, error) {
 	addrs, err := iface.Addrs()
 	if err != nil {
@@ -33,12 +33,10 @@ func TestNormalizeMac(t *testing.T) {
 	}
 }
 
-// TODO: refactor to parse targets with an actual alias map
 func TestParseTargets(t *testing.T) {
 	cases := []struct {
 		Name             string
 		InputTargets     string
-		InputAliases     *Aliases
 		ExpectedIPCount  int
 		ExpectedMACCount int
 		ExpectedError    bool
@@ -48,7 +46,6 @@ func TestParseTargets(t *testing.T) {
 		{
 			"empty target string causes empty return",
 			"",
-			&Aliases{},
 			0,
 			0,
 			false,
@@ -56,7 +53,6 @@ func TestParseTargets(t *testing.T) {
 		{
 			"MACs are parsed",
 			"192.168.1.2, 192.168.1.3, 5c:00:0b:90:a9:f0, 6c:00:0b:90:a9:f0",
-			&Aliases{},
 			2,
 			2,
 			false,
@@ -64,7 +60,7 @@ func TestParseTargets(t *testing.T) {
 	}
 	for _, test := range cases {
 		t.Run(test.Name, func(t *testing.T) {
-			ips, macs, err := ParseTargets(test.InputTargets, test.InputAliases)
+			ips, macs, err := ParseTargets(test.InputTargets, nil)
 			if err != nil && !test.ExpectedError {
 				t.Errorf("unexpected error: %s", err)
 			}
@@ -0,0 +1,239 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the following types mirror what the MarshalJSON methods of the
+// entities produce, in order to restore them from a workspace
+
+type endpointJSON struct {
+	IpAddress  string    `json:"ipv4"`
+	Ip6Address string    `json:"ipv6"`
+	HwAddress  string    `json:"mac"`
+	Hostname   string    `json:"hostname"`
+	Alias      string    `json:"alias"`
+	Vendor     string    `json:"vendor"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Meta       *Meta     `json:"meta"`
+}
+
+func (j endpointJSON) endpoint() *Endpoint {
+	e := NewEndpointNoResolve(j.IpAddress, j.HwAddress, j.Hostname, 0)
+	if j.Ip6Address != "" {
+		e.SetIPv6(j.Ip6Address)
+	}
+	if j.Vendor != "" {
+		e.Vendor = j.Vendor
+	}
+	e.Alias = j.Alias
+	e.FirstSeen = j.FirstSeen
+	e.LastSeen = j.LastSeen
+	if j.Meta != nil {
+		e.Meta = j.Meta
+	}
+	return e
+}
+
+type stationJSON struct {
+	endpointJSON
+	Frequency      int               `json:"frequency"`
+	Channel        int               `json:"channel"`
+	RSSI           int8              `json:"rssi"`
+	Sent           uint64            `json:"sent"`
+	Received       uint64            `json:"received"`
+	Encryption     string            `json:"encryption"`
+	Cipher         string            `json:"cipher"`
+	Authentication string            `json:"authentication"`
+	WPS            map[string]string `json:"wps"`
+}
+
+func (j stationJSON) station() *Station {
+	if net.ParseIP(j.IpAddress) == nil {
+		j.IpAddress = MonitorModeAddress
+	}
+
+	s := &Station{
+		Endpoint:       j.endpoint(),
+		Frequency:      j.Frequency,
+		Channel:        j.Channel,
+		RSSI:           j.RSSI,
+		Sent:           j.Sent,
+		Received:       j.Received,
+		Encryption:     j.Encryption,
+		Cipher:         j.Cipher,
+		Authentication: j.Authentication,
+		WPS:            j.WPS,
+		Handshake:      NewHandshake(),
+	}
+
+	if s.WPS == nil {
+		s.WPS = make(map[string]string)
+	}
+
+	return s
+}
+
+type apRestoreJSON struct {
+	stationJSON
+	Clients   []stationJSON `json:"clients"`
+	Handshake bool          `json:"handshake"`
+}
+
+// Restore adds the hosts of a previously saved LAN which are not known yet
+// and still belong to the subnet of the interface, without notifying them
+// as new. It returns the number of restored hosts.
+func (lan *LAN) Restore(raw []byte) (error, int) {
+	doc := struct {
+		Hosts []endpointJSON `json:"hosts"`
+	}{}
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err, 0
+	}
+
+	lan.Lock()
+	defer lan.Unlock()
+
+	restored := 0
+	for _, h := range doc.Hosts {
+		mac := NormalizeMac(h.HwAddress)
+		if net.ParseIP(h.IpAddress) == nil || lan.shouldIgnore(h.IpAddress, mac) {
+			continue
+		} else if _, found := lan.hosts[mac]; found {
+			continue
+		}
+
+		e := h.endpoint()
+		e.Alias = lan.aliases.GetOr(mac, e.Alias)
+		GetAnnotations().Apply(e)
+		lan.hosts[mac] = e
+		lan.ttl[mac] = LANDefaultttl
+		lan.history.Seen(e)
+		restored++
+	}
+
+	return nil, restored
+}
+
+// RestoreHistory merges a previously saved LAN history, it must be called
+// before Restore so that the saved hosts keep their history. It returns the
+// number of restored hosts.
+func (lan *LAN) RestoreHistory(raw []byte) (error, int) {
+	var hosts []*HostHistory
+	if err := json.Unmarshal(raw, &hosts); err != nil {
+		return err, 0
+	}
+	return nil, lan.history.Restore(hosts)
+}
+
+// Restore adds the access points and clients of a previously saved WiFi
+// which are not known yet, without notifying them as new. It returns the
+// number of restored access points.
+func (w *WiFi) Restore(raw []byte) (error, int) {
+	doc := struct {
+		AccessPoints []apRestoreJSON `json:"aps"`
+	}{}
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err, 0
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	restored := 0
+	for _, a := range doc.AccessPoints {
+		mac := NormalizeMac(a.HwAddress)
+		if _, found := w.aps[mac]; found {
+			continue
+		}
+
+		ap := &AccessPoint{
+			Station:         a.station(),
+			aliases:         w.aliases,
+			clients:         make(map[string]*Station),
+			withKeyMaterial: a.Handshake,
+		}
+		ap.Alias = w.aliases.GetOr(mac, ap.Alias)
+		GetAnnotations().Apply(ap.Endpoint)
+
+		for _, c := range a.Clients {
+			client := c.station()
+			client.Alias = w.aliases.GetOr(client.HwAddress, client.Alias)
+			GetAnnotations().Apply(client.Endpoint)
+			ap.clients[client.HwAddress] = client
+		}
+
+		w.aps[mac] = ap
+		restored++
+	}
+
+	return nil, restored
+}
+
+func hidTypeFromString(name string) HIDType {
+	for _, t := range []HIDType{HIDTypeLogitech, HIDTypeAmazon, HIDTypeMicrosoft, HIDTypeDell} {
+		if t.String() == name {
+			return t
+		}
+	}
+	return HIDTypeUnknown
+}
+
+// Restore adds the devices of a previously saved HID which are not known
+// yet, without notifying them as new. Only the size of the payloads is
+// restored. It returns the number of restored devices.
+func (b *HID) Restore(raw []byte) (error, int) {
+	doc := struct {
+		Devices []hidDeviceJSON `json:"devices"`
+	}{}
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err, 0
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	restored := 0
+	for _, d := range doc.Devices {
+		address := NormalizeHIDAddress(d.Address)
+		if _, found := b.devices[address]; found {
+			continue
+		}
+
+		rawAddress, err := hex.DecodeString(strings.Replace(address, ":", "", -1))
+		if err != nil {
+			continue
+		}
+
+		dev := &HIDDevice{
+			LastSeen:   d.LastSeen,
+			Type:       hidTypeFromString(d.Type),
+			Alias:      b.aliases.GetOr(address, d.Alias),
+			Address:    address,
+			RawAddress: rawAddress,
+			channels:   make(map[int]bool),
+			payloads:   make([]HIDPayload, 0),
+			payloadsSz: d.PayloadsSize,
+		}
+
+		for _, ch := range d.Channels {
+			if n, err := strconv.Atoi(ch); err == nil {
+				dev.channels[n] = true
+			}
+		}
+
+		b.devices[address] = dev
+		restored++
+	}
+
+	return nil, restored
+}
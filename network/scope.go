@@ -0,0 +1,259 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/evilsocket/islazy/fs"
+)
+
+// ScopeRules is a list of CIDRs, MACs, BSSIDs and SSIDs as found in a scope file.
+type ScopeRules struct {
+	CIDRs  []string `json:"cidrs"`
+	MACs   []string `json:"macs"`
+	BSSIDs []string `json:"bssids"`
+	SSIDs  []string `json:"ssids"`
+}
+
+// ScopeDefinition is the content of a scope file, for instance:
+//
+//	{
+//	  "cidrs": ["192.168.1.0/24"],
+//	  "ssids": ["ACME-Corp"],
+//	  "exclude": {
+//	    "cidrs": ["192.168.1.250/32"]
+//	  }
+//	}
+type ScopeDefinition struct {
+	ScopeRules
+	Exclude ScopeRules `json:"exclude"`
+}
+
+// ScopeViolation is reported every time an action against an out of scope
+// target is refused or dropped.
+type ScopeViolation struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+type scopeRules struct {
+	nets   []*net.IPNet
+	macs   map[string]bool
+	bssids map[string]bool
+	ssids  map[string]bool
+}
+
+// Scope is the set of hosts and wireless networks of an engagement. Once
+// loaded it can't be changed: IP addresses are in scope only if they belong
+// to one of the allowed CIDRs, MACs are in scope unless a list of allowed
+// ones is given, access points are in scope if their BSSID or SSID is
+// allowed. Exclusions always win.
+type Scope struct {
+	sync.Mutex
+
+	Path       string
+	Definition ScopeDefinition
+
+	allowed     scopeRules
+	excluded    scopeRules
+	reported    map[string]bool
+	onViolation func(v ScopeViolation)
+}
+
+var (
+	scopeLock   = &sync.Mutex{}
+	activeScope *Scope
+)
+
+func compileScopeRules(def ScopeRules) (error, scopeRules) {
+	rules := scopeRules{
+		nets:   make([]*net.IPNet, 0),
+		macs:   make(map[string]bool),
+		bssids: make(map[string]bool),
+		ssids:  make(map[string]bool),
+	}
+
+	for _, cidr := range def.CIDRs {
+		// single addresses are allowed too
+		if !strings.ContainsRune(cidr, '/') {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR '%s': %v", cidr, err), rules
+		}
+		rules.nets = append(rules.nets, ipNet)
+	}
+
+	for _, mac := range def.MACs {
+		hw, err := net.ParseMAC(NormalizeMac(mac))
+		if err != nil {
+			return fmt.Errorf("invalid MAC '%s': %v", mac, err), rules
+		}
+		rules.macs[hw.String()] = true
+	}
+
+	for _, bssid := range def.BSSIDs {
+		hw, err := net.ParseMAC(NormalizeMac(bssid))
+		if err != nil {
+			return fmt.Errorf("invalid BSSID '%s': %v", bssid, err), rules
+		}
+		rules.bssids[hw.String()] = true
+	}
+
+	for _, ssid := range def.SSIDs {
+		rules.ssids[ssid] = true
+	}
+
+	return nil, rules
+}
+
+func NewScope(def ScopeDefinition) (error, *Scope) {
+	s := &Scope{
+		Definition: def,
+		reported:   make(map[string]bool),
+	}
+
+	var err error
+	if err, s.allowed = compileScopeRules(def.ScopeRules); err != nil {
+		return err, nil
+	} else if err, s.excluded = compileScopeRules(def.Exclude); err != nil {
+		return err, nil
+	}
+
+	return nil, s
+}
+
+func LoadScope(fileName string) (error, *Scope) {
+	fileName, _ = fs.Expand(fileName)
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err, nil
+	}
+
+	var def ScopeDefinition
+	if err = json.Unmarshal(raw, &def); err != nil {
+		return fmt.Errorf("error while parsing scope file %s: %v", fileName, err), nil
+	}
+
+	err, s := NewScope(def)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fileName, err), nil
+	}
+	s.Path = fileName
+
+	return nil, s
+}
+
+// SetScope sets the scope of the engagement, it can only be done once.
+func SetScope(s *Scope) error {
+	scopeLock.Lock()
+	defer scopeLock.Unlock()
+
+	if activeScope != nil {
+		return fmt.Errorf("the scope of this session is locked to %s", activeScope.Path)
+	}
+	activeScope = s
+	return nil
+}
+
+// GetScope returns the scope of the engagement or nil if not set.
+func GetScope() *Scope {
+	scopeLock.Lock()
+	defer scopeLock.Unlock()
+	return activeScope
+}
+
+// OnViolation sets the callback invoked the first time each action against
+// an out of scope target is refused.
+func (s *Scope) OnViolation(cb func(v ScopeViolation)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onViolation = cb
+}
+
+func (s *Scope) violation(action string, target string, reason string) error {
+	s.Lock()
+	key := action + " " + target
+	cb := s.onViolation
+	report := !s.reported[key]
+	s.reported[key] = true
+	s.Unlock()
+
+	if report && cb != nil {
+		cb(ScopeViolation{
+			Action: action,
+			Target: target,
+			Reason: reason,
+		})
+	}
+
+	return fmt.Errorf("%s: %s is out of scope (%s)", action, target, reason)
+}
+
+func (r scopeRules) hasIP(ip net.IP) bool {
+	for _, ipNet := range r.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckIP returns an error if the address is out of scope, broadcast and
+// multicast addresses are always allowed.
+func (s *Scope) CheckIP(ip net.IP, action string) error {
+	if s == nil || ip.IsMulticast() || ip.IsUnspecified() || ip.Equal(net.IPv4bcast) {
+		return nil
+	} else if s.excluded.hasIP(ip) {
+		return s.violation(action, ip.String(), "excluded")
+	} else if !s.allowed.hasIP(ip) {
+		return s.violation(action, ip.String(), "not in any allowed CIDR")
+	}
+	return nil
+}
+
+// CheckMAC returns an error if the hardware address is out of scope,
+// broadcast and multicast addresses are always allowed.
+func (s *Scope) CheckMAC(hw net.HardwareAddr, action string) error {
+	if s == nil || len(hw) == 0 || IsZeroMac(hw) || IsBroadcastMac(hw) || hw[0]&0x01 == 1 {
+		return nil
+	}
+
+	mac := hw.String()
+	if s.excluded.macs[mac] {
+		return s.violation(action, mac, "excluded")
+	} else if len(s.allowed.macs) > 0 && !s.allowed.macs[mac] {
+		return s.violation(action, mac, "not an allowed MAC")
+	}
+	return nil
+}
+
+// CheckAP returns an error if the wireless network is out of scope.
+func (s *Scope) CheckAP(bssid net.HardwareAddr, ssid string, action string) error {
+	if s == nil {
+		return nil
+	}
+
+	target := bssid.String()
+	if ssid != "" {
+		target = fmt.Sprintf("%s (%s)", ssid, target)
+	}
+
+	if s.excluded.bssids[bssid.String()] || (ssid != "" && s.excluded.ssids[ssid]) {
+		return s.violation(action, target, "excluded")
+	} else if !s.allowed.bssids[bssid.String()] && (ssid == "" || !s.allowed.ssids[ssid]) {
+		return s.violation(action, target, "not an allowed BSSID or SSID")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func buildTestScope(t *testing.T) *Scope {
+	err, s := NewScope(ScopeDefinition{
+		ScopeRules: ScopeRules{
+			CIDRs:  []string{"192.168.1.0/24", "10.0.0.1"},
+			BSSIDs: []string{"aa:bb:cc:dd:ee:ff"},
+			SSIDs:  []string{"ACME-Corp"},
+		},
+		Exclude: ScopeRules{
+			CIDRs: []string{"192.168.1.250/32"},
+			MACs:  []string{"00:11:22:33:44:55"},
+			SSIDs: []string{"ACME-Guests"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScopeCheckIP(t *testing.T) {
+	s := buildTestScope(t)
+	cases := []struct {
+		ip      string
+		inScope bool
+	}{
+		{"192.168.1.10", true},
+		{"10.0.0.1", true},
+		{"10.0.0.2", false},
+		{"192.168.1.250", false},
+		{"192.168.2.1", false},
+		{"255.255.255.255", true},
+		{"224.0.0.251", true},
+	}
+
+	for _, c := range cases {
+		if err := s.CheckIP(net.ParseIP(c.ip), "test"); (err == nil) != c.inScope {
+			t.Errorf("expected %s in scope to be %v, got error %v", c.ip, c.inScope, err)
+		}
+	}
+}
+
+func TestScopeCheckMACAndAP(t *testing.T) {
+	s := buildTestScope(t)
+	excluded, _ := net.ParseMAC("00:11:22:33:44:55")
+	other, _ := net.ParseMAC("de:ad:be:ef:00:01")
+	bssid, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+
+	if err := s.CheckMAC(excluded, "test"); err == nil {
+		t.Errorf("expected %s to be out of scope", excluded)
+	} else if err := s.CheckMAC(other, "test"); err != nil {
+		t.Errorf("expected %s to be in scope: %v", other, err)
+	} else if err := s.CheckMAC(BroadcastHw, "test"); err != nil {
+		t.Errorf("expected broadcast to be in scope: %v", err)
+	}
+
+	if err := s.CheckAP(bssid, "", "test"); err != nil {
+		t.Errorf("expected BSSID %s to be in scope: %v", bssid, err)
+	} else if err := s.CheckAP(other, "ACME-Corp", "test"); err != nil {
+		t.Errorf("expected SSID ACME-Corp to be in scope: %v", err)
+	} else if err := s.CheckAP(other, "ACME-Guests", "test"); err == nil {
+		t.Errorf("expected SSID ACME-Guests to be out of scope")
+	} else if err := s.CheckAP(other, "Neighbours", "test"); err == nil {
+		t.Errorf("expected SSID Neighbours to be out of scope")
+	}
+}
+
+func TestScopeViolationsReportedOnce(t *testing.T) {
+	s := buildTestScope(t)
+	reported := make([]ScopeViolation, 0)
+	s.OnViolation(func(v ScopeViolation) {
+		reported = append(reported, v)
+	})
+
+	for i := 0; i < 3; i++ {
+		s.CheckIP(net.ParseIP("8.8.8.8"), "test")
+	}
+	s.CheckIP(net.ParseIP("8.8.4.4"), "test")
+
+	if len(reported) != 2 {
+		t.Fatalf("expected 2 violations, got %d", len(reported))
+	} else if reported[0].Target != "8.8.8.8" || reported[0].Action != "test" {
+		t.Fatalf("unexpected violation %+v", reported[0])
+	}
+}
+
+func TestParseTargetsOutOfScope(t *testing.T) {
+	activeScope = buildTestScope(t)
+	defer func() {
+		activeScope = nil
+	}()
+
+	if _, _, err := ParseTargets("192.168.1.1-20", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, _, err := ParseTargets("192.168.1.240-255", nil); err == nil {
+		t.Fatalf("expected excluded address to be refused")
+	} else if _, _, err := ParseTargets("00:11:22:33:44:55", nil); err == nil {
+		t.Fatalf("expected excluded MAC to be refused")
+	} else if ips, _, err := ParseTargetsUnscoped("8.8.8.8", nil); err != nil || len(ips) != 1 {
+		t.Fatalf("expected unscoped parsing to succeed, got %v %v", ips, err)
+	}
+}
+
+func TestSetScopeLocked(t *testing.T) {
+	defer func() {
+		activeScope = nil
+	}()
+
+	if err := SetScope(buildTestScope(t)); err != nil {
+		t.Fatal(err)
+	} else if err := SetScope(buildTestScope(t)); err == nil {
+		t.Fatalf("expected the scope to be locked")
+	}
+}
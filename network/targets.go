@@ -0,0 +1,459 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/evilsocket/islazy/str"
+
+	"github.com/malfunkt/iprange"
+)
+
+// maximum number of addresses of an IPv6 network to expand
+const MaxIPv6Prefix = 112
+
+var (
+	ipv4TargetValidator = regexp.MustCompile(`^[0-9\.\-\*]+(/\d+)?$`)
+	nameTargetValidator = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_\-\.]*$`)
+
+	// hostnames which are neither aliases nor names of known hosts are
+	// resolved with DNS, only the first time the expression is evaluated
+	lookupIP = net.LookupIP
+)
+
+type targetKind int
+
+const (
+	targetAddresses targetKind = iota
+	targetMAC
+	targetName
+	targetVendor
+	targetMeta
+	targetTag
+)
+
+type targetTerm struct {
+	kind  targetKind
+	value string
+	ips   []net.IP
+	set   map[string]bool
+	mac   net.HardwareAddr
+	key   string
+	// result of the DNS lookup of a name
+	lookedUp  bool
+	lookupErr error
+}
+
+// Targets is a parsed target expression, a comma separated list of:
+//
+//	192.168.1.10, 192.168.1.1-20, 192.168.1.0/24  IPv4 addresses and nmap style ranges
+//	fe80::1, fd00::/120                           IPv6 addresses and networks
+//	aa:bb:cc:dd:ee:ff                             MAC addresses
+//	printer, fileserver.corp                      aliases, hostnames of known hosts or DNS names
+//	vendor:Apple                                  hosts whose vendor contains the string
+//	meta:os=windows, meta:ports                   hosts with the meta value (or with the meta at all)
+//	tag:owned                                     hosts with the tag
+//
+// Each item can be prefixed with ! to exclude the hosts it selects, if
+// only exclusions are given every known host is selected but them.
+// Hosts are selected among the ones of the LAN when the expression is
+// evaluated, so the same expression can select new hosts over time.
+type Targets struct {
+	Expression string
+	include    []*targetTerm
+	exclude    []*targetTerm
+}
+
+func parseTargetTerm(value string) (*targetTerm, error) {
+	term := &targetTerm{value: value}
+	lower := strings.ToLower(value)
+
+	switch {
+	case strings.HasPrefix(lower, "vendor:"):
+		term.kind = targetVendor
+		term.value = strings.ToLower(value[7:])
+	case strings.HasPrefix(lower, "meta:"):
+		term.kind = targetMeta
+		parts := strings.SplitN(value[5:], "=", 2)
+		term.key = parts[0]
+		term.value = ""
+		if len(parts) == 2 {
+			term.value = strings.ToLower(parts[1])
+		}
+	case strings.HasPrefix(lower, "tag:"):
+		term.kind = targetTag
+		term.value = value[4:]
+	case MACValidator.MatchString(NormalizeMac(value)):
+		term.kind = targetMAC
+		hw, err := net.ParseMAC(NormalizeMac(value))
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing MAC '%s': %s", value, err)
+		}
+		term.mac = hw
+	case strings.ContainsRune(value, ':'):
+		term.kind = targetAddresses
+		ips, err := parseIPv6Target(value)
+		if err != nil {
+			return nil, err
+		}
+		term.ips = ips
+	case ipv4TargetValidator.MatchString(value):
+		term.kind = targetAddresses
+		r, err := iprange.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing address range '%s': %s", value, err)
+		}
+		term.ips = r.Expand()
+	case nameTargetValidator.MatchString(value):
+		term.kind = targetName
+	default:
+		return nil, fmt.Errorf("invalid target '%s'", value)
+	}
+
+	if (term.kind == targetMeta && term.key == "") || ((term.kind == targetVendor || term.kind == targetTag) && term.value == "") {
+		return nil, fmt.Errorf("empty selector '%s'", value)
+	}
+
+	if term.kind == targetAddresses {
+		term.set = make(map[string]bool)
+		for _, ip := range term.ips {
+			term.set[ip.String()] = true
+		}
+	}
+
+	return term, nil
+}
+
+func parseIPv6Target(value string) ([]net.IP, error) {
+	if !strings.ContainsRune(value, '/') {
+		if ip := net.ParseIP(value); ip == nil {
+			return nil, fmt.Errorf("'%s' is not a valid IPv6 address", value)
+		} else {
+			return []net.IP{ip}, nil
+		}
+	}
+
+	ip, ipnet, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, err
+	} else if bits, _ := ipnet.Mask.Size(); bits < MaxIPv6Prefix {
+		return nil, fmt.Errorf("network %s is too large, the prefix must be at least /%d", value, MaxIPv6Prefix)
+	}
+
+	ips := make([]net.IP, 0)
+	for ip = ip.Mask(ipnet.Mask); ipnet.Contains(ip); ip = NextIP(ip) {
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// NextIP returns the address following the given one.
+func NextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] > 0 {
+			break
+		}
+	}
+	return next
+}
+
+// ParseTargetExpression parses the expression, names and selectors are
+// only resolved when the targets are evaluated.
+func ParseTargetExpression(expr string) (*Targets, error) {
+	t := &Targets{
+		Expression: str.Trim(expr),
+		include:    make([]*targetTerm, 0),
+		exclude:    make([]*targetTerm, 0),
+	}
+
+	for _, value := range str.Comma(t.Expression) {
+		excluded := strings.HasPrefix(value, "!")
+		if excluded {
+			value = str.Trim(value[1:])
+		}
+
+		term, err := parseTargetTerm(value)
+		if err != nil {
+			return nil, err
+		} else if excluded {
+			t.exclude = append(t.exclude, term)
+		} else {
+			t.include = append(t.include, term)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *Targets) String() string {
+	return t.Expression
+}
+
+// Empty returns true if the expression selects nothing.
+func (t *Targets) Empty() bool {
+	return len(t.include) == 0 && len(t.exclude) == 0
+}
+
+// matches checks the term against a host, names are compared to its alias
+// and hostname without resolving them.
+func (term *targetTerm) matches(e *Endpoint) bool {
+	switch term.kind {
+	case targetAddresses:
+		return term.set[e.IpAddress] || (e.Ip6Address != "" && term.set[e.Ip6Address])
+	case targetMAC:
+		return e.HwAddress == term.mac.String()
+	case targetName:
+		return e.Alias == term.value || strings.EqualFold(e.Hostname, term.value)
+	case targetVendor:
+		return term.value != "" && strings.Contains(strings.ToLower(e.Vendor), term.value)
+	case targetMeta:
+		if value := e.Meta.GetOr(term.key, nil); value == nil {
+			return false
+		} else if term.value == "" {
+			return true
+		} else {
+			return strings.ToLower(fmt.Sprintf("%v", value)) == term.value
+		}
+	case targetTag:
+		for _, tag := range e.Tags {
+			if tag == term.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match returns true if the host is selected by the expression.
+func (t *Targets) Match(e *Endpoint) bool {
+	if t.Empty() || e == nil {
+		return false
+	}
+
+	for _, term := range t.exclude {
+		if term.matches(e) {
+			return false
+		}
+	}
+
+	if len(t.include) == 0 {
+		return true
+	}
+
+	for _, term := range t.include {
+		if term.matches(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func lanHosts(lan *LAN) []*Endpoint {
+	if lan == nil {
+		return []*Endpoint{}
+	}
+	return lan.List()
+}
+
+// resolve returns the addresses and hardware addresses selected by the term.
+func (term *targetTerm) resolve(lan *LAN) ([]net.IP, []net.HardwareAddr, error) {
+	ips := make([]net.IP, 0)
+	macs := make([]net.HardwareAddr, 0)
+
+	switch term.kind {
+	case targetAddresses:
+		ips = append(ips, term.ips...)
+	case targetMAC:
+		macs = append(macs, term.mac)
+	case targetName:
+		if lan != nil {
+			lan.Aliases().Each(func(mac, alias string) bool {
+				if alias == term.value {
+					if hw, err := net.ParseMAC(mac); err == nil {
+						macs = append(macs, hw)
+						return true
+					}
+				}
+				return false
+			})
+		}
+
+		if len(macs) == 0 {
+			for _, e := range lanHosts(lan) {
+				if strings.EqualFold(e.Hostname, term.value) {
+					macs = append(macs, e.HW)
+				}
+			}
+		}
+
+		if len(macs) == 0 {
+			if !term.lookedUp {
+				term.lookedUp = true
+				if found, err := lookupIP(term.value); err != nil || len(found) == 0 {
+					term.lookupErr = fmt.Errorf("could not resolve %s", term.value)
+				} else {
+					term.ips = found
+				}
+			}
+			if term.lookupErr != nil {
+				return nil, nil, term.lookupErr
+			}
+			ips = append(ips, term.ips...)
+		}
+	default:
+		for _, e := range lanHosts(lan) {
+			if term.matches(e) {
+				macs = append(macs, e.HW)
+			}
+		}
+	}
+
+	return ips, macs, nil
+}
+
+// Resolve evaluates the expression against the hosts of the LAN, returning
+// the selected addresses and hardware addresses. Names are looked up with
+// DNS only once, so the expression can be evaluated again without blocking.
+func (t *Targets) Resolve(lan *LAN) (ips []net.IP, macs []net.HardwareAddr, err error) {
+	ips = make([]net.IP, 0)
+	macs = make([]net.HardwareAddr, 0)
+
+	excludedIPs := make(map[string]bool)
+	excludedMACs := make(map[string]bool)
+	for _, term := range t.exclude {
+		termIPs, termMACs, err := term.resolve(lan)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ip := range termIPs {
+			excludedIPs[ip.String()] = true
+		}
+		for _, hw := range termMACs {
+			excludedMACs[hw.String()] = true
+		}
+	}
+
+	// a host is excluded by either of its addresses
+	isExcluded := func(ip string, mac string) bool {
+		if excludedIPs[ip] || excludedMACs[mac] {
+			return true
+		} else if lan == nil {
+			return false
+		} else if ip != "" {
+			if e := lan.GetByIp(ip); e != nil {
+				return excludedMACs[e.HwAddress]
+			}
+		} else if e, found := lan.Get(mac); found {
+			return excludedIPs[e.IpAddress] || excludedIPs[e.Ip6Address]
+		}
+		return false
+	}
+
+	seen := make(map[string]bool)
+	addIPs := func(list []net.IP) {
+		for _, ip := range list {
+			key := ip.String()
+			if !seen[key] && !isExcluded(key, "") {
+				seen[key] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+	addMACs := func(list []net.HardwareAddr) {
+		for _, hw := range list {
+			key := hw.String()
+			if !seen[key] && !isExcluded("", key) {
+				seen[key] = true
+				macs = append(macs, hw)
+			}
+		}
+	}
+
+	if len(t.include) == 0 && len(t.exclude) > 0 {
+		for _, e := range lanHosts(lan) {
+			addMACs([]net.HardwareAddr{e.HW})
+		}
+	}
+
+	for _, term := range t.include {
+		termIPs, termMACs, err := term.resolve(lan)
+		if err != nil {
+			return nil, nil, err
+		}
+		addIPs(termIPs)
+		addMACs(termMACs)
+	}
+
+	return
+}
+
+// ParseTargets parses and evaluates a target expression, refusing it if
+// any of the selected hosts is out of the scope of the engagement.
+func ParseTargets(targets string, lan *LAN) (ips []net.IP, macs []net.HardwareAddr, err error) {
+	if ips, macs, err = ParseTargetsUnscoped(targets, lan); err != nil {
+		return nil, nil, err
+	} else if err = CheckTargetsScope(ips, macs, "target selection"); err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// ParseTargetsUnscoped is like ParseTargets but doesn't check the scope, it
+// is meant for lists which are not going to be attacked like whitelists.
+func ParseTargetsUnscoped(targets string, lan *LAN) (ips []net.IP, macs []net.HardwareAddr, err error) {
+	t, err := ParseTargetExpression(targets)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.Resolve(lan)
+}
+
+// CheckTargetsScope returns an error if any of the addresses is out of
+// the scope of the engagement.
+func CheckTargetsScope(ips []net.IP, macs []net.HardwareAddr, action string) error {
+	scope := GetScope()
+	for _, ip := range ips {
+		if err := scope.CheckIP(ip, action); err != nil {
+			return err
+		}
+	}
+
+	for _, hw := range macs {
+		if err := scope.CheckMAC(hw, action); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseEndpoints returns the known hosts selected by the target expression.
+func ParseEndpoints(targets string, lan *LAN) ([]*Endpoint, error) {
+	ips, macs, err := ParseTargetsUnscoped(targets, lan)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := make(map[string]*Endpoint)
+	for _, ip := range ips {
+		if e := lan.GetByIp(ip.String()); e != nil {
+			tmp[e.HW.String()] = e
+		}
+	}
+
+	for _, mac := range macs {
+		if e, found := lan.Get(mac.String()); found {
+			tmp[e.HW.String()] = e
+		}
+	}
+
+	ret := make([]*Endpoint, 0)
+	for _, e := range tmp {
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
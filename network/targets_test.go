@@ -0,0 +1,289 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/evilsocket/islazy/data"
+)
+
+func buildTargetsLAN(t *testing.T) *LAN {
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "eth0", 24)
+	gateway := NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+	lan := NewLAN(iface, gateway, aliases, func(e *Endpoint) {}, func(e *Endpoint) {}, func(e *Endpoint, previous string) {})
+
+	add := func(ip, mac, hostname, vendor string) *Endpoint {
+		e := NewEndpointNoResolve(ip, mac, hostname, 24)
+		e.Vendor = vendor
+		lan.hosts[e.HwAddress] = e
+		return e
+	}
+
+	add("10.0.0.10", "00:00:00:00:00:10", "macbook.lan", "Apple, Inc.")
+	add("10.0.0.11", "00:00:00:00:00:11", "", "Apple, Inc.").Tags = []string{"dc", "owned"}
+	add("10.0.0.12", "00:00:00:00:00:12", "printer.lan", "Hewlett Packard").Meta.Set("os", "Windows")
+	add("10.0.0.13", "00:00:00:00:00:13", "", "Raspberry Pi Foundation").SetIPv6("fd00::13/64")
+
+	aliases.Set("00:00:00:00:00:12", "printer")
+	lan.hosts["00:00:00:00:00:12"].Alias = "printer"
+
+	return lan
+}
+
+func sortedStrings(ips []net.IP, macs []net.HardwareAddr) []string {
+	all := make([]string, 0)
+	for _, ip := range ips {
+		all = append(all, ip.String())
+	}
+	for _, hw := range macs {
+		all = append(all, hw.String())
+	}
+	sort.Strings(all)
+	return all
+}
+
+func TestParseTargetExpressionErrors(t *testing.T) {
+	for _, expr := range []string{
+		"foo bar",
+		"10.0..1",
+		"fd00::/64",
+		"fd00::zz",
+		"vendor:",
+		"tag:",
+		"meta:",
+		"meta:=windows",
+		"10.0.0.1, $$$",
+	} {
+		if _, err := ParseTargetExpression(expr); err == nil {
+			t.Errorf("expected an error parsing '%s'", expr)
+		}
+	}
+}
+
+func TestParseTargetExpressionEmpty(t *testing.T) {
+	for _, expr := range []string{"", "  ", ", ,"} {
+		if targets, err := ParseTargetExpression(expr); err != nil {
+			t.Errorf("unexpected error parsing '%s': %v", expr, err)
+		} else if !targets.Empty() {
+			t.Errorf("expected '%s' to be empty", expr)
+		} else if ips, macs, err := targets.Resolve(nil); err != nil || len(ips) != 0 || len(macs) != 0 {
+			t.Errorf("expected '%s' to select nothing, got %v %v %v", expr, ips, macs, err)
+		}
+	}
+}
+
+func TestTargetsResolve(t *testing.T) {
+	lan := buildTargetsLAN(t)
+
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host == "fileserver.corp" {
+			return []net.IP{net.ParseIP("192.168.10.5")}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	defer func() {
+		lookupIP = net.LookupIP
+	}()
+
+	cases := []struct {
+		expr     string
+		expected []string
+	}{
+		{"10.0.0.10", []string{"10.0.0.10"}},
+		{"10.0.0.10-12", []string{"10.0.0.10", "10.0.0.11", "10.0.0.12"}},
+		{"10.0.0.10/31", []string{"10.0.0.10", "10.0.0.11"}},
+		{"10.0.0.10, 10.0.0.10", []string{"10.0.0.10"}},
+		{"fd00::13", []string{"fd00::13"}},
+		{"fd00::/126", []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"}},
+		{"00:00:00:00:00:10", []string{"00:00:00:00:00:10"}},
+		{"0-0-0-0-0-10", []string{"00:00:00:00:00:10"}},
+		{"printer", []string{"00:00:00:00:00:12"}},
+		{"macbook.lan", []string{"00:00:00:00:00:10"}},
+		{"MACBOOK.LAN", []string{"00:00:00:00:00:10"}},
+		{"fileserver.corp", []string{"192.168.10.5"}},
+		{"vendor:apple", []string{"00:00:00:00:00:10", "00:00:00:00:00:11"}},
+		{"VENDOR:Raspberry", []string{"00:00:00:00:00:13"}},
+		{"vendor:cisco", []string{}},
+		{"meta:os=windows", []string{"00:00:00:00:00:12"}},
+		{"meta:os=linux", []string{}},
+		{"meta:os", []string{"00:00:00:00:00:12"}},
+		{"tag:owned", []string{"00:00:00:00:00:11"}},
+		{"tag:own", []string{}},
+		{"10.0.0.10-12, !10.0.0.11", []string{"10.0.0.10", "10.0.0.12"}},
+		// excluded by the MAC of the host with that address
+		{"10.0.0.10-12, !00:00:00:00:00:12", []string{"10.0.0.10", "10.0.0.11"}},
+		// excluded by the address of the host with that MAC
+		{"vendor:apple, !10.0.0.10", []string{"00:00:00:00:00:11"}},
+		{"10.0.0.9-14, !vendor:apple, !tag:dc, !printer", []string{"10.0.0.9", "10.0.0.13", "10.0.0.14"}},
+		{"!vendor:apple", []string{"00:00:00:00:00:12", "00:00:00:00:00:13"}},
+		{"! 10.0.0.12, !fd00::13", []string{"00:00:00:00:00:10", "00:00:00:00:00:11"}},
+	}
+
+	for _, c := range cases {
+		targets, err := ParseTargetExpression(c.expr)
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s': %v", c.expr, err)
+			continue
+		}
+
+		ips, macs, err := targets.Resolve(lan)
+		if err != nil {
+			t.Errorf("unexpected error resolving '%s': %v", c.expr, err)
+			continue
+		}
+
+		got := sortedStrings(ips, macs)
+		sort.Strings(c.expected)
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", c.expected) {
+			t.Errorf("expected '%s' to select %v, got %v", c.expr, c.expected, got)
+		}
+	}
+}
+
+func TestTargetsResolveUnknownName(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		return nil, fmt.Errorf("no such host")
+	}
+	defer func() {
+		lookupIP = net.LookupIP
+	}()
+
+	targets, err := ParseTargetExpression("10.0.0.10, nosuchhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, _, err = targets.Resolve(buildTargetsLAN(t)); err == nil {
+		t.Fatalf("expected an error resolving an unknown name")
+	}
+}
+
+func TestTargetsResolveLooksUpOnce(t *testing.T) {
+	lookups := 0
+	lookupIP = func(host string) ([]net.IP, error) {
+		lookups++
+		if host == "fileserver.corp" {
+			return []net.IP{net.ParseIP("192.168.10.5")}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	defer func() {
+		lookupIP = net.LookupIP
+	}()
+
+	lan := buildTargetsLAN(t)
+	targets, err := ParseTargetExpression("fileserver.corp, nosuchhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err = targets.Resolve(lan); err == nil {
+			t.Fatalf("expected an error resolving an unknown name")
+		}
+	}
+	if lookups != 2 {
+		t.Fatalf("expected 2 lookups, got %d", lookups)
+	}
+
+	// names of known hosts are not looked up
+	if targets, err = ParseTargetExpression("fileserver.corp, printer"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if ips, macs, err := targets.Resolve(lan); err != nil || len(ips) != 1 || len(macs) != 1 {
+			t.Fatalf("unexpected result %v %v %v", ips, macs, err)
+		}
+	}
+	if lookups != 3 {
+		t.Fatalf("expected 3 lookups, got %d", lookups)
+	}
+}
+
+func TestTargetsResolveNewHosts(t *testing.T) {
+	lan := buildTargetsLAN(t)
+	targets, err := ParseTargetExpression("vendor:apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, macs, _ := targets.Resolve(lan); len(macs) != 2 {
+		t.Fatalf("expected 2 hosts, got %v", macs)
+	}
+
+	e := NewEndpointNoResolve("10.0.0.20", "00:00:00:00:00:20", "", 24)
+	e.Vendor = "Apple, Inc."
+	lan.hosts[e.HwAddress] = e
+
+	if _, macs, _ := targets.Resolve(lan); len(macs) != 3 {
+		t.Fatalf("expected the new host to be selected, got %v", macs)
+	}
+}
+
+func TestTargetsMatch(t *testing.T) {
+	lan := buildTargetsLAN(t)
+	macbook, _ := lan.Get("00:00:00:00:00:10")
+	owned, _ := lan.Get("00:00:00:00:00:11")
+	printer, _ := lan.Get("00:00:00:00:00:12")
+	raspberry, _ := lan.Get("00:00:00:00:00:13")
+
+	cases := []struct {
+		expr    string
+		host    *Endpoint
+		matches bool
+	}{
+		{"", macbook, false},
+		{"10.0.0.10", macbook, true},
+		{"10.0.0.0/24", printer, true},
+		{"fd00::13", raspberry, true},
+		{"00:00:00:00:00:10", macbook, true},
+		{"00:00:00:00:00:10", owned, false},
+		{"printer", printer, true},
+		{"printer.lan", printer, true},
+		{"vendor:hewlett", printer, true},
+		{"vendor:apple", printer, false},
+		{"meta:os=WINDOWS", printer, true},
+		{"tag:dc", owned, true},
+		{"tag:dc", macbook, false},
+		{"vendor:apple, !tag:owned", owned, false},
+		{"vendor:apple, !tag:owned", macbook, true},
+		{"!printer", printer, false},
+		{"!printer", raspberry, true},
+	}
+
+	for _, c := range cases {
+		targets, err := ParseTargetExpression(c.expr)
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s': %v", c.expr, err)
+		} else if got := targets.Match(c.host); got != c.matches {
+			t.Errorf("expected '%s' matching %s to be %v, got %v", c.expr, c.host.HwAddress, c.matches, got)
+		}
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	lan := buildTargetsLAN(t)
+	if list, err := ParseEndpoints("10.0.0.10, vendor:apple, printer", lan); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(list) != 3 {
+		t.Fatalf("expected 3 hosts, got %d", len(list))
+	}
+}
+
+func TestNextIP(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1":   "10.0.0.2",
+		"10.0.0.255": "10.0.1.0",
+		"fd00::ffff": "fd00::1:0",
+	}
+	for from, to := range cases {
+		if got := NextIP(net.ParseIP(from)); got.String() != to {
+			t.Errorf("expected %s after %s, got %s", to, from, got)
+		}
+	}
+}
@@ -156,6 +156,7 @@ func (w *WiFi) AddIfNew(ssid, mac string, frequency int, rssi int8) (*AccessPoin
 
 	newAp := NewAccessPoint(ssid, mac, frequency, rssi, w.aliases)
 	newAp.Alias = alias
+	GetAnnotations().Apply(newAp.Endpoint)
 	w.aps[mac] = newAp
 
 	if w.newCb != nil {
@@ -188,6 +189,31 @@ func (w *WiFi) GetClient(mac string) (*Station, bool) {
 	return nil, false
 }
 
+// Update calls cb with the endpoint of the access point and of the stations
+// with the given hardware address while holding the locks, returning false if
+// none of them is known.
+func (w *WiFi) Update(mac string, cb func(e *Endpoint)) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	mac = NormalizeMac(mac)
+	found := false
+	for bssid, ap := range w.aps {
+		ap.Lock()
+		if bssid == mac {
+			cb(ap.Endpoint)
+			found = true
+		}
+		if client, ok := ap.clients[mac]; ok {
+			cb(client.Endpoint)
+			found = true
+		}
+		ap.Unlock()
+	}
+
+	return found
+}
+
 func (w *WiFi) Clear() {
 	w.Lock()
 	defer w.Unlock()
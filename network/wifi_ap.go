@@ -91,6 +91,7 @@ func (ap *AccessPoint) AddClientIfNew(bssid string, frequency int, rssi int8) (*
 
 	s := NewStation("", bssid, frequency, rssi)
 	s.Alias = alias
+	GetAnnotations().Apply(s.Endpoint)
 	ap.clients[bssid] = s
 
 	return s, true
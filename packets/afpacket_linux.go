@@ -0,0 +1,293 @@
+package packets
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// the ring is made of afpacketBlocks blocks of afpacketBlockSize bytes
+	// each, a block is handed to userspace when it's full or when no packet
+	// has been added to it for afpacketBlockTimeout milliseconds
+	afpacketBlockSize    = 1 << 20
+	afpacketBlocks       = 8
+	afpacketFrameSize    = 1 << 11
+	afpacketBlockTimeout = 10
+	// how often a blocked read checks if the handle has been closed
+	afpacketPollTimeout = 100 * time.Millisecond
+
+	// offsets of the tpacket_hdr_v1 fields inside a tpacket_block_desc
+	blockStatusOffset  = 8
+	blockPacketsOffset = 12
+	blockFirstOffset   = 16
+)
+
+func init() {
+	RegisterCaptureBackend(afpacketBackend{})
+}
+
+// afpacketBackend captures with a TPACKET_V3 memory mapped ring, packets are
+// read from memory shared with the kernel without any system call as long
+// as there are full blocks to consume.
+type afpacketBackend struct{}
+
+func (b afpacketBackend) Name() string {
+	return "afpacket"
+}
+
+func htons(v uint16) uint16 {
+	return (v << 8) | (v >> 8)
+}
+
+// afpacketLinkType maps the ARPHRD_* type of an interface to a link type.
+func afpacketLinkType(iface string) layers.LinkType {
+	raw, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/type", iface))
+	if err != nil {
+		return layers.LinkTypeEthernet
+	}
+
+	hwType, _ := strconv.Atoi(strings.TrimSpace(string(raw)))
+	switch hwType {
+	case unix.ARPHRD_IEEE80211_RADIOTAP:
+		return layers.LinkTypeIEEE80211Radio
+	case unix.ARPHRD_NONE:
+		return layers.LinkTypeRaw
+	default:
+		return layers.LinkTypeEthernet
+	}
+}
+
+func (b afpacketBackend) Open(iface string, opts CaptureOptions) (error, Handle) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err, nil
+	}
+
+	linkType := afpacketLinkType(iface)
+	if opts.Monitor && linkType != layers.LinkTypeIEEE80211Radio {
+		return fmt.Errorf("interface %s is not in monitor mode and the afpacket backend can't enable it", iface), nil
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return fmt.Errorf("error while creating packet socket: %v", err), nil
+	}
+
+	h := &afpacketHandle{
+		fd:       fd,
+		linkType: linkType,
+		snaplen:  opts.Snaplen,
+	}
+
+	if err := h.setup(ifi, opts.Promisc); err != nil {
+		unix.Close(fd)
+		return err, nil
+	}
+
+	return nil, h
+}
+
+type afpacketHandle struct {
+	fd       int
+	ring     []byte
+	linkType layers.LinkType
+	snaplen  int
+
+	// serializes reads and protects the ring from being unmapped while
+	// it's in use
+	sync.Mutex
+	closed int32
+
+	block   int
+	pending uint32
+	offset  int
+	release bool
+}
+
+func (h *afpacketHandle) setup(ifi *net.Interface, promisc bool) error {
+	if err := unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3); err != nil {
+		return fmt.Errorf("TPACKET_V3 not supported: %v", err)
+	}
+
+	req := unix.TpacketReq3{
+		Block_size:     afpacketBlockSize,
+		Block_nr:       afpacketBlocks,
+		Frame_size:     afpacketFrameSize,
+		Frame_nr:       (afpacketBlockSize / afpacketFrameSize) * afpacketBlocks,
+		Retire_blk_tov: afpacketBlockTimeout,
+	}
+	if err := unix.SetsockoptTpacketReq3(h.fd, unix.SOL_PACKET, unix.PACKET_RX_RING, &req); err != nil {
+		return fmt.Errorf("error while setting up the ring: %v", err)
+	}
+
+	ring, err := unix.Mmap(h.fd, 0, afpacketBlockSize*afpacketBlocks, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_LOCKED)
+	if err != nil {
+		return fmt.Errorf("error while mapping the ring: %v", err)
+	}
+	h.ring = ring
+
+	addr := unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ALL),
+		Ifindex:  ifi.Index,
+	}
+	if err := unix.Bind(h.fd, &addr); err != nil {
+		unix.Munmap(h.ring)
+		return fmt.Errorf("error while binding to %s: %v", ifi.Name, err)
+	}
+
+	if promisc {
+		mreq := unix.PacketMreq{
+			Ifindex: int32(ifi.Index),
+			Type:    unix.PACKET_MR_PROMISC,
+		}
+		if err := unix.SetsockoptPacketMreq(h.fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+			unix.Munmap(h.ring)
+			return fmt.Errorf("error while enabling promiscuous mode: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (h *afpacketHandle) u32(offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&h.ring[offset]))
+}
+
+// ZeroCopyReadPacketData returns a packet pointing directly to the ring,
+// the data is only valid until the next call.
+func (h *afpacketHandle) ZeroCopyReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
+	h.Lock()
+	defer h.Unlock()
+
+	for {
+		if atomic.LoadInt32(&h.closed) != 0 {
+			return nil, ci, io.EOF
+		}
+
+		base := h.block * afpacketBlockSize
+		if h.release {
+			// give the block back to the kernel
+			atomic.StoreUint32(h.u32(base+blockStatusOffset), unix.TP_STATUS_KERNEL)
+			h.block = (h.block + 1) % afpacketBlocks
+			h.release = false
+			continue
+		}
+
+		if h.pending > 0 {
+			hdr := (*unix.Tpacket3Hdr)(unsafe.Pointer(&h.ring[h.offset]))
+			start := h.offset + int(hdr.Mac)
+			size := int(hdr.Snaplen)
+			if h.snaplen > 0 && size > h.snaplen {
+				size = h.snaplen
+			}
+
+			data = h.ring[start : start+size]
+			ci = gopacket.CaptureInfo{
+				Timestamp:     time.Unix(int64(hdr.Sec), int64(hdr.Nsec)),
+				CaptureLength: size,
+				Length:        int(hdr.Len),
+			}
+
+			h.offset += int(hdr.Next_offset)
+			h.pending--
+			h.release = h.pending == 0
+			return data, ci, nil
+		}
+
+		if atomic.LoadUint32(h.u32(base+blockStatusOffset))&unix.TP_STATUS_USER != 0 {
+			h.pending = atomic.LoadUint32(h.u32(base + blockPacketsOffset))
+			h.offset = base + int(atomic.LoadUint32(h.u32(base+blockFirstOffset)))
+			h.release = h.pending == 0
+			continue
+		}
+
+		fds := []unix.PollFd{{Fd: int32(h.fd), Events: unix.POLLIN | unix.POLLERR}}
+		if _, err = unix.Poll(fds, int(afpacketPollTimeout/time.Millisecond)); err != nil && err != unix.EINTR {
+			return nil, ci, err
+		}
+	}
+}
+
+func (h *afpacketHandle) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := h.ZeroCopyReadPacketData()
+	if err != nil {
+		return nil, ci, err
+	}
+	return append([]byte{}, data...), ci, nil
+}
+
+func (h *afpacketHandle) LinkType() layers.LinkType {
+	return h.linkType
+}
+
+// SetBPFFilter compiles expr with libpcap and attaches it to the socket so
+// that the packets are filtered by the kernel.
+func (h *afpacketHandle) SetBPFFilter(expr string) error {
+	if expr == "" {
+		return unix.SetsockoptInt(h.fd, unix.SOL_SOCKET, unix.SO_DETACH_FILTER, 0)
+	}
+
+	snaplen := h.snaplen
+	if snaplen <= 0 {
+		snaplen = SharedSnaplen
+	}
+
+	instructions, err := pcap.CompileBPFFilter(h.linkType, snaplen, expr)
+	if err != nil {
+		return err
+	} else if len(instructions) == 0 {
+		return fmt.Errorf("empty filter program for '%s'", expr)
+	}
+
+	filter := make([]unix.SockFilter, len(instructions))
+	for i, ins := range instructions {
+		filter[i] = unix.SockFilter{
+			Code: ins.Code,
+			Jt:   ins.Jt,
+			Jf:   ins.Jf,
+			K:    ins.K,
+		}
+	}
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	return unix.SetsockoptSockFprog(h.fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog)
+}
+
+func (h *afpacketHandle) WritePacketData(data []byte) error {
+	if atomic.LoadInt32(&h.closed) != 0 {
+		return fmt.Errorf("handle closed")
+	}
+	_, err := unix.Write(h.fd, data)
+	return err
+}
+
+func (h *afpacketHandle) Close() {
+	if !atomic.CompareAndSwapInt32(&h.closed, 0, 1) {
+		return
+	}
+
+	// wait for the pending read to notice the handle is closed
+	h.Lock()
+	defer h.Unlock()
+
+	unix.Munmap(h.ring)
+	h.ring = nil
+	unix.Close(h.fd)
+}
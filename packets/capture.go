@@ -0,0 +1,155 @@
+package packets
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Handle is a capture and injection handle as returned by a CaptureBackend,
+// *pcap.Handle satisfies it.
+type Handle interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+	SetBPFFilter(expr string) error
+	WritePacketData(data []byte) error
+	Close()
+}
+
+type CaptureOptions struct {
+	Snaplen int
+	Promisc bool
+	// maximum time a read blocks waiting for packets, zero means forever
+	Timeout time.Duration
+	// put the interface in monitor mode before capturing
+	Monitor bool
+}
+
+// CaptureBackend opens capture handles on network interfaces.
+type CaptureBackend interface {
+	Name() string
+	Open(iface string, opts CaptureOptions) (error, Handle)
+}
+
+const DefaultCaptureBackend = "pcap"
+
+var (
+	backendsLock   = sync.Mutex{}
+	backends       = make(map[string]CaptureBackend)
+	currentBackend = CaptureBackend(pcapBackend{})
+)
+
+func init() {
+	RegisterCaptureBackend(pcapBackend{})
+}
+
+// RegisterCaptureBackend makes a backend available to SetCaptureBackend.
+func RegisterCaptureBackend(backend CaptureBackend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[backend.Name()] = backend
+}
+
+// CaptureBackends returns the names of the registered backends.
+func CaptureBackends() []string {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetCaptureBackend selects the registered backend used by OpenCapture and
+// Subscribe, already opened handles are not affected.
+func SetCaptureBackend(name string) error {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	if backend, found := backends[name]; !found {
+		return fmt.Errorf("unknown capture backend '%s'", name)
+	} else {
+		currentBackend = backend
+	}
+	return nil
+}
+
+// UseCaptureBackend selects a backend without registering it.
+func UseCaptureBackend(backend CaptureBackend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	currentBackend = backend
+}
+
+func GetCaptureBackend() CaptureBackend {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	return currentBackend
+}
+
+// OpenCapture opens a handle on iface with the selected backend, the handle
+// is not shared so it should only be used when Subscribe is not an option.
+func OpenCapture(iface string, opts CaptureOptions) (error, Handle) {
+	return GetCaptureBackend().Open(iface, opts)
+}
+
+type pcapBackend struct{}
+
+const (
+	// Ugly, but gopacket folks are not exporting pcap errors, so ...
+	// ref. https://github.com/google/gopacket/blob/96986c90e3e5c7e01deed713ff8058e357c0c047/pcap/pcap.go#L281
+	ErrIfaceNotUp = "Interface Not Up"
+)
+
+func (b pcapBackend) Name() string {
+	return "pcap"
+}
+
+func (b pcapBackend) Open(iface string, opts CaptureOptions) (error, Handle) {
+	timeout := pcap.BlockForever
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	if !opts.Monitor {
+		handle, err := pcap.OpenLive(iface, int32(opts.Snaplen), opts.Promisc, timeout)
+		if err != nil {
+			return err, nil
+		}
+		return nil, handle
+	}
+
+	for retry := 0; ; retry++ {
+		ihandle, err := pcap.NewInactiveHandle(iface)
+		if err != nil {
+			return fmt.Errorf("error while opening interface %s: %s", iface, err), nil
+		}
+		defer ihandle.CleanUp()
+
+		if err = ihandle.SetRFMon(true); err != nil {
+			return fmt.Errorf("error while setting interface %s in monitor mode: %s", iface, err), nil
+		} else if err = ihandle.SetSnapLen(opts.Snaplen); err != nil {
+			return fmt.Errorf("error while settng span len: %s", err), nil
+		} else if err = ihandle.SetTimeout(timeout); err != nil {
+			return fmt.Errorf("error while setting timeout: %s", err), nil
+		} else if handle, err := ihandle.Activate(); err != nil {
+			if retry == 0 && err.Error() == ErrIfaceNotUp {
+				if err := network.ActivateInterface(iface); err != nil {
+					return err, nil
+				}
+				continue
+			}
+			return fmt.Errorf("error while activating handle: %s", err), nil
+		} else {
+			return nil, handle
+		}
+	}
+}
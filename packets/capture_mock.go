@@ -0,0 +1,167 @@
+package packets
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// MockBackend is an in-memory CaptureBackend used to test modules without
+// a real interface: the packets to read are injected or loaded from pcap
+// fixtures and the written ones are recorded.
+type MockBackend struct {
+	sync.Mutex
+	cond     *sync.Cond
+	linkType layers.LinkType
+	queue    []capturedPacket
+	written  [][]byte
+	done     bool
+	opened   int
+}
+
+func NewMockBackend(linkType layers.LinkType) *MockBackend {
+	m := &MockBackend{
+		linkType: linkType,
+		queue:    make([]capturedPacket, 0),
+		written:  make([][]byte, 0),
+	}
+	m.cond = sync.NewCond(&m.Mutex)
+	return m
+}
+
+func (m *MockBackend) Name() string {
+	return "mock"
+}
+
+func (m *MockBackend) Open(iface string, opts CaptureOptions) (error, Handle) {
+	m.Lock()
+	defer m.Unlock()
+	m.opened++
+	return nil, &mockHandle{backend: m}
+}
+
+// Opened returns how many handles have been opened so far.
+func (m *MockBackend) Opened() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.opened
+}
+
+// Inject queues a packet for the readers.
+func (m *MockBackend) Inject(data []byte) {
+	m.InjectWithInfo(data, gopacket.CaptureInfo{
+		CaptureLength: len(data),
+		Length:        len(data),
+	})
+}
+
+func (m *MockBackend) InjectWithInfo(data []byte, ci gopacket.CaptureInfo) {
+	m.Lock()
+	defer m.Unlock()
+	m.queue = append(m.queue, capturedPacket{data: data, ci: ci})
+	m.cond.Broadcast()
+}
+
+// Load queues every packet of a pcap file.
+func (m *MockBackend) Load(fileName string) error {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	reader, err := pcapgo.NewReader(fp)
+	if err != nil {
+		return err
+	}
+
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		m.InjectWithInfo(data, ci)
+	}
+}
+
+// Done makes the readers return io.EOF once the queued packets are consumed.
+func (m *MockBackend) Done() {
+	m.Lock()
+	defer m.Unlock()
+	m.done = true
+	m.cond.Broadcast()
+}
+
+// Written returns the packets written by the handles.
+func (m *MockBackend) Written() [][]byte {
+	m.Lock()
+	defer m.Unlock()
+	return append([][]byte{}, m.written...)
+}
+
+type mockHandle struct {
+	backend *MockBackend
+	filter  *pcap.BPF
+	closed  bool
+}
+
+func (h *mockHandle) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	m := h.backend
+	m.Lock()
+	defer m.Unlock()
+
+	for {
+		for len(m.queue) == 0 && !m.done && !h.closed {
+			m.cond.Wait()
+		}
+
+		if h.closed || len(m.queue) == 0 {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+
+		pkt := m.queue[0]
+		m.queue = m.queue[1:]
+		if h.filter == nil || h.filter.Matches(pkt.ci, pkt.data) {
+			return pkt.data, pkt.ci, nil
+		}
+	}
+}
+
+func (h *mockHandle) LinkType() layers.LinkType {
+	return h.backend.linkType
+}
+
+func (h *mockHandle) SetBPFFilter(expr string) (err error) {
+	var filter *pcap.BPF
+	if expr != "" {
+		if filter, err = pcap.NewBPF(h.backend.linkType, SharedSnaplen, expr); err != nil {
+			return
+		}
+	}
+
+	h.backend.Lock()
+	defer h.backend.Unlock()
+	h.filter = filter
+	return
+}
+
+func (h *mockHandle) WritePacketData(data []byte) error {
+	h.backend.Lock()
+	defer h.backend.Unlock()
+	h.backend.written = append(h.backend.written, append([]byte{}, data...))
+	return nil
+}
+
+func (h *mockHandle) Close() {
+	h.backend.Lock()
+	defer h.backend.Unlock()
+	h.closed = true
+	h.backend.cond.Broadcast()
+}
@@ -0,0 +1,218 @@
+package packets
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// withMockBackend selects a new mock backend and returns a function
+// restoring the previous one.
+func withMockBackend() (*MockBackend, func()) {
+	mock := NewMockBackend(layers.LinkTypeEthernet)
+	prev := GetCaptureBackend()
+	UseCaptureBackend(mock)
+	return mock, func() {
+		UseCaptureBackend(prev)
+	}
+}
+
+func readPacket(t *testing.T, h Handle) []byte {
+	done := make(chan []byte)
+	go func() {
+		data, _, err := h.ReadPacketData()
+		if err != nil {
+			data = nil
+		}
+		done <- data
+	}()
+
+	select {
+	case data := <-done:
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("timeout while reading packet")
+	}
+	return nil
+}
+
+func TestCaptureBackends(t *testing.T) {
+	if err := SetCaptureBackend("pcap"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := SetCaptureBackend("nope"); err == nil {
+		t.Fatal("expected error for unknown backend")
+	} else if name := GetCaptureBackend().Name(); name != "pcap" {
+		t.Fatalf("expected pcap backend, got %s", name)
+	}
+
+	found := false
+	for _, name := range CaptureBackends() {
+		if name == DefaultCaptureBackend {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("default backend not registered: %v", CaptureBackends())
+	}
+}
+
+func TestSubscribeFanOut(t *testing.T) {
+	mock, restore := withMockBackend()
+	defer restore()
+
+	err, a := Subscribe("mock0", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err, b := Subscribe("mock0", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opened := mock.Opened(); opened != 1 {
+		t.Fatalf("expected one shared handle, got %d", opened)
+	} else if a.LinkType() != layers.LinkTypeEthernet {
+		t.Fatalf("unexpected link type %v", a.LinkType())
+	}
+
+	pkt := []byte{1, 2, 3, 4}
+	mock.Inject(pkt)
+
+	for _, sub := range []*Subscription{a, b} {
+		if got := readPacket(t, sub); !bytes.Equal(got, pkt) {
+			t.Fatalf("expected %v, got %v", pkt, got)
+		}
+	}
+
+	if err := a.WritePacketData([]byte{5, 6}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if written := mock.Written(); len(written) != 1 || !bytes.Equal(written[0], []byte{5, 6}) {
+		t.Fatalf("unexpected written packets: %v", written)
+	}
+
+	a.Close()
+	if _, _, err := a.ReadPacketData(); err != io.EOF {
+		t.Fatalf("expected EOF from closed subscription, got %v", err)
+	}
+
+	mock.Inject(pkt)
+	if got := readPacket(t, b); !bytes.Equal(got, pkt) {
+		t.Fatalf("expected %v, got %v", pkt, got)
+	}
+
+	// the last subscriber closes the shared handle
+	b.Close()
+	err, c := Subscribe("mock0", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	if opened := mock.Opened(); opened != 2 {
+		t.Fatalf("expected a new handle, got %d", opened)
+	}
+}
+
+func TestSubscribeDrops(t *testing.T) {
+	mock, restore := withMockBackend()
+	defer restore()
+
+	err, sub := Subscribe("mock0", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Close()
+
+	for i := 0; i < SubscriptionBuffer+10; i++ {
+		mock.Inject([]byte{byte(i)})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for sub.Dropped() < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if dropped := sub.Dropped(); dropped != 10 {
+		t.Fatalf("expected 10 dropped packets, got %d", dropped)
+	}
+}
+
+func TestMockBackendFixture(t *testing.T) {
+	mock, restore := withMockBackend()
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "bettercap-capture")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture := filepath.Join(dir, "fixture.pcap")
+	fp, err := os.Create(fixture)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	eth := layers.Ethernet{
+		SrcMAC:       []byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		DstMAC:       []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeARP,
+	}
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   eth.SrcMAC,
+		SourceProtAddress: []byte{192, 168, 1, 2},
+		DstHwAddress:      []byte{0, 0, 0, 0, 0, 0},
+		DstProtAddress:    []byte{192, 168, 1, 1},
+	}
+	err, raw := Serialize(&eth, &arp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := pcapgo.NewWriter(fp)
+	w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	for i := 0; i < 3; i++ {
+		w.WritePacket(gopacket.CaptureInfo{
+			Timestamp:     time.Now(),
+			CaptureLength: len(raw),
+			Length:        len(raw),
+		}, raw)
+	}
+	fp.Close()
+
+	if err := mock.Load(fixture); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mock.Done()
+
+	err, sub := Subscribe("mock0", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Close()
+
+	requests := 0
+	src := gopacket.NewPacketSource(sub, sub.LinkType())
+	for pkt := range src.Packets() {
+		if req, ok := pkt.Layer(layers.LayerTypeARP).(*layers.ARP); ok && req.Operation == layers.ARPRequest {
+			requests++
+		}
+	}
+
+	if requests != 3 {
+		t.Fatalf("expected 3 arp requests, got %d", requests)
+	}
+}
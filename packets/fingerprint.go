@@ -0,0 +1,884 @@
+package packets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Passive fingerprinting of hosts from the traffic they send. Signatures
+// use the p0f v3 format (https://github.com/p0f/p0f/blob/master/docs/README),
+// of which only the [tcp:request] section is supported, extended with:
+//
+//   [dhcp]             comma separated list of DHCP option 55 codes
+//   [dhcp:vendor]      regexp matching DHCP option 60
+//   [http:user-agent]  regexp matching the User-Agent of HTTP requests
+//   [device]           regexp matching mdns:<key>=<value> and upnp:<header>=<value>
+//
+// Every label can be followed by "device = ..." and "model = ..." lines and
+// for the regexp sections $1 to $9 in the name, flavor and model are
+// expanded with the submatches.
+
+// how many hops a tcp signature initial ttl can be from the observed one
+const fingerprintMaxDistance = 35
+
+// how much a match from every section can be trusted
+var fingerprintConfidence = map[string]int{
+	"tcp:request":     50,
+	"dhcp":            70,
+	"dhcp:vendor":     60,
+	"http:user-agent": 80,
+	"device":          90,
+}
+
+type fingerprintLabel struct {
+	generic bool
+	app     bool
+	name    string
+	flavor  string
+	device  string
+	model   string
+}
+
+// type:class:name:flavor
+func parseFingerprintLabel(value string) (*fingerprintLabel, error) {
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) != 4 || (parts[0] != "s" && parts[0] != "g") || parts[2] == "" {
+		return nil, fmt.Errorf("invalid label '%s'", value)
+	}
+	return &fingerprintLabel{
+		generic: parts[0] == "g",
+		app:     parts[1] == "!",
+		name:    parts[2],
+		flavor:  parts[3],
+	}, nil
+}
+
+const (
+	wsizeAny = iota
+	wsizeValue
+	wsizeMSS
+	wsizeMTU
+	wsizeMod
+)
+
+type tcpSignature struct {
+	label     *fingerprintLabel
+	ver       int
+	ittl      int
+	guessed   bool
+	olen      int
+	mss       int
+	wsizeType int
+	wsize     int
+	scale     int
+	layout    string
+	quirks    []string
+	pclass    int
+}
+
+// -1 for *
+func parseWildcard(value string) (int, error) {
+	if value == "*" {
+		return -1, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// ver:ittl:olen:mss:wsize,scale:olayout:quirks:pclass
+func parseTCPSignature(value string) (sig *tcpSignature, err error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 8 {
+		return nil, fmt.Errorf("invalid tcp signature '%s'", value)
+	}
+
+	sig = &tcpSignature{}
+	switch parts[0] {
+	case "4", "6":
+		sig.ver, _ = strconv.Atoi(parts[0])
+	case "*":
+		sig.ver = -1
+	default:
+		return nil, fmt.Errorf("invalid ip version '%s'", parts[0])
+	}
+
+	// 64, 54+10 or 64- when the initial ttl has been guessed
+	ittl := parts[1]
+	if strings.HasSuffix(ittl, "-") {
+		sig.guessed = true
+		ittl = ittl[:len(ittl)-1]
+	}
+	for _, n := range strings.Split(ittl, "+") {
+		v, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl '%s'", parts[1])
+		}
+		sig.ittl += v
+	}
+
+	if sig.olen, err = parseWildcard(parts[2]); err != nil {
+		return nil, fmt.Errorf("invalid options length '%s'", parts[2])
+	} else if sig.mss, err = parseWildcard(parts[3]); err != nil {
+		return nil, fmt.Errorf("invalid mss '%s'", parts[3])
+	}
+
+	window := strings.Split(parts[4], ",")
+	if len(window) != 2 {
+		return nil, fmt.Errorf("invalid window '%s'", parts[4])
+	} else if sig.scale, err = parseWildcard(window[1]); err != nil {
+		return nil, fmt.Errorf("invalid window scale '%s'", window[1])
+	}
+
+	wsize := window[0]
+	switch {
+	case wsize == "*":
+		sig.wsizeType = wsizeAny
+	case strings.HasPrefix(wsize, "mss*"):
+		sig.wsizeType = wsizeMSS
+		sig.wsize, err = strconv.Atoi(wsize[4:])
+	case strings.HasPrefix(wsize, "mtu*"):
+		sig.wsizeType = wsizeMTU
+		sig.wsize, err = strconv.Atoi(wsize[4:])
+	case strings.HasPrefix(wsize, "%"):
+		sig.wsizeType = wsizeMod
+		if sig.wsize, err = strconv.Atoi(wsize[1:]); err == nil && sig.wsize == 0 {
+			err = fmt.Errorf("division by zero")
+		}
+	default:
+		sig.wsizeType = wsizeValue
+		sig.wsize, err = strconv.Atoi(wsize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid window size '%s'", wsize)
+	}
+
+	sig.layout = parts[5]
+	if parts[6] != "" {
+		sig.quirks = strings.Split(parts[6], ",")
+		sort.Strings(sig.quirks)
+	}
+
+	switch parts[7] {
+	case "0":
+		sig.pclass = 0
+	case "+":
+		sig.pclass = 1
+	case "*":
+		sig.pclass = -1
+	default:
+		return nil, fmt.Errorf("invalid payload class '%s'", parts[7])
+	}
+
+	return sig, nil
+}
+
+// what a tcp SYN looks like in the same terms of a signature
+type tcpObservation struct {
+	ver     int
+	ttl     int
+	olen    int
+	mss     int
+	wsize   int
+	scale   int
+	layout  string
+	quirks  []string
+	payload bool
+}
+
+func observeTCP(pkt gopacket.Packet) *tcpObservation {
+	ltcp := pkt.Layer(layers.LayerTypeTCP)
+	if ltcp == nil {
+		return nil
+	}
+
+	tcp := ltcp.(*layers.TCP)
+	if !tcp.SYN || tcp.ACK || len(tcp.Contents) < 20 {
+		return nil
+	}
+
+	obs := &tcpObservation{
+		wsize:   int(tcp.Window),
+		payload: len(tcp.Payload) > 0,
+	}
+	quirks := make(map[string]bool)
+
+	if l4 := pkt.Layer(layers.LayerTypeIPv4); l4 != nil {
+		ip4 := l4.(*layers.IPv4)
+		obs.ver = 4
+		obs.ttl = int(ip4.TTL)
+		obs.olen = int(ip4.IHL)*4 - 20
+		df := ip4.Flags&layers.IPv4DontFragment != 0
+		quirks["df"] = df
+		quirks["id+"] = df && ip4.Id != 0
+		quirks["id-"] = !df && ip4.Id == 0
+		quirks["ecn"] = ip4.TOS&3 != 0
+		quirks["0+"] = ip4.Flags&layers.IPv4EvilBit != 0
+	} else if l6 := pkt.Layer(layers.LayerTypeIPv6); l6 != nil {
+		ip6 := l6.(*layers.IPv6)
+		obs.ver = 6
+		obs.ttl = int(ip6.HopLimit)
+		quirks["ecn"] = ip6.TrafficClass&3 != 0
+		quirks["flow"] = ip6.FlowLabel != 0
+	} else {
+		return nil
+	}
+
+	quirks["ecn"] = quirks["ecn"] || tcp.ECE || tcp.CWR
+	quirks["seq-"] = tcp.Seq == 0
+	quirks["ack+"] = tcp.Ack != 0
+	quirks["uptr"] = !tcp.URG && tcp.Urgent != 0
+	quirks["urgf+"] = tcp.URG
+	quirks["pushf+"] = tcp.PSH
+
+	// options are parsed from the raw header as we need the padding after
+	// the end of list and the broken ones
+	end := int(tcp.DataOffset) * 4
+	if end > len(tcp.Contents) {
+		end = len(tcp.Contents)
+	}
+	opts := tcp.Contents[20:end]
+	layout := make([]string, 0)
+	for i := 0; i < len(opts); {
+		kind := opts[i]
+		if kind == 0 {
+			rest := opts[i+1:]
+			layout = append(layout, fmt.Sprintf("eol+%d", len(rest)))
+			quirks["opt+"] = len(bytes.Trim(rest, "\x00")) > 0
+			break
+		} else if kind == 1 {
+			layout = append(layout, "nop")
+			i++
+			continue
+		} else if i+1 >= len(opts) || opts[i+1] < 2 || i+int(opts[i+1]) > len(opts) {
+			quirks["bad"] = true
+			break
+		}
+
+		size := int(opts[i+1])
+		data := opts[i+2 : i+size]
+		switch kind {
+		case 2:
+			layout = append(layout, "mss")
+			if len(data) == 2 {
+				obs.mss = int(binary.BigEndian.Uint16(data))
+			}
+		case 3:
+			layout = append(layout, "ws")
+			if len(data) == 1 {
+				obs.scale = int(data[0])
+				quirks["exws"] = obs.scale > 14
+			}
+		case 4:
+			layout = append(layout, "sok")
+		case 5:
+			layout = append(layout, "sack")
+		case 8:
+			layout = append(layout, "ts")
+			if len(data) == 8 {
+				quirks["ts1-"] = binary.BigEndian.Uint32(data[:4]) == 0
+				quirks["ts2+"] = binary.BigEndian.Uint32(data[4:]) != 0
+			}
+		default:
+			layout = append(layout, fmt.Sprintf("?%d", kind))
+		}
+		i += size
+	}
+	obs.layout = strings.Join(layout, ",")
+
+	for quirk, set := range quirks {
+		if set {
+			obs.quirks = append(obs.quirks, quirk)
+		}
+	}
+	sort.Strings(obs.quirks)
+
+	return obs
+}
+
+func (sig *tcpSignature) Match(obs *tcpObservation) bool {
+	if sig.ver != -1 && sig.ver != obs.ver {
+		return false
+	} else if obs.ttl > sig.ittl || (!sig.guessed && sig.ittl-obs.ttl > fingerprintMaxDistance) {
+		return false
+	} else if sig.olen != -1 && sig.olen != obs.olen {
+		return false
+	} else if sig.mss != -1 && sig.mss != obs.mss {
+		return false
+	} else if sig.scale != -1 && sig.scale != obs.scale {
+		return false
+	} else if sig.layout != obs.layout {
+		return false
+	} else if sig.pclass != -1 && (sig.pclass == 1) != obs.payload {
+		return false
+	}
+
+	switch sig.wsizeType {
+	case wsizeValue:
+		if obs.wsize != sig.wsize {
+			return false
+		}
+	case wsizeMSS:
+		if obs.mss == 0 || obs.wsize != obs.mss*sig.wsize {
+			return false
+		}
+	case wsizeMTU:
+		mtu := obs.mss + 40
+		if obs.ver == 6 {
+			mtu = obs.mss + 60
+		}
+		if obs.mss == 0 || obs.wsize != mtu*sig.wsize {
+			return false
+		}
+	case wsizeMod:
+		if obs.wsize%sig.wsize != 0 {
+			return false
+		}
+	}
+
+	// ipv4 only quirks are ignored for ipv6 packets
+	quirks := make([]string, 0, len(sig.quirks))
+	for _, quirk := range sig.quirks {
+		if obs.ver == 4 || (quirk != "df" && quirk != "id+" && quirk != "id-") {
+			quirks = append(quirks, quirk)
+		}
+	}
+	return strings.Join(quirks, ",") == strings.Join(obs.quirks, ",")
+}
+
+type regexpSignature struct {
+	label   *fingerprintLabel
+	pattern *regexp.Regexp
+}
+
+// Fingerprints is a signature database.
+type Fingerprints struct {
+	tcp     []*tcpSignature
+	dhcp    map[string]*fingerprintLabel
+	regexps map[string][]*regexpSignature
+	Skipped int
+}
+
+func NewFingerprints() *Fingerprints {
+	return &Fingerprints{
+		tcp:     make([]*tcpSignature, 0),
+		dhcp:    make(map[string]*fingerprintLabel),
+		regexps: make(map[string][]*regexpSignature),
+	}
+}
+
+func LoadFingerprints(fileName string) (*Fingerprints, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return ParseFingerprints(fp)
+}
+
+// normalizes a list of dhcp options
+func dhcpOptionList(value string) (string, error) {
+	codes := make([]string, 0)
+	for _, code := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil || n < 0 || n > 255 {
+			return "", fmt.Errorf("invalid dhcp option '%s'", code)
+		}
+		codes = append(codes, strconv.Itoa(n))
+	}
+	return strings.Join(codes, ","), nil
+}
+
+func ParseFingerprints(r io.Reader) (*Fingerprints, error) {
+	db := NewFingerprints()
+
+	var label *fingerprintLabel
+	section := ""
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		} else if line[0] == '[' && line[len(line)-1] == ']' {
+			section = line[1 : len(line)-1]
+			label = nil
+			continue
+		}
+
+		idx := strings.IndexByte(line, '=')
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key, value := strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+
+		// sections we don't support, such as p0f's mtu and http ones
+		if _, found := fingerprintConfidence[section]; !found {
+			if key == "sig" {
+				db.Skipped++
+			}
+			continue
+		}
+
+		var err error
+		switch key {
+		case "label":
+			label, err = parseFingerprintLabel(value)
+		case "sys":
+			// only used by p0f for application labels
+		case "device", "model", "sig":
+			if label == nil {
+				err = fmt.Errorf("%s outside of a label", key)
+			} else if key == "device" {
+				label.device = value
+			} else if key == "model" {
+				label.model = value
+			} else if section == "tcp:request" {
+				var sig *tcpSignature
+				if sig, err = parseTCPSignature(value); err == nil {
+					sig.label = label
+					db.tcp = append(db.tcp, sig)
+				}
+			} else if section == "dhcp" {
+				var options string
+				if options, err = dhcpOptionList(value); err == nil {
+					db.dhcp[options] = label
+				}
+			} else {
+				var pattern *regexp.Regexp
+				if pattern, err = regexp.Compile(value); err == nil {
+					db.regexps[section] = append(db.regexps[section], &regexpSignature{
+						label:   label,
+						pattern: pattern,
+					})
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown key %s", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Merge adds the signatures of another database to this one.
+func (db *Fingerprints) Merge(other *Fingerprints) {
+	db.tcp = append(db.tcp, other.tcp...)
+	for options, label := range other.dhcp {
+		db.dhcp[options] = label
+	}
+	for section, sigs := range other.regexps {
+		db.regexps[section] = append(db.regexps[section], sigs...)
+	}
+	db.Skipped += other.Skipped
+}
+
+// Size returns the number of signatures in the database.
+func (db *Fingerprints) Size() int {
+	size := len(db.tcp) + len(db.dhcp)
+	for _, sigs := range db.regexps {
+		size += len(sigs)
+	}
+	return size
+}
+
+// FingerprintMatch is what a single signature tells us about a host.
+type FingerprintMatch struct {
+	Source     string
+	Family     string
+	OS         string
+	Device     string
+	Model      string
+	Confidence int
+}
+
+// expands $1 to $9 with the submatches
+func expandFingerprint(template string, submatches []string) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+	for i := len(submatches) - 1; i > 0 && i <= 9; i-- {
+		template = strings.Replace(template, "$"+strconv.Itoa(i), submatches[i], -1)
+	}
+	return strings.TrimSpace(template)
+}
+
+func newFingerprintMatch(source string, label *fingerprintLabel, submatches []string) *FingerprintMatch {
+	m := &FingerprintMatch{
+		Source:     source,
+		Device:     label.device,
+		Model:      expandFingerprint(label.model, submatches),
+		Confidence: fingerprintConfidence[source],
+	}
+
+	name := expandFingerprint(label.name, submatches)
+	full := name
+	if flavor := expandFingerprint(label.flavor, submatches); flavor != "" {
+		full += " " + flavor
+	}
+
+	if label.app {
+		// applications tell us what the device is, not its OS
+		if m.Model == "" {
+			m.Model = full
+		}
+	} else {
+		m.Family = name
+		m.OS = full
+	}
+
+	if label.generic {
+		m.Confidence -= 20
+	}
+	return m
+}
+
+func (db *Fingerprints) matchTCP(obs *tcpObservation) *FingerprintMatch {
+	var generic *FingerprintMatch
+	for _, sig := range db.tcp {
+		if sig.Match(obs) {
+			if !sig.label.generic {
+				return newFingerprintMatch("tcp:request", sig.label, nil)
+			} else if generic == nil {
+				generic = newFingerprintMatch("tcp:request", sig.label, nil)
+			}
+		}
+	}
+	return generic
+}
+
+func (db *Fingerprints) matchDHCP(options []int) *FingerprintMatch {
+	codes := make([]string, len(options))
+	for i, code := range options {
+		codes[i] = strconv.Itoa(code)
+	}
+	if label, found := db.dhcp[strings.Join(codes, ",")]; found {
+		return newFingerprintMatch("dhcp", label, nil)
+	}
+	return nil
+}
+
+// returns the best match of any of the values, specific signatures win
+// over generic ones
+func (db *Fingerprints) matchRegexp(section string, values ...string) *FingerprintMatch {
+	var generic *FingerprintMatch
+	for _, sig := range db.regexps[section] {
+		for _, value := range values {
+			if submatches := sig.pattern.FindStringSubmatch(value); submatches != nil {
+				if !sig.label.generic {
+					return newFingerprintMatch(section, sig.label, submatches)
+				} else if generic == nil {
+					generic = newFingerprintMatch(section, sig.label, submatches)
+				}
+			}
+		}
+	}
+	return generic
+}
+
+// Fingerprint is what all the matches tell us about a host.
+type Fingerprint struct {
+	OS         string   `json:"os"`
+	Device     string   `json:"device"`
+	Model      string   `json:"model"`
+	Confidence int      `json:"confidence"`
+	Sources    []string `json:"sources"`
+}
+
+func newFingerprint(matches map[string]*FingerprintMatch) *Fingerprint {
+	sorted := make([]*FingerprintMatch, 0, len(matches))
+	for _, m := range matches {
+		sorted = append(sorted, m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Confidence == sorted[j].Confidence {
+			return sorted[i].Source < sorted[j].Source
+		}
+		return sorted[i].Confidence > sorted[j].Confidence
+	})
+
+	// the os family with the most confidence wins
+	votes := make(map[string]int)
+	family := ""
+	for _, m := range sorted {
+		if m.Family != "" {
+			votes[m.Family] += m.Confidence
+			if family == "" || votes[m.Family] > votes[family] {
+				family = m.Family
+			}
+		}
+	}
+
+	fp := &Fingerprint{
+		Sources: make([]string, 0, len(sorted)),
+	}
+	agree, disagree := 0, 0
+	for _, m := range sorted {
+		fp.Sources = append(fp.Sources, m.Source)
+		if m.Family != "" && m.Family != family {
+			disagree++
+			continue
+		} else if m.Family != "" {
+			agree++
+			// prefer the most specific version
+			if fp.OS == "" || (fp.OS == family && m.OS != family) {
+				fp.OS = m.OS
+			}
+		}
+
+		if fp.Confidence == 0 {
+			fp.Confidence = m.Confidence
+		}
+		if fp.Device == "" {
+			fp.Device = m.Device
+		}
+		if fp.Model == "" {
+			fp.Model = m.Model
+		}
+	}
+	sort.Strings(fp.Sources)
+
+	if agree > 1 {
+		fp.Confidence += 10 * (agree - 1)
+	}
+	fp.Confidence -= 15 * disagree
+	if fp.Confidence > 100 {
+		fp.Confidence = 100
+	} else if fp.Confidence < 1 {
+		fp.Confidence = 1
+	}
+
+	return fp
+}
+
+// Meta returns the fingerprint as endpoint meta data.
+func (fp *Fingerprint) Meta() map[string]string {
+	meta := map[string]string{
+		"fingerprint:confidence": strconv.Itoa(fp.Confidence),
+		"fingerprint:sources":    strings.Join(fp.Sources, ","),
+	}
+	if fp.OS != "" {
+		meta["fingerprint:os"] = fp.OS
+	}
+	if fp.Device != "" {
+		meta["fingerprint:device"] = fp.Device
+	}
+	if fp.Model != "" {
+		meta["fingerprint:model"] = fp.Model
+	}
+	return meta
+}
+
+// Fingerprinter matches the traffic of the hosts against a signature
+// database, keeping the best match of every source for each host.
+type Fingerprinter struct {
+	sync.Mutex
+	DB *Fingerprints
+	// if set, hosts are only fingerprinted by the IP traffic coming from
+	// these networks (or from ipv6 link local addresses), so that what is
+	// routed through the gateway isn't attributed to it
+	Networks []*net.IPNet
+	// hardware addresses to ignore, such as our own
+	Ignore map[string]bool
+
+	hosts map[string]map[string]*FingerprintMatch
+}
+
+func NewFingerprinter(db *Fingerprints) *Fingerprinter {
+	return &Fingerprinter{
+		DB:     db,
+		Ignore: make(map[string]bool),
+		hosts:  make(map[string]map[string]*FingerprintMatch),
+	}
+}
+
+func (f *Fingerprinter) isLocal(pkt gopacket.Packet) bool {
+	if len(f.Networks) == 0 {
+		return true
+	}
+
+	var ip net.IP
+	if l4 := pkt.Layer(layers.LayerTypeIPv4); l4 != nil {
+		ip = l4.(*layers.IPv4).SrcIP
+	} else if l6 := pkt.Layer(layers.LayerTypeIPv6); l6 != nil {
+		if ip = l6.(*layers.IPv6).SrcIP; ip.IsLinkLocalUnicast() {
+			return true
+		}
+	} else {
+		return false
+	}
+
+	for _, network := range f.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// headers of SSDP requests such as NOTIFY and M-SEARCH, responses are
+// parsed by UPNPGetMeta
+func ssdpRequestMeta(udp *layers.UDP) map[string]string {
+	if udp.DstPort != UPNPPort || len(udp.Payload) == 0 {
+		return nil
+	}
+
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(udp.Payload)))
+	if err != nil {
+		return nil
+	}
+
+	meta := make(map[string]string)
+	for name, values := range request.Header {
+		if len(values) > 0 {
+			meta["upnp:"+name] = strings.Join(values, ", ")
+		}
+	}
+	return meta
+}
+
+func userAgent(payload []byte) string {
+	if len(payload) == 0 || payload[0] < 'A' || payload[0] > 'Z' {
+		return ""
+	} else if request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(payload))); err == nil {
+		return request.UserAgent()
+	}
+	return ""
+}
+
+func (f *Fingerprinter) matchDHCP(dhcp *layers.DHCPv4) []*FingerprintMatch {
+	matches := make([]*FingerprintMatch, 0)
+	for _, opt := range dhcp.Options {
+		var m *FingerprintMatch
+		if opt.Type == layers.DHCPOptParamsRequest {
+			options := make([]int, len(opt.Data))
+			for i, code := range opt.Data {
+				options[i] = int(code)
+			}
+			m = f.DB.matchDHCP(options)
+		} else if opt.Type == layers.DHCPOptClassID {
+			m = f.DB.matchRegexp("dhcp:vendor", string(opt.Data))
+		}
+
+		if m != nil {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+func (f *Fingerprinter) matchTraffic(pkt gopacket.Packet) []*FingerprintMatch {
+	matches := make([]*FingerprintMatch, 0)
+	if obs := observeTCP(pkt); obs != nil {
+		if m := f.DB.matchTCP(obs); m != nil {
+			matches = append(matches, m)
+		}
+	}
+
+	if ltcp := pkt.Layer(layers.LayerTypeTCP); ltcp != nil {
+		if ua := userAgent(ltcp.(*layers.TCP).Payload); ua != "" {
+			if m := f.DB.matchRegexp("http:user-agent", ua); m != nil {
+				matches = append(matches, m)
+			}
+		}
+	} else if ludp := pkt.Layer(layers.LayerTypeUDP); ludp != nil {
+		meta := MDNSGetMeta(pkt)
+		if meta == nil {
+			if meta = UPNPGetMeta(pkt); meta == nil {
+				meta = ssdpRequestMeta(ludp.(*layers.UDP))
+			}
+		}
+
+		if len(meta) > 0 {
+			values := make([]string, 0, len(meta))
+			for key, value := range meta {
+				values = append(values, key+"="+value)
+			}
+			sort.Strings(values)
+			if m := f.DB.matchRegexp("device", values...); m != nil {
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	return matches
+}
+
+// Process returns the hardware address of the host the packet tells us
+// something about and its updated fingerprint, or nil if nothing matched.
+func (f *Fingerprinter) Process(pkt gopacket.Packet) (string, *Fingerprint) {
+	leth := pkt.Layer(layers.LayerTypeEthernet)
+	if leth == nil {
+		return "", nil
+	}
+
+	mac := leth.(*layers.Ethernet).SrcMAC.String()
+	if f.Ignore[mac] {
+		return "", nil
+	}
+
+	var matches []*FingerprintMatch
+	if ldhcp := pkt.Layer(layers.LayerTypeDHCPv4); ldhcp != nil {
+		dhcp := ldhcp.(*layers.DHCPv4)
+		if dhcp.Operation != layers.DHCPOpRequest {
+			return "", nil
+		} else if len(dhcp.ClientHWAddr) == 6 {
+			mac = dhcp.ClientHWAddr.String()
+		}
+		matches = f.matchDHCP(dhcp)
+	} else if f.isLocal(pkt) {
+		matches = f.matchTraffic(pkt)
+	}
+
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	host, found := f.hosts[mac]
+	if !found {
+		host = make(map[string]*FingerprintMatch)
+		f.hosts[mac] = host
+	}
+	for _, m := range matches {
+		if prev, found := host[m.Source]; !found || m.Confidence >= prev.Confidence {
+			host[m.Source] = m
+		}
+	}
+
+	return mac, newFingerprint(host)
+}
+
+// Get returns the fingerprint of the host or nil if we don't know anything
+// about it.
+func (f *Fingerprinter) Get(mac string) *Fingerprint {
+	f.Lock()
+	defer f.Unlock()
+
+	if host, found := f.hosts[mac]; found {
+		return newFingerprint(host)
+	}
+	return nil
+}
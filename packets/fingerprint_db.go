@@ -0,0 +1,279 @@
+package packets
+
+import (
+	"strings"
+	"sync"
+)
+
+// A small set of signatures for the most common systems, more can be loaded
+// from files in the same format, including p0f.fp itself.
+const builtinFingerprints = `
+[tcp:request]
+
+label = s:unix:Linux:3.11 and newer
+sig   = *:64:0:*:mss*20,10:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*20,7:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*20,10:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:mss*20,7:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:mss*44,7:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*44,7:mss,sok,ts,nop,ws:df:0
+
+label = s:unix:Linux:3.1-3.10
+sig   = *:64:0:*:mss*10,4:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*10,5:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*10,6:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*10,7:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.6.x
+sig   = *:64:0:*:mss*4,6:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*4,7:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*4,8:mss,sok,ts,nop,ws:df,id+:0
+
+label = g:unix:Linux:
+sig   = *:64:0:*:*,*:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:*,*:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:*,*:mss,nop,nop,sok,nop,ws:df,id+:0
+
+label = s:win:Windows:XP
+sig   = *:128:0:*:16384,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,0:mss,nop,nop,sok:df,id+:0
+
+label = s:win:Windows:7 or 8
+sig   = *:128:0:*:8192,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:8192,2:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:8192,8:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = s:win:Windows:10 or 11
+sig   = *:128:0:*:64240,8:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,8:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = g:win:Windows:
+sig   = *:128:0:*:*,*:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:*,*:mss,nop,nop,sok:df,id+:0
+
+label = s:unix:Mac OS X:
+sig   = *:64:0:*:65535,1:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,3:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,4:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,5:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,6:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = s:unix:iOS:
+sig   = *:64:0:*:65535,2:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = s:unix:FreeBSD:9.x or newer
+sig   = *:64:0:*:65535,6:mss,nop,ws,sok,ts:df,id+:0
+sig   = *:64:0:*:65535,6:mss,nop,ws,sok,ts:df:0
+
+label = s:unix:OpenBSD:
+sig   = *:64:0:*:16384,3:mss,nop,nop,sok,nop,ws,nop,nop,ts:df,id+:0
+sig   = *:64:0:*:16384,6:mss,nop,nop,sok,nop,ws,nop,nop,ts:df,id+:0
+
+label = s:!:NMap:SYN scan
+sig   = *:64-:0:1460:1024,0:mss::0
+sig   = *:64-:0:1460:2048,0:mss::0
+sig   = *:64-:0:1460:3072,0:mss::0
+sig   = *:64-:0:1460:4096,0:mss::0
+
+[dhcp]
+
+label = s:win:Windows:10 or 11
+device = computer
+sig   = 1,3,6,15,31,33,43,44,46,47,119,121,249,252
+
+label = s:win:Windows:7 or 8
+device = computer
+sig   = 1,15,3,6,44,46,47,31,33,121,249,43,252
+sig   = 1,15,3,6,44,46,47,31,33,121,249,43
+
+label = s:win:Windows:XP
+device = computer
+sig   = 1,15,3,6,44,46,47,31,33,249,43
+sig   = 1,15,3,6,44,46,47,31,33,249,43,252
+
+label = s:unix:Android:
+device = phone
+sig   = 1,3,6,15,26,28,51,58,59,43
+sig   = 1,3,6,15,26,28,51,58,59,43,114
+sig   = 1,3,6,15,26,28,51,58,59
+sig   = 1,121,33,3,6,15,28,51,58,59
+sig   = 1,33,3,6,15,28,51,58,59
+
+label = s:unix:iOS:
+device = phone
+sig   = 1,121,3,6,15,119,252
+sig   = 1,121,3,6,15,108,114,119,252
+
+label = s:unix:Mac OS X:
+device = computer
+sig   = 1,121,3,6,15,119,252,95,44,46
+sig   = 1,121,3,6,15,108,114,119,252,95,44,46
+sig   = 1,3,6,15,119,95,252,44,46,101
+
+label = s:unix:Linux:
+device = computer
+sig   = 1,28,2,3,15,6,119,12,44,47,26,121,42
+sig   = 1,28,2,3,15,6,119,12,44,47,26,121,42,121,249,33,252,42
+sig   = 1,3,6,12,15,28,42,51,54,58,59,119,121
+sig   = 1,3,6,12,15,28,42,121
+
+label = g:unix:Linux:
+device = embedded
+sig   = 1,3,6,12,15,28,42
+sig   = 1,3,6,12,15,28,40,41,42
+
+[dhcp:vendor]
+
+label = s:win:Windows:
+sig   = ^MSFT 5\.0
+
+label = s:unix:Android:$1
+device = phone
+sig   = ^android-dhcp-([\d.]+)
+
+label = g:unix:Linux:
+sig   = ^dhcpcd-[\d.]+:Linux
+
+label = g:unix:Linux:
+device = embedded
+sig   = ^udhcp
+
+[http:user-agent]
+
+label = s:unix:iOS:$1.$2
+device = phone
+model = iPhone
+sig   = iPhone; CPU iPhone OS (\d+)_(\d+)
+
+label = s:unix:iOS:$1.$2
+device = tablet
+model = iPad
+sig   = iPad; CPU OS (\d+)_(\d+)
+
+label = s:unix:Android:$1
+device = phone
+model = $2
+sig   = Android ([\d.]+); (?:[a-z]{2}[-_][a-zA-Z]{2}; )?([^;)]+?)(?: Build/[^;)]*)?\)
+
+label = s:unix:Android:$1
+device = phone
+sig   = Android ([\d.]+)
+
+label = s:unix:Chrome OS:
+device = computer
+sig   = CrOS
+
+label = s:win:Windows:10 or 11
+device = computer
+sig   = Windows NT 10\.0
+
+label = s:win:Windows:8
+device = computer
+sig   = Windows NT 6\.[23]
+
+label = s:win:Windows:7
+device = computer
+sig   = Windows NT 6\.1
+
+label = s:unix:Mac OS X:$1.$2
+device = computer
+sig   = Macintosh; Intel Mac OS X (\d+)[_.](\d+)
+
+label = s:!:Sony PlayStation:$1
+device = game console
+sig   = PlayStation (\d)
+
+label = s:win:Xbox:
+device = game console
+sig   = Xbox
+
+label = s:unix:Tizen:
+device = tv
+sig   = SMART-TV.*Tizen
+
+label = s:unix:webOS:
+device = tv
+sig   = Web0S|webOS
+
+label = s:!:Roku:
+device = media player
+sig   = ^Roku/
+
+label = g:unix:Linux:
+device = computer
+sig   = X11; (?:Ubuntu; |Fedora; )?Linux
+
+[device]
+
+label = s:unix:iOS:
+device = phone
+model = $1
+sig   = ^mdns:model=(iPhone[\d,]+)$
+
+label = s:unix:iOS:
+device = tablet
+model = $1
+sig   = ^mdns:model=(iPad[\d,]+)$
+
+label = s:unix:Mac OS X:
+device = computer
+model = $1
+sig   = ^mdns:model=((?:MacBook|MacBookAir|MacBookPro|iMac|Macmini|MacPro|Mac)[\d,]+)$
+
+label = s:unix:tvOS:
+device = media player
+model = $1
+sig   = ^mdns:model=(AppleTV[\d,]+)$
+
+label = s:!:Google Cast:
+device = media player
+model = $1
+sig   = ^mdns:md=(Chromecast.*|Google (?:Home|Nest).*)$
+
+label = s:!:Sonos:
+device = speaker
+model = Sonos
+sig   = ^upnp:Server=.*Sonos/
+
+label = s:!:Printer:
+device = printer
+model = $1
+sig   = ^mdns:ty=(.+)$
+
+label = s:!:Roku:
+device = media player
+model = Roku
+sig   = ^upnp:Server=.*Roku
+
+label = s:!:Philips Hue:
+device = bridge
+model = Philips Hue
+sig   = ^upnp:Hue-Bridgeid=
+
+label = s:win:Windows:
+device = computer
+sig   = ^upnp:(?:Server|User-Agent)=.*Microsoft-Windows
+
+label = g:unix:Linux:$1
+device = embedded
+sig   = ^upnp:Server=.*[Ll]inux/([\d.]+)
+`
+
+var (
+	builtinFingerprintsOnce = sync.Once{}
+	builtinFingerprintsDB   *Fingerprints
+)
+
+// BuiltinFingerprints returns a copy of the built-in signature database.
+func BuiltinFingerprints() *Fingerprints {
+	builtinFingerprintsOnce.Do(func() {
+		var err error
+		if builtinFingerprintsDB, err = ParseFingerprints(strings.NewReader(builtinFingerprints)); err != nil {
+			panic(err)
+		}
+	})
+
+	db := NewFingerprints()
+	db.Merge(builtinFingerprintsDB)
+	return db
+}
@@ -0,0 +1,282 @@
+package packets
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	fpHostMAC    = mustMAC("00:00:00:00:00:20")
+	fpGatewayMAC = mustMAC("00:00:00:00:00:01")
+)
+
+func decodeFrame(t *testing.T, raw []byte) gopacket.Packet {
+	return gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func ipv4Frame(t *testing.T, fromHw net.HardwareAddr, from string, ttl uint8, proto layers.IPProtocol, l4 ...gopacket.SerializableLayer) gopacket.Packet {
+	eth := layers.Ethernet{
+		SrcMAC:       fromHw,
+		DstMAC:       fpGatewayMAC,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip4 := layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      ttl,
+		Id:       1234,
+		Flags:    layers.IPv4DontFragment,
+		Protocol: proto,
+		SrcIP:    net.ParseIP(from),
+		DstIP:    net.ParseIP("10.0.0.1"),
+	}
+
+	for _, l := range l4 {
+		if tcp, ok := l.(*layers.TCP); ok {
+			tcp.SetNetworkLayerForChecksum(&ip4)
+		} else if udp, ok := l.(*layers.UDP); ok {
+			udp.SetNetworkLayerForChecksum(&ip4)
+		}
+	}
+
+	err, raw := Serialize(append([]gopacket.SerializableLayer{&eth, &ip4}, l4...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decodeFrame(t, raw)
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func tcpOption(kind layers.TCPOptionKind, data ...byte) layers.TCPOption {
+	return layers.TCPOption{
+		OptionType:   kind,
+		OptionLength: uint8(len(data) + 2),
+		OptionData:   data,
+	}
+}
+
+var nop = layers.TCPOption{OptionType: layers.TCPOptionKindNop, OptionLength: 1}
+
+func linuxSYN(t *testing.T, fromHw net.HardwareAddr, from string, ttl uint8) gopacket.Packet {
+	return ipv4Frame(t, fromHw, from, ttl, layers.IPProtocolTCP, &layers.TCP{
+		SrcPort: 40000,
+		DstPort: 443,
+		Seq:     1,
+		SYN:     true,
+		Window:  64240,
+		Options: []layers.TCPOption{
+			tcpOption(layers.TCPOptionKindMSS, u16(1460)...),
+			tcpOption(layers.TCPOptionKindSACKPermitted),
+			tcpOption(layers.TCPOptionKindTimestamps, 0, 0, 0, 1, 0, 0, 0, 0),
+			nop,
+			tcpOption(layers.TCPOptionKindWindowScale, 7),
+		},
+	})
+}
+
+func windowsSYN(t *testing.T, fromHw net.HardwareAddr, from string, ttl uint8) gopacket.Packet {
+	return ipv4Frame(t, fromHw, from, ttl, layers.IPProtocolTCP, &layers.TCP{
+		SrcPort: 50000,
+		DstPort: 443,
+		Seq:     1,
+		SYN:     true,
+		Window:  64240,
+		Options: []layers.TCPOption{
+			tcpOption(layers.TCPOptionKindMSS, u16(1460)...),
+			nop,
+			tcpOption(layers.TCPOptionKindWindowScale, 8),
+			nop,
+			nop,
+			tcpOption(layers.TCPOptionKindSACKPermitted),
+		},
+	})
+}
+
+func httpRequest(t *testing.T, fromHw net.HardwareAddr, from string, ua string) gopacket.Packet {
+	tcp := &layers.TCP{
+		SrcPort: 40001,
+		DstPort: 80,
+		Seq:     2,
+		ACK:     true,
+		PSH:     true,
+		Window:  502,
+	}
+	payload := gopacket.Payload("GET / HTTP/1.1\r\nHost: example.com\r\nUser-Agent: " + ua + "\r\n\r\n")
+	return ipv4Frame(t, fromHw, from, 64, layers.IPProtocolTCP, tcp, &payload)
+}
+
+func dhcpRequest(t *testing.T, clientHw net.HardwareAddr, options []byte, vendor string) gopacket.Packet {
+	dhcp := &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		ClientHWAddr: clientHw,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+			layers.NewDHCPOption(layers.DHCPOptParamsRequest, options),
+		},
+	}
+	if vendor != "" {
+		dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptClassID, []byte(vendor)))
+	}
+	udp := &layers.UDP{SrcPort: 68, DstPort: 67}
+	return ipv4Frame(t, clientHw, "0.0.0.0", 64, layers.IPProtocolUDP, udp, dhcp)
+}
+
+func TestParseFingerprints(t *testing.T) {
+	db := BuiltinFingerprints()
+	if db.Size() == 0 {
+		t.Fatal("expected built-in signatures")
+	}
+
+	db, err := ParseFingerprints(strings.NewReader(`
+; from p0f.fp
+[mtu]
+label = Ethernet or modem
+sig   = 1500
+
+[tcp:request]
+label = s:unix:Linux:3.11 and newer
+sig   = *:64:0:*:mss*20,10:mss,sok,ts,nop,ws:df,id+:0
+
+[http:user-agent]
+label = s:unix:Android:$1
+device = phone
+sig   = Android ([\d.]+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	} else if db.Size() != 2 {
+		t.Fatalf("expected 2 signatures, got %d", db.Size())
+	} else if db.Skipped != 1 {
+		t.Fatalf("expected 1 skipped signature, got %d", db.Skipped)
+	}
+
+	for _, bad := range []string{
+		"[tcp:request]\nsig = *:64:0:*:mss*20,10:mss:df:0",
+		"[tcp:request]\nlabel = s:unix:Linux:\nsig = *:64:0:*:mss*20:mss::0",
+		"[tcp:request]\nlabel = x:unix:Linux:",
+		"[dhcp]\nlabel = s:unix:Linux:\nsig = 1,3,abc",
+		"[device]\nlabel = s:unix:Linux:\nsig = ([",
+		"[device]\nnot a key value",
+	} {
+		if _, err := ParseFingerprints(strings.NewReader(bad)); err == nil {
+			t.Fatalf("expected an error for '%s'", bad)
+		}
+	}
+}
+
+func TestFingerprintTCP(t *testing.T) {
+	f := NewFingerprinter(BuiltinFingerprints())
+
+	mac, fp := f.Process(linuxSYN(t, fpHostMAC, "10.0.0.20", 64))
+	if mac != fpHostMAC.String() || fp == nil {
+		t.Fatalf("expected a fingerprint for %s, got %s %v", fpHostMAC, mac, fp)
+	} else if fp.OS != "Linux 3.11 and newer" {
+		t.Fatalf("unexpected os '%s'", fp.OS)
+	} else if fp.Confidence != 50 {
+		t.Fatalf("unexpected confidence %d", fp.Confidence)
+	}
+
+	other := mustMAC("00:00:00:00:00:21")
+	if _, fp = f.Process(windowsSYN(t, other, "10.0.0.21", 126)); fp == nil || fp.OS != "Windows 10 or 11" {
+		t.Fatalf("expected Windows 10 or 11, got %v", fp)
+	}
+
+	// too far away for the initial ttl
+	if _, fp = f.Process(linuxSYN(t, fpHostMAC, "10.0.0.20", 20)); fp != nil {
+		t.Fatalf("expected no match, got %v", fp)
+	}
+}
+
+func TestFingerprintIgnoresRoutedTraffic(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("10.0.0.0/24")
+	f := NewFingerprinter(BuiltinFingerprints())
+	f.Networks = []*net.IPNet{lan}
+	f.Ignore[fpHostMAC.String()] = true
+
+	if _, fp := f.Process(linuxSYN(t, fpGatewayMAC, "8.8.8.8", 60)); fp != nil {
+		t.Fatalf("routed traffic attributed to the gateway: %v", fp)
+	} else if _, fp := f.Process(linuxSYN(t, fpHostMAC, "10.0.0.20", 64)); fp != nil {
+		t.Fatalf("ignored host fingerprinted: %v", fp)
+	} else if mac, fp := f.Process(linuxSYN(t, fpGatewayMAC, "10.0.0.1", 64)); fp == nil || mac != fpGatewayMAC.String() {
+		t.Fatalf("expected the gateway to be fingerprinted, got %s %v", mac, fp)
+	}
+}
+
+func TestFingerprintSourcesAgree(t *testing.T) {
+	f := NewFingerprinter(BuiltinFingerprints())
+
+	android := []byte{1, 3, 6, 15, 26, 28, 51, 58, 59, 43}
+	mac, fp := f.Process(dhcpRequest(t, fpHostMAC, android, "android-dhcp-10"))
+	if mac != fpHostMAC.String() || fp == nil {
+		t.Fatalf("expected a fingerprint for %s, got %s %v", fpHostMAC, mac, fp)
+	} else if fp.OS != "Android 10" || fp.Device != "phone" {
+		t.Fatalf("unexpected fingerprint %+v", fp)
+	}
+
+	ua := "Mozilla/5.0 (Linux; Android 10; Pixel 4 Build/QQ3A.200805.001) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0 Mobile Safari/537.36"
+	if _, fp = f.Process(httpRequest(t, fpHostMAC, "10.0.0.20", ua)); fp == nil {
+		t.Fatal("expected a fingerprint")
+	} else if fp.OS != "Android 10" || fp.Model != "Pixel 4" || fp.Device != "phone" {
+		t.Fatalf("unexpected fingerprint %+v", fp)
+	} else if fp.Confidence != 100 {
+		t.Fatalf("expected confidence 100, got %d", fp.Confidence)
+	} else if sources := strings.Join(fp.Sources, ","); sources != "dhcp,dhcp:vendor,http:user-agent" {
+		t.Fatalf("unexpected sources %s", sources)
+	}
+
+	meta := fp.Meta()
+	if meta["fingerprint:os"] != "Android 10" || meta["fingerprint:model"] != "Pixel 4" || meta["fingerprint:confidence"] != "100" {
+		t.Fatalf("unexpected meta %v", meta)
+	}
+}
+
+func TestFingerprintSourcesDisagree(t *testing.T) {
+	f := NewFingerprinter(BuiltinFingerprints())
+
+	f.Process(linuxSYN(t, fpHostMAC, "10.0.0.20", 64))
+	ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0 Safari/537.36"
+	if _, fp := f.Process(httpRequest(t, fpHostMAC, "10.0.0.20", ua)); fp == nil {
+		t.Fatal("expected a fingerprint")
+	} else if fp.OS != "Windows 10 or 11" || fp.Device != "computer" {
+		t.Fatalf("unexpected fingerprint %+v", fp)
+	} else if fp.Confidence != 65 {
+		t.Fatalf("expected confidence 65, got %d", fp.Confidence)
+	}
+
+	if fp := f.Get(fpHostMAC.String()); fp == nil || fp.OS != "Windows 10 or 11" {
+		t.Fatalf("unexpected fingerprint %v", fp)
+	} else if fp := f.Get("00:00:00:00:00:99"); fp != nil {
+		t.Fatalf("unexpected fingerprint %v", fp)
+	}
+}
+
+func TestFingerprintDevice(t *testing.T) {
+	f := NewFingerprinter(BuiltinFingerprints())
+
+	notify := gopacket.Payload("NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"NT: upnp:rootdevice\r\n" +
+		"NTS: ssdp:alive\r\n" +
+		"SERVER: Linux UPnP/1.0 Sonos/57.3-77280 (ZPS13)\r\n\r\n")
+	udp := &layers.UDP{SrcPort: 1400, DstPort: 1900}
+
+	if _, fp := f.Process(ipv4Frame(t, fpHostMAC, "10.0.0.20", 1, layers.IPProtocolUDP, udp, &notify)); fp == nil {
+		t.Fatal("expected a fingerprint")
+	} else if fp.OS != "" || fp.Device != "speaker" || fp.Model != "Sonos" || fp.Confidence != 90 {
+		t.Fatalf("unexpected fingerprint %+v", fp)
+	} else if _, found := fp.Meta()["fingerprint:os"]; found {
+		t.Fatalf("unexpected os in %v", fp.Meta())
+	}
+}
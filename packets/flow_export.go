@@ -0,0 +1,414 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	NetFlowV9 = 9
+	IPFIX     = 10
+
+	// keep the messages below the usual MTU to avoid fragmentation
+	maxFlowMessage = 1400
+
+	flowTemplateIPv4 = 256
+	flowTemplateIPv6 = 257
+)
+
+// information elements used by the templates, the ids are shared by
+// NetFlow v9 and IPFIX
+const (
+	fieldInBytes      = 1
+	fieldInPackets    = 2
+	fieldProtocol     = 4
+	fieldTCPFlags     = 6
+	fieldL4SrcPort    = 7
+	fieldIPv4SrcAddr  = 8
+	fieldL4DstPort    = 11
+	fieldIPv4DstAddr  = 12
+	fieldLastSwitched = 21
+	fieldFirstSwitch  = 22
+	fieldIPv6SrcAddr  = 27
+	fieldIPv6DstAddr  = 28
+	fieldFlowStartMs  = 152
+	fieldFlowEndMs    = 153
+)
+
+// FlowRecord is an unidirectional flow as exported to the collector.
+type FlowRecord struct {
+	SrcIP    net.IP
+	SrcPort  uint16
+	DstIP    net.IP
+	DstPort  uint16
+	Protocol uint8
+	TCPFlags uint8
+	Packets  uint64
+	Bytes    uint64
+	Start    time.Time
+	End      time.Time
+}
+
+type flowExportState struct {
+	sentPackets uint64
+	sentBytes   uint64
+	recvPackets uint64
+	recvBytes   uint64
+	// when the interval that has not been exported yet started
+	start time.Time
+}
+
+// FlowExporter sends the flows tracked by a FlowTable to a NetFlow v9 or
+// IPFIX collector over UDP. Flows are exported once they have been idle for
+// InactiveTimeout, every ActiveTimeout while they are active and as soon as
+// tcp connections are closed.
+type FlowExporter struct {
+	Version         int
+	SourceID        uint32
+	ActiveTimeout   time.Duration
+	InactiveTimeout time.Duration
+	TemplateRefresh time.Duration
+
+	conn         net.Conn
+	boot         time.Time
+	sequence     uint32
+	lastTemplate time.Time
+	state        map[FlowKey]*flowExportState
+}
+
+func NewFlowExporter(collector string, version int) (error, *FlowExporter) {
+	if version != NetFlowV9 && version != IPFIX {
+		return fmt.Errorf("unsupported flow export version %d", version), nil
+	}
+
+	conn, err := net.Dial("udp", collector)
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, &FlowExporter{
+		Version:         version,
+		ActiveTimeout:   time.Minute,
+		InactiveTimeout: 15 * time.Second,
+		TemplateRefresh: time.Minute,
+		conn:            conn,
+		boot:            time.Now(),
+		state:           make(map[FlowKey]*flowExportState),
+	}
+}
+
+func (e *FlowExporter) Close() error {
+	return e.conn.Close()
+}
+
+// records returns the traffic of a flow which has not been exported yet,
+// one record for each direction with packets.
+func (e *FlowExporter) records(flow *Flow, state *flowExportState) []FlowRecord {
+	records := []FlowRecord{}
+	if packets := flow.SentPackets - state.sentPackets; packets > 0 {
+		records = append(records, FlowRecord{
+			SrcIP:    flow.SrcIP,
+			SrcPort:  flow.SrcPort,
+			DstIP:    flow.DstIP,
+			DstPort:  flow.DstPort,
+			Protocol: flow.Number,
+			TCPFlags: flow.TCPFlags,
+			Packets:  packets,
+			Bytes:    flow.SentBytes - state.sentBytes,
+			Start:    state.start,
+			End:      flow.LastSeen,
+		})
+	}
+	if packets := flow.RecvPackets - state.recvPackets; packets > 0 {
+		records = append(records, FlowRecord{
+			SrcIP:    flow.DstIP,
+			SrcPort:  flow.DstPort,
+			DstIP:    flow.SrcIP,
+			DstPort:  flow.SrcPort,
+			Protocol: flow.Number,
+			TCPFlags: flow.TCPFlags,
+			Packets:  packets,
+			Bytes:    flow.RecvBytes - state.recvBytes,
+			Start:    state.start,
+			End:      flow.LastSeen,
+		})
+	}
+
+	state.sentPackets, state.sentBytes = flow.SentPackets, flow.SentBytes
+	state.recvPackets, state.recvBytes = flow.RecvPackets, flow.RecvBytes
+	state.start = flow.LastSeen
+
+	return records
+}
+
+// Update exports the flows whose timeouts expired, if force is true all the
+// pending traffic is exported.
+func (e *FlowExporter) Update(flows []Flow, now time.Time, force bool) error {
+	records := []FlowRecord{}
+	seen := make(map[FlowKey]bool)
+
+	for i := range flows {
+		flow := &flows[i]
+		key := flow.Key()
+		seen[key] = true
+
+		state, found := e.state[key]
+		if !found || flow.SentPackets < state.sentPackets || flow.RecvPackets < state.recvPackets {
+			// new flow or the table has been cleared
+			state = &flowExportState{start: flow.FirstSeen}
+			e.state[key] = state
+		}
+
+		if flow.SentPackets == state.sentPackets && flow.RecvPackets == state.recvPackets {
+			continue
+		}
+
+		if force ||
+			flow.Finished() ||
+			now.Sub(flow.LastSeen) >= e.InactiveTimeout ||
+			now.Sub(state.start) >= e.ActiveTimeout {
+			records = append(records, e.records(flow, state)...)
+		}
+	}
+
+	// forget the flows removed from the table
+	for key := range e.state {
+		if !seen[key] {
+			delete(e.state, key)
+		}
+	}
+
+	return e.Export(records, now)
+}
+
+// Export sends the records to the collector together with the templates if
+// they have never been sent or need to be refreshed.
+func (e *FlowExporter) Export(records []FlowRecord, now time.Time) error {
+	templates := e.lastTemplate.IsZero() || now.Sub(e.lastTemplate) >= e.TemplateRefresh
+	if len(records) == 0 && !templates {
+		return nil
+	} else if templates {
+		e.lastTemplate = now
+	}
+
+	for _, msg := range e.Encode(records, now, templates) {
+		if _, err := e.conn.Write(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *FlowExporter) headerSize() int {
+	if e.Version == IPFIX {
+		return 16
+	}
+	return 20
+}
+
+func (e *FlowExporter) recordSize(ipv6 bool) int {
+	// ports, protocol, flags, bytes and packets
+	size := 2 + 2 + 1 + 1 + 8 + 8
+	if ipv6 {
+		size += 16 * 2
+	} else {
+		size += 4 * 2
+	}
+
+	if e.Version == IPFIX {
+		size += 8 * 2
+	} else {
+		size += 4 * 2
+	}
+	return size
+}
+
+func (e *FlowExporter) fields(ipv6 bool) [][2]uint16 {
+	fields := [][2]uint16{}
+	if ipv6 {
+		fields = append(fields, [2]uint16{fieldIPv6SrcAddr, 16}, [2]uint16{fieldIPv6DstAddr, 16})
+	} else {
+		fields = append(fields, [2]uint16{fieldIPv4SrcAddr, 4}, [2]uint16{fieldIPv4DstAddr, 4})
+	}
+
+	fields = append(fields,
+		[2]uint16{fieldL4SrcPort, 2},
+		[2]uint16{fieldL4DstPort, 2},
+		[2]uint16{fieldProtocol, 1},
+		[2]uint16{fieldTCPFlags, 1},
+		[2]uint16{fieldInBytes, 8},
+		[2]uint16{fieldInPackets, 8})
+
+	if e.Version == IPFIX {
+		fields = append(fields, [2]uint16{fieldFlowStartMs, 8}, [2]uint16{fieldFlowEndMs, 8})
+	} else {
+		fields = append(fields, [2]uint16{fieldFirstSwitch, 4}, [2]uint16{fieldLastSwitched, 4})
+	}
+	return fields
+}
+
+func (e *FlowExporter) templateSet() []byte {
+	body := &bytes.Buffer{}
+	for _, ipv6 := range []bool{false, true} {
+		id := uint16(flowTemplateIPv4)
+		if ipv6 {
+			id = flowTemplateIPv6
+		}
+
+		fields := e.fields(ipv6)
+		binary.Write(body, binary.BigEndian, id)
+		binary.Write(body, binary.BigEndian, uint16(len(fields)))
+		for _, field := range fields {
+			binary.Write(body, binary.BigEndian, field)
+		}
+	}
+
+	// template sets have id 0 in NetFlow v9 and 2 in IPFIX
+	setID := uint16(0)
+	if e.Version == IPFIX {
+		setID = 2
+	}
+	return flowSet(setID, body.Bytes(), false)
+}
+
+// flowSet prepends the set header to body, NetFlow v9 sets are padded to
+// 32 bits.
+func flowSet(id uint16, body []byte, pad bool) []byte {
+	size := 4 + len(body)
+	padding := 0
+	if pad && size%4 != 0 {
+		padding = 4 - size%4
+	}
+
+	set := make([]byte, 4, size+padding)
+	binary.BigEndian.PutUint16(set[0:], id)
+	binary.BigEndian.PutUint16(set[2:], uint16(size+padding))
+	set = append(set, body...)
+	return append(set, make([]byte, padding)...)
+}
+
+// uptime returns the milliseconds elapsed between the start of the
+// exporter and t, as NetFlow v9 timestamps are relative to it.
+func (e *FlowExporter) uptime(t time.Time) uint32 {
+	if t.Before(e.boot) {
+		return 0
+	}
+	return uint32(t.Sub(e.boot) / time.Millisecond)
+}
+
+func (e *FlowExporter) dataSet(records []FlowRecord, ipv6 bool) []byte {
+	body := &bytes.Buffer{}
+	for _, r := range records {
+		if ipv6 {
+			body.Write(r.SrcIP.To16())
+			body.Write(r.DstIP.To16())
+		} else {
+			body.Write(r.SrcIP.To4())
+			body.Write(r.DstIP.To4())
+		}
+
+		binary.Write(body, binary.BigEndian, r.SrcPort)
+		binary.Write(body, binary.BigEndian, r.DstPort)
+		body.WriteByte(r.Protocol)
+		body.WriteByte(r.TCPFlags)
+		binary.Write(body, binary.BigEndian, r.Bytes)
+		binary.Write(body, binary.BigEndian, r.Packets)
+
+		if e.Version == IPFIX {
+			binary.Write(body, binary.BigEndian, uint64(r.Start.UnixNano()/int64(time.Millisecond)))
+			binary.Write(body, binary.BigEndian, uint64(r.End.UnixNano()/int64(time.Millisecond)))
+		} else {
+			binary.Write(body, binary.BigEndian, e.uptime(r.Start))
+			binary.Write(body, binary.BigEndian, e.uptime(r.End))
+		}
+	}
+
+	id := uint16(flowTemplateIPv4)
+	if ipv6 {
+		id = flowTemplateIPv6
+	}
+	return flowSet(id, body.Bytes(), e.Version == NetFlowV9)
+}
+
+func (e *FlowExporter) header(now time.Time, count int, data int, size int) []byte {
+	hdr := &bytes.Buffer{}
+	if e.Version == IPFIX {
+		binary.Write(hdr, binary.BigEndian, uint16(IPFIX))
+		binary.Write(hdr, binary.BigEndian, uint16(e.headerSize()+size))
+		binary.Write(hdr, binary.BigEndian, uint32(now.Unix()))
+		// the sequence counts the data records sent before this message
+		binary.Write(hdr, binary.BigEndian, e.sequence)
+		binary.Write(hdr, binary.BigEndian, e.SourceID)
+		e.sequence += uint32(data)
+	} else {
+		binary.Write(hdr, binary.BigEndian, uint16(NetFlowV9))
+		binary.Write(hdr, binary.BigEndian, uint16(count))
+		binary.Write(hdr, binary.BigEndian, e.uptime(now))
+		binary.Write(hdr, binary.BigEndian, uint32(now.Unix()))
+		// the sequence counts the packets sent before this one
+		binary.Write(hdr, binary.BigEndian, e.sequence)
+		binary.Write(hdr, binary.BigEndian, e.SourceID)
+		e.sequence++
+	}
+	return hdr.Bytes()
+}
+
+// Encode splits the records in as many messages as needed, the templates
+// are only included in the first one.
+func (e *FlowExporter) Encode(records []FlowRecord, now time.Time, templates bool) [][]byte {
+	var v4, v6 []FlowRecord
+	for _, r := range records {
+		if r.SrcIP.To4() != nil {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+
+	messages := [][]byte{}
+	body := &bytes.Buffer{}
+	// NetFlow v9 counts the templates as records too
+	count := 0
+	data := 0
+	flush := func() {
+		if body.Len() > 0 {
+			msg := e.header(now, count, data, body.Len())
+			messages = append(messages, append(msg, body.Bytes()...))
+			body.Reset()
+			count = 0
+			data = 0
+		}
+	}
+
+	if templates {
+		body.Write(e.templateSet())
+		count += 2
+	}
+
+	for i, group := range [][]FlowRecord{v4, v6} {
+		ipv6 := i == 1
+		size := e.recordSize(ipv6)
+		for len(group) > 0 {
+			// room left for records once the header and set header are added
+			room := (maxFlowMessage - e.headerSize() - body.Len() - 4 - 3) / size
+			if room <= 0 {
+				flush()
+				continue
+			} else if room > len(group) {
+				room = len(group)
+			}
+
+			body.Write(e.dataSet(group[:room], ipv6))
+			count += room
+			data += room
+			group = group[room:]
+		}
+	}
+
+	flush()
+
+	return messages
+}
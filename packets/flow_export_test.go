@@ -0,0 +1,240 @@
+package packets
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+type collectedMessage struct {
+	version   uint16
+	sequence  uint32
+	templates int
+	records   []FlowRecord
+}
+
+// collector is a stand-in for a flow collector decoding the messages sent
+// by a FlowExporter.
+type collector struct {
+	t    *testing.T
+	conn *net.UDPConn
+}
+
+func newCollector(t *testing.T) *collector {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &collector{t: t, conn: conn}
+}
+
+func (c *collector) address() string {
+	return c.conn.LocalAddr().String()
+}
+
+func (c *collector) read() *collectedMessage {
+	buf := make([]byte, 65536)
+	c.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		return nil
+	}
+	buf = buf[:n]
+
+	msg := &collectedMessage{version: binary.BigEndian.Uint16(buf)}
+	offset := 20
+	if msg.version == IPFIX {
+		if size := int(binary.BigEndian.Uint16(buf[2:])); size != n {
+			c.t.Fatalf("message length %d, received %d bytes", size, n)
+		}
+		msg.sequence = binary.BigEndian.Uint32(buf[8:])
+		offset = 16
+	} else {
+		msg.sequence = binary.BigEndian.Uint32(buf[12:])
+	}
+
+	for offset < n {
+		id := binary.BigEndian.Uint16(buf[offset:])
+		size := int(binary.BigEndian.Uint16(buf[offset+2:]))
+		set := buf[offset+4 : offset+size]
+		offset += size
+
+		if id == 0 || id == 2 {
+			for len(set) > 0 {
+				fields := int(binary.BigEndian.Uint16(set[2:]))
+				set = set[4+fields*4:]
+				msg.templates++
+			}
+			continue
+		}
+
+		addrSize := 4
+		if id == flowTemplateIPv6 {
+			addrSize = 16
+		}
+		tsSize := 4
+		if msg.version == IPFIX {
+			tsSize = 8
+		}
+		recSize := addrSize*2 + 22 + tsSize*2
+
+		for len(set) >= recSize {
+			r := FlowRecord{
+				SrcIP: net.IP(set[0:addrSize]),
+				DstIP: net.IP(set[addrSize : addrSize*2]),
+			}
+			rec := set[addrSize*2:]
+			r.SrcPort = binary.BigEndian.Uint16(rec[0:])
+			r.DstPort = binary.BigEndian.Uint16(rec[2:])
+			r.Protocol = rec[4]
+			r.TCPFlags = rec[5]
+			r.Bytes = binary.BigEndian.Uint64(rec[6:])
+			r.Packets = binary.BigEndian.Uint64(rec[14:])
+			msg.records = append(msg.records, r)
+			set = set[recSize:]
+		}
+	}
+
+	return msg
+}
+
+func testFlow(now time.Time) Flow {
+	return Flow{
+		Protocol:    "tcp",
+		Number:      6,
+		SrcIP:       net.ParseIP("10.0.0.2").To4(),
+		SrcPort:     40000,
+		DstIP:       net.ParseIP("10.0.0.1").To4(),
+		DstPort:     80,
+		SentPackets: 3,
+		SentBytes:   300,
+		RecvPackets: 2,
+		RecvBytes:   2000,
+		FirstSeen:   now.Add(-time.Minute),
+		LastSeen:    now.Add(-time.Minute),
+	}
+}
+
+func TestFlowExporterTimeouts(t *testing.T) {
+	for _, version := range []int{NetFlowV9, IPFIX} {
+		c := newCollector(t)
+		defer c.conn.Close()
+
+		err, exp := NewFlowExporter(c.address(), version)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer exp.Close()
+
+		now := time.Now()
+		exp.ActiveTimeout = 30 * time.Second
+		exp.InactiveTimeout = 10 * time.Second
+
+		// a recent flow is not exported, the templates are
+		active := testFlow(now)
+		active.SrcPort = 40001
+		active.FirstSeen = now.Add(-time.Second)
+		active.LastSeen = now
+		if err := exp.Update([]Flow{active}, now, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if msg := c.read(); msg == nil || int(msg.version) != version || msg.templates != 2 || len(msg.records) != 0 {
+			t.Fatalf("v%d: expected templates only, got %+v", version, msg)
+		}
+
+		// an idle flow is exported in both directions
+		idle := testFlow(now)
+		if err := exp.Update([]Flow{active, idle}, now, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		msg := c.read()
+		if msg == nil || msg.templates != 0 || len(msg.records) != 2 {
+			t.Fatalf("v%d: expected 2 records, got %+v", version, msg)
+		} else if r := msg.records[0]; r.SrcPort != 40000 || r.Packets != 3 || r.Bytes != 300 || r.Protocol != 6 {
+			t.Fatalf("v%d: unexpected record %+v", version, r)
+		} else if r := msg.records[1]; !r.SrcIP.Equal(idle.DstIP) || r.Packets != 2 || r.Bytes != 2000 {
+			t.Fatalf("v%d: unexpected record %+v", version, r)
+		}
+
+		// nothing new to export
+		if err := exp.Update([]Flow{active, idle}, now, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if msg := c.read(); msg != nil {
+			t.Fatalf("v%d: unexpected message %+v", version, msg)
+		}
+
+		// the active flow is exported after the active timeout
+		later := now.Add(31 * time.Second)
+		active.LastSeen = later
+		if err := exp.Update([]Flow{active, idle}, later, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if msg := c.read(); msg == nil || len(msg.records) != 2 {
+			t.Fatalf("v%d: expected active flow records, got %+v", version, msg)
+		}
+
+		// only the traffic since the previous export is sent
+		active.SentPackets++
+		active.SentBytes += 100
+		if err := exp.Update([]Flow{active, idle}, later, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		msg = c.read()
+		if msg == nil || len(msg.records) != 1 || msg.records[0].Packets != 1 || msg.records[0].Bytes != 100 {
+			t.Fatalf("v%d: expected delta record, got %+v", version, msg)
+		}
+
+		if version == NetFlowV9 && msg.sequence != 3 {
+			t.Fatalf("expected sequence 3, got %d", msg.sequence)
+		} else if version == IPFIX && msg.sequence != 4 {
+			t.Fatalf("expected sequence 4, got %d", msg.sequence)
+		}
+	}
+}
+
+func TestFlowExporterSplit(t *testing.T) {
+	c := newCollector(t)
+	defer c.conn.Close()
+
+	err, exp := NewFlowExporter(c.address(), IPFIX)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exp.Close()
+
+	now := time.Now()
+	records := []FlowRecord{}
+	for i := 0; i < 100; i++ {
+		records = append(records, FlowRecord{
+			SrcIP:    net.ParseIP("fe80::1"),
+			DstIP:    net.ParseIP("fe80::2"),
+			SrcPort:  uint16(1000 + i),
+			DstPort:  53,
+			Protocol: 17,
+			Packets:  1,
+			Bytes:    80,
+			Start:    now,
+			End:      now,
+		})
+	}
+
+	messages := exp.Encode(records, now, true)
+	if len(messages) < 2 {
+		t.Fatalf("expected the records to be split, got %d messages", len(messages))
+	}
+
+	for _, msg := range messages {
+		if len(msg) > maxFlowMessage {
+			t.Fatalf("message of %d bytes exceeds the limit", len(msg))
+		} else if _, err := exp.conn.Write(msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	total := 0
+	for msg := c.read(); msg != nil; msg = c.read() {
+		total += len(msg.records)
+	}
+	if total != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), total)
+	}
+}
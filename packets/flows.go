@@ -0,0 +1,464 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	TCPStateSynSent     = "syn_sent"
+	TCPStateSynReceived = "syn_received"
+	TCPStateEstablished = "established"
+	TCPStateClosing     = "closing"
+	TCPStateClosed      = "closed"
+	TCPStateReset       = "reset"
+)
+
+var (
+	// flows without packets for this long are removed
+	FlowIdleTimeout = 5 * time.Minute
+	// closed and reset tcp flows are removed sooner
+	FlowClosedTimeout = 30 * time.Second
+	// new flows are ignored once the table is this big
+	MaxFlows = 65536
+	// windows over which the per host bandwidth is averaged
+	RateWindows = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+)
+
+// one second buckets of history kept for each host
+const rateHistory = 300
+
+// FlowKey identifies a bidirectional conversation, the endpoints are sorted
+// so that both directions map to the same key.
+type FlowKey struct {
+	Protocol string
+	AddrA    string
+	PortA    uint16
+	AddrB    string
+	PortB    uint16
+}
+
+// Flow is a conversation between two endpoints, Src is the endpoint which
+// started it as far as we can tell.
+type Flow struct {
+	Protocol    string    `json:"protocol"`
+	Number      uint8     `json:"protocol_number"` // IANA protocol number
+	SrcIP       net.IP    `json:"src_ip"`
+	SrcPort     uint16    `json:"src_port"`
+	DstIP       net.IP    `json:"dst_ip"`
+	DstPort     uint16    `json:"dst_port"`
+	Application string    `json:"application"`
+	State       string    `json:"state,omitempty"`
+	TCPFlags    uint8     `json:"tcp_flags,omitempty"`
+	SentPackets uint64    `json:"sent_packets"`
+	SentBytes   uint64    `json:"sent_bytes"`
+	RecvPackets uint64    `json:"recv_packets"`
+	RecvBytes   uint64    `json:"recv_bytes"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+
+	// true when Application has been detected from the payload rather than
+	// guessed from the ports
+	appFromPayload bool
+	srcFin         bool
+	dstFin         bool
+}
+
+func (f *Flow) Key() FlowKey {
+	return makeFlowKey(f.Protocol, f.SrcIP, f.SrcPort, f.DstIP, f.DstPort)
+}
+
+// Finished returns true if the tcp connection has been closed or reset.
+func (f *Flow) Finished() bool {
+	return f.State == TCPStateClosed || f.State == TCPStateReset
+}
+
+func (f *Flow) Packets() uint64 {
+	return f.SentPackets + f.RecvPackets
+}
+
+func (f *Flow) Bytes() uint64 {
+	return f.SentBytes + f.RecvBytes
+}
+
+func (f *Flow) Src() string {
+	return endpointString(f.SrcIP, f.SrcPort, f.Protocol)
+}
+
+func (f *Flow) Dst() string {
+	return endpointString(f.DstIP, f.DstPort, f.Protocol)
+}
+
+func (f *Flow) String() string {
+	return fmt.Sprintf("%s %s -> %s", f.Protocol, f.Src(), f.Dst())
+}
+
+func endpointString(ip net.IP, port uint16, proto string) string {
+	if proto != "tcp" && proto != "udp" {
+		return ip.String()
+	}
+	return net.JoinHostPort(ip.String(), fmt.Sprintf("%d", port))
+}
+
+// rateWindow counts bytes in one second buckets.
+type rateWindow struct {
+	buckets [rateHistory]uint64
+	seconds [rateHistory]int64
+}
+
+func (w *rateWindow) add(now time.Time, size uint64) {
+	sec := now.Unix()
+	idx := sec % rateHistory
+	if w.seconds[idx] != sec {
+		w.seconds[idx] = sec
+		w.buckets[idx] = 0
+	}
+	w.buckets[idx] += size
+}
+
+// rate returns the average bytes per second over the last window.
+func (w *rateWindow) rate(now time.Time, window time.Duration) float64 {
+	secs := int64(window / time.Second)
+	if secs <= 0 {
+		return 0
+	} else if secs > rateHistory {
+		secs = rateHistory
+	}
+
+	total := uint64(0)
+	last := now.Unix()
+	for i := int64(0); i < secs; i++ {
+		sec := last - i
+		if idx := sec % rateHistory; w.seconds[idx] == sec {
+			total += w.buckets[idx]
+		}
+	}
+	return float64(total) / float64(secs)
+}
+
+type hostRates struct {
+	sent     rateWindow
+	received rateWindow
+	lastSeen time.Time
+}
+
+type Rate struct {
+	Window   string  `json:"window"`
+	Sent     float64 `json:"sent"`
+	Received float64 `json:"received"`
+}
+
+// HostBandwidth is the bandwidth used by a host in bytes per second,
+// averaged over each of the RateWindows.
+type HostBandwidth struct {
+	Address string `json:"address"`
+	Rates   []Rate `json:"rates"`
+}
+
+// Total returns the sum of the sent and received rates of the i-th window.
+func (h HostBandwidth) Total(i int) float64 {
+	if i < 0 || i >= len(h.Rates) {
+		return 0
+	}
+	return h.Rates[i].Sent + h.Rates[i].Received
+}
+
+// FlowTable tracks the conversations seen by the packet queue.
+type FlowTable struct {
+	sync.RWMutex
+	flows     map[FlowKey]*Flow
+	hosts     map[string]*hostRates
+	lastPrune time.Time
+}
+
+func NewFlowTable() *FlowTable {
+	return &FlowTable{
+		flows: make(map[FlowKey]*Flow),
+		hosts: make(map[string]*hostRates),
+	}
+}
+
+func makeFlowKey(proto string, src net.IP, srcPort uint16, dst net.IP, dstPort uint16) FlowKey {
+	a, b := src.String(), dst.String()
+	if a > b || (a == b && srcPort > dstPort) {
+		return FlowKey{proto, b, dstPort, a, srcPort}
+	}
+	return FlowKey{proto, a, srcPort, b, dstPort}
+}
+
+// guessApplication detects the application protocol from the first bytes
+// of the payload if possible, from the well known ports otherwise.
+func guessApplication(proto string, srcPort, dstPort uint16, payload []byte) (string, bool) {
+	if proto == "tcp" && len(payload) > 0 {
+		switch {
+		case len(payload) >= 3 && payload[0] == 0x16 && payload[1] == 0x03 && payload[2] <= 0x04:
+			return "tls", true
+		case bytes.HasPrefix(payload, []byte("SSH-")):
+			return "ssh", true
+		case bytes.HasPrefix(payload, []byte("HTTP/1.")):
+			return "http", true
+		}
+
+		for _, method := range []string{"GET ", "POST ", "PUT ", "HEAD ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT "} {
+			if bytes.HasPrefix(payload, []byte(method)) {
+				return "http", true
+			}
+		}
+	}
+
+	if proto == "tcp" || proto == "udp" {
+		if svc := network.GetServiceByPort(int(dstPort), proto); svc != "" {
+			return svc, false
+		} else if svc := network.GetServiceByPort(int(srcPort), proto); svc != "" {
+			return svc, false
+		}
+	}
+
+	return "", false
+}
+
+// Track accounts a packet to its flow and to the bandwidth of its hosts,
+// non IP packets are ignored.
+func (t *FlowTable) Track(pkt gopacket.Packet) {
+	var src, dst net.IP
+	var proto string
+	var number layers.IPProtocol
+
+	if ip4, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		src, dst, number = ip4.SrcIP, ip4.DstIP, ip4.Protocol
+	} else if ip6, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		src, dst, number = ip6.SrcIP, ip6.DstIP, ip6.NextHeader
+	} else {
+		return
+	}
+
+	var srcPort, dstPort uint16
+	var payload []byte
+	tcp, isTCP := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if isTCP {
+		proto, number = "tcp", layers.IPProtocolTCP
+		srcPort, dstPort = uint16(tcp.SrcPort), uint16(tcp.DstPort)
+		payload = tcp.Payload
+	} else if udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		proto, number = "udp", layers.IPProtocolUDP
+		srcPort, dstPort = uint16(udp.SrcPort), uint16(udp.DstPort)
+		payload = udp.Payload
+	} else if pkt.Layer(layers.LayerTypeICMPv4) != nil {
+		proto, number = "icmp", layers.IPProtocolICMPv4
+	} else if pkt.Layer(layers.LayerTypeICMPv6) != nil {
+		proto, number = "icmpv6", layers.IPProtocolICMPv6
+	} else {
+		proto = strings.ToLower(number.String())
+	}
+
+	now := pkt.Metadata().Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	size := uint64(len(pkt.Data()))
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.trackHost(src.String(), now, size, true)
+	t.trackHost(dst.String(), now, size, false)
+
+	key := makeFlowKey(proto, src, srcPort, dst, dstPort)
+	flow, found := t.flows[key]
+	if !found {
+		if len(t.flows) >= MaxFlows {
+			t.prune(now)
+			if len(t.flows) >= MaxFlows {
+				return
+			}
+		}
+
+		// the addresses are slices of the packet buffer, which is shared
+		// with the other subscribers of the capture
+		flow = &Flow{
+			Protocol:  proto,
+			Number:    uint8(number),
+			SrcIP:     append(net.IP(nil), src...),
+			SrcPort:   srcPort,
+			DstIP:     append(net.IP(nil), dst...),
+			DstPort:   dstPort,
+			FirstSeen: now,
+		}
+		// the answer to a syn we missed, the other side started it
+		if isTCP && tcp.SYN && tcp.ACK {
+			flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort = flow.DstIP, dstPort, flow.SrcIP, srcPort
+		}
+		t.flows[key] = flow
+	}
+
+	fromSrc := flow.SrcIP.Equal(src) && flow.SrcPort == srcPort
+	if fromSrc {
+		flow.SentPackets++
+		flow.SentBytes += size
+	} else {
+		flow.RecvPackets++
+		flow.RecvBytes += size
+	}
+	flow.LastSeen = now
+
+	if isTCP {
+		flow.trackTCP(tcp, fromSrc)
+	}
+
+	if !flow.appFromPayload {
+		if app, fromPayload := guessApplication(proto, flow.SrcPort, flow.DstPort, payload); app != "" {
+			flow.Application = app
+			flow.appFromPayload = fromPayload
+		}
+	}
+
+	if now.Sub(t.lastPrune) > 10*time.Second {
+		t.prune(now)
+	}
+}
+
+func (t *FlowTable) trackHost(addr string, now time.Time, size uint64, sent bool) {
+	host, found := t.hosts[addr]
+	if !found {
+		host = &hostRates{}
+		t.hosts[addr] = host
+	}
+
+	if sent {
+		host.sent.add(now, size)
+	} else {
+		host.received.add(now, size)
+	}
+	host.lastSeen = now
+}
+
+func tcpFlags(tcp *layers.TCP) uint8 {
+	flags := uint8(0)
+	for i, set := range []bool{tcp.FIN, tcp.SYN, tcp.RST, tcp.PSH, tcp.ACK, tcp.URG, tcp.ECE, tcp.CWR} {
+		if set {
+			flags |= 1 << uint(i)
+		}
+	}
+	return flags
+}
+
+func (f *Flow) trackTCP(tcp *layers.TCP, fromSrc bool) {
+	f.TCPFlags |= tcpFlags(tcp)
+
+	switch {
+	case tcp.RST:
+		f.State = TCPStateReset
+	case tcp.SYN && !tcp.ACK:
+		f.State = TCPStateSynSent
+	case tcp.SYN && tcp.ACK:
+		f.State = TCPStateSynReceived
+	case tcp.FIN:
+		if fromSrc {
+			f.srcFin = true
+		} else {
+			f.dstFin = true
+		}
+
+		if f.srcFin && f.dstFin {
+			f.State = TCPStateClosed
+		} else {
+			f.State = TCPStateClosing
+		}
+	case f.State == "" || f.State == TCPStateSynReceived:
+		// flows we only see from the middle are considered established
+		f.State = TCPStateEstablished
+	}
+}
+
+func (f *Flow) expired(now time.Time) bool {
+	idle := now.Sub(f.LastSeen)
+	if f.Finished() {
+		return idle > FlowClosedTimeout
+	}
+	return idle > FlowIdleTimeout
+}
+
+func (t *FlowTable) prune(now time.Time) {
+	t.lastPrune = now
+	for key, flow := range t.flows {
+		if flow.expired(now) {
+			delete(t.flows, key)
+		}
+	}
+
+	for addr, host := range t.hosts {
+		if now.Sub(host.lastSeen) > rateHistory*time.Second {
+			delete(t.hosts, addr)
+		}
+	}
+}
+
+// Flows returns a copy of the tracked flows.
+func (t *FlowTable) Flows() []Flow {
+	t.RLock()
+	defer t.RUnlock()
+
+	flows := make([]Flow, 0, len(t.flows))
+	for _, flow := range t.flows {
+		flows = append(flows, *flow)
+	}
+	return flows
+}
+
+// Bandwidth returns the bandwidth of each host as of now.
+func (t *FlowTable) Bandwidth(now time.Time) []HostBandwidth {
+	t.RLock()
+	defer t.RUnlock()
+
+	hosts := make([]HostBandwidth, 0, len(t.hosts))
+	for addr, host := range t.hosts {
+		bw := HostBandwidth{
+			Address: addr,
+			Rates:   make([]Rate, len(RateWindows)),
+		}
+		for i, window := range RateWindows {
+			bw.Rates[i] = Rate{
+				Window:   window.String(),
+				Sent:     host.sent.rate(now, window),
+				Received: host.received.rate(now, window),
+			}
+		}
+		hosts = append(hosts, bw)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Address < hosts[j].Address
+	})
+
+	return hosts
+}
+
+func (t *FlowTable) Clear() {
+	t.Lock()
+	defer t.Unlock()
+	t.flows = make(map[FlowKey]*Flow)
+	t.hosts = make(map[string]*hostRates)
+}
+
+type flowTableJSON struct {
+	Flows []Flow          `json:"flows"`
+	Hosts []HostBandwidth `json:"hosts"`
+}
+
+func (t *FlowTable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(flowTableJSON{
+		Flows: t.Flows(),
+		Hosts: t.Bandwidth(time.Now()),
+	})
+}
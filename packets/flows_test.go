@@ -0,0 +1,182 @@
+package packets
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func buildTCP(t *testing.T, src, dst string, sport, dport int, payload []byte, flags string, ts time.Time) gopacket.Packet {
+	eth := layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{5, 4, 3, 2, 1, 0},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip4 := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(src),
+		DstIP:    net.ParseIP(dst),
+	}
+	tcp := layers.TCP{
+		SrcPort: layers.TCPPort(sport),
+		DstPort: layers.TCPPort(dport),
+	}
+	for _, f := range flags {
+		switch f {
+		case 'S':
+			tcp.SYN = true
+		case 'A':
+			tcp.ACK = true
+		case 'F':
+			tcp.FIN = true
+		case 'R':
+			tcp.RST = true
+		}
+	}
+	tcp.SetNetworkLayerForChecksum(&ip4)
+
+	err, raw := Serialize(&eth, &ip4, &tcp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+	pkt.Metadata().Timestamp = ts
+	return pkt
+}
+
+func TestFlowTableTCP(t *testing.T) {
+	table := NewFlowTable()
+	now := time.Now()
+
+	client, server := "10.0.0.2", "10.0.0.1"
+	steps := []struct {
+		fromClient bool
+		flags      string
+		payload    []byte
+		state      string
+	}{
+		{true, "S", nil, TCPStateSynSent},
+		{false, "SA", nil, TCPStateSynReceived},
+		{true, "A", nil, TCPStateEstablished},
+		{true, "A", []byte("GET / HTTP/1.1\r\n\r\n"), TCPStateEstablished},
+		{false, "A", []byte("HTTP/1.1 200 OK\r\n\r\n"), TCPStateEstablished},
+		{true, "FA", nil, TCPStateClosing},
+		{false, "FA", nil, TCPStateClosed},
+	}
+
+	for i, step := range steps {
+		var pkt gopacket.Packet
+		if step.fromClient {
+			pkt = buildTCP(t, client, server, 40000, 8080, step.payload, step.flags, now)
+		} else {
+			pkt = buildTCP(t, server, client, 8080, 40000, step.payload, step.flags, now)
+		}
+		table.Track(pkt)
+
+		flows := table.Flows()
+		if len(flows) != 1 {
+			t.Fatalf("step %d: expected 1 flow, got %d", i, len(flows))
+		} else if flows[0].State != step.state {
+			t.Fatalf("step %d: expected state %s, got %s", i, step.state, flows[0].State)
+		}
+	}
+
+	flow := table.Flows()[0]
+	if flow.Src() != "10.0.0.2:40000" || flow.Dst() != "10.0.0.1:8080" {
+		t.Fatalf("unexpected direction %s", flow.String())
+	} else if flow.SentPackets != 4 || flow.RecvPackets != 3 {
+		t.Fatalf("unexpected packets %d/%d", flow.SentPackets, flow.RecvPackets)
+	} else if flow.Application != "http" {
+		t.Fatalf("expected http application, got '%s'", flow.Application)
+	} else if flow.TCPFlags&0x13 != 0x13 {
+		t.Fatalf("unexpected flags 0x%x", flow.TCPFlags)
+	}
+
+	// closed flows are removed before the idle ones
+	table.Lock()
+	table.prune(now.Add(FlowClosedTimeout + time.Second))
+	table.Unlock()
+	if flows := table.Flows(); len(flows) != 0 {
+		t.Fatalf("expected closed flow to be pruned, got %d flows", len(flows))
+	}
+}
+
+func TestFlowTableMidstream(t *testing.T) {
+	table := NewFlowTable()
+	now := time.Now()
+
+	// we missed the syn, the answer tells us who started the conversation
+	table.Track(buildTCP(t, "10.0.0.1", "10.0.0.2", 443, 50000, nil, "SA", now))
+	table.Track(buildTCP(t, "10.0.0.3", "10.0.0.4", 50001, 22, []byte("SSH-2.0-OpenSSH\r\n"), "A", now))
+
+	for _, flow := range table.Flows() {
+		switch flow.DstPort {
+		case 443:
+			if flow.Src() != "10.0.0.2:50000" || flow.Application != "https" {
+				t.Fatalf("unexpected flow %s (%s)", flow.String(), flow.Application)
+			}
+		case 22:
+			if flow.State != TCPStateEstablished || flow.Application != "ssh" {
+				t.Fatalf("unexpected flow %s (%s %s)", flow.String(), flow.State, flow.Application)
+			}
+		default:
+			t.Fatalf("unexpected flow %s", flow.String())
+		}
+	}
+}
+
+func TestFlowTableCopiesAddresses(t *testing.T) {
+	table := NewFlowTable()
+	now := time.Now()
+
+	pkt := buildTCP(t, "10.0.0.2", "10.0.0.1", 40000, 8080, nil, "S", now)
+	table.Track(pkt)
+	// the capture buffers are reused once the packet has been dispatched
+	data := pkt.Data()
+	for i := range data {
+		data[i] = 0xff
+	}
+
+	if flows := table.Flows(); len(flows) != 1 {
+		t.Fatalf("expected 1 flow, got %d", len(flows))
+	} else if flows[0].Src() != "10.0.0.2:40000" || flows[0].Dst() != "10.0.0.1:8080" {
+		t.Fatalf("flow addresses changed with the packet buffer: %s", flows[0].String())
+	}
+}
+
+func TestFlowTableBandwidth(t *testing.T) {
+	table := NewFlowTable()
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		table.Track(buildTCP(t, "10.0.0.2", "10.0.0.1", 40000, 80, make([]byte, 946), "A", now.Add(-time.Duration(i)*time.Second)))
+	}
+
+	hosts := table.Bandwidth(now)
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(hosts))
+	}
+
+	// 10 packets of 1000 bytes in the last 10 seconds
+	client := hosts[1]
+	if client.Address != "10.0.0.2" {
+		t.Fatalf("unexpected host %s", client.Address)
+	} else if client.Rates[0].Sent != 1000 || client.Rates[0].Received != 0 {
+		t.Fatalf("unexpected 10s rates %+v", client.Rates[0])
+	} else if client.Rates[1].Sent != 10000.0/60.0 {
+		t.Fatalf("unexpected 1m rates %+v", client.Rates[1])
+	} else if server := hosts[0]; server.Total(0) != 1000 {
+		t.Fatalf("unexpected server rates %+v", server.Rates[0])
+	}
+
+	// the history is not accounted once it slides out of the window
+	if rate := table.Bandwidth(now.Add(20 * time.Second))[1].Rates[0]; rate.Sent != 0 {
+		t.Fatalf("expected no recent traffic, got %+v", rate)
+	}
+}
@@ -0,0 +1,113 @@
+package packets
+
+import (
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	NDPFlagRouter    = 0x80
+	NDPFlagSolicited = 0x40
+	NDPFlagOverride  = 0x20
+)
+
+func NewNDPAdvertisement(from net.IP, from_hw net.HardwareAddr, to net.IP, to_hw net.HardwareAddr, router bool) (error, []byte) {
+	eth := layers.Ethernet{
+		SrcMAC:       from_hw,
+		DstMAC:       to_hw,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip6 := layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+		SrcIP:      from,
+		DstIP:      to,
+	}
+	icmp6 := layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0),
+	}
+	icmp6.SetNetworkLayerForChecksum(&ip6)
+
+	flags := uint8(NDPFlagSolicited | NDPFlagOverride)
+	if router {
+		flags |= NDPFlagRouter
+	}
+
+	adv := layers.ICMPv6NeighborAdvertisement{
+		Flags:         flags,
+		TargetAddress: from,
+		Options: layers.ICMPv6Options{
+			{
+				Type: layers.ICMPv6OptTargetAddress,
+				Data: from_hw,
+			},
+		},
+	}
+
+	return Serialize(&eth, &ip6, &icmp6, &adv)
+}
+
+// NDPSolicitedNodeAddress returns the multicast address neighbor solicitations
+// for the given address are sent to, and its ethernet mapping.
+func NDPSolicitedNodeAddress(ip net.IP) (net.IP, net.HardwareAddr) {
+	ip = ip.To16()
+	addr := net.IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0xff, ip[13], ip[14], ip[15]}
+	hw := net.HardwareAddr{0x33, 0x33, addr[12], addr[13], addr[14], addr[15]}
+	return addr, hw
+}
+
+func NewNDPSolicitation(from net.IP, from_hw net.HardwareAddr, to net.IP) (error, []byte) {
+	dst, dst_hw := NDPSolicitedNodeAddress(to)
+
+	eth := layers.Ethernet{
+		SrcMAC:       from_hw,
+		DstMAC:       dst_hw,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip6 := layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+		SrcIP:      from,
+		DstIP:      dst,
+	}
+	icmp6 := layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0),
+	}
+	icmp6.SetNetworkLayerForChecksum(&ip6)
+
+	sol := layers.ICMPv6NeighborSolicitation{
+		TargetAddress: to,
+		Options: layers.ICMPv6Options{
+			{
+				Type: layers.ICMPv6OptSourceAddress,
+				Data: from_hw,
+			},
+		},
+	}
+
+	return Serialize(&eth, &ip6, &icmp6, &sol)
+}
+
+// NDPGetAdvertisedMAC returns the hardware address advertised for the target
+// if the packet is a neighbor advertisement for it.
+func NDPGetAdvertisedMAC(pkt gopacket.Packet, target net.IP) net.HardwareAddr {
+	if ladv := pkt.Layer(layers.LayerTypeICMPv6NeighborAdvertisement); ladv != nil {
+		adv := ladv.(*layers.ICMPv6NeighborAdvertisement)
+		if adv.TargetAddress.Equal(target) {
+			for _, opt := range adv.Options {
+				if opt.Type == layers.ICMPv6OptTargetAddress && len(opt.Data) == 6 {
+					return net.HardwareAddr(opt.Data)
+				}
+			}
+			// the option is not mandatory for solicited advertisements
+			if leth := pkt.Layer(layers.LayerTypeEthernet); leth != nil {
+				return leth.(*layers.Ethernet).SrcMAC
+			}
+		}
+	}
+	return nil
+}
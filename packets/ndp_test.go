@@ -0,0 +1,90 @@
+package packets
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewNDPAdvertisement(t *testing.T) {
+	from := net.ParseIP("fe80::1")
+	from_hw, _ := net.ParseMAC("01:23:45:67:89:ab")
+	to := net.ParseIP("fe80::2")
+	to_hw, _ := net.ParseMAC("ab:89:67:45:23:01")
+
+	err, raw := NewNDPAdvertisement(from, from_hw, to, to_hw, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+	layer := pkt.Layer(layers.LayerTypeICMPv6NeighborAdvertisement)
+	if layer == nil {
+		t.Fatalf("expected a neighbor advertisement, got %v", pkt)
+	}
+
+	adv := layer.(*layers.ICMPv6NeighborAdvertisement)
+	if !adv.TargetAddress.Equal(from) {
+		t.Fatalf("expected '%s', got '%s'", from, adv.TargetAddress)
+	} else if !adv.Router() || !adv.Override() || !adv.Solicited() {
+		t.Fatalf("unexpected flags %x", adv.Flags)
+	} else if len(adv.Options) != 1 || !bytes.Equal(adv.Options[0].Data, from_hw) {
+		t.Fatalf("expected target link-layer address '%s', got %v", from_hw, adv.Options)
+	}
+
+	eth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if !bytes.Equal(eth.DstMAC, to_hw) {
+		t.Fatalf("expected '%s', got '%s'", to_hw, eth.DstMAC)
+	}
+}
+
+func TestNewNDPSolicitation(t *testing.T) {
+	from := net.ParseIP("fe80::1")
+	from_hw, _ := net.ParseMAC("01:23:45:67:89:ab")
+	to := net.ParseIP("fe80::aabb:ccdd")
+
+	err, raw := NewNDPSolicitation(from, from_hw, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+	layer := pkt.Layer(layers.LayerTypeICMPv6NeighborSolicitation)
+	if layer == nil {
+		t.Fatalf("expected a neighbor solicitation, got %v", pkt)
+	}
+
+	sol := layer.(*layers.ICMPv6NeighborSolicitation)
+	if !sol.TargetAddress.Equal(to) {
+		t.Fatalf("expected '%s', got '%s'", to, sol.TargetAddress)
+	} else if len(sol.Options) != 1 || !bytes.Equal(sol.Options[0].Data, from_hw) {
+		t.Fatalf("expected source link-layer address '%s', got %v", from_hw, sol.Options)
+	}
+
+	ip6 := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	eth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if expected := net.ParseIP("ff02::1:ffbb:ccdd"); !ip6.DstIP.Equal(expected) {
+		t.Fatalf("expected '%s', got '%s'", expected, ip6.DstIP)
+	} else if expected, _ := net.ParseMAC("33:33:ff:bb:cc:dd"); !bytes.Equal(eth.DstMAC, expected) {
+		t.Fatalf("expected '%s', got '%s'", expected, eth.DstMAC)
+	}
+}
+
+func TestNDPGetAdvertisedMAC(t *testing.T) {
+	from := net.ParseIP("fe80::2")
+	from_hw, _ := net.ParseMAC("ab:89:67:45:23:01")
+	to := net.ParseIP("fe80::1")
+	to_hw, _ := net.ParseMAC("01:23:45:67:89:ab")
+
+	_, raw := NewNDPAdvertisement(from, from_hw, to, to_hw, false)
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+
+	if hw := NDPGetAdvertisedMAC(pkt, from); !bytes.Equal(hw, from_hw) {
+		t.Fatalf("expected '%s', got '%s'", from_hw, hw)
+	} else if hw := NDPGetAdvertisedMAC(pkt, to); hw != nil {
+		t.Fatalf("unexpected '%s'", hw)
+	}
+}
@@ -0,0 +1,486 @@
+package packets
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	WatchAddressFlapping  = "address_flapping"
+	WatchGratuitousStorm  = "gratuitous_storm"
+	WatchDuplicateGateway = "duplicate_gateway"
+	WatchMultipleAddress  = "multiple_addresses"
+	WatchRogueDHCP        = "rogue_dhcp"
+	WatchRogueDHCP6       = "rogue_dhcp6"
+	WatchRogueRouter      = "rogue_router_advertisement"
+)
+
+const watchTimeFormat = "15:04:05.000"
+
+// how often the bindings, claims, storms and alerts older than their window
+// are dropped
+const watchPruneInterval = time.Minute
+
+var zeroHw = []byte{0, 0, 0, 0, 0, 0}
+
+// WatchAlert is something suspicious a NetWatcher noticed, along with the
+// packets that made it think so.
+type WatchAlert struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Message  string    `json:"message"`
+	Address  string    `json:"address,omitempty"`
+	MACs     []string  `json:"macs"`
+	Evidence []string  `json:"evidence"`
+}
+
+func (a *WatchAlert) String() string {
+	return fmt.Sprintf("%s: %s", a.Kind, a.Message)
+}
+
+type watchBinding struct {
+	mac      string
+	seen     time.Time
+	evidence string
+}
+
+// NetWatcher looks at ARP, NDP, DHCP, DHCPv6 and router advertisements for
+// signs of spoofing and rogue servers. Only the timestamps of the packets
+// are used, so that captures can be replayed.
+type NetWatcher struct {
+	sync.Mutex
+	// address and hardware address of the gateway, if known
+	Gateway    net.IP
+	GatewayMAC net.HardwareAddr
+	// DHCP servers and routers allowed on the network by address or MAC,
+	// if empty the gateway and the first one seen are trusted
+	TrustedServers map[string]bool
+	TrustedRouters map[string]bool
+	// an address moving to another MAC within this time is flapping, and
+	// the addresses a MAC claimed before are forgotten
+	FlapWindow time.Duration
+	// how many gratuitous ARPs or unsolicited neighbor advertisements from
+	// the same MAC within StormWindow make a storm
+	StormThreshold int
+	StormWindow    time.Duration
+	// MACs claiming more addresses than this of the same family are reported
+	MaxAddresses int
+	// the same alert is not repeated more often than this
+	AlertInterval time.Duration
+
+	bindings map[string]*watchBinding
+	claims   map[string]map[string]time.Time
+	storms   map[string][]time.Time
+	learned  map[string]string
+	alerted  map[string]time.Time
+	pruned   time.Time
+}
+
+func NewNetWatcher() *NetWatcher {
+	return &NetWatcher{
+		TrustedServers: make(map[string]bool),
+		TrustedRouters: make(map[string]bool),
+		FlapWindow:     5 * time.Minute,
+		StormThreshold: 10,
+		StormWindow:    10 * time.Second,
+		MaxAddresses:   3,
+		AlertInterval:  time.Minute,
+		bindings:       make(map[string]*watchBinding),
+		claims:         make(map[string]map[string]time.Time),
+		storms:         make(map[string][]time.Time),
+		learned:        make(map[string]string),
+		alerted:        make(map[string]time.Time),
+	}
+}
+
+// Process inspects a packet and returns the alerts it raised, if any.
+func (w *NetWatcher) Process(pkt gopacket.Packet) []*WatchAlert {
+	w.Lock()
+	defer w.Unlock()
+
+	now := pkt.Metadata().Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// timestamps going back, as when another capture is replayed, restart the
+	// pruning clock
+	if since := now.Sub(w.pruned); since >= watchPruneInterval || since < 0 {
+		w.prune(now)
+	}
+
+	var srcMAC net.HardwareAddr
+	if eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		srcMAC = eth.SrcMAC
+	}
+
+	alerts := make([]*WatchAlert, 0)
+	if arp, ok := pkt.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		alerts = w.onARP(alerts, now, arp)
+	} else if adv, ok := pkt.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement); ok {
+		alerts = w.onNeighborAdvertisement(alerts, now, pkt, adv)
+	} else if ra, ok := pkt.Layer(layers.LayerTypeICMPv6RouterAdvertisement).(*layers.ICMPv6RouterAdvertisement); ok {
+		alerts = w.onRouterAdvertisement(alerts, now, pkt, srcMAC, ra)
+	} else if dhcp, ok := pkt.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4); ok {
+		alerts = w.onDHCP(alerts, now, pkt, srcMAC, dhcp)
+	} else if dhcp6, ok := pkt.Layer(layers.LayerTypeDHCPv6).(*layers.DHCPv6); ok {
+		alerts = w.onDHCP6(alerts, now, pkt, srcMAC, dhcp6)
+	}
+
+	return alerts
+}
+
+// prune drops what is too old to raise alerts, the binding of the gateway is
+// kept as it's checked no matter how long it's been.
+func (w *NetWatcher) prune(now time.Time) {
+	w.pruned = now
+
+	for addr, b := range w.bindings {
+		if now.Sub(b.seen) > w.FlapWindow && !w.isGateway(net.ParseIP(addr)) {
+			delete(w.bindings, addr)
+		}
+	}
+
+	for hw, claimed := range w.claims {
+		for addr, seen := range claimed {
+			if now.Sub(seen) > w.FlapWindow {
+				delete(claimed, addr)
+			}
+		}
+		if len(claimed) == 0 {
+			delete(w.claims, hw)
+		}
+	}
+
+	for hw, times := range w.storms {
+		if n := len(times); n == 0 || now.Sub(times[n-1]) > w.StormWindow {
+			delete(w.storms, hw)
+		}
+	}
+
+	for key, last := range w.alerted {
+		if now.Sub(last) >= w.AlertInterval {
+			delete(w.alerted, key)
+		}
+	}
+}
+
+// alert adds the alert unless the same one has been raised recently.
+func (w *NetWatcher) alert(alerts []*WatchAlert, key string, a *WatchAlert) []*WatchAlert {
+	key = a.Kind + "|" + key
+	if last, found := w.alerted[key]; found && a.Time.Sub(last) < w.AlertInterval {
+		return alerts
+	}
+	w.alerted[key] = a.Time
+	return append(alerts, a)
+}
+
+func (w *NetWatcher) isGateway(ip net.IP) bool {
+	return w.Gateway != nil && w.Gateway.Equal(ip)
+}
+
+func (w *NetWatcher) onARP(alerts []*WatchAlert, now time.Time, arp *layers.ARP) []*WatchAlert {
+	ip := net.IP(arp.SourceProtAddress)
+	mac := net.HardwareAddr(arp.SourceHwAddress)
+	// address probes don't claim anything
+	if ip.IsUnspecified() {
+		return alerts
+	}
+
+	op := "request"
+	if arp.Operation == layers.ARPReply {
+		op = "reply"
+	}
+
+	gratuitous := bytes.Equal(arp.SourceProtAddress, arp.DstProtAddress) ||
+		(arp.Operation == layers.ARPReply && (bytes.Equal(arp.DstHwAddress, network.BroadcastHw) || bytes.Equal(arp.DstHwAddress, zeroHw)))
+	if gratuitous {
+		op = "gratuitous " + op
+	}
+
+	evidence := fmt.Sprintf("%s ARP %s: %s is-at %s", now.Format(watchTimeFormat), op, ip, mac)
+	if gratuitous {
+		alerts = w.onGratuitous(alerts, now, mac, evidence)
+	}
+	return w.claim(alerts, now, ip, mac, evidence)
+}
+
+func (w *NetWatcher) onNeighborAdvertisement(alerts []*WatchAlert, now time.Time, pkt gopacket.Packet, adv *layers.ICMPv6NeighborAdvertisement) []*WatchAlert {
+	mac := NDPGetAdvertisedMAC(pkt, adv.TargetAddress)
+	if mac == nil || adv.TargetAddress.IsUnspecified() {
+		return alerts
+	}
+
+	kind := "solicited"
+	if !adv.Solicited() {
+		kind = "unsolicited"
+	}
+
+	evidence := fmt.Sprintf("%s NDP %s advertisement: %s is-at %s", now.Format(watchTimeFormat), kind, adv.TargetAddress, mac)
+	if !adv.Solicited() {
+		alerts = w.onGratuitous(alerts, now, mac, evidence)
+	}
+	return w.claim(alerts, now, adv.TargetAddress, mac, evidence)
+}
+
+func (w *NetWatcher) onGratuitous(alerts []*WatchAlert, now time.Time, mac net.HardwareAddr, evidence string) []*WatchAlert {
+	key := mac.String()
+	recent := make([]time.Time, 0)
+	for _, t := range w.storms[key] {
+		if now.Sub(t) <= w.StormWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	w.storms[key] = recent
+
+	if len(recent) >= w.StormThreshold {
+		alerts = w.alert(alerts, key, &WatchAlert{
+			Time:     now,
+			Kind:     WatchGratuitousStorm,
+			Message:  fmt.Sprintf("%s sent %d gratuitous announcements in %s", mac, len(recent), now.Sub(recent[0]).Round(time.Millisecond)),
+			MACs:     []string{key},
+			Evidence: []string{evidence},
+		})
+	}
+	return alerts
+}
+
+// claim records that mac answers for ip and checks it against what we knew.
+func (w *NetWatcher) claim(alerts []*WatchAlert, now time.Time, ip net.IP, mac net.HardwareAddr, evidence string) []*WatchAlert {
+	addr, hw := ip.String(), mac.String()
+
+	if w.isGateway(ip) && w.GatewayMAC != nil && !bytes.Equal(mac, w.GatewayMAC) {
+		alerts = w.alert(alerts, addr+"|"+hw, &WatchAlert{
+			Time:     now,
+			Kind:     WatchDuplicateGateway,
+			Message:  fmt.Sprintf("%s claims to be the gateway %s, which is %s", hw, addr, w.GatewayMAC),
+			Address:  addr,
+			MACs:     []string{w.GatewayMAC.String(), hw},
+			Evidence: []string{evidence},
+		})
+	} else if b, found := w.bindings[addr]; found && b.mac != hw {
+		if w.isGateway(ip) {
+			alerts = w.alert(alerts, addr, &WatchAlert{
+				Time:     now,
+				Kind:     WatchDuplicateGateway,
+				Message:  fmt.Sprintf("the gateway %s is claimed by both %s and %s", addr, b.mac, hw),
+				Address:  addr,
+				MACs:     []string{b.mac, hw},
+				Evidence: []string{b.evidence, evidence},
+			})
+		} else if now.Sub(b.seen) <= w.FlapWindow {
+			alerts = w.alert(alerts, addr, &WatchAlert{
+				Time:     now,
+				Kind:     WatchAddressFlapping,
+				Message:  fmt.Sprintf("%s moved from %s to %s in %s", addr, b.mac, hw, now.Sub(b.seen).Round(time.Millisecond)),
+				Address:  addr,
+				MACs:     []string{b.mac, hw},
+				Evidence: []string{b.evidence, evidence},
+			})
+		}
+	}
+
+	w.bindings[addr] = &watchBinding{
+		mac:      hw,
+		seen:     now,
+		evidence: evidence,
+	}
+
+	claimed, found := w.claims[hw]
+	if !found {
+		claimed = make(map[string]time.Time)
+		w.claims[hw] = claimed
+	}
+	claimed[addr] = now
+
+	isIPv4 := ip.To4() != nil
+	same := make([]string, 0)
+	for other, seen := range claimed {
+		if now.Sub(seen) > w.FlapWindow {
+			delete(claimed, other)
+		} else if (net.ParseIP(other).To4() != nil) == isIPv4 {
+			same = append(same, other)
+		}
+	}
+
+	if len(same) > w.MaxAddresses {
+		sort.Strings(same)
+		alerts = w.alert(alerts, hw, &WatchAlert{
+			Time:     now,
+			Kind:     WatchMultipleAddress,
+			Message:  fmt.Sprintf("%s claims %d addresses: %v", hw, len(same), same),
+			MACs:     []string{hw},
+			Evidence: []string{evidence},
+		})
+	}
+
+	return alerts
+}
+
+// trusted tells if a server or router is allowed, learning the first one
+// seen of its kind when no trusted list is given.
+func (w *NetWatcher) trusted(kind string, trusted map[string]bool, ip net.IP, mac net.HardwareAddr) bool {
+	if len(trusted) > 0 {
+		return (ip != nil && trusted[ip.String()]) || (mac != nil && trusted[mac.String()])
+	}
+
+	id := mac.String()
+	if mac == nil {
+		id = ip.String()
+	}
+
+	isGateway := w.isGateway(ip) || (w.GatewayMAC != nil && bytes.Equal(mac, w.GatewayMAC))
+	first, found := w.learned[kind]
+	if !found {
+		w.learned[kind] = id
+		return true
+	}
+	return isGateway || first == id
+}
+
+func (w *NetWatcher) onRouterAdvertisement(alerts []*WatchAlert, now time.Time, pkt gopacket.Packet, srcMAC net.HardwareAddr, ra *layers.ICMPv6RouterAdvertisement) []*WatchAlert {
+	var ip net.IP
+	if ip6, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		ip = ip6.SrcIP
+	}
+
+	mac := srcMAC
+	for _, opt := range ra.Options {
+		if opt.Type == layers.ICMPv6OptSourceAddress && len(opt.Data) == 6 {
+			mac = net.HardwareAddr(opt.Data)
+		}
+	}
+
+	if w.trusted(WatchRogueRouter, w.TrustedRouters, ip, mac) {
+		return alerts
+	}
+
+	prefixes := make([]string, 0)
+	for _, opt := range ra.Options {
+		if opt.Type == layers.ICMPv6OptPrefixInfo && len(opt.Data) >= 30 {
+			prefixes = append(prefixes, fmt.Sprintf("%s/%d", net.IP(opt.Data[14:30]), opt.Data[0]))
+		}
+	}
+
+	return w.alert(alerts, mac.String(), &WatchAlert{
+		Time:    now,
+		Kind:    WatchRogueRouter,
+		Message: fmt.Sprintf("unexpected router advertisement from %s (%s)", ip, mac),
+		Address: ip.String(),
+		MACs:    []string{mac.String()},
+		Evidence: []string{fmt.Sprintf("%s router advertisement from %s (%s): lifetime %ds, prefixes %v",
+			now.Format(watchTimeFormat), ip, mac, ra.RouterLifetime, prefixes)},
+	})
+}
+
+func dhcpOption(dhcp *layers.DHCPv4, opt layers.DHCPOpt) []byte {
+	for _, o := range dhcp.Options {
+		if o.Type == opt {
+			return o.Data
+		}
+	}
+	return nil
+}
+
+func dhcpAddresses(data []byte) []string {
+	addrs := make([]string, 0)
+	for i := 0; i+4 <= len(data); i += 4 {
+		addrs = append(addrs, net.IP(data[i:i+4]).String())
+	}
+	return addrs
+}
+
+func (w *NetWatcher) onDHCP(alerts []*WatchAlert, now time.Time, pkt gopacket.Packet, srcMAC net.HardwareAddr, dhcp *layers.DHCPv4) []*WatchAlert {
+	msgType := dhcpOption(dhcp, layers.DHCPOptMessageType)
+	if dhcp.Operation != layers.DHCPOpReply || len(msgType) != 1 {
+		return alerts
+	}
+
+	what := ""
+	switch layers.DHCPMsgType(msgType[0]) {
+	case layers.DHCPMsgTypeOffer:
+		what = "offer"
+	case layers.DHCPMsgTypeAck:
+		what = "ack"
+	default:
+		return alerts
+	}
+
+	var ip net.IP
+	if id := dhcpOption(dhcp, layers.DHCPOptServerID); len(id) == 4 {
+		ip = net.IP(id)
+	} else if ip4, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		ip = ip4.SrcIP
+	}
+
+	if w.trusted(WatchRogueDHCP, w.TrustedServers, ip, srcMAC) {
+		return alerts
+	}
+
+	return w.alert(alerts, ip.String(), &WatchAlert{
+		Time:    now,
+		Kind:    WatchRogueDHCP,
+		Message: fmt.Sprintf("unexpected DHCP server %s (%s)", ip, srcMAC),
+		Address: ip.String(),
+		MACs:    []string{srcMAC.String()},
+		Evidence: []string{fmt.Sprintf("%s DHCP %s from %s (%s): address %s for %s, routers %v, dns %v",
+			now.Format(watchTimeFormat),
+			what,
+			ip,
+			srcMAC,
+			dhcp.YourClientIP,
+			dhcp.ClientHWAddr,
+			dhcpAddresses(dhcpOption(dhcp, layers.DHCPOptRouter)),
+			dhcpAddresses(dhcpOption(dhcp, layers.DHCPOptDNS)))},
+	})
+}
+
+func (w *NetWatcher) onDHCP6(alerts []*WatchAlert, now time.Time, pkt gopacket.Packet, srcMAC net.HardwareAddr, dhcp *layers.DHCPv6) []*WatchAlert {
+	what := ""
+	switch dhcp.MsgType {
+	case layers.DHCPv6MsgTypeAdverstise:
+		what = "advertise"
+	case layers.DHCPv6MsgTypeReply:
+		what = "reply"
+	default:
+		return alerts
+	}
+
+	var ip net.IP
+	if ip6, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		ip = ip6.SrcIP
+	}
+
+	if w.trusted(WatchRogueDHCP6, w.TrustedServers, ip, srcMAC) {
+		return alerts
+	}
+
+	dns := make([]string, 0)
+	for _, opt := range dhcp.Options {
+		if opt.Code == layers.DHCPv6OptDNSServers {
+			for i := 0; i+16 <= len(opt.Data); i += 16 {
+				dns = append(dns, net.IP(opt.Data[i:i+16]).String())
+			}
+		}
+	}
+
+	return w.alert(alerts, ip.String(), &WatchAlert{
+		Time:    now,
+		Kind:    WatchRogueDHCP6,
+		Message: fmt.Sprintf("unexpected DHCPv6 server %s (%s)", ip, srcMAC),
+		Address: ip.String(),
+		MACs:    []string{srcMAC.String()},
+		Evidence: []string{fmt.Sprintf("%s DHCPv6 %s from %s (%s): dns %v",
+			now.Format(watchTimeFormat), what, ip, srcMAC, dns)},
+	})
+}
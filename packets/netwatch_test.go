@@ -0,0 +1,439 @@
+package packets
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	watchGateway    = net.ParseIP("10.0.0.1")
+	watchGatewayMAC = mustMAC("00:00:00:00:00:01")
+	watchVictimMAC  = mustMAC("00:00:00:00:00:10")
+	watchRogueMAC   = mustMAC("00:00:00:00:00:66")
+	watchBase       = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+)
+
+func mustMAC(s string) net.HardwareAddr {
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return hw
+}
+
+type watchFrame struct {
+	at  time.Duration
+	raw []byte
+}
+
+func arpFrame(t *testing.T, at time.Duration, op uint16, from string, fromHw net.HardwareAddr, to string, toHw net.HardwareAddr) watchFrame {
+	if toHw == nil {
+		toHw = network.BroadcastHw
+	}
+	eth, arp := NewARPTo(net.ParseIP(from), fromHw, net.ParseIP(to), toHw, op)
+	err, raw := Serialize(&eth, &arp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return watchFrame{at, raw}
+}
+
+func routerAdvertisementFrame(t *testing.T, at time.Duration, from string, fromHw net.HardwareAddr) watchFrame {
+	eth := layers.Ethernet{
+		SrcMAC:       fromHw,
+		DstMAC:       mustMAC("33:33:00:00:00:01"),
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip6 := layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+		SrcIP:      net.ParseIP(from),
+		DstIP:      net.ParseIP("ff02::1"),
+	}
+	icmp6 := layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeRouterAdvertisement, 0),
+	}
+	icmp6.SetNetworkLayerForChecksum(&ip6)
+
+	prefix := make([]byte, 30)
+	prefix[0] = 64
+	copy(prefix[14:], net.ParseIP("2001:db8::"))
+
+	ra := layers.ICMPv6RouterAdvertisement{
+		HopLimit:       64,
+		RouterLifetime: 1800,
+		Options: layers.ICMPv6Options{
+			{Type: layers.ICMPv6OptSourceAddress, Data: fromHw},
+			{Type: layers.ICMPv6OptPrefixInfo, Data: prefix},
+		},
+	}
+
+	err, raw := Serialize(&eth, &ip6, &icmp6, &ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return watchFrame{at, raw}
+}
+
+func dhcpOfferFrame(t *testing.T, at time.Duration, server string, serverHw net.HardwareAddr) watchFrame {
+	eth := layers.Ethernet{
+		SrcMAC:       serverHw,
+		DstMAC:       watchVictimMAC,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip4 := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(server),
+		DstIP:    net.ParseIP("10.0.0.100"),
+	}
+	udp := layers.UDP{
+		SrcPort: 67,
+		DstPort: 68,
+	}
+	udp.SetNetworkLayerForChecksum(&ip4)
+
+	dhcp := layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          1,
+		YourClientIP: net.ParseIP("10.0.0.100").To4(),
+		ClientHWAddr: watchVictimMAC,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeOffer)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, net.ParseIP(server).To4()),
+			layers.NewDHCPOption(layers.DHCPOptRouter, net.ParseIP(server).To4()),
+			layers.NewDHCPOption(layers.DHCPOptDNS, net.ParseIP(server).To4()),
+			layers.NewDHCPOption(layers.DHCPOptEnd, nil),
+		},
+	}
+
+	err, raw := Serialize(&eth, &ip4, &udp, &dhcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return watchFrame{at, raw}
+}
+
+func dhcp6AdvertiseFrame(t *testing.T, at time.Duration, server string, serverHw net.HardwareAddr) watchFrame {
+	eth := layers.Ethernet{
+		SrcMAC:       serverHw,
+		DstMAC:       watchVictimMAC,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip6 := layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolUDP,
+		HopLimit:   64,
+		SrcIP:      net.ParseIP(server),
+		DstIP:      net.ParseIP("fe80::10"),
+	}
+	udp := layers.UDP{
+		SrcPort: 547,
+		DstPort: 546,
+	}
+	udp.SetNetworkLayerForChecksum(&ip6)
+
+	dhcp := layers.DHCPv6{
+		MsgType:       layers.DHCPv6MsgTypeAdverstise,
+		TransactionID: []byte{1, 2, 3},
+		Options: layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptDNSServers, net.ParseIP(server).To16()),
+		},
+	}
+
+	err, raw := Serialize(&eth, &ip6, &udp, &dhcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return watchFrame{at, raw}
+}
+
+// replayWatch writes the frames to a pcap fixture and feeds it to the
+// watcher, returning all the alerts raised.
+func replayWatch(t *testing.T, w *NetWatcher, frames ...watchFrame) []*WatchAlert {
+	dir, err := ioutil.TempDir("", "netwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture := filepath.Join(dir, "fixture.pcap")
+	fp, err := os.Create(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := pcapgo.NewWriter(fp)
+	writer.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	for _, f := range frames {
+		writer.WritePacket(gopacket.CaptureInfo{
+			Timestamp:     watchBase.Add(f.at),
+			CaptureLength: len(f.raw),
+			Length:        len(f.raw),
+		}, f.raw)
+	}
+	fp.Close()
+
+	if fp, err = os.Open(fixture); err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	reader, err := pcapgo.NewReader(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := make([]*WatchAlert, 0)
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		pkt := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+		pkt.Metadata().CaptureInfo = ci
+		alerts = append(alerts, w.Process(pkt)...)
+	}
+	return alerts
+}
+
+func alertsOf(alerts []*WatchAlert, kind string) []*WatchAlert {
+	found := make([]*WatchAlert, 0)
+	for _, a := range alerts {
+		if a.Kind == kind {
+			found = append(found, a)
+		}
+	}
+	return found
+}
+
+func TestNetWatchNoAlerts(t *testing.T) {
+	w := NewNetWatcher()
+	w.Gateway, w.GatewayMAC = watchGateway, watchGatewayMAC
+
+	alerts := replayWatch(t, w,
+		arpFrame(t, 0, layers.ARPRequest, "10.0.0.10", watchVictimMAC, "10.0.0.1", nil),
+		arpFrame(t, time.Second, layers.ARPReply, "10.0.0.1", watchGatewayMAC, "10.0.0.10", watchVictimMAC),
+		arpFrame(t, time.Minute, layers.ARPRequest, "10.0.0.10", watchVictimMAC, "10.0.0.1", nil),
+		dhcpOfferFrame(t, 2*time.Minute, "10.0.0.1", watchGatewayMAC),
+		routerAdvertisementFrame(t, 3*time.Minute, "fe80::1", watchGatewayMAC),
+	)
+
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %v", alerts)
+	}
+}
+
+func TestNetWatchAddressFlapping(t *testing.T) {
+	w := NewNetWatcher()
+	alerts := replayWatch(t, w,
+		arpFrame(t, 0, layers.ARPReply, "10.0.0.20", watchVictimMAC, "10.0.0.30", nil),
+		arpFrame(t, time.Second, layers.ARPReply, "10.0.0.20", watchRogueMAC, "10.0.0.30", nil),
+		// the same alert is not repeated
+		arpFrame(t, 2*time.Second, layers.ARPReply, "10.0.0.20", watchVictimMAC, "10.0.0.30", nil),
+	)
+
+	flapping := alertsOf(alerts, WatchAddressFlapping)
+	if len(flapping) != 1 {
+		t.Fatalf("expected one flapping alert, got %v", alerts)
+	} else if a := flapping[0]; a.Address != "10.0.0.20" || len(a.MACs) != 2 || len(a.Evidence) != 2 {
+		t.Fatalf("unexpected alert %+v", a)
+	} else if a.MACs[0] != watchVictimMAC.String() || a.MACs[1] != watchRogueMAC.String() {
+		t.Fatalf("unexpected MACs %v", a.MACs)
+	}
+
+	// an address changing owner after a long time is not flapping
+	w = NewNetWatcher()
+	alerts = replayWatch(t, w,
+		arpFrame(t, 0, layers.ARPReply, "10.0.0.20", watchVictimMAC, "10.0.0.30", nil),
+		arpFrame(t, time.Hour, layers.ARPReply, "10.0.0.20", watchRogueMAC, "10.0.0.30", nil),
+	)
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %v", alerts)
+	}
+}
+
+func TestNetWatchDuplicateGateway(t *testing.T) {
+	// known gateway MAC
+	w := NewNetWatcher()
+	w.Gateway, w.GatewayMAC = watchGateway, watchGatewayMAC
+	alerts := replayWatch(t, w,
+		arpFrame(t, 0, layers.ARPReply, "10.0.0.1", watchRogueMAC, "10.0.0.10", watchVictimMAC),
+	)
+	if dups := alertsOf(alerts, WatchDuplicateGateway); len(dups) != 1 {
+		t.Fatalf("expected a duplicate gateway alert, got %v", alerts)
+	}
+
+	// unknown gateway MAC, no matter how long it's been
+	w = NewNetWatcher()
+	w.Gateway = watchGateway
+	alerts = replayWatch(t, w,
+		arpFrame(t, 0, layers.ARPReply, "10.0.0.1", watchGatewayMAC, "10.0.0.10", watchVictimMAC),
+		arpFrame(t, time.Hour, layers.ARPReply, "10.0.0.1", watchRogueMAC, "10.0.0.10", watchVictimMAC),
+	)
+	if dups := alertsOf(alerts, WatchDuplicateGateway); len(dups) != 1 {
+		t.Fatalf("expected a duplicate gateway alert, got %v", alerts)
+	}
+}
+
+func TestNetWatchGratuitousStorm(t *testing.T) {
+	w := NewNetWatcher()
+	frames := make([]watchFrame, 0)
+	for i := 0; i < w.StormThreshold; i++ {
+		frames = append(frames, arpFrame(t, time.Duration(i)*100*time.Millisecond, layers.ARPRequest, "10.0.0.66", watchRogueMAC, "10.0.0.66", nil))
+	}
+
+	alerts := replayWatch(t, w, frames...)
+	if storms := alertsOf(alerts, WatchGratuitousStorm); len(storms) != 1 {
+		t.Fatalf("expected one storm alert, got %v", alerts)
+	} else if storms[0].MACs[0] != watchRogueMAC.String() {
+		t.Fatalf("unexpected MACs %v", storms[0].MACs)
+	}
+
+	// the same number spread over a longer time is fine
+	w = NewNetWatcher()
+	frames = frames[:0]
+	for i := 0; i < w.StormThreshold; i++ {
+		frames = append(frames, arpFrame(t, time.Duration(i)*time.Minute, layers.ARPRequest, "10.0.0.66", watchRogueMAC, "10.0.0.66", nil))
+	}
+	if alerts = replayWatch(t, w, frames...); len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %v", alerts)
+	}
+}
+
+func TestNetWatchMultipleAddresses(t *testing.T) {
+	w := NewNetWatcher()
+	frames := make([]watchFrame, 0)
+	for i, ip := range []string{"10.0.0.20", "10.0.0.21", "10.0.0.22", "10.0.0.23"} {
+		frames = append(frames, arpFrame(t, time.Duration(i)*time.Second, layers.ARPReply, ip, watchRogueMAC, "10.0.0.10", watchVictimMAC))
+	}
+
+	alerts := replayWatch(t, w, frames...)
+	if multi := alertsOf(alerts, WatchMultipleAddress); len(multi) != 1 {
+		t.Fatalf("expected one multiple addresses alert, got %v", alerts)
+	}
+}
+
+func TestNetWatchNeighborAdvertisement(t *testing.T) {
+	w := NewNetWatcher()
+
+	err, legit := NewNDPAdvertisement(net.ParseIP("fe80::20"), watchVictimMAC, net.ParseIP("fe80::30"), watchGatewayMAC, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, spoofed := NewNDPAdvertisement(net.ParseIP("fe80::20"), watchRogueMAC, net.ParseIP("fe80::30"), watchGatewayMAC, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := replayWatch(t, w, watchFrame{0, legit}, watchFrame{time.Second, spoofed})
+	if flapping := alertsOf(alerts, WatchAddressFlapping); len(flapping) != 1 {
+		t.Fatalf("expected one flapping alert, got %v", alerts)
+	} else if flapping[0].Address != "fe80::20" {
+		t.Fatalf("unexpected address %s", flapping[0].Address)
+	}
+}
+
+func TestNetWatchRogueDHCP(t *testing.T) {
+	w := NewNetWatcher()
+	alerts := replayWatch(t, w,
+		dhcpOfferFrame(t, 0, "10.0.0.2", watchGatewayMAC),
+		dhcpOfferFrame(t, time.Second, "10.0.0.66", watchRogueMAC),
+		dhcp6AdvertiseFrame(t, 2*time.Second, "fe80::2", watchGatewayMAC),
+		dhcp6AdvertiseFrame(t, 3*time.Second, "fe80::66", watchRogueMAC),
+	)
+
+	if rogue := alertsOf(alerts, WatchRogueDHCP); len(rogue) != 1 {
+		t.Fatalf("expected one rogue DHCP alert, got %v", alerts)
+	} else if rogue[0].Address != "10.0.0.66" || len(rogue[0].Evidence) != 1 {
+		t.Fatalf("unexpected alert %+v", rogue[0])
+	}
+
+	if rogue := alertsOf(alerts, WatchRogueDHCP6); len(rogue) != 1 {
+		t.Fatalf("expected one rogue DHCPv6 alert, got %v", alerts)
+	} else if rogue[0].Address != "fe80::66" {
+		t.Fatalf("unexpected alert %+v", rogue[0])
+	}
+
+	// with a trusted list, the first server is not trusted anymore
+	w = NewNetWatcher()
+	w.TrustedServers["10.0.0.2"] = true
+	alerts = replayWatch(t, w, dhcpOfferFrame(t, 0, "10.0.0.66", watchRogueMAC))
+	if rogue := alertsOf(alerts, WatchRogueDHCP); len(rogue) != 1 {
+		t.Fatalf("expected one rogue DHCP alert, got %v", alerts)
+	}
+}
+
+func TestNetWatchRogueRouter(t *testing.T) {
+	w := NewNetWatcher()
+	w.GatewayMAC = watchGatewayMAC
+	alerts := replayWatch(t, w,
+		routerAdvertisementFrame(t, 0, "fe80::1", watchGatewayMAC),
+		routerAdvertisementFrame(t, time.Second, "fe80::66", watchRogueMAC),
+	)
+
+	if rogue := alertsOf(alerts, WatchRogueRouter); len(rogue) != 1 {
+		t.Fatalf("expected one rogue router alert, got %v", alerts)
+	} else if rogue[0].MACs[0] != watchRogueMAC.String() {
+		t.Fatalf("unexpected MACs %v", rogue[0].MACs)
+	}
+}
+
+func TestNetWatchPrune(t *testing.T) {
+	w := NewNetWatcher()
+	w.Gateway = watchGateway
+
+	frames := []watchFrame{
+		arpFrame(t, 0, layers.ARPReply, "10.0.0.1", watchGatewayMAC, "10.0.0.10", watchVictimMAC),
+		arpFrame(t, 0, layers.ARPReply, "10.0.0.20", watchVictimMAC, "10.0.0.10", watchVictimMAC),
+	}
+	for i := 0; i < w.StormThreshold; i++ {
+		frames = append(frames, arpFrame(t, time.Duration(i)*100*time.Millisecond, layers.ARPRequest, "10.0.0.66", watchRogueMAC, "10.0.0.66", nil))
+	}
+	// only what this one claims should be kept, besides the gateway
+	frames = append(frames, arpFrame(t, time.Hour, layers.ARPRequest, "10.0.0.40", watchVictimMAC, "10.0.0.1", nil))
+
+	if alerts := replayWatch(t, w, frames...); len(alertsOf(alerts, WatchGratuitousStorm)) != 1 {
+		t.Fatalf("expected one storm alert, got %v", alerts)
+	}
+
+	tests := []struct {
+		name string
+		got  int
+		exp  int
+	}{
+		{"bindings", len(w.bindings), 2},
+		{"claims", len(w.claims), 1},
+		{"storms", len(w.storms), 0},
+		{"alerted", len(w.alerted), 0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.exp {
+			t.Errorf("expected %d %s, got %d", tt.exp, tt.name, tt.got)
+		}
+	}
+
+	if _, found := w.bindings["10.0.0.1"]; !found {
+		t.Error("expected the gateway binding to be kept")
+	} else if claimed := w.claims[watchVictimMAC.String()]; len(claimed) != 1 {
+		t.Errorf("expected one address claimed, got %v", claimed)
+	}
+}
@@ -11,7 +11,6 @@ import (
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
 )
 
 type Activity struct {
@@ -31,6 +30,7 @@ type Stats struct {
 	Received    uint64 `json:"received"`
 	PktReceived uint64 `json:"pkts_received"`
 	Errors      uint64 `json:"errors"`
+	Dropped     uint64 `json:"pkts_dropped"`
 }
 
 type Queue struct {
@@ -40,14 +40,16 @@ type Queue struct {
 	Stats      Stats
 	Protos     sync.Map
 	Traffic    sync.Map
+	Flows      *FlowTable
 	Activities chan Activity
 
 	iface      *network.Endpoint
-	handle     *pcap.Handle
+	handle     *Subscription
 	source     *gopacket.PacketSource
 	srcChannel chan gopacket.Packet
 	writes     *sync.WaitGroup
 	active     bool
+	recorder   func(raw []byte)
 }
 
 type queueJSON struct {
@@ -61,6 +63,7 @@ func NewQueue(iface *network.Endpoint) (q *Queue, err error) {
 		Protos:     sync.Map{},
 		Traffic:    sync.Map{},
 		Stats:      Stats{},
+		Flows:      NewFlowTable(),
 		Activities: make(chan Activity),
 
 		writes: &sync.WaitGroup{},
@@ -69,7 +72,7 @@ func NewQueue(iface *network.Endpoint) (q *Queue, err error) {
 	}
 
 	if q.active {
-		if q.handle, err = pcap.OpenLive(iface.Name(), 1024, true, pcap.BlockForever); err != nil {
+		if err, q.handle = Subscribe(iface.Name(), ""); err != nil {
 			return
 		}
 
@@ -183,10 +186,12 @@ func (q *Queue) worker() {
 		}
 
 		q.trackProtocols(pkt)
+		q.Flows.Track(pkt)
 
 		pktSize := uint64(len(pkt.Data()))
 
 		q.TrackPacket(pktSize)
+		atomic.StoreUint64(&q.Stats.Dropped, q.handle.Dropped())
 
 		// decode eth and ipv4 layers
 		leth := pkt.Layer(layers.LayerTypeEthernet)
@@ -218,11 +223,53 @@ func (q *Queue) worker() {
 	}
 }
 
+// Record makes Send pass every packet to the callback instead of injecting
+// it, a nil callback restores the normal behaviour.
+func (q *Queue) Record(cb func(raw []byte)) {
+	q.Lock()
+	defer q.Unlock()
+	q.recorder = cb
+}
+
+// checkScope returns an error if the packet is directed to a host which is
+// out of the scope of the engagement.
+func checkScope(scope *network.Scope, raw []byte) error {
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+	if eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		if err := scope.CheckMAC(eth.DstMAC, "packet injection"); err != nil {
+			return err
+		}
+	}
+
+	if arp, ok := pkt.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		if err := scope.CheckMAC(arp.DstHwAddress, "packet injection"); err != nil {
+			return err
+		}
+		return scope.CheckIP(arp.DstProtAddress, "packet injection")
+	} else if ip4, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		return scope.CheckIP(ip4.DstIP, "packet injection")
+	} else if ip6, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		return scope.CheckIP(ip6.DstIP, "packet injection")
+	}
+
+	return nil
+}
+
 func (q *Queue) Send(raw []byte) error {
 	q.Lock()
 	defer q.Unlock()
 
-	if !q.active {
+	if scope := network.GetScope(); scope != nil {
+		if err := checkScope(scope, raw); err != nil {
+			return err
+		}
+	}
+
+	if q.recorder != nil {
+		q.recorder(raw)
+		return nil
+	} else if !q.active {
 		return fmt.Errorf("Packet queue is not active.")
 	}
 
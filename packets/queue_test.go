@@ -4,6 +4,8 @@ import (
 	"net"
 	"reflect"
 	"testing"
+
+	"github.com/bettercap/bettercap/network"
 )
 
 func TestQueueActivity(t *testing.T) {
@@ -54,6 +56,7 @@ func TestQueueStats(t *testing.T) {
 		{s.Received, uint64(0)},
 		{s.PktReceived, uint64(0)},
 		{s.Errors, uint64(0)},
+		{s.Dropped, uint64(0)},
 	}
 	for _, u := range units {
 		if !reflect.DeepEqual(u.exp, u.got) {
@@ -63,3 +66,26 @@ func TestQueueStats(t *testing.T) {
 }
 
 // TODO: add tests for the rest of queue.go
+
+func TestQueueCheckScope(t *testing.T) {
+	err, scope := network.NewScope(network.ScopeDefinition{
+		ScopeRules: network.ScopeRules{
+			CIDRs: []string{"192.168.1.0/24"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := net.ParseIP("192.168.1.2")
+	from_hw, _ := net.ParseMAC("01:23:45:67:89:ab")
+	to_hw, _ := net.ParseMAC("ab:89:67:45:23:01")
+
+	if _, pkt := NewARPReply(from, from_hw, net.ParseIP("192.168.1.1"), to_hw); checkScope(scope, pkt) != nil {
+		t.Fatalf("expected ARP reply to an in scope host to be allowed")
+	} else if _, pkt := NewARPReply(from, from_hw, net.ParseIP("192.168.2.1"), to_hw); checkScope(scope, pkt) == nil {
+		t.Fatalf("expected ARP reply to an out of scope host to be refused")
+	} else if _, pkt := NewTCPSyn(from, from_hw, net.ParseIP("10.0.0.1"), to_hw, 6666, 80); checkScope(scope, pkt) == nil {
+		t.Fatalf("expected SYN to an out of scope host to be refused")
+	}
+}
@@ -0,0 +1,248 @@
+package packets
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+const (
+	// every subscriber shares the same capture, so it must be large enough
+	// for the most demanding one
+	SharedSnaplen = 65536
+	// packets buffered for each subscriber before they start being dropped
+	SubscriptionBuffer = 4096
+)
+
+type capturedPacket struct {
+	data []byte
+	ci   gopacket.CaptureInfo
+}
+
+// sharedCapture reads the packets of an interface once and dispatches them
+// to every subscription whose filter matches.
+type sharedCapture struct {
+	sync.RWMutex
+	iface       string
+	handle      Handle
+	writeLock   sync.Mutex
+	subscribers map[*Subscription]bool
+	stopping    int32
+}
+
+var (
+	capturesLock = sync.Mutex{}
+	captures     = make(map[string]*sharedCapture)
+)
+
+// Subscription is a Handle receiving the packets of a capture shared with
+// the other subscribers of the same interface. The packet buffers are shared
+// too and must not be modified.
+type Subscription struct {
+	capture *sharedCapture
+	packets chan capturedPacket
+	filter  *pcap.BPF
+	lock    sync.RWMutex
+	closed  bool
+	dropped uint64
+}
+
+// Subscribe returns a handle on the capture of iface, opening it with the
+// selected backend if this is the first subscription. If filter is not empty
+// only the matching packets are delivered.
+func Subscribe(iface string, filter string) (error, *Subscription) {
+	capturesLock.Lock()
+	defer capturesLock.Unlock()
+
+	capture, found := captures[iface]
+	if !found {
+		err, handle := OpenCapture(iface, CaptureOptions{
+			Snaplen: SharedSnaplen,
+			Promisc: true,
+			/*
+			 * We don't want to pcap.BlockForever otherwise pcap_close(handle)
+			 * could hang waiting for a timeout to expire ...
+			 */
+			Timeout: 500 * time.Millisecond,
+		})
+		if err != nil {
+			return err, nil
+		}
+
+		capture = &sharedCapture{
+			iface:       iface,
+			handle:      handle,
+			subscribers: make(map[*Subscription]bool),
+		}
+		captures[iface] = capture
+	}
+
+	sub := &Subscription{
+		capture: capture,
+		packets: make(chan capturedPacket, SubscriptionBuffer),
+	}
+
+	if filter != "" {
+		if err := sub.SetBPFFilter(filter); err != nil {
+			if !found {
+				delete(captures, iface)
+				capture.stop()
+			}
+			return err, nil
+		}
+	}
+
+	capture.Lock()
+	capture.subscribers[sub] = true
+	capture.Unlock()
+
+	// start reading only once the first subscriber is in place
+	if !found {
+		go capture.dispatcher()
+	}
+
+	return nil, sub
+}
+
+func (c *sharedCapture) dispatcher() {
+	for atomic.LoadInt32(&c.stopping) == 0 {
+		data, ci, err := c.handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		} else if err != nil {
+			// the handle has been closed or the source is exhausted
+			break
+		}
+
+		pkt := capturedPacket{data: data, ci: ci}
+
+		c.RLock()
+		for sub := range c.subscribers {
+			sub.deliver(pkt)
+		}
+		c.RUnlock()
+	}
+
+	capturesLock.Lock()
+	if captures[c.iface] == c {
+		delete(captures, c.iface)
+	}
+	capturesLock.Unlock()
+
+	c.Lock()
+	for sub := range c.subscribers {
+		sub.terminate()
+	}
+	c.subscribers = make(map[*Subscription]bool)
+	c.Unlock()
+
+	c.stop()
+}
+
+func (c *sharedCapture) stop() {
+	if atomic.CompareAndSwapInt32(&c.stopping, 0, 1) {
+		c.handle.Close()
+	}
+}
+
+func (c *sharedCapture) unsubscribe(sub *Subscription) {
+	// hold the captures lock so that the capture can't be picked up by a
+	// new subscription while it's being closed
+	capturesLock.Lock()
+	defer capturesLock.Unlock()
+
+	c.Lock()
+	delete(c.subscribers, sub)
+	last := len(c.subscribers) == 0
+	c.Unlock()
+
+	if last {
+		if captures[c.iface] == c {
+			delete(captures, c.iface)
+		}
+		c.stop()
+	}
+}
+
+func (s *Subscription) deliver(pkt capturedPacket) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return
+	} else if s.filter != nil && !s.filter.Matches(pkt.ci, pkt.data) {
+		return
+	}
+
+	select {
+	case s.packets <- pkt:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// terminate closes the packets channel so that pending reads return io.EOF.
+func (s *Subscription) terminate() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	close(s.packets)
+	return true
+}
+
+func (s *Subscription) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if pkt, ok := <-s.packets; !ok {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	} else {
+		return pkt.data, pkt.ci, nil
+	}
+}
+
+func (s *Subscription) LinkType() layers.LinkType {
+	return s.capture.handle.LinkType()
+}
+
+// SetBPFFilter compiles expr and applies it in userspace to the packets of
+// this subscription only.
+func (s *Subscription) SetBPFFilter(expr string) error {
+	var filter *pcap.BPF
+	if expr != "" {
+		var err error
+		if filter, err = pcap.NewBPF(s.LinkType(), SharedSnaplen, expr); err != nil {
+			return fmt.Errorf("error while compiling filter '%s': %v", expr, err)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.filter = filter
+	return nil
+}
+
+func (s *Subscription) WritePacketData(data []byte) error {
+	s.capture.writeLock.Lock()
+	defer s.capture.writeLock.Unlock()
+	return s.capture.handle.WritePacketData(data)
+}
+
+// Dropped returns the number of packets lost because the subscriber was not
+// reading them fast enough.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) Close() {
+	if s.terminate() {
+		s.capture.unsubscribe(s)
+	}
+}
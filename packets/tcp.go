@@ -27,3 +27,26 @@ func NewTCPSyn(from net.IP, from_hw net.HardwareAddr, to net.IP, to_hw net.Hardw
 
 	return Serialize(&eth, &ip4, &tcp)
 }
+
+func NewTCP6Syn(from net.IP, from_hw net.HardwareAddr, to net.IP, to_hw net.HardwareAddr, srcPort int, dstPort int) (error, []byte) {
+	eth := layers.Ethernet{
+		SrcMAC:       from_hw,
+		DstMAC:       to_hw,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip6 := layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolTCP,
+		HopLimit:   64,
+		SrcIP:      from,
+		DstIP:      to,
+	}
+	tcp := layers.TCP{
+		SrcPort: layers.TCPPort(srcPort),
+		DstPort: layers.TCPPort(dstPort),
+		SYN:     true,
+	}
+	tcp.SetNetworkLayerForChecksum(&ip6)
+
+	return Serialize(&eth, &ip6, &tcp)
+}
@@ -0,0 +1,36 @@
+package packets
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewTCP6Syn(t *testing.T) {
+	from := net.ParseIP("fd00::1")
+	from_hw, _ := net.ParseMAC("01:23:45:67:89:ab")
+	to := net.ParseIP("fd00::2")
+	to_hw, _ := net.ParseMAC("ab:89:67:45:23:01")
+
+	err, raw := NewTCP6Syn(from, from_hw, to, to_hw, 666, 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+	ip6, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok {
+		t.Fatalf("expected an IPv6 packet, got %v", pkt)
+	} else if !ip6.SrcIP.Equal(from) || !ip6.DstIP.Equal(to) {
+		t.Fatalf("unexpected addresses %s -> %s", ip6.SrcIP, ip6.DstIP)
+	}
+
+	tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		t.Fatalf("expected a TCP segment, got %v", pkt)
+	} else if !tcp.SYN || tcp.ACK || tcp.SrcPort != 666 || tcp.DstPort != 22 {
+		t.Fatalf("unexpected segment %v", tcp)
+	}
+}
@@ -0,0 +1,91 @@
+package packets
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	// NTP v4 client request.
+	NTPRequest = append([]byte{0xe3}, make([]byte, 47)...)
+
+	// SNMP v1 get-request of sysDescr.0 with the "public" community.
+	SNMPRequest = []byte{
+		0x30, 0x29, 0x02, 0x01, 0x00, 0x04, 0x06, 0x70, 0x75, 0x62,
+		0x6c, 0x69, 0x63, 0xa0, 0x1c, 0x02, 0x04, 0x62, 0x65, 0x74,
+		0x74, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00, 0x30, 0x0e, 0x30,
+		0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01,
+		0x00, 0x05, 0x00,
+	}
+
+	// IKEv1 main mode request with a single 3DES/SHA1/PSK/MODP1024 proposal.
+	IKERequest = []byte{
+		// header
+		0x62, 0x65, 0x74, 0x74, 0x65, 0x72, 0x63, 0x70,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x10, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x50,
+		// security association
+		0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01,
+		// proposal
+		0x00, 0x00, 0x00, 0x28, 0x01, 0x01, 0x00, 0x01,
+		// transform
+		0x00, 0x00, 0x00, 0x20, 0x01, 0x01, 0x00, 0x00,
+		0x80, 0x01, 0x00, 0x05, 0x80, 0x02, 0x00, 0x02,
+		0x80, 0x03, 0x00, 0x01, 0x80, 0x04, 0x00, 0x02,
+		0x80, 0x0b, 0x00, 0x01, 0x80, 0x0c, 0x70, 0x80,
+	}
+
+	// MS-SQL browser service instances enumeration.
+	MSSQLBrowserRequest = []byte{0x02}
+
+	// DNS server version request and mDNS services enumeration.
+	DNSRequest  = dnsQuery("version.bind", layers.DNSTypeTXT, layers.DNSClassCH)
+	MDNSRequest = dnsQuery("_services._dns-sd._udp.local", layers.DNSTypePTR, layers.DNSClassIN)
+
+	// UDPProbes maps well known ports to payloads the services listening
+	// on them are likely to answer to.
+	UDPProbes = map[int][]byte{
+		53:       DNSRequest,
+		123:      NTPRequest,
+		NBNSPort: NBNSRequest,
+		161:      SNMPRequest,
+		500:      IKERequest,
+		1434:     MSSQLBrowserRequest,
+		UPNPPort: UPNPDiscoveryPayload,
+		WSDPort:  WSDDiscoveryPayload,
+		// IKE with NAT traversal, prefixed by the non-ESP marker
+		4500:     append([]byte{0x00, 0x00, 0x00, 0x00}, IKERequest...),
+		MDNSPort: MDNSRequest,
+	}
+)
+
+func dnsQuery(name string, qtype layers.DNSType, qclass layers.DNSClass) []byte {
+	dns := layers.DNS{
+		ID:     0xbeef,
+		OpCode: layers.DNSOpCodeQuery,
+		Questions: []layers.DNSQuestion{
+			{
+				Name:  []byte(name),
+				Type:  qtype,
+				Class: qclass,
+			},
+		},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := dns.SerializeTo(buf, SerializationOptions); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// UDPProbeFor returns the payload to send in order to check if the UDP
+// port is open, an empty one if the port has no known service.
+func UDPProbeFor(port int) []byte {
+	if payload, found := UDPProbes[port]; found {
+		return payload
+	}
+	return []byte{}
+}
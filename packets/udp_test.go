@@ -0,0 +1,59 @@
+package packets
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewUDPPacket(t *testing.T) {
+	from := net.ParseIP("192.168.1.2").To4()
+	from_hw, _ := net.ParseMAC("01:23:45:67:89:ab")
+	to := net.ParseIP("192.168.1.1").To4()
+	to_hw, _ := net.ParseMAC("ab:89:67:45:23:01")
+
+	for port, payload := range UDPProbes {
+		err, raw := NewUDPPacket(from, from_hw, to, to_hw, 666, port, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+		layer := pkt.Layer(layers.LayerTypeUDP)
+		if layer == nil {
+			t.Fatalf("expected an udp packet, got %v", pkt)
+		}
+
+		udp := layer.(*layers.UDP)
+		if udp.SrcPort != 666 || int(udp.DstPort) != port {
+			t.Fatalf("unexpected ports %d -> %d", udp.SrcPort, udp.DstPort)
+		} else if !bytes.Equal(udp.Payload, payload) {
+			t.Fatalf("port %d: unexpected payload %x", port, udp.Payload)
+		} else if eth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); !bytes.Equal(eth.DstMAC, to_hw) {
+			t.Fatalf("expected '%s', got '%s'", to_hw, eth.DstMAC)
+		}
+	}
+}
+
+func TestUDPProbeFor(t *testing.T) {
+	if probe := UDPProbeFor(31337); len(probe) != 0 {
+		t.Fatalf("expected empty probe, got %x", probe)
+	}
+
+	dns := layers.DNS{}
+	if err := dns.DecodeFromBytes(UDPProbeFor(53), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	} else if len(dns.Questions) != 1 || string(dns.Questions[0].Name) != "version.bind" || dns.Questions[0].Class != layers.DNSClassCH {
+		t.Fatalf("unexpected dns questions %v", dns.Questions)
+	}
+
+	// the lengths encoded in the headers must match the payloads
+	if snmp := UDPProbeFor(161); int(snmp[1])+2 != len(snmp) {
+		t.Fatalf("unexpected snmp message length %d", snmp[1])
+	} else if ike := UDPProbeFor(500); int(ike[27]) != len(ike) {
+		t.Fatalf("unexpected ike message length %d", ike[27])
+	}
+}
@@ -252,7 +252,7 @@ func (m *SessionModule) SetRunning(running bool, cb func()) error {
 		for _, modName := range m.Required() {
 			if m.Session.IsOn(modName) == false {
 				m.Info("starting %s as a requirement for %s", modName, m.Name)
-				if err := m.Session.Run(modName + " on"); err != nil {
+				if err := m.Session.RunFrom(SourceModule+":"+m.Name, modName+" on"); err != nil {
 					return fmt.Errorf("error while starting module %s as a requirement for %s: %v", modName, m.Name, err)
 				}
 			}
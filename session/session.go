@@ -26,6 +26,9 @@ import (
 	"github.com/evilsocket/islazy/ops"
 	"github.com/evilsocket/islazy/str"
 	"github.com/evilsocket/islazy/tui"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 )
 
 const (
@@ -62,9 +65,15 @@ type GPS struct {
 	Separation    float64 // Geoidal separation
 }
 
-const AliasesFile = "~/bettercap.aliases"
+const (
+	AliasesFile     = "~/bettercap.aliases"
+	AnnotationsFile = "~/bettercap.annotations"
+)
 
-var aliasesFileName, _ = fs.Expand(AliasesFile)
+var (
+	aliasesFileName, _     = fs.Expand(AliasesFile)
+	annotationsFileName, _ = fs.Expand(AnnotationsFile)
+)
 
 type Session struct {
 	Options   core.Options
@@ -81,6 +90,8 @@ type Session struct {
 	GPS       GPS
 	Modules   ModuleList
 	Aliases   *data.UnsortedKV
+	// tags and notes of the hosts
+	Annotations *network.Annotations
 
 	Input            *readline.Instance
 	Prompt           Prompt
@@ -89,6 +100,13 @@ type Session struct {
 	EventsIgnoreList *EventsIgnoreList
 	UnkCmdCallback   UnknownCommandCallback
 	Firewall         firewall.FirewallManager
+	DryRun           *DryRun
+	Audit            *AuditLog
+	Journal          *Journal
+	Jobs             *Jobs
+	Workspace        *Workspace
+
+	fw *switchableFirewall
 }
 
 func New() (*Session, error) {
@@ -114,8 +132,11 @@ func New() (*Session, error) {
 		Events:           nil,
 		EventsIgnoreList: NewEventsIgnoreList(),
 		UnkCmdCallback:   nil,
+		DryRun:           NewDryRun(),
 	}
 
+	s.Jobs = NewJobs(s.RunFrom)
+
 	if *s.Options.CpuProfile != "" {
 		if f, err := os.Create(*s.Options.CpuProfile); err != nil {
 			return nil, err
@@ -132,8 +153,29 @@ func New() (*Session, error) {
 		return nil, err
 	}
 
+	if err, s.Annotations = network.LoadAnnotations(annotationsFileName); err != nil {
+		return nil, err
+	}
+	network.SetAnnotations(s.Annotations)
+
+	if err, s.Journal = LoadJournal(journalFileName); err != nil {
+		return nil, err
+	}
+
+	if *s.Options.AuditFile != "" {
+		if err, s.Audit = OpenAuditLog(*s.Options.AuditFile); err != nil {
+			return nil, err
+		}
+	}
+
 	s.Events = NewEventPool(*s.Options.Debug, *s.Options.Silent)
 
+	if *s.Options.Scope != "" {
+		if err = s.loadScope(*s.Options.Scope); err != nil {
+			return nil, err
+		}
+	}
+
 	s.registerCoreHandlers()
 
 	if I == nil {
@@ -181,6 +223,8 @@ func (s *Session) Close() {
 	}
 
 	s.Firewall.Restore()
+	s.closeDryRun()
+	s.closeWorkspace()
 
 	if *s.Options.EnvFile != "" {
 		envFile, _ := fs.Expand(*s.Options.EnvFile)
@@ -189,6 +233,10 @@ func (s *Session) Close() {
 		}
 	}
 
+	if s.Audit != nil {
+		s.Audit.Close()
+	}
+
 	if *s.Options.CpuProfile != "" {
 		pprof.StopCPUProfile()
 	}
@@ -228,6 +276,12 @@ func (s *Session) Start() error {
 		return err
 	}
 
+	if *s.Options.Capture != "" {
+		if err = packets.SetCaptureBackend(*s.Options.Capture); err != nil {
+			return err
+		}
+	}
+
 	if s.Queue, err = packets.NewQueue(s.Interface); err != nil {
 		return err
 	}
@@ -250,7 +304,15 @@ func (s *Session) Start() error {
 		s.Gateway = s.Interface
 	}
 
-	s.Firewall = firewall.Make(s.Interface)
+	s.fw = newSwitchableFirewall(&journaledFirewall{
+		FirewallManager: firewall.Make(s.Interface),
+		journal:         s.Journal,
+	})
+	s.Firewall = s.fw
+
+	if leftovers := s.Journal.Leftovers(); len(leftovers) > 0 {
+		s.Events.Log(log.WARNING, "found %d side effects of a previous session which were not cleaned up, use 'session.recover' or bettercap -recover to undo them.", len(leftovers))
+	}
 
 	s.HID = network.NewHID(s.Aliases, func(dev *network.HIDDevice) {
 		s.Events.Add("hid.device.new", dev)
@@ -274,10 +336,18 @@ func (s *Session) Start() error {
 		s.Events.Add("endpoint.new", e)
 	}, func(e *network.Endpoint) {
 		s.Events.Add("endpoint.lost", e)
+	}, func(e *network.Endpoint, previous string) {
+		s.Events.Add("endpoint.changed", network.EndpointChange{Endpoint: e, Previous: previous})
 	})
 
 	s.setupEnv()
 
+	if *s.Options.Workspace != "" {
+		if err = s.openWorkspace(*s.Options.Workspace); err != nil {
+			return err
+		}
+	}
+
 	if err := s.setupReadline(); err != nil {
 		return err
 	}
@@ -312,6 +382,10 @@ func (s *Session) FindMAC(ip net.IP, probe bool) (net.HardwareAddr, error) {
 	var hw net.HardwareAddr
 	var err error
 
+	if ip.To4() == nil {
+		return s.findMAC6(ip, probe)
+	}
+
 	// do we have this ip mac address?
 	mac, err = network.ArpLookup(s.Interface.Name(), ip.String(), false)
 	if err != nil && probe {
@@ -340,6 +414,151 @@ func (s *Session) FindMAC(ip net.IP, probe bool) (net.HardwareAddr, error) {
 	return hw, nil
 }
 
+// IPv6 neighbors are either known from the hosts list or resolved with a
+// neighbor solicitation.
+func (s *Session) findMAC6(ip net.IP, probe bool) (net.HardwareAddr, error) {
+	found, err := s.findMACs6([]net.IP{ip}, probe)
+	if err != nil {
+		return nil, err
+	} else if hw, ok := found[ip.String()]; ok {
+		return hw, nil
+	}
+	return nil, fmt.Errorf("Could not find hardware address for %s.", ip.String())
+}
+
+// FindMACs is like FindMAC for a list of addresses, the ones which are not
+// known yet are probed all at once. The result only contains the addresses
+// which have been resolved.
+func (s *Session) FindMACs(ips []net.IP, probe bool) (map[string]net.HardwareAddr, error) {
+	ip4s := make([]net.IP, 0)
+	ip6s := make([]net.IP, 0)
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			ip6s = append(ip6s, ip)
+		} else {
+			ip4s = append(ip4s, ip)
+		}
+	}
+
+	found := s.findMACs4(ip4s, probe)
+	if len(ip6s) > 0 {
+		found6, err := s.findMACs6(ip6s, probe)
+		for ip, hw := range found6 {
+			found[ip] = hw
+		}
+		if err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+func (s *Session) findMACs4(ips []net.IP, probe bool) map[string]net.HardwareAddr {
+	found := make(map[string]net.HardwareAddr)
+	lookup := func() []net.IP {
+		missing := make([]net.IP, 0)
+		for _, ip := range ips {
+			if _, done := found[ip.String()]; done {
+				continue
+			} else if mac, err := network.ArpLookup(s.Interface.Name(), ip.String(), false); err != nil || mac == "" {
+				missing = append(missing, ip)
+			} else if hw, err := net.ParseMAC(network.NormalizeMac(mac)); err == nil {
+				found[ip.String()] = hw
+			}
+		}
+		return missing
+	}
+
+	if missing := lookup(); len(missing) > 0 && probe {
+		for _, ip := range missing {
+			if err, probe := packets.NewUDPProbe(s.Interface.IP, s.Interface.HW, ip, 139); err != nil {
+				log.Error("Error while creating UDP probe packet for %s: %s", ip.String(), err)
+			} else {
+				s.Queue.Send(probe)
+			}
+		}
+
+		time.Sleep(500 * time.Millisecond)
+		lookup()
+	}
+
+	return found
+}
+
+// the neighbor solicitations for all the addresses which are not in the
+// hosts list are sent at once and the advertisements collected within the
+// same timeout.
+func (s *Session) findMACs6(ips []net.IP, probe bool) (map[string]net.HardwareAddr, error) {
+	found := make(map[string]net.HardwareAddr)
+	pending := make(map[string]bool)
+	for _, ip := range ips {
+		if e := s.Lan.GetByIp(ip.String()); e != nil && e.HW != nil {
+			found[ip.String()] = e.HW
+		} else {
+			pending[ip.String()] = true
+		}
+	}
+
+	if len(pending) == 0 || !probe {
+		return found, nil
+	} else if s.Interface.IPv6 == nil {
+		return found, fmt.Errorf("Interface %s has no IPv6 address.", s.Interface.Name())
+	}
+
+	err, sub := packets.Subscribe(s.Interface.Name(), "icmp6")
+	if err != nil {
+		return found, err
+	}
+	defer sub.Close()
+
+	type advertisement struct {
+		ip string
+		hw net.HardwareAddr
+	}
+
+	// buffered so that the reader never blocks once we stopped waiting
+	advertised := make(chan advertisement, len(pending))
+	go func() {
+		seen := make(map[string]bool)
+		for pkt := range gopacket.NewPacketSource(sub, sub.LinkType()).Packets() {
+			ladv := pkt.Layer(layers.LayerTypeICMPv6NeighborAdvertisement)
+			if ladv == nil {
+				continue
+			}
+
+			target := ladv.(*layers.ICMPv6NeighborAdvertisement).TargetAddress
+			key := target.String()
+			if pending[key] && !seen[key] {
+				if hw := packets.NDPGetAdvertisedMAC(pkt, target); hw != nil {
+					seen[key] = true
+					advertised <- advertisement{key, hw}
+				}
+			}
+		}
+	}()
+
+	for _, ip := range ips {
+		if !pending[ip.String()] {
+			continue
+		} else if err, raw := packets.NewNDPSolicitation(s.Interface.IPv6, s.Interface.HW, ip); err != nil {
+			return found, err
+		} else if err = s.Queue.Send(raw); err != nil {
+			return found, err
+		}
+	}
+
+	timeout := time.After(500 * time.Millisecond)
+	for left := len(pending); left > 0; left-- {
+		select {
+		case adv := <-advertised:
+			found[adv.ip] = adv.hw
+		case <-timeout:
+			return found, nil
+		}
+	}
+	return found, nil
+}
+
 func (s *Session) IsOn(moduleName string) bool {
 	for _, m := range s.Modules {
 		if m.Name() == moduleName {
@@ -366,8 +585,23 @@ func (s *Session) RunCaplet(filename string) error {
 		return err
 	}
 
-	return caplet.Eval(nil, func(line string) error {
-		return s.Run(line + "\n")
+	return s.evalCaplet(caplet, nil)
+}
+
+func (s *Session) evalCaplet(caplet *caplets.Caplet, argv []string) error {
+	return caplet.Eval(argv, s.Env, func(line string) error {
+		// stop as soon as the job running the caplet is cancelled
+		ctx := s.Jobs.Context()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := s.RunFrom(SourceCaplet+":"+caplet.Name, line+"\n")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}, func(line string, err error) {
+		s.Events.Log(log.ERROR, "%s", err)
 	})
 }
 
@@ -389,7 +623,26 @@ func parseCapletCommand(line string) (is bool, caplet *caplets.Caplet, argv []st
 	return false, nil, nil
 }
 
+// Run executes a command typed by the user.
 func (s *Session) Run(line string) error {
+	return s.Exec(SourceInteractive, line)
+}
+
+// RunFrom executes a command recording in the audit log where it came from
+// and the changes it caused.
+func (s *Session) RunFrom(source string, line string) error {
+	if s.Audit == nil || str.Trim(line) == "" {
+		return s.run(line)
+	}
+
+	before := s.auditSnapshot()
+	err := s.run(line)
+	s.audit(source, str.Trim(line), before, err)
+
+	return err
+}
+
+func (s *Session) run(line string) error {
 	line = str.TrimRight(line)
 	// remove extra spaces after the first command
 	// so that 'arp.spoof      on' is normalized
@@ -420,9 +673,7 @@ func (s *Session) Run(line string) error {
 
 	// is it a caplet command?
 	if parsed, caplet, argv := parseCapletCommand(line); parsed {
-		return caplet.Eval(argv, func(line string) error {
-			return s.Run(line + "\n")
-		})
+		return s.evalCaplet(caplet, argv)
 	}
 
 	// is it a proxy module custom command?
@@ -0,0 +1,372 @@
+package session
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/str"
+	"github.com/evilsocket/islazy/tui"
+)
+
+const (
+	SourceInteractive = "interactive"
+	SourceStartup     = "startup"
+	SourceCaplet      = "caplet"
+	SourceAPI         = "api"
+	SourceTrigger     = "trigger"
+	SourceTicker      = "ticker"
+	SourceSchedule    = "schedule"
+	SourceModule      = "module"
+)
+
+// AuditEntry is an executed command with the changes it caused, each entry
+// is chained to the previous one by its hash.
+type AuditEntry struct {
+	Seq      uint64                       `json:"seq"`
+	Time     time.Time                    `json:"time"`
+	Source   string                       `json:"source"`
+	Command  string                       `json:"command"`
+	Error    string                       `json:"error,omitempty"`
+	Started  []string                     `json:"started,omitempty"`
+	Stopped  []string                     `json:"stopped,omitempty"`
+	Changed  map[string]string            `json:"changed,omitempty"`
+	Params   map[string]map[string]string `json:"params,omitempty"`
+	PrevHash string                       `json:"prev_hash"`
+	Hash     string                       `json:"hash"`
+}
+
+func (e AuditEntry) computeHash() string {
+	e.Hash = ""
+	raw, _ := json.Marshal(e)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog is an append only log file of hash chained entries.
+type AuditLog struct {
+	sync.Mutex
+
+	Path string
+	seq  uint64
+	last string
+	fd   *os.File
+}
+
+func readAuditEntries(fileName string, cb func(lineNum int, e *AuditEntry, err error) bool) error {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	lineNum := 0
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lineNum++
+		line := str.Trim(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		e := &AuditEntry{}
+		err := json.Unmarshal([]byte(line), e)
+		if !cb(lineNum, e, err) {
+			break
+		}
+	}
+
+	return scanner.Err()
+}
+
+func OpenAuditLog(fileName string) (error, *AuditLog) {
+	fileName, _ = fs.Expand(fileName)
+	a := &AuditLog{Path: fileName}
+
+	// the chain continues from the last entry of an existing log
+	if fs.Exists(fileName) {
+		err := readAuditEntries(fileName, func(lineNum int, e *AuditEntry, err error) bool {
+			if err == nil {
+				a.seq = e.Seq
+				a.last = e.Hash
+			}
+			return true
+		})
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err, nil
+	}
+	a.fd = fd
+
+	return nil, a
+}
+
+func (a *AuditLog) Append(e *AuditEntry) error {
+	a.Lock()
+	defer a.Unlock()
+
+	e.Seq = a.seq + 1
+	e.PrevHash = a.last
+	e.Hash = e.computeHash()
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	} else if _, err = a.fd.Write(append(raw, '\n')); err != nil {
+		return err
+	} else if err = a.fd.Sync(); err != nil {
+		return err
+	}
+
+	a.seq = e.Seq
+	a.last = e.Hash
+	return nil
+}
+
+func (a *AuditLog) Close() {
+	a.Lock()
+	defer a.Unlock()
+	a.fd.Close()
+}
+
+func ReadAuditLog(fileName string) (error, []*AuditEntry) {
+	entries := make([]*AuditEntry, 0)
+	var parseErr error
+	err := readAuditEntries(fileName, func(lineNum int, e *AuditEntry, err error) bool {
+		if err != nil {
+			parseErr = fmt.Errorf("%s:%d: %v", fileName, lineNum, err)
+			return false
+		}
+		entries = append(entries, e)
+		return true
+	})
+
+	if err != nil {
+		return err, nil
+	} else if parseErr != nil {
+		return parseErr, nil
+	}
+	return nil, entries
+}
+
+// VerifyAuditLog checks the hash chain of the log, returning the number of
+// valid entries and the first problem found.
+func VerifyAuditLog(fileName string) (error, int) {
+	valid := 0
+	prev := ""
+	seq := uint64(0)
+	var verr error
+
+	err := readAuditEntries(fileName, func(lineNum int, e *AuditEntry, err error) bool {
+		if err != nil {
+			verr = fmt.Errorf("%s:%d: corrupted entry: %v", fileName, lineNum, err)
+		} else if valid == 0 && (e.Seq != 1 || e.PrevHash != "") {
+			verr = fmt.Errorf("%s:%d: the log starts from entry %d, previous entries are missing", fileName, lineNum, e.Seq)
+		} else if valid > 0 && e.Seq != seq+1 {
+			verr = fmt.Errorf("%s:%d: expected entry %d, found %d", fileName, lineNum, seq+1, e.Seq)
+		} else if valid > 0 && e.PrevHash != prev {
+			verr = fmt.Errorf("%s:%d: entry %d is not chained to entry %d", fileName, lineNum, e.Seq, seq)
+		} else if e.Hash != e.computeHash() {
+			verr = fmt.Errorf("%s:%d: entry %d has been tampered with", fileName, lineNum, e.Seq)
+		} else {
+			valid++
+			prev = e.Hash
+			seq = e.Seq
+			return true
+		}
+		return false
+	})
+
+	if err != nil {
+		return err, valid
+	}
+	return verr, valid
+}
+
+type auditSnapshot struct {
+	running map[string]bool
+	env     map[string]string
+}
+
+func (s *Session) auditSnapshot() auditSnapshot {
+	snap := auditSnapshot{
+		running: make(map[string]bool),
+		env:     make(map[string]string),
+	}
+
+	for _, m := range s.Modules {
+		snap.running[m.Name()] = m.Running()
+	}
+
+	s.Env.Lock()
+	for name, value := range s.Env.Data {
+		snap.env[name] = value
+	}
+	s.Env.Unlock()
+
+	return snap
+}
+
+func auditValue(name string, value string) string {
+	lname := strings.ToLower(name)
+	if value != "" && (strings.Contains(lname, "password") || strings.Contains(lname, "secret") || strings.Contains(lname, "token")) {
+		return "********"
+	}
+	return value
+}
+
+var auditSetParser = regexp.MustCompile(`(?:^|;)\s*set\s+([^\s;]+)\s+("[^"]*"|'[^']*'|[^;]*)`)
+
+// auditCommand masks the sensitive values assigned by the set commands of
+// the line.
+func auditCommand(line string) string {
+	masked := ""
+	last := 0
+	for _, m := range auditSetParser.FindAllStringSubmatchIndex(line, -1) {
+		name, value := line[m[2]:m[3]], str.Trim(line[m[4]:m[5]])
+		if masking := auditValue(name, value); masking != value {
+			masked += line[last:m[4]] + masking
+			last = m[5]
+		}
+	}
+	return masked + line[last:]
+}
+
+func (s *Session) audit(source string, command string, before auditSnapshot, err error) {
+	after := s.auditSnapshot()
+	e := &AuditEntry{
+		Time:    time.Now(),
+		Source:  source,
+		Command: auditCommand(command),
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	for name, value := range after.env {
+		if old, found := before.env[name]; !found || old != value {
+			if e.Changed == nil {
+				e.Changed = make(map[string]string)
+			}
+			e.Changed[name] = auditValue(name, value)
+		}
+	}
+
+	for _, m := range s.Modules {
+		name := m.Name()
+		if after.running[name] && !before.running[name] {
+			e.Started = append(e.Started, name)
+			// the parameters a module has been started with
+			params := make(map[string]string)
+			for pname := range m.Parameters() {
+				params[pname] = auditValue(pname, after.env[pname])
+			}
+			if len(params) > 0 {
+				if e.Params == nil {
+					e.Params = make(map[string]map[string]string)
+				}
+				e.Params[name] = params
+			}
+		} else if !after.running[name] && before.running[name] {
+			e.Stopped = append(e.Stopped, name)
+		}
+	}
+
+	if err := s.Audit.Append(e); err != nil {
+		fmt.Fprintf(os.Stderr, "error while writing audit log %s: %v\n", s.Audit.Path, err)
+	}
+}
+
+func auditSummary(e *AuditEntry) string {
+	parts := make([]string, 0)
+	if len(e.Started) > 0 {
+		parts = append(parts, tui.Green("started "+strings.Join(e.Started, ", ")))
+	}
+	if len(e.Stopped) > 0 {
+		parts = append(parts, tui.Red("stopped "+strings.Join(e.Stopped, ", ")))
+	}
+	if len(e.Changed) > 0 {
+		names := make([]string, 0, len(e.Changed))
+		for name, value := range e.Changed {
+			names = append(names, fmt.Sprintf("%s=%s", name, value))
+		}
+		sort.Strings(names)
+		parts = append(parts, strings.Join(names, " "))
+	}
+	if e.Error != "" {
+		parts = append(parts, tui.Red(e.Error))
+	}
+	return strings.Join(parts, " ; ")
+}
+
+func (s *Session) auditShowHandler(args []string, sess *Session) error {
+	if s.Audit == nil {
+		return fmt.Errorf("audit log is disabled")
+	}
+
+	err, entries := ReadAuditLog(s.Audit.Path)
+	if err != nil {
+		return err
+	}
+
+	if limit := str.Trim(args[0]); limit != "" {
+		n := 0
+		if _, err := fmt.Sscanf(limit, "%d", &n); err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of entries '%s'", limit)
+		} else if n < len(entries) {
+			entries = entries[len(entries)-n:]
+		}
+	}
+
+	rows := [][]string{}
+	for _, e := range entries {
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", e.Seq),
+			e.Time.Format("2006-01-02 15:04:05"),
+			tui.Dim(e.Source),
+			tui.Bold(e.Command),
+			auditSummary(e),
+		})
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, []string{"#", "Time", "Source", "Command", "Changes"}, rows)
+	fmt.Println()
+
+	return nil
+}
+
+func (s *Session) auditVerifyHandler(args []string, sess *Session) error {
+	fileName := str.Trim(args[0])
+	if fileName == "" {
+		if s.Audit == nil {
+			return fmt.Errorf("audit log is disabled")
+		}
+		fileName = s.Audit.Path
+	}
+
+	fileName, _ = fs.Expand(fileName)
+	err, valid := VerifyAuditLog(fileName)
+	if err != nil {
+		return fmt.Errorf("audit log verification failed after %d valid entries: %v", valid, err)
+	}
+
+	fmt.Printf("\naudit log %s verified, %d entries.\n\n", tui.Bold(fileName), valid)
+	return nil
+}
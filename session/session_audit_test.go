@@ -0,0 +1,139 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newAuditSession(t *testing.T, dir string) *Session {
+	s := newCheckSession(t)
+	err, audit := OpenAuditLog(filepath.Join(dir, "bettercap.audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Audit = audit
+	return s
+}
+
+func TestAuditRunFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newAuditSession(t, dir)
+	s.RunFrom(SourceCaplet+":test", "set test.mod.count 5")
+	s.RunFrom(SourceAPI+":127.0.0.1:1234", "set api.rest.password hunter2")
+	s.Run("nope")
+	s.Run("   ")
+	s.Audit.Close()
+
+	err, entries := ReadAuditLog(s.Audit.Path)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	if e := entries[0]; e.Source != "caplet:test" || e.Changed["test.mod.count"] != "5" {
+		t.Fatalf("unexpected entry %+v", e)
+	} else if e := entries[1]; e.Source != "api:127.0.0.1:1234" || e.Changed["api.rest.password"] != "********" || strings.Contains(e.Command, "hunter2") {
+		t.Fatalf("unexpected entry %+v", e)
+	} else if e := entries[2]; e.Source != SourceInteractive || e.Error == "" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	if err, valid := VerifyAuditLog(s.Audit.Path); err != nil {
+		t.Fatal(err)
+	} else if valid != 3 {
+		t.Fatalf("expected 3 valid entries, got %d", valid)
+	}
+}
+
+func TestAuditCommandMasking(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"set api.rest.password hunter2", "set api.rest.password ********"},
+		{"set api.rest.username admin", "set api.rest.username admin"},
+		{"set https.proxy.token \"a b;c\"; net.probe on", "set https.proxy.token ********; net.probe on"},
+		{"net.probe on;set wifi.secret x ;set a.b c", "net.probe on;set wifi.secret ********;set a.b c"},
+		{"get api.rest.password", "get api.rest.password"},
+	}
+
+	for _, tt := range tests {
+		if got := auditCommand(tt.line); got != tt.want {
+			t.Errorf("auditCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAuditChainContinues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 2; i++ {
+		s := newAuditSession(t, dir)
+		s.Run("set a b")
+		s.Run("set c d")
+		s.Audit.Close()
+	}
+
+	fileName := filepath.Join(dir, "bettercap.audit")
+	if err, valid := VerifyAuditLog(fileName); err != nil {
+		t.Fatal(err)
+	} else if valid != 4 {
+		t.Fatalf("expected 4 valid entries, got %d", valid)
+	}
+}
+
+func TestAuditVerifyDetectsTampering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newAuditSession(t, dir)
+	for _, cmd := range []string{"set a 1", "set b 2", "set c 3"} {
+		s.Run(cmd)
+	}
+	s.Audit.Close()
+
+	raw, err := ioutil.ReadFile(s.Audit.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+
+	tests := []struct {
+		name  string
+		lines []string
+		valid int
+	}{
+		{"edited", []string{lines[0], strings.Replace(lines[1], "set b 2", "set b 3", 1), lines[2]}, 1},
+		{"removed", []string{lines[0], lines[2]}, 1},
+		{"truncated head", []string{lines[1], lines[2]}, 0},
+	}
+
+	for _, test := range tests {
+		fileName := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(fileName, []byte(strings.Join(test.lines, "\n")), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err, valid := VerifyAuditLog(fileName); err == nil {
+			t.Errorf("%s: expected verification to fail", test.name)
+		} else if valid != test.valid {
+			t.Errorf("%s: expected %d valid entries, got %d", test.name, test.valid, valid)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bettercap/bettercap/caplets"
+
+	"github.com/evilsocket/islazy/str"
+)
+
+var reDynamicToken = regexp.MustCompile(`\$([0-9]+|[A-Za-z_][A-Za-z0-9_]*)|{env\.[^}]+}`)
+
+// CapletProblem is an issue found while statically checking a caplet.
+type CapletProblem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (p CapletProblem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+type capletChecker struct {
+	s        *Session
+	visited  map[string]bool
+	problems []CapletProblem
+}
+
+// CheckCaplet parses the caplet and all the caplets it includes, resolving
+// every command against the core and module handlers and validating the
+// values of module parameters, without executing anything.
+func (s *Session) CheckCaplet(name string) (error, []CapletProblem) {
+	err, caplet := caplets.Load(name)
+	if err != nil {
+		return err, nil
+	}
+
+	c := &capletChecker{
+		s:        s,
+		visited:  make(map[string]bool),
+		problems: make([]CapletProblem, 0),
+	}
+	c.caplet(caplet)
+
+	return nil, c.problems
+}
+
+func (c *capletChecker) report(file string, line int, format string, args ...interface{}) {
+	c.problems = append(c.problems, CapletProblem{
+		File:    file,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *capletChecker) caplet(caplet *caplets.Caplet) {
+	if c.visited[caplet.Path] {
+		return
+	}
+	c.visited[caplet.Path] = true
+
+	prog, err := caplets.Parse(caplet.Path, caplet.Code)
+	if err != nil {
+		if perr, ok := err.(caplets.ParseError); ok {
+			c.report(perr.File, perr.Line, "%s", perr.Message)
+		} else {
+			c.report(caplet.Path, 0, "%v", err)
+		}
+		return
+	}
+
+	funcs := make([]*caplets.Function, 0, len(prog.Funcs))
+	for _, fn := range prog.Funcs {
+		funcs = append(funcs, fn)
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Line < funcs[j].Line
+	})
+
+	c.block(prog.File, prog.Body)
+	for _, fn := range funcs {
+		c.block(prog.File, fn.Body)
+	}
+}
+
+func (c *capletChecker) block(file string, body []*caplets.Node) {
+	for _, n := range body {
+		switch n.Kind {
+		case caplets.NodeCommand:
+			c.command(file, n.Line, n.Text)
+		case caplets.NodeIf:
+			c.block(file, n.Body)
+			c.block(file, n.Else)
+		case caplets.NodeFor:
+			c.block(file, n.Body)
+		}
+	}
+}
+
+// resolveStatic replaces the {env.NAME} tokens which are already defined
+// and reports if the line still depends on values only known at runtime.
+func (c *capletChecker) resolveStatic(line string) (string, bool) {
+	dynamic := false
+	line = reDynamicToken.ReplaceAllStringFunc(line, func(m string) string {
+		if strings.HasPrefix(m, "{env.") {
+			if found, value := c.s.Env.Get(m[5 : len(m)-1]); found {
+				return value
+			}
+		}
+		dynamic = true
+		return m
+	})
+	return line, dynamic
+}
+
+func (c *capletChecker) command(file string, lineNum int, line string) {
+	line = reCmdSpaceCleaner.ReplaceAllString(str.TrimRight(line), "$1 $2")
+	line, dynamic := c.resolveStatic(line)
+
+	for _, h := range c.s.CoreHandlers {
+		if parsed, args := h.Parse(line); parsed {
+			c.coreCommand(file, lineNum, h, args, dynamic)
+			return
+		}
+	}
+
+	for _, m := range c.s.Modules {
+		for _, h := range m.Handlers() {
+			if parsed, _ := h.Parse(line); parsed {
+				return
+			}
+		}
+	}
+
+	if parsed, caplet, _ := parseCapletCommand(line); parsed {
+		c.caplet(caplet)
+		return
+	}
+
+	// values only known at runtime might be what makes the line valid,
+	// in this case just check the command itself exists
+	if dynamic && c.isCommand(strings.Fields(line)[0]) {
+		return
+	}
+
+	c.report(file, lineNum, "unknown or invalid command '%s'", line)
+}
+
+func (c *capletChecker) isCommand(word string) bool {
+	for _, h := range c.s.CoreHandlers {
+		if strings.Fields(h.Name)[0] == word {
+			return true
+		}
+	}
+
+	for _, m := range c.s.Modules {
+		for _, h := range m.Handlers() {
+			if strings.Fields(h.Name)[0] == word {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c *capletChecker) coreCommand(file string, lineNum int, h CommandHandler, args []string, dynamic bool) {
+	switch strings.Fields(h.Name)[0] {
+	case "set":
+		c.setCommand(file, lineNum, args[0], args[1], dynamic)
+
+	case "include":
+		if dynamic {
+			return
+		} else if err, caplet := caplets.Load(str.Trim(args[0])); err != nil {
+			c.report(file, lineNum, "%v", err)
+		} else {
+			c.caplet(caplet)
+		}
+	}
+}
+
+func (c *capletChecker) setCommand(file string, lineNum int, name string, value string, dynamic bool) {
+	if value == "\"\"" || value == "''" {
+		value = ""
+	}
+
+	for _, m := range c.s.Modules {
+		if p, found := m.Parameters()[name]; found {
+			// placeholders like <interface name> are resolved at runtime
+			if !dynamic && !(strings.HasPrefix(value, "<") && strings.HasSuffix(value, ">")) {
+				if err, _ := p.Validate(value); err != nil {
+					c.report(file, lineNum, "%v", err)
+				}
+			}
+			return
+		}
+	}
+
+	// custom variables are allowed, unless they are in the namespace of a module
+	for _, m := range c.s.Modules {
+		if strings.HasPrefix(name, m.Name()+".") {
+			c.report(file, lineNum, "module %s has no parameter %s", m.Name(), name)
+			return
+		}
+	}
+}
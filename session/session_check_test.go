@@ -0,0 +1,133 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type checkTestModule struct {
+	SessionModule
+}
+
+func (mod *checkTestModule) Name() string        { return "test.mod" }
+func (mod *checkTestModule) Description() string { return "" }
+func (mod *checkTestModule) Author() string      { return "" }
+func (mod *checkTestModule) Start() error        { return nil }
+func (mod *checkTestModule) Stop() error         { return nil }
+
+func newCheckSession(t *testing.T) *Session {
+	env, err := NewEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Session{
+		Env:          env,
+		CoreHandlers: make([]CommandHandler, 0),
+		Modules:      make([]Module, 0),
+	}
+	s.Jobs = NewJobs(s.RunFrom)
+	s.registerCoreHandlers()
+
+	mod := &checkTestModule{SessionModule: NewSessionModule("test.mod", s)}
+	mod.AddParam(NewIntParameter("test.mod.count", "1", ""))
+	mod.AddParam(NewBoolParameter("test.mod.enabled", "false", ""))
+	mod.AddHandler(NewModuleHandler("test.mod on", "", "", nil))
+	mod.AddHandler(NewModuleHandler("test.mod.probe IP", `test\.mod\.probe\s+(\d+\.\d+\.\d+\.\d+)`, "", nil))
+	s.Modules = append(s.Modules, mod)
+
+	return s
+}
+
+func writeCaplet(t *testing.T, dir string, name string, code string) string {
+	fileName := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(fileName, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestSessionCheckCaplet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	included := writeCaplet(t, dir, "included.cap", strings.Join([]string{
+		"set test.mod.enabled maybe",
+		"test.mod on",
+	}, "\n"))
+
+	main := writeCaplet(t, dir, "main.cap", strings.Join([]string{
+		"# comment",
+		"set test.mod.count 10",
+		"set test.mod.count ten",
+		"set test.mod.cuont 1",
+		"set my.custom.var whatever",
+		"include " + included,
+		"test.mod.probe 10.0.0.1",
+		"test.mod.probe nope",
+		"test.mod.probe $0",
+		"unknown.command on",
+		"for n in 1 2 3",
+		"  set test.mod.count $n",
+		"  sleep $n",
+		"  nope $n",
+		"end",
+		"include " + filepath.Join(dir, "missing.cap"),
+		"include " + included,
+	}, "\n"))
+
+	err, problems := newCheckSession(t).CheckCaplet(main)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		file string
+		line int
+		msg  string
+	}{
+		{main, 3, "not valid"},
+		{main, 4, "has no parameter test.mod.cuont"},
+		{included, 1, "not valid"},
+		{main, 8, "unknown or invalid command"},
+		{main, 10, "unknown or invalid command"},
+		{main, 14, "unknown or invalid command"},
+		{main, 16, "not found"},
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+
+	for i, e := range expected {
+		p := problems[i]
+		if p.File != e.file || p.Line != e.line || !strings.Contains(p.Message, e.msg) {
+			t.Fatalf("expected %s:%d '%s', got %s", e.file, e.line, e.msg, p)
+		}
+	}
+}
+
+func TestSessionCheckCapletSyntaxError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	main := writeCaplet(t, dir, "main.cap", "if {env.foo}\ntest.mod on\n")
+
+	err, problems := newCheckSession(t).CheckCaplet(main)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(problems) != 1 {
+		t.Fatalf("expected 1 problem, got %v", problems)
+	} else if problems[0].Line != 1 || !strings.Contains(problems[0].Message, "missing 'end'") {
+		t.Fatalf("unexpected problem %s", problems[0])
+	}
+}
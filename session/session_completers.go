@@ -70,6 +70,8 @@ func (s *Session) EventsCompleter(prefix string) []string {
 		"mod.stopped",
 		"endpoint.new",
 		"endpoint.lost",
+		"endpoint.changed",
+		"net.watch.alert",
 		"wifi.client.lost",
 		"wifi.client.probe",
 		"wifi.client.new",
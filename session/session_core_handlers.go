@@ -16,6 +16,7 @@ import (
 	"github.com/bettercap/bettercap/network"
 
 	"github.com/bettercap/readline"
+	"github.com/evilsocket/islazy/log"
 	"github.com/evilsocket/islazy/str"
 	"github.com/evilsocket/islazy/tui"
 )
@@ -168,8 +169,12 @@ func (s *Session) exitHandler(args []string, sess *Session) error {
 
 func (s *Session) sleepHandler(args []string, sess *Session) error {
 	if secs, err := strconv.Atoi(args[0]); err == nil {
-		time.Sleep(time.Duration(secs) * time.Second)
-		return nil
+		select {
+		case <-time.After(time.Duration(secs) * time.Second):
+			return nil
+		case <-s.Jobs.Context().Done():
+			return s.Jobs.Context().Err()
+		}
 	} else {
 		return err
 	}
@@ -326,6 +331,69 @@ func (s *Session) aliasHandler(args []string, sess *Session) error {
 	return nil
 }
 
+func (s *Session) propagateAnnotation(mac string) {
+	mac = normalizeMac(mac)
+
+	// the endpoints are read by other goroutines while holding the wifi and
+	// lan locks
+	s.WiFi.Update(mac, func(e *network.Endpoint) {
+		s.Annotations.Apply(e)
+	})
+
+	s.Lan.Update(mac, func(host *network.Endpoint) {
+		s.Annotations.Apply(host)
+	})
+}
+
+func (s *Session) tagHandler(args []string, sess *Session) error {
+	mac := args[0]
+	if err := s.Annotations.Tag(mac, str.Comma(args[1])...); err != nil {
+		return err
+	}
+	s.propagateAnnotation(mac)
+	return nil
+}
+
+func (s *Session) untagHandler(args []string, sess *Session) error {
+	mac := args[0]
+	if err := s.Annotations.Untag(mac, str.Comma(args[1])...); err != nil {
+		return err
+	}
+	s.propagateAnnotation(mac)
+	return nil
+}
+
+func (s *Session) noteHandler(args []string, sess *Session) error {
+	mac := args[0]
+	note := str.Trim(args[1])
+	if note == "\"\"" || note == "''" {
+		note = ""
+	}
+	if err := s.Annotations.SetNote(mac, note); err != nil {
+		return err
+	}
+	s.propagateAnnotation(mac)
+	return nil
+}
+
+func (s *Session) dryRunShowHandler(args []string, sess *Session) error {
+	s.DryRun.Show()
+	return nil
+}
+
+func (s *Session) dryRunSaveHandler(args []string, sess *Session) error {
+	fileName := str.Trim(args[0])
+	if err := s.DryRun.Save(fileName); err != nil {
+		return err
+	}
+	s.Events.Log(log.INFO, "dry-run report saved to %s", fileName)
+	return nil
+}
+
+func (s *Session) recoverHandler(args []string, sess *Session) error {
+	return s.Recover()
+}
+
 func (s *Session) addHandler(h CommandHandler, c *readline.PrefixCompleter) {
 	h.Completer = c
 	s.CoreHandlers = append(s.CoreHandlers, h)
@@ -442,4 +510,90 @@ func (s *Session) registerCoreHandlers() {
 			return macs
 		})))
 
+	s.addHandler(NewCommandHandler("tag MAC TAG",
+		"^tag\\s+([a-fA-F0-9:]{14,17})\\s+([^\\s]+)$",
+		"Add a tag (or a comma separated list of tags) to a given endpoint given its MAC address.",
+		s.tagHandler),
+		readline.PcItem("tag", readline.PcItemDynamic(func(prefix string) []string {
+			prefix = str.Trim(prefix[3:])
+			macs := []string{""}
+			s.Lan.EachHost(func(mac string, e *network.Endpoint) {
+				if prefix == "" || strings.HasPrefix(mac, prefix) {
+					macs = append(macs, mac)
+				}
+			})
+			return macs
+		})))
+
+	s.addHandler(NewCommandHandler("untag MAC TAG",
+		"^untag\\s+([a-fA-F0-9:]{14,17})\\s*([^\\s]*)$",
+		"Remove a tag (or a comma separated list of tags) from a given endpoint given its MAC address, or all of them if no tag is given.",
+		s.untagHandler),
+		readline.PcItem("untag"))
+
+	s.addHandler(NewCommandHandler("note MAC TEXT",
+		"^note\\s+([a-fA-F0-9:]{14,17})\\s*(.*)",
+		"Write a note about a given endpoint given its MAC address, use \"\" to remove it.",
+		s.noteHandler),
+		readline.PcItem("note"))
+
+	s.addHandler(NewCommandHandler("dryrun.show",
+		"^dryrun\\.show$",
+		"Show the packets, firewall rules and listeners recorded while session.dryrun is true.",
+		s.dryRunShowHandler),
+		readline.PcItem("dryrun.show"))
+
+	s.addHandler(NewCommandHandler("dryrun.save FILE",
+		"^dryrun\\.save\\s+(.+)$",
+		"Save the dry-run report to FILE as JSON.",
+		s.dryRunSaveHandler),
+		readline.PcItem("dryrun.save"))
+
+	s.addHandler(NewCommandHandler("session.recover",
+		"^session\\.recover$",
+		"Undo the firewall changes and heal the spoofed targets recorded in the journal, including the ones left behind by previous sessions.",
+		s.recoverHandler),
+		readline.PcItem("session.recover"))
+
+	s.addHandler(NewCommandHandler("firewall.show",
+		"^firewall\\.show$",
+		"Show the forwarding state and the firewall redirections created by this session.",
+		s.firewallShowHandler),
+		readline.PcItem("firewall.show"))
+
+	s.addHandler(NewCommandHandler("scope.show",
+		"^scope\\.show$",
+		"Show the scope of the engagement, it can only be loaded at startup with -scope.",
+		s.scopeShowHandler),
+		readline.PcItem("scope.show"))
+
+	s.addHandler(NewCommandHandler("workspace.save",
+		"^workspace\\.save$",
+		"Save the session to the workspace now instead of waiting for the next snapshot.",
+		s.workspaceSaveHandler),
+		readline.PcItem("workspace.save"))
+
+	s.addHandler(NewCommandHandler("jobs",
+		"^jobs$",
+		"Show the queued, running and last finished commands.",
+		s.jobsHandler),
+		readline.PcItem("jobs"))
+
+	s.addHandler(NewCommandHandler("jobs.kill ID",
+		"^jobs\\.kill\\s+(\\d+)$",
+		"Cancel the queued or running command with the given ID.",
+		s.jobsKillHandler),
+		readline.PcItem("jobs.kill"))
+
+	s.addHandler(NewCommandHandler("audit.show LIMIT?",
+		"^audit\\.show\\s*(\\d*)$",
+		"Show the last LIMIT entries of the audit log, or all of them if LIMIT is not given.",
+		s.auditShowHandler),
+		readline.PcItem("audit.show"))
+
+	s.addHandler(NewCommandHandler("audit.verify FILE?",
+		"^audit\\.verify\\s*(.*)$",
+		"Verify the hash chain of the current audit log or of FILE if given.",
+		s.auditVerifyHandler),
+		readline.PcItem("audit.verify"))
 }
@@ -0,0 +1,274 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/tui"
+)
+
+const (
+	DryRunPacket   = "packet"
+	DryRunFirewall = "firewall"
+	DryRunListener = "listener"
+	DryRunMAC      = "mac"
+)
+
+// DryRunEntry is a side effect that would have happened if not in dry-run mode.
+type DryRunEntry struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Source  string    `json:"source"`
+	Details string    `json:"details"`
+}
+
+// DryRunPackets aggregates the packets of the same type sent to the same target.
+type DryRunPackets struct {
+	Type      string    `json:"type"`
+	Target    string    `json:"target"`
+	Count     uint64    `json:"count"`
+	Bytes     uint64    `json:"bytes"`
+	FirstSent time.Time `json:"first_sent"`
+	LastSent  time.Time `json:"last_sent"`
+	Rate      float64   `json:"rate"`
+}
+
+type DryRun struct {
+	sync.Mutex
+
+	enabled  bool
+	timeline []DryRunEntry
+	packets  map[string]*DryRunPackets
+}
+
+type dryRunJSON struct {
+	Timeline []DryRunEntry    `json:"timeline"`
+	Packets  []*DryRunPackets `json:"packets"`
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{
+		timeline: make([]DryRunEntry, 0),
+		packets:  make(map[string]*DryRunPackets),
+	}
+}
+
+func (d *DryRun) Enabled() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.enabled
+}
+
+func (d *DryRun) Record(kind string, source string, format string, args ...interface{}) {
+	d.Lock()
+	defer d.Unlock()
+	d.timeline = append(d.timeline, DryRunEntry{
+		Time:    time.Now(),
+		Kind:    kind,
+		Source:  source,
+		Details: fmt.Sprintf(format, args...),
+	})
+}
+
+// describePacket returns the protocols stack and the target of a packet.
+func describePacket(pkt gopacket.Packet) (proto string, target string) {
+	protos := make([]string, 0)
+	for _, layer := range pkt.Layers() {
+		switch layer.LayerType() {
+		case layers.LayerTypeEthernet, layers.LayerTypeRadioTap, gopacket.LayerTypePayload, gopacket.LayerTypeDecodeFailure:
+			continue
+		}
+		protos = append(protos, layer.LayerType().String())
+	}
+	proto = strings.Join(protos, "/")
+
+	if arp, ok := pkt.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		op := "request"
+		if arp.Operation == layers.ARPReply {
+			op = "reply"
+		}
+		proto = fmt.Sprintf("ARP %s", op)
+		target = fmt.Sprintf("%s (%s)", gopacket.Endpoint.String(layers.NewIPEndpoint(arp.DstProtAddress)),
+			gopacket.Endpoint.String(layers.NewMACEndpoint(arp.DstHwAddress)))
+	} else if net := pkt.NetworkLayer(); net != nil {
+		target = net.NetworkFlow().Dst().String()
+		if tr := pkt.TransportLayer(); tr != nil {
+			target += ":" + tr.TransportFlow().Dst().String()
+		}
+	} else if dot11, ok := pkt.Layer(layers.LayerTypeDot11).(*layers.Dot11); ok {
+		target = dot11.Address1.String()
+	} else if eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		target = eth.DstMAC.String()
+	}
+
+	if proto == "" {
+		proto = "unknown"
+	}
+	return
+}
+
+// Packet records a packet that would have been sent, its first layer is
+// decoded with the given decoder.
+func (d *DryRun) Packet(source string, raw []byte, decoder gopacket.Decoder) {
+	pkt := gopacket.NewPacket(raw, decoder, gopacket.Default)
+	proto, target := describePacket(pkt)
+	key := proto + "|" + target
+	now := time.Now()
+
+	d.Lock()
+	defer d.Unlock()
+
+	if agg, found := d.packets[key]; found {
+		agg.Count++
+		agg.Bytes += uint64(len(raw))
+		agg.LastSent = now
+		if secs := agg.LastSent.Sub(agg.FirstSent).Seconds(); secs > 0 {
+			agg.Rate = float64(agg.Count-1) / secs
+		}
+		return
+	}
+
+	d.packets[key] = &DryRunPackets{
+		Type:      proto,
+		Target:    target,
+		Count:     1,
+		Bytes:     uint64(len(raw)),
+		FirstSent: now,
+		LastSent:  now,
+	}
+
+	// only the first packet of each kind goes in the timeline, the rest is aggregated
+	d.timeline = append(d.timeline, DryRunEntry{
+		Time:    now,
+		Kind:    DryRunPacket,
+		Source:  source,
+		Details: fmt.Sprintf("%s to %s", proto, target),
+	})
+}
+
+func (d *DryRun) sortedPackets() []*DryRunPackets {
+	packets := make([]*DryRunPackets, 0, len(d.packets))
+	for _, agg := range d.packets {
+		packets = append(packets, agg)
+	}
+	sort.Slice(packets, func(i, j int) bool {
+		return packets[i].FirstSent.Before(packets[j].FirstSent)
+	})
+	return packets
+}
+
+func (d *DryRun) MarshalJSON() ([]byte, error) {
+	d.Lock()
+	defer d.Unlock()
+	return json.Marshal(dryRunJSON{
+		Timeline: d.timeline,
+		Packets:  d.sortedPackets(),
+	})
+}
+
+func (d *DryRun) Save(fileName string) error {
+	fileName, _ = fs.Expand(fileName)
+	raw, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, raw, 0644)
+}
+
+func (d *DryRun) Show() {
+	d.Lock()
+	defer d.Unlock()
+
+	if len(d.timeline) == 0 {
+		fmt.Printf("\nno side effects recorded.\n\n")
+		return
+	}
+
+	rows := [][]string{}
+	start := d.timeline[0].Time
+	for _, e := range d.timeline {
+		rows = append(rows, []string{
+			tui.Dim(fmt.Sprintf("+%.3fs", e.Time.Sub(start).Seconds())),
+			tui.Yellow(e.Kind),
+			tui.Bold(e.Source),
+			e.Details,
+		})
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, []string{"Time", "Kind", "Source", "Details"}, rows)
+
+	if len(d.packets) > 0 {
+		rows = [][]string{}
+		for _, agg := range d.sortedPackets() {
+			rows = append(rows, []string{
+				agg.Type,
+				agg.Target,
+				fmt.Sprintf("%d", agg.Count),
+				humanize.Bytes(agg.Bytes),
+				fmt.Sprintf("%.1f pkt/s", agg.Rate),
+			})
+		}
+
+		fmt.Println()
+		tui.Table(os.Stdout, []string{"Packet", "Target", "Count", "Size", "Rate"}, rows)
+	}
+	fmt.Println()
+}
+
+// setDryRun replaces the firewall and the packet injection with recording
+// stand-ins, or restores the real ones.
+func (s *Session) setDryRun(enabled bool) {
+	s.DryRun.Lock()
+	s.DryRun.enabled = enabled
+	s.DryRun.Unlock()
+
+	s.fw.dryRun(enabled, func(action string, details string) {
+		s.DryRun.Record(DryRunFirewall, action, "%s", details)
+	})
+
+	if enabled {
+		var decoder gopacket.Decoder = layers.LayerTypeEthernet
+		if s.Interface.IsMonitor() {
+			decoder = layers.LayerTypeRadioTap
+		}
+		s.Queue.Record(func(raw []byte) {
+			s.DryRun.Packet("packets.queue", raw, decoder)
+		})
+	} else {
+		s.Queue.Record(nil)
+	}
+}
+
+// IsDryRun returns true if side effects must be recorded instead of executed.
+func (s *Session) IsDryRun() bool {
+	return s.DryRun.Enabled()
+}
+
+func (s *Session) closeDryRun() {
+	if !s.IsDryRun() {
+		return
+	}
+
+	if _, output := s.Env.Get("session.dryrun.output"); output != "" {
+		if err := s.DryRun.Save(output); err != nil {
+			fmt.Printf("error while saving dry-run report to %s: %s\n", output, err)
+		} else {
+			fmt.Printf("dry-run report saved to %s\n", output)
+		}
+	} else {
+		s.DryRun.Show()
+	}
+}
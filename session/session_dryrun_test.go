@@ -0,0 +1,66 @@
+package session
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/bettercap/bettercap/packets"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestDryRunPacketAggregation(t *testing.T) {
+	d := NewDryRun()
+	from := net.ParseIP("192.168.1.2")
+	fromHW, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+
+	for i := 0; i < 3; i++ {
+		_, raw := packets.NewARPRequest(from, fromHW, net.ParseIP("192.168.1.1"))
+		d.Packet("test", raw, layers.LayerTypeEthernet)
+	}
+	_, raw := packets.NewUDPProbe(from, fromHW, net.ParseIP("192.168.1.3"), 137)
+	d.Packet("test", raw, layers.LayerTypeEthernet)
+
+	if len(d.packets) != 2 {
+		t.Fatalf("expected 2 aggregated packet kinds, got %d", len(d.packets))
+	}
+	// only the first packet of each kind is added to the timeline
+	if len(d.timeline) != 2 {
+		t.Fatalf("expected 2 timeline entries, got %d", len(d.timeline))
+	}
+
+	arp := d.sortedPackets()[0]
+	if arp.Type != "ARP request" {
+		t.Fatalf("unexpected packet type %s", arp.Type)
+	} else if arp.Count != 3 {
+		t.Fatalf("expected 3 packets, got %d", arp.Count)
+	} else if !strings.HasPrefix(arp.Target, "192.168.1.1") {
+		t.Fatalf("unexpected target %s", arp.Target)
+	}
+
+	udp := d.sortedPackets()[1]
+	if udp.Target != "192.168.1.3:137" {
+		t.Fatalf("unexpected target %s", udp.Target)
+	}
+}
+
+func TestDryRunJSON(t *testing.T) {
+	d := NewDryRun()
+	d.Record(DryRunFirewall, "redirection", "add %s", "eth0 TCP 80 -> 8080")
+
+	raw, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report dryRunJSON
+	if err := json.Unmarshal(raw, &report); err != nil {
+		t.Fatal(err)
+	} else if len(report.Timeline) != 1 {
+		t.Fatalf("expected 1 timeline entry, got %d", len(report.Timeline))
+	} else if e := report.Timeline[0]; e.Kind != DryRunFirewall || e.Details != "add eth0 TCP 80 -> 8080" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bettercap/bettercap/network"
+	"github.com/bettercap/bettercap/packets"
+
+	"github.com/evilsocket/islazy/data"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestFindMACsNeighborSolicitations(t *testing.T) {
+	mock := packets.NewMockBackend(layers.LinkTypeEthernet)
+	prev := packets.GetCaptureBackend()
+	packets.UseCaptureBackend(mock)
+	defer packets.UseCaptureBackend(prev)
+
+	aliases, err := data.NewMemUnsortedKV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := network.NewEndpointNoResolve("10.0.0.2", "aa:aa:aa:aa:aa:02", "mock0", 24)
+	iface.IPv6 = net.ParseIP("fe80::2")
+	gateway := network.NewEndpointNoResolve("10.0.0.1", "aa:aa:aa:aa:aa:01", "", 24)
+
+	queue, err := packets.NewQueue(iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the queue worker exits once the capture is over
+	defer mock.Done()
+
+	s := &Session{
+		Interface: iface,
+		Gateway:   gateway,
+		Queue:     queue,
+		Lan:       network.NewLAN(iface, gateway, aliases, func(e *network.Endpoint) {}, func(e *network.Endpoint) {}, func(e *network.Endpoint, previous string) {}),
+	}
+
+	s.Lan.AddIfNew("10.0.0.10", "aa:aa:aa:aa:aa:10")
+	known, _ := s.Lan.Get("aa:aa:aa:aa:aa:10")
+	known.SetIPv6("fe80::10")
+
+	neighbors := map[string]net.HardwareAddr{
+		"fe80::11": {0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x11},
+		"fe80::12": {0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x12},
+	}
+
+	// the neighbors only answer once all the solicitations have been sent,
+	// which is never the case if they're resolved one at a time
+	go func() {
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+			solicited := 0
+			for _, raw := range mock.Written() {
+				pkt := gopacket.NewPacket(raw, layers.LayerTypeEthernet, gopacket.Default)
+				if pkt.Layer(layers.LayerTypeICMPv6NeighborSolicitation) != nil {
+					solicited++
+				}
+			}
+
+			if solicited == 3 {
+				for ip, hw := range neighbors {
+					if err, raw := packets.NewNDPAdvertisement(net.ParseIP(ip), hw, iface.IPv6, iface.HW, false); err == nil {
+						mock.Inject(raw)
+					}
+				}
+				return
+			}
+		}
+	}()
+
+	ips := []net.IP{
+		net.ParseIP("fe80::10"),
+		net.ParseIP("fe80::11"),
+		net.ParseIP("fe80::12"),
+		net.ParseIP("fe80::13"),
+	}
+
+	found, err := s.FindMACs(ips, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(found) != 3 {
+		t.Fatalf("expected 3 addresses to be resolved, got %v", found)
+	} else if hw := found["fe80::10"]; hw.String() != known.HwAddress {
+		t.Fatalf("expected the known host to be resolved from the lan, got %s", hw)
+	}
+
+	for ip, hw := range neighbors {
+		if found[ip].String() != hw.String() {
+			t.Fatalf("expected %s to be resolved to %s, got %s", ip, hw, found[ip])
+		}
+	}
+
+	if _, err = s.findMAC6(net.ParseIP("fe80::13"), false); err == nil {
+		t.Fatalf("expected an error resolving an unknown neighbor without probing")
+	}
+}
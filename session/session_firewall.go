@@ -0,0 +1,154 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bettercap/bettercap/firewall"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// switchableFirewall is the FirewallManager exposed as Session.Firewall, it
+// forwards every call to the active implementation which can be replaced
+// (dry-run toggling, recovery) while modules are still using it.
+type switchableFirewall struct {
+	sync.RWMutex
+	active firewall.FirewallManager
+	// the real firewall while the dry-run one is active
+	real firewall.FirewallManager
+}
+
+func newSwitchableFirewall(fw firewall.FirewallManager) *switchableFirewall {
+	return &switchableFirewall{active: fw}
+}
+
+func (f *switchableFirewall) current() firewall.FirewallManager {
+	f.RLock()
+	defer f.RUnlock()
+	return f.active
+}
+
+// replace swaps the real firewall, leaving a dry-run one in place if active.
+func (f *switchableFirewall) replace(fw firewall.FirewallManager) {
+	f.Lock()
+	defer f.Unlock()
+	if f.real != nil {
+		f.real = fw
+	} else {
+		f.active = fw
+	}
+}
+
+func (f *switchableFirewall) dryRun(enabled bool, record func(action string, details string)) {
+	f.Lock()
+	defer f.Unlock()
+	if enabled && f.real == nil {
+		f.real = f.active
+		f.active = firewall.NewDryRun(f.real, record)
+	} else if !enabled && f.real != nil {
+		f.active = f.real
+		f.real = nil
+	}
+}
+
+func (f *switchableFirewall) IsForwardingEnabled() bool {
+	return f.current().IsForwardingEnabled()
+}
+
+func (f *switchableFirewall) EnableForwarding(enabled bool) error {
+	return f.current().EnableForwarding(enabled)
+}
+
+func (f *switchableFirewall) EnableRedirection(r *firewall.Redirection, enabled bool) error {
+	return f.current().EnableRedirection(r, enabled)
+}
+
+func (f *switchableFirewall) Redirections() []*firewall.Redirection {
+	return f.current().Redirections()
+}
+
+func (f *switchableFirewall) Track(r *firewall.Redirection) {
+	firewall.Track(f.current(), r)
+}
+
+func (f *switchableFirewall) Restore() {
+	f.RLock()
+	active, real := f.active, f.real
+	f.RUnlock()
+
+	active.Restore()
+	if real != nil {
+		real.Restore()
+	}
+}
+
+func redirectionMatch(r *firewall.Redirection) string {
+	match := []string{}
+	if len(r.Sources) > 0 {
+		match = append(match, "from "+strings.Join(r.Sources, ", "))
+	}
+	if dsts := r.DestinationFilter(); len(dsts) > 0 {
+		match = append(match, "to "+strings.Join(dsts, ", "))
+	}
+	if len(r.ExcludeSources) > 0 {
+		match = append(match, tui.Red("not from ")+strings.Join(r.ExcludeSources, ", "))
+	}
+	if len(r.ExcludeDestinations) > 0 {
+		match = append(match, tui.Red("not to ")+strings.Join(r.ExcludeDestinations, ", "))
+	}
+
+	if len(match) == 0 {
+		return tui.Dim("any")
+	}
+	return strings.Join(match, " ")
+}
+
+func (s *Session) firewallShowHandler(args []string, sess *Session) error {
+	forwarding := tui.Red("disabled")
+	if s.Firewall.IsForwardingEnabled() {
+		forwarding = tui.Green("enabled")
+	}
+	fmt.Printf("\nforwarding is %s.\n\n", forwarding)
+
+	redirections := s.Firewall.Redirections()
+	if len(redirections) == 0 {
+		fmt.Printf("no active redirections.\n\n")
+		return nil
+	}
+
+	rows := [][]string{}
+	for _, r := range redirections {
+		ports := fmt.Sprintf("%d", r.SrcPort)
+		if first, last := r.Ports(); first != last {
+			ports = fmt.Sprintf("%d-%d", first, last)
+		}
+
+		mode := firewall.RedirectionDNAT
+		if r.IsTProxy() {
+			mode = firewall.RedirectionTProxy
+		}
+
+		mark := tui.Dim("-")
+		if r.Mark != 0 {
+			mark = fmt.Sprintf("0x%x", r.Mark)
+		}
+
+		rows = append(rows, []string{
+			r.Interface,
+			strings.ToUpper(r.Protocol),
+			redirectionMatch(r),
+			ports,
+			mode,
+			tui.Bold(fmt.Sprintf("%s:%d", r.DstAddress, r.DstPort)),
+			mark,
+		})
+	}
+
+	tui.Table(os.Stdout, []string{"Interface", "Protocol", "Match", "Ports", "Mode", "Redirect To", "Mark"}, rows)
+	fmt.Println()
+
+	return nil
+}
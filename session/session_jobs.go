@@ -0,0 +1,346 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/evilsocket/islazy/str"
+	"github.com/evilsocket/islazy/tui"
+)
+
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobKilled   = "killed"
+	JobTimedOut = "timeout"
+
+	// how many finished jobs are kept around
+	jobsHistory = 50
+	jobsQueue   = 1024
+)
+
+// these commands are executed right away instead of being queued, so that
+// a job blocking the queue can still be inspected and killed
+var reJobsCommand = regexp.MustCompile(`^\s*jobs(\.kill\s+.*)?\s*$`)
+
+// exiting cancels every job and doesn't wait for the queue
+var reExitCommand = regexp.MustCompile(`^\s*(q|quit|e|exit)\s*$`)
+
+// Job is a command submitted to the executor.
+type Job struct {
+	ID        uint64        `json:"id"`
+	Source    string        `json:"source"`
+	Command   string        `json:"command"`
+	Status    string        `json:"status"`
+	Timeout   time.Duration `json:"timeout"`
+	QueuedAt  time.Time     `json:"queued_at"`
+	StartedAt time.Time     `json:"started_at"`
+	StoppedAt time.Time     `json:"stopped_at"`
+	Error     string        `json:"error,omitempty"`
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Done returns true if the job is not queued nor running anymore.
+func (j Job) Done() bool {
+	return j.Status != JobQueued && j.Status != JobRunning
+}
+
+// Jobs executes the submitted commands one at a time, in order, each one
+// with its own context so that it can be cancelled or timed out.
+type Jobs struct {
+	sync.Mutex
+
+	run     func(source string, line string) error
+	queue   chan *Job
+	jobs    []*Job
+	current *Job
+	nextID  uint64
+	once    sync.Once
+}
+
+func NewJobs(run func(source string, line string) error) *Jobs {
+	return &Jobs{
+		run:   run,
+		queue: make(chan *Job, jobsQueue),
+		jobs:  make([]*Job, 0),
+	}
+}
+
+// Submit queues a command and returns its job without waiting for it.
+func (j *Jobs) Submit(source string, command string, timeout time.Duration) Job {
+	j.once.Do(func() {
+		go j.worker()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	j.Lock()
+	j.nextID++
+	job := &Job{
+		ID:       j.nextID,
+		Source:   source,
+		Command:  str.Trim(command),
+		Status:   JobQueued,
+		Timeout:  timeout,
+		QueuedAt: time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	j.jobs = append(j.jobs, job)
+	j.Unlock()
+
+	j.queue <- job
+
+	return *job
+}
+
+// Wait blocks until the job is done and returns its error.
+func (j *Jobs) Wait(id uint64) error {
+	j.Lock()
+	job := j.find(id)
+	j.Unlock()
+
+	if job == nil {
+		return fmt.Errorf("job %d not found", id)
+	}
+
+	<-job.done
+	return job.err
+}
+
+// Exec queues a command and waits for it.
+func (j *Jobs) Exec(source string, command string, timeout time.Duration) error {
+	return j.Wait(j.Submit(source, command, timeout).ID)
+}
+
+// Context returns the context of the running job, handlers that block
+// should give up as soon as it's done.
+func (j *Jobs) Context() context.Context {
+	if j == nil {
+		return context.Background()
+	}
+
+	j.Lock()
+	defer j.Unlock()
+	if j.current == nil {
+		return context.Background()
+	}
+	return j.current.ctx
+}
+
+func (j *Jobs) find(id uint64) *Job {
+	for _, job := range j.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (j *Jobs) Get(id uint64) (Job, bool) {
+	j.Lock()
+	defer j.Unlock()
+	if job := j.find(id); job != nil {
+		return *job, true
+	}
+	return Job{}, false
+}
+
+func (j *Jobs) List() []Job {
+	j.Lock()
+	defer j.Unlock()
+	list := make([]Job, len(j.jobs))
+	for i, job := range j.jobs {
+		list[i] = *job
+	}
+	return list
+}
+
+// Kill cancels a queued or running job.
+func (j *Jobs) Kill(id uint64) error {
+	j.Lock()
+	defer j.Unlock()
+
+	job := j.find(id)
+	if job == nil {
+		return fmt.Errorf("job %d not found", id)
+	} else if job.Status != JobQueued && job.Status != JobRunning {
+		return fmt.Errorf("job %d is not running (%s)", id, job.Status)
+	}
+
+	job.cancel()
+	return nil
+}
+
+// KillAll cancels every queued or running job.
+func (j *Jobs) KillAll() {
+	j.Lock()
+	defer j.Unlock()
+
+	for _, job := range j.jobs {
+		if !job.Done() {
+			job.cancel()
+		}
+	}
+}
+
+func (j *Jobs) exec(job *Job) {
+	j.Lock()
+	// killed while still in the queue
+	if job.ctx.Err() == nil {
+		if job.Timeout > 0 {
+			parent := job.cancel
+			job.ctx, job.cancel = context.WithTimeout(job.ctx, job.Timeout)
+			defer parent()
+		}
+		job.Status = JobRunning
+		job.StartedAt = time.Now()
+		j.current = job
+	}
+	j.Unlock()
+
+	var err error
+	if job.Status == JobRunning {
+		err = j.run(job.Source, job.Command)
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	switch job.ctx.Err() {
+	case context.Canceled:
+		job.Status = JobKilled
+		err = fmt.Errorf("job %d (%s) has been killed", job.ID, job.Command)
+	case context.DeadlineExceeded:
+		job.Status = JobTimedOut
+		err = fmt.Errorf("job %d (%s) timed out after %s", job.ID, job.Command, job.Timeout)
+	default:
+		if err != nil {
+			job.Status = JobFailed
+		} else {
+			job.Status = JobDone
+		}
+	}
+
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.err = err
+	job.StoppedAt = time.Now()
+	job.cancel()
+	j.current = nil
+	close(job.done)
+
+	j.prune()
+}
+
+// prune removes the oldest finished jobs.
+func (j *Jobs) prune() {
+	finished := 0
+	for _, job := range j.jobs {
+		if job.Done() {
+			finished++
+		}
+	}
+
+	kept := make([]*Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		if job.Done() && finished > jobsHistory {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	j.jobs = kept
+}
+
+func (j *Jobs) worker() {
+	for job := range j.queue {
+		j.exec(job)
+	}
+}
+
+func (s *Session) jobsTimeout() time.Duration {
+	if err, secs := s.Env.GetInt("session.jobs.timeout"); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// Exec queues a top level command and waits for it, commands executed by
+// other commands (caplets, module requirements) use RunFrom instead as the
+// executor is busy running their parent.
+func (s *Session) Exec(source string, line string) error {
+	if reExitCommand.MatchString(line) {
+		s.Jobs.KillAll()
+		return s.RunFrom(source, line)
+	} else if str.Trim(line) == "" || reJobsCommand.MatchString(line) {
+		return s.RunFrom(source, line)
+	}
+	return s.Jobs.Exec(source, line, s.jobsTimeout())
+}
+
+func (s *Session) jobsHandler(args []string, sess *Session) error {
+	rows := [][]string{}
+	for _, job := range s.Jobs.List() {
+		status := job.Status
+		switch status {
+		case JobRunning:
+			status = tui.Green(status)
+		case JobQueued:
+			status = tui.Yellow(status)
+		case JobDone:
+			status = tui.Dim(status)
+		default:
+			status = tui.Red(status)
+		}
+
+		took := ""
+		if job.Status == JobRunning {
+			took = time.Since(job.StartedAt).Round(time.Millisecond).String()
+		} else if !job.StartedAt.IsZero() {
+			took = job.StoppedAt.Sub(job.StartedAt).Round(time.Millisecond).String()
+		}
+
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", job.ID),
+			tui.Dim(job.Source),
+			tui.Bold(job.Command),
+			status,
+			job.QueuedAt.Format("15:04:05"),
+			took,
+			job.Error,
+		})
+	}
+
+	if len(rows) == 0 {
+		fmt.Printf("\nno jobs.\n\n")
+		return nil
+	}
+
+	fmt.Println()
+	tui.Table(os.Stdout, []string{"ID", "Source", "Command", "Status", "Queued", "Duration", "Error"}, rows)
+	fmt.Println()
+
+	return nil
+}
+
+func (s *Session) jobsKillHandler(args []string, sess *Session) error {
+	id, err := strconv.ParseUint(str.Trim(args[0]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid job id '%s'", args[0])
+	}
+	return s.Jobs.Kill(id)
+}
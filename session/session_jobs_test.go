@@ -0,0 +1,157 @@
+package session
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobsSerialized(t *testing.T) {
+	lock := sync.Mutex{}
+	order := make([]string, 0)
+	running := 0
+
+	jobs := NewJobs(func(source string, line string) error {
+		lock.Lock()
+		running++
+		if running > 1 {
+			t.Errorf("more than one job running at once")
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		order = append(order, line)
+		lock.Unlock()
+		return nil
+	})
+
+	ids := make([]uint64, 0)
+	for _, cmd := range []string{"a", "b", "c"} {
+		ids = append(ids, jobs.Submit("test", cmd, 0).ID)
+	}
+
+	for _, id := range ids {
+		if err := jobs.Wait(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if strings.Join(order, "") != "abc" {
+		t.Fatalf("unexpected execution order %v", order)
+	}
+
+	for _, job := range jobs.List() {
+		if job.Status != JobDone {
+			t.Fatalf("unexpected status for job %d: %s", job.ID, job.Status)
+		}
+	}
+}
+
+func TestJobsKillAndTimeout(t *testing.T) {
+	var jobs *Jobs
+	started := make(chan bool, 1)
+
+	jobs = NewJobs(func(source string, line string) error {
+		if line == "block" {
+			started <- true
+			ctx := jobs.Context()
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	running := jobs.Submit("test", "block", 0)
+	queued := jobs.Submit("test", "never", 0)
+	<-started
+
+	if err := jobs.Kill(queued.ID); err != nil {
+		t.Fatal(err)
+	} else if err := jobs.Kill(running.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := jobs.Wait(running.ID); err == nil {
+		t.Fatalf("expected the running job to be killed")
+	} else if job, _ := jobs.Get(running.ID); job.Status != JobKilled {
+		t.Fatalf("unexpected status %s", job.Status)
+	} else if err := jobs.Wait(queued.ID); err == nil {
+		t.Fatalf("expected the queued job to be killed")
+	} else if job, _ := jobs.Get(queued.ID); job.Status != JobKilled || !job.StartedAt.IsZero() {
+		t.Fatalf("the queued job should have never started: %+v", job)
+	} else if err := jobs.Kill(running.ID); err == nil {
+		t.Fatalf("expected an error killing a finished job")
+	}
+
+	if err := jobs.Exec("test", "block", 20*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	if jobs.Context() != context.Background() {
+		t.Fatalf("expected no running job")
+	}
+}
+
+func TestJobsKillAll(t *testing.T) {
+	var jobs *Jobs
+	started := make(chan bool, 1)
+
+	jobs = NewJobs(func(source string, line string) error {
+		started <- true
+		<-jobs.Context().Done()
+		return nil
+	})
+
+	running := jobs.Submit("test", "block", 0)
+	queued := jobs.Submit("test", "block", 0)
+	<-started
+
+	jobs.KillAll()
+
+	for _, id := range []uint64{running.ID, queued.ID} {
+		if err := jobs.Wait(id); err == nil {
+			t.Fatalf("expected job %d to be killed", id)
+		} else if job, _ := jobs.Get(id); job.Status != JobKilled {
+			t.Fatalf("unexpected status for job %d: %s", id, job.Status)
+		}
+	}
+
+	for _, line := range []string{"exit", " q ", "quit"} {
+		if !reExitCommand.MatchString(line) {
+			t.Fatalf("expected '%s' to bypass the queue", line)
+		}
+	}
+}
+
+func TestJobsCaplet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newCheckSession(t)
+	fileName := writeCaplet(t, dir, "slow.cap", "on error continue\nsleep 5\nset after.sleep 1\n")
+
+	start := time.Now()
+	if err := s.Jobs.Exec(SourceInteractive, "include "+fileName, 50*time.Millisecond); err == nil {
+		t.Fatalf("expected the caplet to time out")
+	} else if time.Since(start) > 2*time.Second {
+		t.Fatalf("the caplet has not been interrupted")
+	} else if found, _ := s.Env.Get("after.sleep"); found {
+		t.Fatalf("the caplet kept running after the timeout")
+	}
+
+	if err := s.Exec(SourceInteractive, "set after.sleep 1"); err != nil {
+		t.Fatal(err)
+	} else if found, _ := s.Env.Get("after.sleep"); !found {
+		t.Fatalf("expected the next job to run")
+	}
+}
@@ -0,0 +1,438 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/firewall"
+	"github.com/bettercap/bettercap/packets"
+
+	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/log"
+)
+
+const (
+	JournalFile = "~/bettercap.journal"
+
+	JournalForwarding  = "forwarding"
+	JournalRedirection = "redirection"
+	JournalSpoof       = "spoof"
+
+	// how many times healing packets are sent while recovering
+	recoverRounds = 5
+)
+
+var journalFileName, _ = fs.Expand(JournalFile)
+
+// SpoofState is a poisoned cache entry: Target has been told that Address
+// is at our MAC address instead of HW.
+type SpoofState struct {
+	Module    string `json:"module"`
+	Protocol  string `json:"protocol"`
+	Interface string `json:"interface"`
+	Address   string `json:"address"`
+	HW        string `json:"hw"`
+	Target    string `json:"target"`
+	TargetHW  string `json:"target_hw"`
+}
+
+func (s SpoofState) String() string {
+	return fmt.Sprintf("[%s] (%s) %s told %s is at us instead of %s", s.Interface, s.Protocol, s.Target, s.Address, s.HW)
+}
+
+// JournalEntry is a side effect on the system or the network which must be
+// undone when the session ends.
+type JournalEntry struct {
+	Kind        string                `json:"kind"`
+	PID         int                   `json:"pid"`
+	Time        time.Time             `json:"time"`
+	Forwarding  bool                  `json:"forwarding,omitempty"`
+	Redirection *firewall.Redirection `json:"redirection,omitempty"`
+	Spoof       *SpoofState           `json:"spoof,omitempty"`
+}
+
+// Journal is persisted on every change, so that if the process gets killed
+// before it can clean up after itself, `bettercap -recover` can still undo
+// what it left behind.
+type Journal struct {
+	sync.Mutex
+
+	path    string
+	pid     int
+	entries map[string]*JournalEntry
+}
+
+func journalKey(kind string, what fmt.Stringer) string {
+	if what == nil {
+		return kind
+	}
+	return kind + " " + what.String()
+}
+
+func LoadJournal(fileName string) (error, *Journal) {
+	j := &Journal{
+		path:    fileName,
+		pid:     os.Getpid(),
+		entries: make(map[string]*JournalEntry),
+	}
+
+	if fileName != "" && fs.Exists(fileName) {
+		raw, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err, nil
+		}
+
+		entries := make([]*JournalEntry, 0)
+		if err = json.Unmarshal(raw, &entries); err != nil {
+			return fmt.Errorf("error while parsing journal %s: %v", fileName, err), nil
+		}
+
+		for _, e := range entries {
+			switch e.Kind {
+			case JournalForwarding:
+				j.entries[journalKey(e.Kind, nil)] = e
+			case JournalRedirection:
+				if e.Redirection != nil {
+					j.entries[journalKey(e.Kind, e.Redirection)] = e
+				}
+			case JournalSpoof:
+				if e.Spoof != nil {
+					j.entries[journalKey(e.Kind, e.Spoof)] = e
+				}
+			}
+		}
+	}
+
+	return nil, j
+}
+
+// Entries returns the journal entries sorted by time.
+func (j *Journal) Entries() []*JournalEntry {
+	j.Lock()
+	defer j.Unlock()
+	return j.sorted()
+}
+
+func (j *Journal) sorted() []*JournalEntry {
+	entries := make([]*JournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Time.Before(entries[b].Time)
+	})
+	return entries
+}
+
+// Leftovers returns the entries written by other processes which did not
+// clean up after themselves.
+func (j *Journal) Leftovers() []*JournalEntry {
+	j.Lock()
+	defer j.Unlock()
+
+	leftovers := make([]*JournalEntry, 0)
+	for _, e := range j.sorted() {
+		if e.PID != j.pid {
+			leftovers = append(leftovers, e)
+		}
+	}
+	return leftovers
+}
+
+// flush writes the journal to a temporary file and atomically renames it,
+// an empty journal is removed from disk.
+func (j *Journal) flush() error {
+	if j.path == "" {
+		return nil
+	} else if len(j.entries) == 0 {
+		if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(j.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(j.path, raw)
+}
+
+// writeFileAtomic replaces the file with a synced temporary one, so that
+// a crash never leaves it truncated.
+func writeFileAtomic(fileName string, raw []byte) error {
+	tmp := fileName + ".tmp"
+	fd, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fd.Write(raw); err == nil {
+		err = fd.Sync()
+	}
+	fd.Close()
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, fileName)
+}
+
+func (j *Journal) add(key string, e *JournalEntry) error {
+	j.Lock()
+	defer j.Unlock()
+
+	if _, found := j.entries[key]; found {
+		return nil
+	}
+
+	e.PID = j.pid
+	e.Time = time.Now()
+	j.entries[key] = e
+
+	return j.flush()
+}
+
+func (j *Journal) remove(keys ...string) error {
+	j.Lock()
+	defer j.Unlock()
+
+	removed := 0
+	for _, key := range keys {
+		if _, found := j.entries[key]; found {
+			delete(j.entries, key)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return nil
+	}
+	return j.flush()
+}
+
+// Forwarding records the forwarding state before it was changed for the
+// first time, later changes are not recorded.
+func (j *Journal) Forwarding(original bool) error {
+	return j.add(journalKey(JournalForwarding, nil), &JournalEntry{
+		Kind:       JournalForwarding,
+		Forwarding: original,
+	})
+}
+
+func (j *Journal) ForwardingRestored() error {
+	return j.remove(journalKey(JournalForwarding, nil))
+}
+
+func (j *Journal) Redirection(r *firewall.Redirection, enabled bool) error {
+	key := journalKey(JournalRedirection, r)
+	if !enabled {
+		return j.remove(key)
+	}
+
+	rcopy := *r
+	return j.add(key, &JournalEntry{
+		Kind:        JournalRedirection,
+		Redirection: &rcopy,
+	})
+}
+
+func (j *Journal) Spoof(s SpoofState) error {
+	return j.add(journalKey(JournalSpoof, s), &JournalEntry{
+		Kind:  JournalSpoof,
+		Spoof: &s,
+	})
+}
+
+// Unspoof removes the spoofing state recorded by this process for the module.
+func (j *Journal) Unspoof(module string) error {
+	j.Lock()
+	keys := make([]string, 0)
+	for key, e := range j.entries {
+		if e.Kind == JournalSpoof && e.PID == j.pid && e.Spoof.Module == module {
+			keys = append(keys, key)
+		}
+	}
+	j.Unlock()
+
+	return j.remove(keys...)
+}
+
+// journaledFirewall records every change to the real firewall before
+// applying it.
+type journaledFirewall struct {
+	firewall.FirewallManager
+	journal *Journal
+}
+
+func (f *journaledFirewall) EnableForwarding(enabled bool) error {
+	if err := f.journal.Forwarding(f.FirewallManager.IsForwardingEnabled()); err != nil {
+		return err
+	}
+	return f.FirewallManager.EnableForwarding(enabled)
+}
+
+func (f *journaledFirewall) EnableRedirection(r *firewall.Redirection, enabled bool) error {
+	// when enabling, the rule is journaled before it is applied
+	if enabled {
+		if err := f.journal.Redirection(r, true); err != nil {
+			return err
+		}
+	}
+
+	if err := f.FirewallManager.EnableRedirection(r, enabled); err != nil {
+		return err
+	} else if !enabled {
+		return f.journal.Redirection(r, false)
+	}
+
+	return nil
+}
+
+func (f *journaledFirewall) Track(r *firewall.Redirection) {
+	firewall.Track(f.FirewallManager, r)
+}
+
+func (f *journaledFirewall) Restore() {
+	f.FirewallManager.Restore()
+
+	// leftovers of other processes are kept until they are recovered
+	for _, e := range f.journal.Entries() {
+		if e.PID != f.journal.pid {
+			continue
+		} else if e.Kind == JournalRedirection {
+			f.journal.Redirection(e.Redirection, false)
+		} else if e.Kind == JournalForwarding {
+			f.journal.ForwardingRestored()
+		}
+	}
+}
+
+// TrackSpoof journals a poisoned cache so that it can be healed even if the
+// session is not closed cleanly.
+func (s *Session) TrackSpoof(state SpoofState) {
+	if s.IsDryRun() {
+		return
+	} else if state.Interface == "" {
+		state.Interface = s.Interface.Name()
+	}
+
+	if err := s.Journal.Spoof(state); err != nil {
+		s.Events.Log(log.ERROR, "error while updating journal: %v", err)
+	}
+}
+
+// UntrackSpoofs removes the journaled state of a module once it healed the
+// caches of its targets.
+func (s *Session) UntrackSpoofs(module string) {
+	if err := s.Journal.Unspoof(module); err != nil {
+		s.Events.Log(log.ERROR, "error while updating journal: %v", err)
+	}
+}
+
+func (s *Session) healPacket(state *SpoofState) (error, []byte) {
+	address, target := net.ParseIP(state.Address), net.ParseIP(state.Target)
+	if address == nil || target == nil {
+		return fmt.Errorf("invalid addresses in %s", state), nil
+	}
+
+	hw, err := net.ParseMAC(state.HW)
+	if err != nil {
+		return err, nil
+	}
+
+	targetHW, err := net.ParseMAC(state.TargetHW)
+	if err != nil {
+		return err, nil
+	}
+
+	switch state.Protocol {
+	case "arp":
+		return packets.NewARPReply(address, hw, target, targetHW)
+	}
+
+	return fmt.Errorf("unknown spoofing protocol %s", state.Protocol), nil
+}
+
+// Recover undoes every side effect found in the journal, either left behind
+// by a previous process or created by the current session. In dry-run mode
+// the journal itself is left untouched.
+func (s *Session) Recover() error {
+	dryRun := s.IsDryRun()
+	entries := s.Journal.Entries()
+	if len(entries) == 0 {
+		s.Events.Log(log.INFO, "journal is empty, nothing to recover.")
+		return nil
+	}
+
+	heal := make([][]byte, 0)
+	for _, e := range entries {
+		switch e.Kind {
+		case JournalRedirection:
+			s.Events.Log(log.INFO, "removing redirection %s", e.Redirection)
+			firewall.Track(s.Firewall, e.Redirection)
+			if err := s.Firewall.EnableRedirection(e.Redirection, false); err != nil {
+				s.Events.Log(log.ERROR, "error while removing redirection %s: %v", e.Redirection, err)
+			}
+			if !dryRun {
+				s.Journal.Redirection(e.Redirection, false)
+			}
+
+		case JournalSpoof:
+			if e.Spoof.Interface != s.Interface.Name() {
+				s.Events.Log(log.WARNING, "can't heal %s from interface %s", e.Spoof, s.Interface.Name())
+				continue
+			} else if err, pkt := s.healPacket(e.Spoof); err != nil {
+				s.Events.Log(log.ERROR, "error while creating healing packet for %s: %v", e.Spoof, err)
+			} else {
+				s.Events.Log(log.INFO, "healing %s", e.Spoof)
+				heal = append(heal, pkt)
+			}
+		}
+	}
+
+	for i := 0; i < recoverRounds && len(heal) > 0; i++ {
+		for _, pkt := range heal {
+			if err := s.Queue.Send(pkt); err != nil {
+				s.Events.Log(log.ERROR, "error while sending healing packet: %v", err)
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	for _, e := range entries {
+		if e.Kind == JournalForwarding {
+			s.Events.Log(log.INFO, "restoring forwarding to %v", e.Forwarding)
+			if err := s.Firewall.EnableForwarding(e.Forwarding); err != nil {
+				s.Events.Log(log.ERROR, "error while restoring forwarding: %v", err)
+			}
+		}
+
+		if dryRun {
+			continue
+		} else if e.Kind == JournalSpoof {
+			s.Journal.remove(journalKey(JournalSpoof, e.Spoof))
+		} else if e.Kind == JournalForwarding {
+			s.Journal.ForwardingRestored()
+		}
+	}
+
+	// the recovered state is the new baseline to restore when the session is closed
+	if !dryRun {
+		s.fw.replace(&journaledFirewall{
+			FirewallManager: firewall.Make(s.Interface),
+			journal:         s.Journal,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bettercap/bettercap/firewall"
+)
+
+type journalTestFirewall struct {
+	forwarding   bool
+	redirections map[string]bool
+}
+
+func (f *journalTestFirewall) IsForwardingEnabled() bool {
+	return f.forwarding
+}
+
+func (f *journalTestFirewall) EnableForwarding(enabled bool) error {
+	f.forwarding = enabled
+	return nil
+}
+
+func (f *journalTestFirewall) EnableRedirection(r *firewall.Redirection, enabled bool) error {
+	if enabled {
+		f.redirections[r.String()] = true
+	} else {
+		delete(f.redirections, r.String())
+	}
+	return nil
+}
+
+func (f *journalTestFirewall) Track(r *firewall.Redirection) {
+	f.redirections[r.String()] = true
+}
+
+func (f *journalTestFirewall) Redirections() []*firewall.Redirection {
+	return nil
+}
+
+func (f *journalTestFirewall) Restore() {
+	f.redirections = make(map[string]bool)
+	f.forwarding = false
+}
+
+func newTestJournal(t *testing.T, dir string) (string, *Journal) {
+	fileName := filepath.Join(dir, "bettercap.journal")
+	err, j := LoadJournal(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileName, j
+}
+
+func TestJournalPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileName, j := newTestJournal(t, dir)
+	r := firewall.NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+
+	if err := j.Forwarding(false); err != nil {
+		t.Fatal(err)
+	} else if err := j.Forwarding(true); err != nil {
+		t.Fatal(err)
+	} else if err := j.Redirection(r, true); err != nil {
+		t.Fatal(err)
+	} else if err := j.Spoof(SpoofState{Module: "arp.spoof", Protocol: "arp", Address: "192.168.1.1", Target: "192.168.1.10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a new process loading what was left behind
+	err, loaded := LoadJournal(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.pid = -1
+
+	entries := loaded.Leftovers()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 leftovers, got %d", len(entries))
+	}
+
+	for _, e := range entries {
+		switch e.Kind {
+		case JournalForwarding:
+			// only the state before the first change is recorded
+			if e.Forwarding {
+				t.Fatalf("expected original forwarding state to be false")
+			}
+		case JournalRedirection:
+			if e.Redirection.String() != r.String() {
+				t.Fatalf("expected %s, got %s", r, e.Redirection)
+			}
+		case JournalSpoof:
+			if e.Spoof.Target != "192.168.1.10" {
+				t.Fatalf("unexpected spoof state %s", e.Spoof)
+			}
+		}
+	}
+
+	if err := j.Unspoof("arp.spoof"); err != nil {
+		t.Fatal(err)
+	} else if err := j.Redirection(r, false); err != nil {
+		t.Fatal(err)
+	} else if err := j.ForwardingRestored(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Fatalf("expected empty journal to be removed")
+	}
+}
+
+func TestJournaledFirewallKeepsLeftovers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, j := newTestJournal(t, dir)
+	old := firewall.NewRedirection("eth0", "TCP", 443, "192.168.1.2", 8083)
+	j.Redirection(old, true)
+	// pretend it was created by another process
+	for _, e := range j.entries {
+		e.PID = -1
+	}
+
+	fw := &journaledFirewall{
+		FirewallManager: &journalTestFirewall{redirections: make(map[string]bool)},
+		journal:         j,
+	}
+
+	r := firewall.NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	if err := fw.EnableForwarding(true); err != nil {
+		t.Fatal(err)
+	} else if err := fw.EnableRedirection(r, true); err != nil {
+		t.Fatal(err)
+	} else if n := len(j.Entries()); n != 3 {
+		t.Fatalf("expected 3 journal entries, got %d", n)
+	}
+
+	fw.Restore()
+
+	entries := j.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected only the leftover to be kept, got %d entries", len(entries))
+	} else if entries[0].Redirection.String() != old.String() {
+		t.Fatalf("unexpected entry %s", entries[0].Redirection)
+	}
+}
+
+func TestJournaledFirewallTracksLeftovers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, j := newTestJournal(t, dir)
+	real := &journalTestFirewall{redirections: make(map[string]bool)}
+	fw := newSwitchableFirewall(&journaledFirewall{
+		FirewallManager: real,
+		journal:         j,
+	})
+
+	old := firewall.NewRedirection("eth0", "TCP", 443, "192.168.1.2", 8083)
+	firewall.Track(fw, old)
+	if !real.redirections[old.String()] {
+		t.Fatalf("expected %s to be tracked by the real firewall", old)
+	}
+
+	// while in dry-run the leftover is only tracked by the recording firewall
+	fw.dryRun(true, func(action string, details string) {})
+	other := firewall.NewRedirection("eth0", "TCP", 80, "192.168.1.2", 8080)
+	firewall.Track(fw, other)
+	if real.redirections[other.String()] {
+		t.Fatalf("expected %s not to reach the real firewall", other)
+	} else if err := fw.EnableRedirection(other, false); err != nil {
+		t.Fatal(err)
+	}
+
+	fw.dryRun(false, nil)
+	if err := fw.EnableRedirection(old, false); err != nil {
+		t.Fatal(err)
+	} else if real.redirections[old.String()] {
+		t.Fatalf("expected %s to be removed", old)
+	}
+}
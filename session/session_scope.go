@@ -0,0 +1,55 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+func (s *Session) loadScope(fileName string) error {
+	err, scope := network.LoadScope(fileName)
+	if err != nil {
+		return err
+	} else if err = network.SetScope(scope); err != nil {
+		return err
+	}
+
+	scope.OnViolation(func(v network.ScopeViolation) {
+		s.Events.Add("scope.violation", v)
+	})
+
+	return nil
+}
+
+func scopeList(list []string) string {
+	if len(list) == 0 {
+		return tui.Dim("-")
+	}
+	return strings.Join(list, ", ")
+}
+
+func (s *Session) scopeShowHandler(args []string, sess *Session) error {
+	scope := network.GetScope()
+	if scope == nil {
+		fmt.Printf("\nno scope loaded, every target is allowed (use -scope FILE to load one).\n\n")
+		return nil
+	}
+
+	def := scope.Definition
+	rows := [][]string{
+		{"CIDRs", scopeList(def.CIDRs), scopeList(def.Exclude.CIDRs)},
+		{"MACs", scopeList(def.MACs), scopeList(def.Exclude.MACs)},
+		{"BSSIDs", scopeList(def.BSSIDs), scopeList(def.Exclude.BSSIDs)},
+		{"SSIDs", scopeList(def.SSIDs), scopeList(def.Exclude.SSIDs)},
+	}
+
+	fmt.Printf("\nscope loaded from %s\n\n", tui.Bold(scope.Path))
+	tui.Table(os.Stdout, []string{"Type", "Allowed", "Excluded"}, rows)
+	fmt.Println()
+
+	return nil
+}
@@ -165,4 +165,21 @@ func (s *Session) setupEnv() {
 		}
 		s.Events.SetSilent(newSilent)
 	})
+
+	dryRun := "false"
+	if *s.Options.DryRun {
+		dryRun = "true"
+	}
+	s.Env.WithCallback("session.dryrun", dryRun, func(newValue string) {
+		s.setDryRun(newValue == "true")
+	})
+	if found, _ := s.Env.Get("session.dryrun.output"); !found {
+		s.Env.Set("session.dryrun.output", "")
+	}
+	if found, _ := s.Env.Get("session.jobs.timeout"); !found {
+		s.Env.Set("session.jobs.timeout", "0")
+	}
+	if found, _ := s.Env.Get("session.workspace.interval"); !found {
+		s.Env.Set("session.workspace.interval", "30")
+	}
 }
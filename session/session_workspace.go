@@ -0,0 +1,317 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bettercap/bettercap/core"
+
+	"github.com/evilsocket/islazy/fs"
+	"github.com/evilsocket/islazy/log"
+	"github.com/evilsocket/islazy/tui"
+)
+
+const (
+	workspaceInfoFile    = "workspace.json"
+	workspaceEnvFile     = "env.json"
+	workspaceLANFile     = "lan.json"
+	workspaceHistoryFile = "history.json"
+	workspaceWiFiFile    = "wifi.json"
+	workspaceBLEFile     = "ble.json"
+	workspaceHIDFile     = "hid.json"
+	workspaceEventsFile  = "events.json"
+)
+
+// module parameters that, when left to their default value, are pointed
+// to files inside the workspace
+var workspaceFiles = map[string]string{
+	"wifi.handshakes.file": "handshakes.pcap",
+	"net.sniff.output":     "capture.pcap",
+}
+
+// these variables describe the current session and are never restored
+var workspaceSkipVars = []string{"iface.", "gateway.", "session."}
+
+type WorkspaceInfo struct {
+	Version   string    `json:"version"`
+	Interface string    `json:"interface"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Snapshots uint64    `json:"snapshots"`
+}
+
+// Workspace is a directory where the state of the session is periodically
+// saved, opening it again restores the hosts, access points and devices
+// found by previous sessions together with their parameters.
+type Workspace struct {
+	sync.Mutex
+
+	Path string
+	Info WorkspaceInfo
+
+	lastEvent time.Time
+	quit      chan bool
+}
+
+func OpenWorkspace(dir string) (error, *Workspace) {
+	dir, _ = fs.Expand(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err, nil
+	}
+
+	w := &Workspace{
+		Path: dir,
+		Info: WorkspaceInfo{
+			Version: core.Version,
+			Created: time.Now(),
+		},
+		lastEvent: time.Now(),
+		quit:      make(chan bool),
+	}
+
+	if err, raw := w.read(workspaceInfoFile); err != nil {
+		return err, nil
+	} else if raw != nil {
+		if err = json.Unmarshal(raw, &w.Info); err != nil {
+			return fmt.Errorf("error while parsing %s: %v", w.File(workspaceInfoFile), err), nil
+		}
+	}
+
+	return nil, w
+}
+
+func (w *Workspace) File(name string) string {
+	return filepath.Join(w.Path, name)
+}
+
+// read returns nil if the file does not exist yet.
+func (w *Workspace) read(name string) (error, []byte) {
+	fileName := w.File(name)
+	if !fs.Exists(fileName) {
+		return nil, nil
+	}
+
+	raw, err := ioutil.ReadFile(fileName)
+	return err, raw
+}
+
+func (w *Workspace) write(name string, raw []byte) error {
+	return writeFileAtomic(w.File(name), raw)
+}
+
+// appendEvents adds the events that happened since the last snapshot to
+// the events log, one JSON object per line.
+func (w *Workspace) appendEvents(events []Event) error {
+	fd, err := os.OpenFile(w.File(workspaceEventsFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	for _, e := range events {
+		if !e.Time.After(w.lastEvent) {
+			continue
+		}
+
+		if raw, err := json.Marshal(e); err == nil {
+			if _, err = fd.Write(append(raw, '\n')); err != nil {
+				return err
+			}
+		}
+		w.lastEvent = e.Time
+	}
+
+	return fd.Sync()
+}
+
+func (s *Session) openWorkspace(dir string) (err error) {
+	if err, s.Workspace = OpenWorkspace(dir); err != nil {
+		return err
+	}
+
+	if err = s.restoreWorkspace(); err != nil {
+		return fmt.Errorf("error while restoring workspace %s: %v", s.Workspace.Path, err)
+	}
+
+	go s.workspaceLoop()
+
+	return nil
+}
+
+func (s *Session) restoreWorkspace() error {
+	w := s.Workspace
+
+	if err, raw := w.read(workspaceEnvFile); err != nil {
+		return err
+	} else if raw != nil {
+		vars := make(map[string]string)
+		if err = json.Unmarshal(raw, &vars); err != nil {
+			return fmt.Errorf("%s: %v", workspaceEnvFile, err)
+		}
+
+	restore:
+		for name, value := range vars {
+			for _, prefix := range workspaceSkipVars {
+				if strings.HasPrefix(name, prefix) {
+					continue restore
+				}
+			}
+			s.Env.Set(name, value)
+		}
+	}
+
+	for _, m := range s.Modules {
+		for name, param := range m.Parameters() {
+			if fileName, found := workspaceFiles[name]; found {
+				if _, value := s.Env.Get(name); value == param.Value {
+					s.Env.Set(name, w.File(fileName))
+				}
+			}
+		}
+	}
+
+	// BLE devices are saved but not restored as they need a live connection
+	known, hosts, aps, devices := 0, 0, 0, 0
+	restore := []struct {
+		file    string
+		restore func(raw []byte) (error, int)
+		count   *int
+	}{
+		{workspaceHistoryFile, s.Lan.RestoreHistory, &known},
+		{workspaceLANFile, s.Lan.Restore, &hosts},
+		{workspaceWiFiFile, s.WiFi.Restore, &aps},
+		{workspaceHIDFile, s.HID.Restore, &devices},
+	}
+
+	for _, r := range restore {
+		if err, raw := w.read(r.file); err != nil {
+			return err
+		} else if raw != nil {
+			if err, *r.count = r.restore(raw); err != nil {
+				return fmt.Errorf("%s: %v", r.file, err)
+			}
+		}
+	}
+
+	if w.Info.Snapshots > 0 {
+		s.Events.Log(log.INFO, "workspace %s restored from %s: %d hosts (%d in history), %d access points, %d HID devices.",
+			tui.Bold(w.Path), w.Info.Updated.Format("2006-01-02 15:04:05"), hosts, known, aps, devices)
+	}
+
+	return nil
+}
+
+func (s *Session) saveWorkspace() error {
+	w := s.Workspace
+	w.Lock()
+	defer w.Unlock()
+
+	s.Env.Lock()
+	env, err := json.Marshal(s.Env.Data)
+	s.Env.Unlock()
+	if err != nil {
+		return err
+	} else if err = w.write(workspaceEnvFile, env); err != nil {
+		return err
+	}
+
+	s.Lan.Lock()
+	lan, err := json.Marshal(s.Lan)
+	s.Lan.Unlock()
+	if err != nil {
+		return err
+	} else if err = w.write(workspaceLANFile, lan); err != nil {
+		return err
+	}
+
+	if history, err := json.Marshal(s.Lan.History()); err != nil {
+		return err
+	} else if err = w.write(workspaceHistoryFile, history); err != nil {
+		return err
+	}
+
+	s.WiFi.Lock()
+	wifi, err := json.Marshal(s.WiFi)
+	s.WiFi.Unlock()
+	if err != nil {
+		return err
+	} else if err = w.write(workspaceWiFiFile, wifi); err != nil {
+		return err
+	}
+
+	if ble, err := json.Marshal(s.BLE); err != nil {
+		return err
+	} else if err = w.write(workspaceBLEFile, ble); err != nil {
+		return err
+	}
+
+	s.HID.RLock()
+	hid, err := json.Marshal(s.HID)
+	s.HID.RUnlock()
+	if err != nil {
+		return err
+	} else if err = w.write(workspaceHIDFile, hid); err != nil {
+		return err
+	}
+
+	if err = w.appendEvents(s.Events.Sorted()); err != nil {
+		return err
+	}
+
+	w.Info.Version = core.Version
+	w.Info.Interface = s.Interface.Name()
+	w.Info.Updated = time.Now()
+	w.Info.Snapshots++
+
+	info, err := json.MarshalIndent(w.Info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return w.write(workspaceInfoFile, info)
+}
+
+func (s *Session) workspaceLoop() {
+	for {
+		interval := 30
+		if err, n := s.Env.GetInt("session.workspace.interval"); err == nil && n > 0 {
+			interval = n
+		}
+
+		select {
+		case <-time.After(time.Duration(interval) * time.Second):
+			if err := s.saveWorkspace(); err != nil {
+				s.Events.Log(log.ERROR, "error while saving workspace %s: %v", s.Workspace.Path, err)
+			}
+		case <-s.Workspace.quit:
+			return
+		}
+	}
+}
+
+func (s *Session) closeWorkspace() {
+	if s.Workspace == nil {
+		return
+	}
+
+	s.Workspace.quit <- true
+	if err := s.saveWorkspace(); err != nil {
+		fmt.Printf("error while saving workspace %s: %s\n", s.Workspace.Path, err)
+	}
+}
+
+func (s *Session) workspaceSaveHandler(args []string, sess *Session) error {
+	if s.Workspace == nil {
+		return fmt.Errorf("no workspace opened, use -workspace DIR to open one")
+	} else if err := s.saveWorkspace(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nsession saved to workspace %s.\n\n", tui.Bold(s.Workspace.Path))
+	return nil
+}
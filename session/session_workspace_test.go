@@ -0,0 +1,98 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bettercap/bettercap/network"
+
+	"github.com/evilsocket/islazy/data"
+)
+
+func newWorkspaceSession(t *testing.T, dir string) *Session {
+	s := newCheckSession(t)
+	s.Events = NewEventPool(false, true)
+
+	aliases, _ := data.NewMemUnsortedKV()
+	iface := network.NewEndpointNoResolve("192.168.1.2", "aa:aa:aa:aa:aa:aa", "eth0", 24)
+	gateway := network.NewEndpointNoResolve("192.168.1.1", "bb:bb:bb:bb:bb:bb", "", 24)
+	s.Interface = iface
+	s.Lan = network.NewLAN(iface, gateway, aliases, func(e *network.Endpoint) {}, func(e *network.Endpoint) {}, func(e *network.Endpoint, previous string) {})
+	s.WiFi = network.NewWiFi(iface, aliases, nil, nil)
+	s.BLE = network.NewBLE(aliases, nil, nil)
+	s.HID = network.NewHID(aliases, nil, nil)
+
+	err, w := OpenWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Workspace = w
+
+	return s
+}
+
+func TestWorkspaceSaveAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bettercap-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newWorkspaceSession(t, dir)
+	s.Lan.AddIfNew("192.168.1.10", "de:ad:be:ef:00:01")
+	s.Lan.AddIfNew("10.0.0.1", "de:ad:be:ef:00:02")
+	host, _ := s.Lan.Get("de:ad:be:ef:00:01")
+	host.Meta.Set("mdns:hostname", "printer.local")
+
+	ap, _ := s.WiFi.AddIfNew("ACME", "00:11:22:33:44:55", 2437, -50)
+	ap.AddClientIfNew("00:11:22:33:44:66", 2437, -60)
+	ap.WithKeyMaterial(true)
+
+	s.HID.AddIfNew([]byte{0x01, 0x02, 0x03, 0x04, 0x05}, 5, []byte{0x00})
+
+	s.Env.Set("test.mod.count", "42")
+	s.Env.Set("session.dryrun", "true")
+	s.Events.Add("test.event", "hello")
+
+	if err := s.saveWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newWorkspaceSession(t, dir)
+	if err := restored.restoreWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hosts := restored.Lan.List(); len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(hosts))
+	} else if hosts[0].Meta.Get("mdns:hostname") != "printer.local" {
+		t.Fatalf("host meta not restored: %v", hosts[0].Meta.Get("mdns:hostname"))
+	} else if history, found := restored.Lan.History().Get("de:ad:be:ef:00:01"); !found || len(history.Presence) != 2 {
+		t.Fatalf("expected the saved presence to be kept in the history, got %v", history)
+	}
+
+	if ap, found := restored.WiFi.Get("00:11:22:33:44:55"); !found {
+		t.Fatalf("access point not restored")
+	} else if ap.ESSID() != "ACME" || ap.NumClients() != 1 || !ap.HasKeyMaterial() {
+		t.Fatalf("unexpected access point %s, %d clients, key material %v", ap.ESSID(), ap.NumClients(), ap.HasKeyMaterial())
+	}
+
+	if dev, found := restored.HID.Get("01:02:03:04:05"); !found {
+		t.Fatalf("HID device not restored")
+	} else if channels := dev.ChannelsList(); len(channels) != 1 || channels[0] != "5" {
+		t.Fatalf("unexpected channels %v", channels)
+	}
+
+	if _, v := restored.Env.Get("test.mod.count"); v != "42" {
+		t.Fatalf("parameter not restored: %s", v)
+	} else if found, _ := restored.Env.Get("session.dryrun"); found {
+		t.Fatalf("session variables should not be restored")
+	}
+
+	if restored.Workspace.Info.Snapshots != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", restored.Workspace.Info.Snapshots)
+	} else if raw, err := ioutil.ReadFile(restored.Workspace.File(workspaceEventsFile)); err != nil || len(raw) == 0 {
+		t.Fatalf("expected events to be saved: %v", err)
+	}
+}